@@ -1,23 +1,15 @@
 package main
 
 import (
-	"net/http"
+	"log"
 
 	"github.com/OkutaniDaichi0106/mcp-go/mcp"
 )
 
 func main() {
 	server := mcp.NewServer("http-server", "0.0.1")
+	defer server.Close()
 
-	http.HandleFunc("/mcp", func(w http.ResponseWriter, r *http.Request) {
-		sess, err := server.AcceptHTTP(w, r)
-		if err != nil {
-			return
-		}
-		defer sess.Close()
-
-		//
-	})
-
-	http.ListenAndServe(":8080", nil)
+	// Serve on http://localhost:8080/mcp
+	log.Fatal(server.ListenAndServeHTTP(":8080"))
 }
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"log/slog"
 
 	"github.com/OkutaniDaichi0106/mcp-go/mcp"
@@ -21,7 +20,7 @@ func main() {
             		"location": {
               			"type": "string",
               			"description": "City name or zip code"
-            		},
+            		}
           	    },
           		"required": ["location"]
 		  	}
@@ -30,12 +29,11 @@ func main() {
 	mcp.HandleToolFunc(tool, func(w mcp.ContentsWriter, name string, args map[string]any) {
 		tempereture := "72"
 		conditions := "Partly cloudy"
-		contents := mcp.NewContents(json.RawMessage(`
-			{
-				"type": "text",
-				"content": "Current weather in New York:\nTemperature: ` + tempereture + `°F\nConditions: ` + conditions + `"
-			}
-		`))
+		contents := []mcp.Content{
+			mcp.TextContent{
+				Text: "Current weather in New York:\nTemperature: " + tempereture + "°F\nConditions: " + conditions,
+			},
+		}
 
 		err := w.WriteContents(contents)
 		if err != nil {
@@ -5,27 +5,16 @@ import (
 	"os"
 
 	"github.com/OkutaniDaichi0106/mcp-go/mcp"
-	"golang.org/x/net/websocket"
 )
 
 func main() {
-	conn, err := websocket.Dial("ws://localhost:8080/mcp", "", "http://localhost:8080")
-	if err != nil {
-		slog.Error("Failed to connect to WebSocket server", "error", err)
-	}
-	defer conn.Close()
-
-	// Create WebSocket adapter and transport
-	transport := mcp.NewStreamTransport(conn, conn)
-
-	// Create client and dial using the transport
+	// Create client and dial the WebSocket server
 	client := mcp.NewClient("websocket-client", "0.0.1")
 
-	session, err := client.Dial(transport)
+	session, err := client.DialWebSocket("ws://localhost:8080/mcp", nil)
 	if err != nil {
 		slog.Error("Failed to establish MCP session", "error", err)
 		os.Exit(1)
 	}
 	defer session.Close()
-
 }
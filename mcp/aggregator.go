@@ -0,0 +1,631 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ConflictPolicy decides how an Aggregator exposes the tools and prompts of several servers.
+type ConflictPolicy int
+
+const (
+	// PrefixAlways prefixes every name with the name of its server, as in "github__create_issue".
+	PrefixAlways ConflictPolicy = iota
+	// PrefixOnConflict keeps the names which are unique, and prefixes the names exposed by several servers.
+	PrefixOnConflict
+	// FirstServerWins keeps the names as they are. A name exposed by several servers
+	// is routed to the server added first, and hidden for the others.
+	FirstServerWins
+)
+
+// DefaultNamespaceSeparator separates the name of a server from the name of its tool or prompt
+// when Aggregator.Separator is not set.
+const DefaultNamespaceSeparator = "__"
+
+// NewAggregator returns an aggregator of servers resolving the conflicts of names with the policy.
+func NewAggregator(policy ConflictPolicy) *Aggregator {
+	return &Aggregator{
+		Policy: policy,
+	}
+}
+
+// Aggregator exposes the tools, resources and prompts of the sessions of several servers as a single catalogue,
+// and routes the calls to the session of the server owning them.
+// The servers are connected by the aggregator with Connect and ConnectAll, or added as sessions with AddServer.
+//
+// The lists of each server are cached until the server notifies that they changed.
+// The notifications are fanned out to the channels returned by ListChanged.
+// Resources keep their URI, which identifies them on their server: a URI exposed by several servers
+// is routed to the server added first, whatever the policy.
+type Aggregator struct {
+	Policy ConflictPolicy
+	// Separator separates the name of a server from the name of its tool or prompt.
+	// Zero means DefaultNamespaceSeparator.
+	Separator string
+	// Client dials the servers connected by Connect and ConnectAll.
+	// Nil means a client named "mcp-go-aggregator".
+	Client *Client
+
+	mu      sync.Mutex
+	servers []*aggregatedServer
+	closed  bool
+	// client is the default client, created on the first connection
+	client *Client
+
+	listChanged listChangedListeners
+}
+
+// aggregatedServer is a server of an aggregator with its cached lists.
+type aggregatedServer struct {
+	name string
+	sess ClientSession
+
+	tools     listCache[*ToolDefinition]
+	resources listCache[*ResourceDefinition]
+	prompts   listCache[*PromptDefinition]
+}
+
+// listCache is a list of a server, which must be fetched again once invalidated.
+type listCache[T any] struct {
+	items []T
+	valid bool
+	// version is incremented on invalidation, so that a list fetched before is not cached
+	version int
+}
+
+func (c *listCache[T]) invalidate() {
+	c.items = nil
+	c.valid = false
+	c.version++
+}
+
+func (a *Aggregator) separator() string {
+	if a.Separator == "" {
+		return DefaultNamespaceSeparator
+	}
+	return a.Separator
+}
+
+// ServerDialer connects to a server with the client, such as with Client.DialHTTP.
+type ServerDialer func(c *Client) (ClientSession, error)
+
+// Connect connects to a server with the dialer and adds its session under the name, as AddServer does.
+// The session is closed if the server cannot be added.
+func (a *Aggregator) Connect(name string, dial ServerDialer) error {
+	err := a.checkName(name)
+	if err != nil {
+		return err
+	}
+
+	client, err := a.dialer()
+	if err != nil {
+		return err
+	}
+
+	sess, err := dial(client)
+	if err != nil {
+		return fmt.Errorf("failed to connect to server %q: %w", name, err)
+	}
+
+	err = a.AddServer(name, sess)
+	if err != nil {
+		sess.Close()
+		return err
+	}
+
+	return nil
+}
+
+// ConnectAll connects to the servers concurrently, and adds them in the order of their names.
+// The servers which cannot be connected are reported in the error, and the others are added anyway.
+func (a *Aggregator) ConnectAll(servers map[string]ServerDialer) error {
+	client, err := a.dialer()
+	if err != nil {
+		return err
+	}
+
+	names := slices.Sorted(maps.Keys(servers))
+	sessions := make([]ClientSession, len(names))
+	errs := make([]error, len(names))
+
+	var wg sync.WaitGroup
+	for i, name := range names {
+		errs[i] = a.checkName(name)
+		if errs[i] != nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			sessions[i], errs[i] = servers[name](client)
+			if errs[i] != nil {
+				errs[i] = fmt.Errorf("failed to connect to server %q: %w", name, errs[i])
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The servers are added in a fixed order, which decides the names that FirstServerWins exposes
+	for i, name := range names {
+		if errs[i] != nil {
+			continue
+		}
+
+		errs[i] = a.AddServer(name, sessions[i])
+		if errs[i] != nil {
+			sessions[i].Close()
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// dialer returns the client dialing the servers.
+func (a *Aggregator) dialer() (*Client, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.closed {
+		return nil, errors.New("aggregator is closed")
+	}
+	if a.Client != nil {
+		return a.Client, nil
+	}
+	if a.client == nil {
+		a.client = NewClient("mcp-go-aggregator", "0.0.0")
+	}
+	return a.client, nil
+}
+
+func (a *Aggregator) checkName(name string) error {
+	if name == "" {
+		return errors.New("server name is empty")
+	}
+	if strings.Contains(name, a.separator()) {
+		return fmt.Errorf("server name %q contains the separator %q", name, a.separator())
+	}
+	return nil
+}
+
+// AddServer adds the session of a server under the name, which must be unique and must not contain the separator.
+// The server is removed when its session ends.
+func (a *Aggregator) AddServer(name string, sess ClientSession) error {
+	err := a.checkName(name)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return errors.New("aggregator is closed")
+	}
+	for _, server := range a.servers {
+		if server.name == name {
+			a.mu.Unlock()
+			return fmt.Errorf("server %q is already added", name)
+		}
+	}
+
+	server := &aggregatedServer{name: name, sess: sess}
+	a.servers = append(a.servers, server)
+	a.mu.Unlock()
+
+	go a.watch(server)
+	a.notifyAll()
+
+	return nil
+}
+
+// RemoveServer removes the server without closing its session.
+func (a *Aggregator) RemoveServer(name string) error {
+	a.mu.Lock()
+	removed := a.removeLocked(func(server *aggregatedServer) bool { return server.name == name })
+	a.mu.Unlock()
+
+	if !removed {
+		return fmt.Errorf("server %q is not added", name)
+	}
+
+	a.notifyAll()
+	return nil
+}
+
+func (a *Aggregator) removeLocked(match func(server *aggregatedServer) bool) bool {
+	for i, server := range a.servers {
+		if match(server) {
+			a.servers = append(a.servers[:i:i], a.servers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Servers returns the names of the servers, in the order they were added.
+func (a *Aggregator) Servers() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	names := make([]string, len(a.servers))
+	for i, server := range a.servers {
+		names[i] = server.name
+	}
+	return names
+}
+
+// Session returns the session of the server.
+func (a *Aggregator) Session(name string) (ClientSession, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, server := range a.servers {
+		if server.name == name {
+			return server.sess, true
+		}
+	}
+	return nil, false
+}
+
+// watch invalidates the lists of the server when they change, and removes the server when its session ends.
+func (a *Aggregator) watch(server *aggregatedServer) {
+	for method := range server.sess.ListChanged() {
+		a.mu.Lock()
+		switch method {
+		case MethodNotifyToolChanged:
+			server.tools.invalidate()
+		case MethodNotifyResourceChanged:
+			server.resources.invalidate()
+		case MethodNotifyPromptChanged:
+			server.prompts.invalidate()
+		}
+		a.mu.Unlock()
+
+		a.listChanged.notify(method)
+	}
+
+	a.mu.Lock()
+	removed := a.removeLocked(func(s *aggregatedServer) bool { return s == server })
+	a.mu.Unlock()
+
+	if removed {
+		a.notifyAll()
+	}
+}
+
+func (a *Aggregator) notifyAll() {
+	for _, method := range []Method{MethodNotifyToolChanged, MethodNotifyResourceChanged, MethodNotifyPromptChanged} {
+		a.listChanged.notify(method)
+	}
+}
+
+// ListChanged returns a channel receiving the list_changed notifications of all the servers,
+// and a notification for each list when a server is added or removed.
+// Notifications are dropped if the channel is not read in time. The channel is closed when the aggregator is closed.
+func (a *Aggregator) ListChanged() <-chan Method {
+	return a.listChanged.add()
+}
+
+// Close closes the sessions of all the servers.
+func (a *Aggregator) Close() error {
+	a.mu.Lock()
+	a.closed = true
+	servers := a.servers
+	a.servers = nil
+	a.mu.Unlock()
+
+	var errs []error
+	for _, server := range servers {
+		errs = append(errs, server.sess.Close())
+	}
+	a.listChanged.close()
+
+	return errors.Join(errs...)
+}
+
+// fetchLists returns the list of each server supporting the feature, fetching the lists which are not cached.
+// A server failing to list is skipped, unless all the lists which had to be fetched fail.
+func fetchLists[T any](ctx context.Context, a *Aggregator, feature string,
+	cache func(server *aggregatedServer) *listCache[T],
+	list func(ctx context.Context, sess ClientSession) ([]T, error),
+) ([]*aggregatedServer, [][]T, error) {
+	type stale struct {
+		index   int
+		version int
+	}
+
+	a.mu.Lock()
+	servers := make([]*aggregatedServer, 0, len(a.servers))
+	lists := make([][]T, 0, len(a.servers))
+	var stales []stale
+	for _, server := range a.servers {
+		if !server.sess.ServerCapabilities().HasFeature(feature) {
+			continue
+		}
+
+		c := cache(server)
+		if !c.valid {
+			stales = append(stales, stale{index: len(servers), version: c.version})
+		}
+		servers = append(servers, server)
+		lists = append(lists, c.items)
+	}
+	a.mu.Unlock()
+
+	errs := make([]error, len(stales))
+	var wg sync.WaitGroup
+	for i, s := range stales {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lists[s.index], errs[i] = list(ctx, servers[s.index].sess)
+		}()
+	}
+	wg.Wait()
+
+	failed := 0
+	a.mu.Lock()
+	for i, s := range stales {
+		server := servers[s.index]
+		if errs[i] != nil {
+			slog.Warn("failed to list the server", "server", server.name, "feature", feature, "error", errs[i])
+			errs[i] = fmt.Errorf("server %q: %w", server.name, errs[i])
+			failed++
+			continue
+		}
+
+		// A list invalidated while it was fetched is fetched again next time
+		c := cache(server)
+		if c.version == s.version {
+			c.items = lists[s.index]
+			c.valid = true
+		}
+	}
+	a.mu.Unlock()
+
+	if failed > 0 && failed == len(stales) {
+		return nil, nil, errors.Join(errs...)
+	}
+
+	return servers, lists, nil
+}
+
+// resolveNames returns the names exposed for the items of each server according to the policy.
+// An empty name means the item is hidden.
+func (a *Aggregator) resolveNames(servers []*aggregatedServer, names [][]string) [][]string {
+	counts := make(map[string]int)
+	for _, list := range names {
+		for _, name := range list {
+			counts[name]++
+		}
+	}
+
+	exposed := make([][]string, len(names))
+	taken := make(map[string]bool)
+	for i, list := range names {
+		exposed[i] = make([]string, len(list))
+		for j, name := range list {
+			if a.Policy == PrefixAlways || (a.Policy == PrefixOnConflict && counts[name] > 1) {
+				name = servers[i].name + a.separator() + name
+			}
+
+			// The first server wins the names which still conflict
+			if taken[name] {
+				continue
+			}
+			taken[name] = true
+			exposed[i][j] = name
+		}
+	}
+
+	return exposed
+}
+
+// toolCatalogue returns the exposed tools, and the server and the tool each exposed name is routed to.
+func (a *Aggregator) toolCatalogue(ctx context.Context) ([]*ToolDefinition, map[string]toolRoute, error) {
+	servers, lists, err := fetchLists(ctx, a, "tools",
+		func(server *aggregatedServer) *listCache[*ToolDefinition] { return &server.tools },
+		func(ctx context.Context, sess ClientSession) ([]*ToolDefinition, error) {
+			result, err := sess.ListTools(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return result.Tools, nil
+		})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	names := make([][]string, len(lists))
+	for i, list := range lists {
+		for _, tool := range list {
+			names[i] = append(names[i], tool.Name)
+		}
+	}
+	exposed := a.resolveNames(servers, names)
+
+	tools := make([]*ToolDefinition, 0)
+	routes := make(map[string]toolRoute)
+	for i, list := range lists {
+		for j, tool := range list {
+			name := exposed[i][j]
+			if name == "" {
+				continue
+			}
+
+			clone := tool.Clone()
+			clone.Name = name
+			tools = append(tools, clone)
+			routes[name] = toolRoute{server: servers[i], tool: tool}
+		}
+	}
+
+	return tools, routes, nil
+}
+
+type toolRoute struct {
+	server *aggregatedServer
+	tool   *ToolDefinition
+}
+
+// ListTools returns the tools of all the servers under their exposed names.
+func (a *Aggregator) ListTools(ctx context.Context) (*ListToolsResult, error) {
+	tools, _, err := a.toolCatalogue(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ListToolsResult{Tools: tools}, nil
+}
+
+// CallTool calls the tool with its exposed name on the server owning it.
+// It fails with ErrToolNotFound if no server exposes the tool.
+func (a *Aggregator) CallTool(ctx context.Context, tool *ToolDefinition, args map[string]any) (*CallToolResult, error) {
+	_, routes, err := a.toolCatalogue(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	route, ok := routes[tool.Name]
+	if !ok {
+		return nil, ErrToolNotFound
+	}
+
+	return route.server.sess.CallTool(ctx, route.tool, args)
+}
+
+// resourceCatalogue returns the exposed resources, and the server each URI is routed to.
+func (a *Aggregator) resourceCatalogue(ctx context.Context) ([]*ResourceDefinition, map[string]*aggregatedServer, error) {
+	servers, lists, err := fetchLists(ctx, a, "resources",
+		func(server *aggregatedServer) *listCache[*ResourceDefinition] { return &server.resources },
+		func(ctx context.Context, sess ClientSession) ([]*ResourceDefinition, error) {
+			result, err := sess.ListResources(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return result.Resources, nil
+		})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resources := make([]*ResourceDefinition, 0)
+	routes := make(map[string]*aggregatedServer)
+	for i, list := range lists {
+		for _, resource := range list {
+			if _, ok := routes[resource.URI]; ok {
+				continue
+			}
+			resources = append(resources, resource.Clone())
+			routes[resource.URI] = servers[i]
+		}
+	}
+
+	return resources, routes, nil
+}
+
+// ListResources returns the resources of all the servers.
+func (a *Aggregator) ListResources(ctx context.Context) (*ListResourcesResult, error) {
+	resources, _, err := a.resourceCatalogue(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ListResourcesResult{Resources: resources}, nil
+}
+
+// ReadResource reads the resource on the server listing its URI.
+// It fails with ErrResourceNotFound if no server lists the resource.
+func (a *Aggregator) ReadResource(ctx context.Context, resource *ResourceDefinition) (*ReadResourceResult, error) {
+	_, routes, err := a.resourceCatalogue(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	server, ok := routes[resource.URI]
+	if !ok {
+		return nil, ErrResourceNotFound
+	}
+
+	return server.sess.ReadResource(ctx, resource)
+}
+
+// promptCatalogue returns the exposed prompts, and the server and the prompt each exposed name is routed to.
+func (a *Aggregator) promptCatalogue(ctx context.Context) ([]*PromptDefinition, map[string]promptRoute, error) {
+	servers, lists, err := fetchLists(ctx, a, "prompts",
+		func(server *aggregatedServer) *listCache[*PromptDefinition] { return &server.prompts },
+		func(ctx context.Context, sess ClientSession) ([]*PromptDefinition, error) {
+			result, err := sess.ListPrompts(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return result.Prompts, nil
+		})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	names := make([][]string, len(lists))
+	for i, list := range lists {
+		for _, prompt := range list {
+			names[i] = append(names[i], prompt.Name)
+		}
+	}
+	exposed := a.resolveNames(servers, names)
+
+	prompts := make([]*PromptDefinition, 0)
+	routes := make(map[string]promptRoute)
+	for i, list := range lists {
+		for j, prompt := range list {
+			name := exposed[i][j]
+			if name == "" {
+				continue
+			}
+
+			clone := prompt.Clone()
+			clone.Name = name
+			prompts = append(prompts, clone)
+			routes[name] = promptRoute{server: servers[i], prompt: prompt}
+		}
+	}
+
+	return prompts, routes, nil
+}
+
+type promptRoute struct {
+	server *aggregatedServer
+	prompt *PromptDefinition
+}
+
+// ListPrompts returns the prompts of all the servers under their exposed names.
+func (a *Aggregator) ListPrompts(ctx context.Context) (*ListPromptsResult, error) {
+	prompts, _, err := a.promptCatalogue(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ListPromptsResult{Prompts: prompts}, nil
+}
+
+// GetPrompt gets the prompt with its exposed name from the server owning it.
+// It fails with ErrPromptNotFound if no server exposes the prompt.
+func (a *Aggregator) GetPrompt(ctx context.Context, prompt *PromptDefinition, args map[string]any) (*GetPromptResult, error) {
+	_, routes, err := a.promptCatalogue(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	route, ok := routes[prompt.Name]
+	if !ok {
+		return nil, ErrPromptNotFound
+	}
+
+	return route.server.sess.GetPrompt(ctx, route.prompt, args)
+}
@@ -0,0 +1,322 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dialAggregatedServer connects to a server exposing a tool for each name, which answers with the name of the server.
+func dialAggregatedServer(t *testing.T, server string, tools ...string) (ClientSession, *ServerMux) {
+	t.Helper()
+
+	mux := NewServerMux()
+	for _, tool := range tools {
+		mux.HandleTool(&ToolDefinition{Name: tool}, ToolHandlerFunc(func(w ContentsWriter, name string, args map[string]any) {
+			w.WriteContents([]Content{TextContent{Text: server + " " + name}})
+		}))
+	}
+	mux.HandleResource(&ResourceDefinition{URI: "file:///" + server + ".txt", Name: server}, ResourceHandlerFunc(func(w ContentsWriter, name string, args map[string]any) {
+		w.WriteContents([]Content{TextContent{Text: server}})
+	}))
+
+	s := NewServer(server, "0.0.1")
+	s.Handler = mux
+	s.ToolsChangedNotification = true
+
+	return dialTestStream(t, s, NewClient("test-client", "0.0.1")), mux
+}
+
+// newAggregatedServer returns a server exposing a tool for each name, which answers with the name of the server.
+func newAggregatedServer(server string, tools ...string) *Server {
+	mux := NewServerMux()
+	for _, tool := range tools {
+		mux.HandleTool(&ToolDefinition{Name: tool}, ToolHandlerFunc(func(w ContentsWriter, name string, args map[string]any) {
+			w.WriteContents([]Content{TextContent{Text: server + " " + name}})
+		}))
+	}
+
+	s := NewServer(server, "0.0.1")
+	s.Handler = mux
+	return s
+}
+
+// streamDialer returns a dialer connecting to the server over pipes.
+func streamDialer(server *Server) ServerDialer {
+	return func(c *Client) (ClientSession, error) {
+		clientR, serverW := io.Pipe()
+		serverR, clientW := io.Pipe()
+
+		go server.AcceptStream(serverW, serverR)
+
+		return c.Dial(NewStreamTransport(clientW, clientR))
+	}
+}
+
+func toolNames(t *testing.T, a *Aggregator) []string {
+	t.Helper()
+
+	result, err := a.ListTools(context.Background())
+	if !assert.NoError(t, err) {
+		return nil
+	}
+
+	var names []string
+	for _, tool := range result.Tools {
+		names = append(names, tool.Name)
+	}
+	return names
+}
+
+func TestAggregator_Policy(t *testing.T) {
+	tests := map[string]struct {
+		policy    ConflictPolicy
+		wantTools []string
+		wantCalls map[string]string
+	}{
+		"prefix always": {
+			policy:    PrefixAlways,
+			wantTools: []string{"github__search", "github__create_issue", "jira__search"},
+			wantCalls: map[string]string{
+				"github__search": "github search",
+				"jira__search":   "jira search",
+			},
+		},
+		"prefix on conflict": {
+			policy:    PrefixOnConflict,
+			wantTools: []string{"github__search", "create_issue", "jira__search"},
+			wantCalls: map[string]string{
+				"create_issue": "github create_issue",
+				"jira__search": "jira search",
+			},
+		},
+		"first server wins": {
+			policy:    FirstServerWins,
+			wantTools: []string{"search", "create_issue"},
+			wantCalls: map[string]string{
+				"search":       "github search",
+				"create_issue": "github create_issue",
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			github, _ := dialAggregatedServer(t, "github", "search", "create_issue")
+			jira, _ := dialAggregatedServer(t, "jira", "search")
+
+			a := NewAggregator(tc.policy)
+			require.NoError(t, a.AddServer("github", github))
+			require.NoError(t, a.AddServer("jira", jira))
+
+			assert.Equal(t, tc.wantTools, toolNames(t, a))
+
+			for tool, want := range tc.wantCalls {
+				result, err := a.CallTool(context.Background(), &ToolDefinition{Name: tool}, nil)
+				require.NoError(t, err)
+				assert.Equal(t, []Content{&TextContent{Text: want}}, result.Content)
+			}
+
+			_, err := a.CallTool(context.Background(), &ToolDefinition{Name: "unknown"}, nil)
+			assert.ErrorIs(t, err, ErrToolNotFound)
+		})
+	}
+}
+
+func TestAggregator_AddServer(t *testing.T) {
+	github, _ := dialAggregatedServer(t, "github", "search")
+
+	a := NewAggregator(PrefixAlways)
+	require.NoError(t, a.AddServer("github", github))
+
+	assert.EqualError(t, a.AddServer("", github), "server name is empty")
+	assert.EqualError(t, a.AddServer("github", github), `server "github" is already added`)
+	assert.EqualError(t, a.AddServer("git__hub", github), `server name "git__hub" contains the separator "__"`)
+	assert.Equal(t, []string{"github"}, a.Servers())
+}
+
+func TestAggregator_Connect(t *testing.T) {
+	t.Run("connect", func(t *testing.T) {
+		a := NewAggregator(PrefixAlways)
+		t.Cleanup(func() { a.Close() })
+
+		require.NoError(t, a.Connect("github", streamDialer(newAggregatedServer("github", "search"))))
+		assert.Equal(t, []string{"github__search"}, toolNames(t, a))
+
+		sess, ok := a.Session("github")
+		require.True(t, ok)
+		assert.Equal(t, "github", sess.ServerInfo().Name)
+
+		// Servers are not dialed under invalid names
+		dialed := false
+		err := a.Connect("git__hub", func(c *Client) (ClientSession, error) {
+			dialed = true
+			return nil, errors.New("should not be dialed")
+		})
+		assert.EqualError(t, err, `server name "git__hub" contains the separator "__"`)
+		assert.False(t, dialed)
+
+		err = a.Connect("github", streamDialer(newAggregatedServer("github", "search")))
+		assert.EqualError(t, err, `server "github" is already added`)
+	})
+
+	t.Run("connect all", func(t *testing.T) {
+		a := NewAggregator(FirstServerWins)
+		a.Client = NewClient("agent", "1.0.0")
+		t.Cleanup(func() { a.Close() })
+
+		errRefused := errors.New("connection refused")
+		err := a.ConnectAll(map[string]ServerDialer{
+			"jira":   streamDialer(newAggregatedServer("jira", "search", "create_ticket")),
+			"github": streamDialer(newAggregatedServer("github", "search")),
+			"slack": func(c *Client) (ClientSession, error) {
+				return nil, errRefused
+			},
+		})
+		assert.ErrorIs(t, err, errRefused)
+		assert.ErrorContains(t, err, `failed to connect to server "slack"`)
+
+		// The servers are added in the order of their names
+		assert.Equal(t, []string{"github", "jira"}, a.Servers())
+		result, err := a.CallTool(context.Background(), &ToolDefinition{Name: "search"}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []Content{&TextContent{Text: "github search"}}, result.Content)
+	})
+
+	t.Run("closed aggregator does not connect", func(t *testing.T) {
+		a := NewAggregator(PrefixAlways)
+		require.NoError(t, a.Close())
+
+		err := a.Connect("github", streamDialer(newAggregatedServer("github", "search")))
+		assert.EqualError(t, err, "aggregator is closed")
+	})
+}
+
+// flakySession is a session whose listing of the tools fails while fail is set.
+type flakySession struct {
+	ClientSession
+	fail atomic.Bool
+}
+
+var errFlakyList = errors.New("list failed")
+
+func (s *flakySession) ListTools(ctx context.Context) (*ListToolsResult, error) {
+	if s.fail.Load() {
+		return nil, errFlakyList
+	}
+	return s.ClientSession.ListTools(ctx)
+}
+
+func TestAggregator_ListFailure(t *testing.T) {
+	github, _ := dialAggregatedServer(t, "github", "search")
+	jiraSess, _ := dialAggregatedServer(t, "jira", "search")
+	jira := &flakySession{ClientSession: jiraSess}
+
+	a := NewAggregator(PrefixAlways)
+	require.NoError(t, a.AddServer("github", github))
+	require.NoError(t, a.AddServer("jira", jira))
+	assert.Equal(t, []string{"github__search", "jira__search"}, toolNames(t, a))
+
+	invalidate := func(servers ...int) {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		for _, i := range servers {
+			a.servers[i].tools.invalidate()
+		}
+	}
+	jira.fail.Store(true)
+
+	// The only list to fetch fails, while the other one is cached
+	invalidate(1)
+	_, err := a.ListTools(context.Background())
+	assert.ErrorIs(t, err, errFlakyList)
+
+	// A server failing to list is skipped when other lists are fetched
+	invalidate(0, 1)
+	assert.Equal(t, []string{"github__search"}, toolNames(t, a))
+}
+
+func TestAggregator_Resources(t *testing.T) {
+	github, _ := dialAggregatedServer(t, "github")
+	jira, _ := dialAggregatedServer(t, "jira")
+
+	a := NewAggregator(PrefixAlways)
+	require.NoError(t, a.AddServer("github", github))
+	require.NoError(t, a.AddServer("jira", jira))
+
+	result, err := a.ListResources(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Resources, 2)
+	assert.Equal(t, "file:///github.txt", result.Resources[0].URI)
+	assert.Equal(t, "file:///jira.txt", result.Resources[1].URI)
+
+	read, err := a.ReadResource(context.Background(), &ResourceDefinition{URI: "file:///jira.txt"})
+	require.NoError(t, err)
+	require.Len(t, read.Contents, 1)
+	assert.Equal(t, "jira", read.Contents[0].Text)
+
+	_, err = a.ReadResource(context.Background(), &ResourceDefinition{URI: "file:///unknown.txt"})
+	assert.ErrorIs(t, err, ErrResourceNotFound)
+}
+
+func TestAggregator_ListChanged(t *testing.T) {
+	github, githubMux := dialAggregatedServer(t, "github", "search")
+	jira, _ := dialAggregatedServer(t, "jira", "search")
+
+	a := NewAggregator(PrefixOnConflict)
+	require.NoError(t, a.AddServer("github", github))
+	require.NoError(t, a.AddServer("jira", jira))
+	t.Cleanup(func() { a.Close() })
+
+	changed := a.ListChanged()
+	assert.Equal(t, []string{"github__search", "jira__search"}, toolNames(t, a))
+
+	// The server registers a tool and notifies the client from the handler of a tool call
+	githubMux.HandleTool(&ToolDefinition{Name: "register"}, ToolHandlerFunc(func(w ContentsWriter, name string, args map[string]any) {
+		githubMux.HandleTool(&ToolDefinition{Name: "create_issue"}, ToolHandlerFunc(func(w ContentsWriter, name string, args map[string]any) {}))
+
+		sess, _ := ServerSessionFromContext(w.Context())
+		sess.(*serverSession).transport.Notify(&Notification{Method: MethodNotifyToolChanged})
+		w.WriteContents(nil)
+	}))
+	_, err := github.CallTool(context.Background(), &ToolDefinition{Name: "register"}, nil)
+	require.NoError(t, err)
+
+	waitListChanged(t, changed, MethodNotifyToolChanged)
+	require.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"github__search", "register", "create_issue", "jira__search"}, toolNames(t, a))
+	}, time.Second, 10*time.Millisecond, "the tools of the server should be listed again")
+
+	// The server is removed once its session ends
+	require.NoError(t, jira.Close())
+	require.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"github"}, a.Servers())
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"search", "register", "create_issue"}, toolNames(t, a))
+}
+
+// waitListChanged drains the channel until the method is received.
+func waitListChanged(t *testing.T, changed <-chan Method, method Method) {
+	t.Helper()
+
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case m, ok := <-changed:
+			require.True(t, ok, "the channel should not be closed")
+			if m == method {
+				return
+			}
+		case <-timeout:
+			require.Failf(t, "list_changed notification not received", "method %s", method)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ProtectedResourceMetadataPath is the well-known path of the OAuth 2.0 protected resource metadata (RFC 9728).
+const ProtectedResourceMetadataPath = "/.well-known/oauth-protected-resource"
+
+var (
+	// ErrInvalidToken is returned by a TokenVerifier when the token is unknown, expired or revoked.
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrInsufficientScope is returned by a TokenVerifier when the token is valid but lacks the scopes required by the server.
+	ErrInsufficientScope = errors.New("insufficient scope")
+)
+
+// AuthInfo describes the principal authenticated by an access token.
+type AuthInfo struct {
+	// Access token presented by the client
+	Token string
+	// Subject of the token, usually the ID of the user
+	Subject string
+	// ID of the client to which the token was issued
+	ClientID string
+	// Scopes granted to the token
+	Scopes []string
+	// Audience of the token, the URIs of the resources for which it was issued (RFC 8707).
+	// A token is accepted only if it was issued for the server.
+	Audience []string
+	// Expiration time of the token, zero if it does not expire
+	ExpiresAt time.Time
+	// Additional claims of the token
+	Extra map[string]any
+}
+
+// HasScope reports whether the token was granted the scope.
+func (a *AuthInfo) HasScope(scope string) bool {
+	for _, s := range a.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type authInfoKey struct{}
+
+// AuthInfoFromContext returns the principal authenticated by the HTTP request carrying the request being served.
+// Handlers get it from the context of their writer, for example:
+//
+//	info, ok := mcp.AuthInfoFromContext(w.Context())
+func AuthInfoFromContext(ctx context.Context) (*AuthInfo, bool) {
+	info, ok := ctx.Value(authInfoKey{}).(*AuthInfo)
+	return info, ok
+}
+
+func withAuthInfo(ctx context.Context, info *AuthInfo) context.Context {
+	return context.WithValue(ctx, authInfoKey{}, info)
+}
+
+// TokenVerifier validates the bearer tokens presented to the server.
+type TokenVerifier interface {
+	// VerifyToken returns the principal authenticated by the token.
+	// It returns an error wrapping ErrInvalidToken if the token is not valid.
+	// It must report the audience of the token in AuthInfo.Audience,
+	// so that tokens issued for other resources are refused.
+	VerifyToken(ctx context.Context, token string) (*AuthInfo, error)
+}
+
+// TokenVerifierFunc is an adapter to use an ordinary function as a TokenVerifier.
+type TokenVerifierFunc func(ctx context.Context, token string) (*AuthInfo, error)
+
+func (f TokenVerifierFunc) VerifyToken(ctx context.Context, token string) (*AuthInfo, error) {
+	return f(ctx, token)
+}
+
+// AuthConfig configures the OAuth 2.1 authorization of the HTTP handlers of a server.
+type AuthConfig struct {
+	// Verifier validates the bearer token of every HTTP request. It is required.
+	Verifier TokenVerifier
+
+	// Canonical URI of the server, such as "https://example.com/mcp". It is required,
+	// as tokens are accepted only if they were issued for it. It is not derived from the requests,
+	// whose Host header is chosen by the client and whose scheme may be changed by a proxy.
+	Resource string
+	// Issuers of the authorization servers which grant tokens for the server
+	AuthorizationServers []string
+	// Scopes advertised in the protected resource metadata
+	ScopesSupported []string
+	// Scopes which every token must be granted
+	RequiredScopes []string
+
+	// URL of the protected resource metadata announced in the WWW-Authenticate header.
+	// If empty, it is the well-known URL of the metadata on the host of the request,
+	// followed by the path of the request.
+	ResourceMetadataURL string
+}
+
+// ProtectedResourceMetadata is the OAuth 2.0 protected resource metadata of a server (RFC 9728).
+type ProtectedResourceMetadata struct {
+	Resource               string   `json:"resource"`
+	AuthorizationServers   []string `json:"authorization_servers,omitempty"`
+	ScopesSupported        []string `json:"scopes_supported,omitempty"`
+	BearerMethodsSupported []string `json:"bearer_methods_supported,omitempty"`
+}
+
+// ProtectedResourceMetadataHandler returns an http.Handler serving the protected resource metadata
+// configured in HTTPConfig.Auth, which tells clients where to obtain tokens.
+// It should be mounted on the well-known path with a trailing slash, which matches the path of the resource appended to it:
+//
+//	http.Handle(mcp.ProtectedResourceMetadataPath+"/", server.ProtectedResourceMetadataHandler())
+func (s *Server) ProtectedResourceMetadataHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		config := s.HTTPConfig.auth()
+		if config == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		if config.Resource == "" {
+			http.Error(w, "resource is not configured", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&ProtectedResourceMetadata{
+			Resource:               config.Resource,
+			AuthorizationServers:   config.AuthorizationServers,
+			ScopesSupported:        config.ScopesSupported,
+			BearerMethodsSupported: []string{"header"},
+		})
+	})
+}
+
+// authenticate verifies the bearer token of the request and returns the request
+// with the authenticated principal in its context.
+// If the token is missing or not valid, the request is answered with
+// 401 Unauthorized and ok is false. A token lacking a required scope is answered with 403 Forbidden.
+func authenticate(w http.ResponseWriter, r *http.Request, config *AuthConfig) (*http.Request, bool) {
+	if config.Verifier == nil {
+		// Fail closed rather than serving requests without authorization
+		http.Error(w, "token verifier is not configured", http.StatusInternalServerError)
+		return nil, false
+	}
+	if config.Resource == "" {
+		// The audience of the tokens cannot be checked
+		http.Error(w, "resource is not configured", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	token = strings.TrimSpace(token)
+	if !strings.EqualFold(scheme, "Bearer") || token == "" {
+		writeAuthError(w, r, config, http.StatusUnauthorized, "", "")
+		return nil, false
+	}
+
+	info, err := config.Verifier.VerifyToken(r.Context(), token)
+	if err == nil && info == nil {
+		err = ErrInvalidToken
+	}
+	if err == nil && !info.ExpiresAt.IsZero() && time.Now().After(info.ExpiresAt) {
+		err = fmt.Errorf("%w: token has expired", ErrInvalidToken)
+	}
+	if err != nil {
+		if errors.Is(err, ErrInsufficientScope) {
+			writeAuthError(w, r, config, http.StatusForbidden, "insufficient_scope", err.Error())
+			return nil, false
+		}
+		if !errors.Is(err, ErrInvalidToken) {
+			http.Error(w, "failed to verify token", http.StatusInternalServerError)
+			return nil, false
+		}
+		writeAuthError(w, r, config, http.StatusUnauthorized, "invalid_token", err.Error())
+		return nil, false
+	}
+
+	// A token issued for another resource must not be accepted, even if it is valid
+	if !hasAudience(info.Audience, config.Resource) {
+		writeAuthError(w, r, config, http.StatusUnauthorized, "invalid_token", "token was not issued for this resource")
+		return nil, false
+	}
+
+	for _, scope := range config.RequiredScopes {
+		if !info.HasScope(scope) {
+			writeAuthError(w, r, config, http.StatusForbidden, "insufficient_scope", "token lacks scope "+scope)
+			return nil, false
+		}
+	}
+
+	if info.Token == "" {
+		info.Token = token
+	}
+
+	return r.WithContext(withAuthInfo(r.Context(), info)), true
+}
+
+// writeAuthError answers the request with the status and a WWW-Authenticate header
+// pointing to the protected resource metadata (RFC 6750 and RFC 9728).
+func writeAuthError(w http.ResponseWriter, r *http.Request, config *AuthConfig, status int, code, description string) {
+	metadataURL := config.ResourceMetadataURL
+	if metadataURL == "" {
+		metadataURL = requestOrigin(r) + ProtectedResourceMetadataPath + r.URL.Path
+	}
+
+	params := []string{fmt.Sprintf("resource_metadata=%q", metadataURL)}
+	if code != "" {
+		params = append(params, fmt.Sprintf("error=%q", code))
+	}
+	if description != "" {
+		params = append(params, fmt.Sprintf("error_description=%q", description))
+	}
+	if code == "insufficient_scope" && len(config.RequiredScopes) > 0 {
+		params = append(params, fmt.Sprintf("scope=%q", strings.Join(config.RequiredScopes, " ")))
+	}
+
+	w.Header().Set("WWW-Authenticate", "Bearer "+strings.Join(params, ", "))
+	http.Error(w, http.StatusText(status), status)
+}
+
+// hasAudience reports whether the audience includes the resource, ignoring a trailing slash.
+func hasAudience(audience []string, resource string) bool {
+	for _, aud := range audience {
+		if strings.TrimSuffix(aud, "/") == strings.TrimSuffix(resource, "/") {
+			return true
+		}
+	}
+	return false
+}
+
+// requestOrigin returns the scheme and host of the URL the request was sent to.
+func requestOrigin(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
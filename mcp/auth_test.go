@@ -0,0 +1,448 @@
+package mcp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testAuthServer is a minimal OAuth 2.1 authorization server which approves every authorization request.
+type testAuthServer struct {
+	*httptest.Server
+
+	// Lifetime of the issued access tokens
+	expiresIn int
+
+	mu            sync.Mutex
+	codes         map[string]url.Values
+	tokens        map[string]*AuthInfo
+	refreshTokens map[string]string
+	lastID        int
+	// Number of tokens issued per grant type
+	grants map[string]int
+}
+
+func newTestAuthServer(t *testing.T, expiresIn int) *testAuthServer {
+	s := &testAuthServer{
+		expiresIn:     expiresIn,
+		codes:         make(map[string]url.Values),
+		tokens:        make(map[string]*AuthInfo),
+		refreshTokens: make(map[string]string),
+		grants:        make(map[string]int),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/oauth-authorization-server", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                           s.URL,
+			"authorization_endpoint":           s.URL + "/authorize",
+			"token_endpoint":                   s.URL + "/token",
+			"code_challenge_methods_supported": []string{"S256"},
+		})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+			http.Error(w, "PKCE is required", http.StatusBadRequest)
+			return
+		}
+
+		s.mu.Lock()
+		s.lastID++
+		code := "code-" + strconv.Itoa(s.lastID)
+		s.codes[code] = query
+		s.mu.Unlock()
+
+		redirect, _ := url.Parse(query.Get("redirect_uri"))
+		redirect.RawQuery = url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+		http.Redirect(w, r, redirect.String(), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		grantType := r.PostForm.Get("grant_type")
+		switch grantType {
+		case "authorization_code":
+			query, ok := s.codes[r.PostForm.Get("code")]
+			delete(s.codes, r.PostForm.Get("code"))
+			challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+			if !ok || base64.RawURLEncoding.EncodeToString(challenge[:]) != query.Get("code_challenge") {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+				return
+			}
+		case "refresh_token":
+			if _, ok := s.refreshTokens[r.PostForm.Get("refresh_token")]; !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+				return
+			}
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "unsupported_grant_type"})
+			return
+		}
+
+		s.grants[grantType]++
+		s.lastID++
+		accessToken := "access-" + strconv.Itoa(s.lastID)
+		refreshToken := "refresh-" + strconv.Itoa(s.lastID)
+		s.tokens[accessToken] = &AuthInfo{
+			Subject:   "user-1",
+			ClientID:  r.PostForm.Get("client_id"),
+			Scopes:    []string{"mcp"},
+			Audience:  []string{r.PostForm.Get("resource")},
+			ExpiresAt: time.Now().Add(time.Duration(s.expiresIn) * time.Second),
+		}
+		s.refreshTokens[refreshToken] = accessToken
+
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  accessToken,
+			"token_type":    "Bearer",
+			"refresh_token": refreshToken,
+			"expires_in":    s.expiresIn,
+		})
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *testAuthServer) VerifyToken(ctx context.Context, token string) (*AuthInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, ok := s.tokens[token]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	return info, nil
+}
+
+func (s *testAuthServer) grantCount(grantType string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.grants[grantType]
+}
+
+// authorizeWithoutBrowser follows the authorization URL and returns the redirect URL, as a browser would.
+func authorizeWithoutBrowser(ctx context.Context, authorizationURL string) (*url.URL, error) {
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, authorizationURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		return nil, errors.New("authorization was not redirected")
+	}
+	return resp.Location()
+}
+
+func TestHTTPHandler_Auth(t *testing.T) {
+	var resource string
+	verifier := TokenVerifierFunc(func(ctx context.Context, token string) (*AuthInfo, error) {
+		switch token {
+		case "valid":
+			return &AuthInfo{Subject: "user-1", Scopes: []string{"mcp"}, Audience: []string{resource}}, nil
+		case "no-scope":
+			return &AuthInfo{Subject: "user-1", Audience: []string{resource}}, nil
+		case "expired":
+			return &AuthInfo{Subject: "user-1", Scopes: []string{"mcp"}, Audience: []string{resource}, ExpiresAt: time.Now().Add(-time.Minute)}, nil
+		case "other-audience":
+			return &AuthInfo{Subject: "user-1", Scopes: []string{"mcp"}, Audience: []string{"https://other.example.com/mcp"}}, nil
+		default:
+			return nil, ErrInvalidToken
+		}
+	})
+
+	server := NewServer("test-server", "0.0.1")
+	server.Handler = NewServerMux()
+	server.HTTPConfig = &HTTPServerConfig{
+		JSONResponse: true,
+		Auth: &AuthConfig{
+			Verifier:             verifier,
+			AuthorizationServers: []string{"https://auth.example.com"},
+			RequiredScopes:       []string{"mcp"},
+		},
+	}
+	t.Cleanup(func() { server.Close() })
+
+	mux := http.NewServeMux()
+	mux.Handle("/mcp", server.HTTPHandler())
+	mux.Handle(ProtectedResourceMetadataPath+"/", server.ProtectedResourceMetadataHandler())
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	resource = ts.URL + "/mcp"
+	server.HTTPConfig.Auth.Resource = resource
+
+	initialize := map[string]any{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  MethodInit,
+		"params": map[string]any{
+			"protocolVersion": DefaultVersion,
+			"capabilities":    map[string]any{},
+			"clientInfo":      map[string]any{"name": "test-client", "version": "0.0.1"},
+		},
+	}
+
+	tests := map[string]struct {
+		authorization   string
+		wantStatus      int
+		wantChallengeIn string
+	}{
+		"missing token is unauthorized": {
+			wantStatus:      http.StatusUnauthorized,
+			wantChallengeIn: `resource_metadata="` + ts.URL + ProtectedResourceMetadataPath + `/mcp"`,
+		},
+		"unknown token is unauthorized": {
+			authorization:   "Bearer unknown",
+			wantStatus:      http.StatusUnauthorized,
+			wantChallengeIn: `error="invalid_token"`,
+		},
+		"expired token is unauthorized": {
+			authorization:   "Bearer expired",
+			wantStatus:      http.StatusUnauthorized,
+			wantChallengeIn: `error="invalid_token"`,
+		},
+		"token issued for another resource is unauthorized": {
+			authorization:   "Bearer other-audience",
+			wantStatus:      http.StatusUnauthorized,
+			wantChallengeIn: `error="invalid_token"`,
+		},
+		"token without required scope is forbidden": {
+			authorization:   "Bearer no-scope",
+			wantStatus:      http.StatusForbidden,
+			wantChallengeIn: `error="insufficient_scope"`,
+		},
+		"valid token is accepted": {
+			authorization: "Bearer valid",
+			wantStatus:    http.StatusOK,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			body, err := json.Marshal(initialize)
+			require.NoError(t, err)
+
+			req, err := http.NewRequest(http.MethodPost, ts.URL+"/mcp", strings.NewReader(string(body)))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Accept", "application/json, text/event-stream")
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tc.wantStatus, resp.StatusCode)
+			assert.Contains(t, resp.Header.Get("WWW-Authenticate"), tc.wantChallengeIn)
+		})
+	}
+
+	t.Run("token is refused without a configured resource", func(t *testing.T) {
+		server := NewServer("test-server", "0.0.1")
+		server.HTTPConfig = &HTTPServerConfig{Auth: &AuthConfig{Verifier: verifier}}
+		t.Cleanup(func() { server.Close() })
+
+		req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader("{}"))
+		req.Header.Set("Authorization", "Bearer valid")
+		rec := httptest.NewRecorder()
+		server.HTTPHandler().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusInternalServerError, rec.Code, "the audience of the token cannot be checked")
+	})
+
+	t.Run("protected resource metadata is served", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + ProtectedResourceMetadataPath + "/mcp")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var metadata ProtectedResourceMetadata
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&metadata))
+		assert.Equal(t, ts.URL+"/mcp", metadata.Resource)
+		assert.Equal(t, []string{"https://auth.example.com"}, metadata.AuthorizationServers)
+	})
+}
+
+func TestClient_OAuth(t *testing.T) {
+	authServer := newTestAuthServer(t, 3600)
+
+	subjects := make(chan string, 1)
+	mux := NewServerMux()
+	mux.HandleTool(&ToolDefinition{Name: "whoami"}, ToolHandlerFunc(func(w ContentsWriter, name string, args map[string]any) {
+		info, ok := AuthInfoFromContext(w.Context())
+		if !ok {
+			w.CloseWithError(ErrInternalError.Code, "no principal")
+			return
+		}
+		subjects <- info.Subject
+		w.WriteContents([]Content{})
+	}))
+
+	server := NewServer("test-server", "0.0.1")
+	server.Handler = mux
+	server.HTTPConfig = &HTTPServerConfig{
+		Auth: &AuthConfig{
+			Verifier:             authServer,
+			AuthorizationServers: []string{authServer.URL},
+			ScopesSupported:      []string{"mcp"},
+		},
+	}
+	t.Cleanup(func() { server.Close() })
+
+	httpMux := http.NewServeMux()
+	httpMux.Handle("/sse", server.SSEHandler())
+	httpMux.Handle(ProtectedResourceMetadataPath+"/", server.ProtectedResourceMetadataHandler())
+	ts := httptest.NewServer(httpMux)
+	t.Cleanup(ts.Close)
+	server.HTTPConfig.Auth.Resource = ts.URL + "/sse"
+
+	authorizations := 0
+	store := NewMemoryTokenStore()
+	config := &HTTPConfig{
+		OAuth: &OAuthConfig{
+			ClientID:    "test-client",
+			RedirectURL: "http://localhost/callback",
+			Authorize: func(ctx context.Context, authorizationURL string) (*url.URL, error) {
+				authorizations++
+				return authorizeWithoutBrowser(ctx, authorizationURL)
+			},
+			TokenStore: store,
+		},
+	}
+
+	callWhoami := func(t *testing.T) {
+		sess, err := NewClient("test-client", "0.0.1").DialSSE(ts.URL+"/sse", config)
+		require.NoError(t, err)
+		defer sess.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		results, err := sess.Batch(ctx, &Request{Method: MethodCallTool, Params: Params(`{"name":"whoami"}`)})
+		require.NoError(t, err)
+		require.NoError(t, results[0].Err)
+		assert.Equal(t, "user-1", <-subjects, "tool should be served with the principal of the token")
+	}
+
+	t.Run("client authorizes with the authorization code flow", func(t *testing.T) {
+		callWhoami(t)
+
+		assert.Equal(t, 1, authorizations, "user should be asked to authorize once")
+		assert.Equal(t, 1, authServer.grantCount("authorization_code"))
+	})
+
+	t.Run("client refreshes an expired token", func(t *testing.T) {
+		token, err := store.Token(context.Background())
+		require.NoError(t, err)
+		require.NotNil(t, token)
+		token.Expiry = time.Now().Add(-time.Minute)
+		require.NoError(t, store.SetToken(context.Background(), token))
+
+		callWhoami(t)
+
+		assert.Equal(t, 1, authorizations, "user should not be asked to authorize again")
+		assert.Equal(t, 1, authServer.grantCount("refresh_token"))
+	})
+}
+
+func TestOAuthRoundTripper_Discover(t *testing.T) {
+	tests := map[string]struct {
+		resource string
+		issuer   string
+		methods  []string
+		wantErr  string
+	}{
+		"metadata of the server and its issuer": {
+			methods: []string{"plain", "S256"},
+		},
+		"protected resource metadata of another resource": {
+			resource: "https://other.example.com/mcp",
+			methods:  []string{"S256"},
+			wantErr:  `protected resource metadata is for "https://other.example.com/mcp"`,
+		},
+		"authorization server metadata of another issuer": {
+			issuer:  "https://other.example.com",
+			methods: []string{"S256"},
+			wantErr: `authorization server metadata is for "https://other.example.com"`,
+		},
+		"authorization server without S256": {
+			methods: []string{"plain"},
+			wantErr: "authorization server does not support PKCE with S256",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var ts *httptest.Server
+			mux := http.NewServeMux()
+			mux.HandleFunc(ProtectedResourceMetadataPath+"/mcp", func(w http.ResponseWriter, r *http.Request) {
+				resource := tc.resource
+				if resource == "" {
+					resource = ts.URL + "/mcp"
+				}
+				json.NewEncoder(w).Encode(&ProtectedResourceMetadata{Resource: resource, AuthorizationServers: []string{ts.URL}})
+			})
+			mux.HandleFunc("/.well-known/oauth-authorization-server", func(w http.ResponseWriter, r *http.Request) {
+				issuer := tc.issuer
+				if issuer == "" {
+					issuer = ts.URL
+				}
+				json.NewEncoder(w).Encode(map[string]any{
+					"issuer":                           issuer,
+					"authorization_endpoint":           ts.URL + "/authorize",
+					"token_endpoint":                   ts.URL + "/token",
+					"code_challenge_methods_supported": tc.methods,
+				})
+			})
+			ts = httptest.NewServer(mux)
+			t.Cleanup(ts.Close)
+
+			rt := newOAuthRoundTripper(nil, &OAuthConfig{ClientID: "test-client"}, ts.URL+"/mcp")
+			err := rt.discover(context.Background(), `Bearer resource_metadata="`+ts.URL+ProtectedResourceMetadataPath+`/mcp"`)
+			if tc.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.wantErr)
+				assert.Nil(t, rt.metadata, "the authorization server should not be used")
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, ts.URL+"/token", rt.metadata.TokenEndpoint)
+		})
+	}
+}
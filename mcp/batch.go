@@ -0,0 +1,120 @@
+package mcp
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+)
+
+// BatchResult is the outcome of a single request sent in a batch.
+type BatchResult struct {
+	Result Result
+	Err    error
+}
+
+// isRequestMessage reports whether the message expects a response,
+// that is, whether it is a request or something which is not a valid message at all.
+// Notifications and responses never produce a response.
+func isRequestMessage(raw json.RawMessage) bool {
+	var message map[string]json.RawMessage
+	err := json.Unmarshal(raw, &message)
+	if err != nil {
+		return true
+	}
+
+	_, hasID := message["id"]
+	_, hasMethod := message["method"]
+	_, hasResult := message["result"]
+	_, hasError := message["error"]
+
+	if hasMethod {
+		return hasID
+	}
+	return !hasID || !(hasResult || hasError)
+}
+
+// newBatchWriter creates a writer collecting the responses to an inbound batch.
+// n is the number of responses expected. Once all of them are collected,
+// they are passed to write as a single array. If n is zero, nothing is written.
+func newBatchWriter(n int, write func(responses []map[string]any) error) *batchWriter {
+	return &batchWriter{
+		pending:   n,
+		responses: make([]map[string]any, 0, n),
+		write:     write,
+	}
+}
+
+type batchWriter struct {
+	mu        sync.Mutex
+	pending   int
+	responses []map[string]any
+
+	write func(responses []map[string]any) error
+}
+
+// Writer returns a ResponseWriter which answers the request with the given ID within the batch.
+func (b *batchWriter) Writer(id ID) ResponseWriter {
+	return &batchResponseWriter{b: b, id: id}
+}
+
+// WriteError adds an error response for an entry of the batch which is not a valid request.
+func (b *batchWriter) WriteError(id ID, err *Error) error {
+	message := map[string]any{
+		"jsonrpc": "2.0",
+		"id":      nil,
+		"error":   err,
+	}
+	if id != "" {
+		message["id"] = id
+	}
+	return b.add(message)
+}
+
+func (b *batchWriter) add(message map[string]any) error {
+	b.mu.Lock()
+
+	if b.pending <= 0 {
+		b.mu.Unlock()
+		return errors.New("all responses in the batch are already written")
+	}
+
+	b.responses = append(b.responses, message)
+	b.pending--
+
+	if b.pending > 0 {
+		b.mu.Unlock()
+		return nil
+	}
+
+	responses := b.responses
+	b.mu.Unlock()
+
+	return b.write(responses)
+}
+
+var _ ResponseWriter = (*batchResponseWriter)(nil)
+
+type batchResponseWriter struct {
+	b  *batchWriter
+	id ID
+}
+
+func (w *batchResponseWriter) ID() ID {
+	return w.id
+}
+
+func (w *batchResponseWriter) WriteResult(result Result) error {
+	return w.b.add(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      w.id,
+		"result":  result,
+	})
+}
+
+func (w *batchResponseWriter) CloseWithError(code ErrorCode, msg string, data map[string]json.RawMessage) error {
+	return w.b.add(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      w.id,
+		"error":   newError(code, msg, data),
+	})
+}
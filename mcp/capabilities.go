@@ -1,5 +1,62 @@
 package mcp
 
+import "encoding/json"
+
+// ServerCapabilities are the features supported by a server, advertised to the client in the initialization.
+// A nil feature is not supported, and is omitted in JSON.
+type ServerCapabilities struct {
+	// Experimental holds the non-standard capabilities, keyed by name
+	Experimental map[string]json.RawMessage `json:"experimental,omitempty"`
+	Logging      *LoggingCapability         `json:"logging,omitempty"`
+	Completions  *CompletionsCapability     `json:"completions,omitempty"`
+	Prompts      *PromptsCapability         `json:"prompts,omitempty"`
+	Resources    *ResourcesCapability       `json:"resources,omitempty"`
+	Tools        *ToolsCapability           `json:"tools,omitempty"`
+}
+
+// ClientCapabilities are the features supported by a client, advertised to the server in the initialization.
+// A nil feature is not supported, and is omitted in JSON.
+type ClientCapabilities struct {
+	// Experimental holds the non-standard capabilities, keyed by name
+	Experimental map[string]json.RawMessage `json:"experimental,omitempty"`
+	Roots        *RootsCapability           `json:"roots,omitempty"`
+	Sampling     *SamplingCapability        `json:"sampling,omitempty"`
+	Elicitation  *ElicitationCapability     `json:"elicitation,omitempty"`
+}
+
+type ToolsCapability struct {
+	// ListChanged is true if the changes of the list of tools are notified
+	ListChanged bool `json:"listChanged,omitempty"`
+}
+
+type ResourcesCapability struct {
+	// Subscribe is true if the updates of the resources can be subscribed to
+	Subscribe bool `json:"subscribe,omitempty"`
+	// ListChanged is true if the changes of the list of resources are notified
+	ListChanged bool `json:"listChanged,omitempty"`
+}
+
+type PromptsCapability struct {
+	// ListChanged is true if the changes of the list of prompts are notified
+	ListChanged bool `json:"listChanged,omitempty"`
+}
+
+type RootsCapability struct {
+	// ListChanged is true if the changes of the list of roots are notified
+	ListChanged bool `json:"listChanged,omitempty"`
+}
+
+type LoggingCapability struct{}
+
+type CompletionsCapability struct{}
+
+type SamplingCapability struct{}
+
+type ElicitationCapability struct{}
+
+// Capabilities are features and their flags keyed by name, such as {"tools": {"listChanged": true}}.
+//
+// Deprecated: Use ServerCapabilities or ClientCapabilities, which Capabilities converts to.
 type Capabilities map[string]map[string]bool
 
 func (c Capabilities) EnableCapability(feature string, method string) Capabilities {
@@ -34,6 +91,7 @@ func (c Capabilities) HasFeature(feature string) bool {
 	return true
 }
 
+// HasCapability reports whether the flag of the feature is set, whether it is enabled or not.
 func (c Capabilities) HasCapability(feature string, method string) bool {
 	if _, ok := c[feature]; !ok {
 		return false
@@ -43,3 +101,393 @@ func (c Capabilities) HasCapability(feature string, method string) bool {
 	}
 	return true
 }
+
+// ServerCapabilities converts the capabilities. Non-standard features are set in Experimental.
+func (c Capabilities) ServerCapabilities() *ServerCapabilities {
+	capabilities := &ServerCapabilities{}
+	c.convert(capabilities)
+	return capabilities
+}
+
+// ClientCapabilities converts the capabilities. Non-standard features are set in Experimental.
+func (c Capabilities) ClientCapabilities() *ClientCapabilities {
+	capabilities := &ClientCapabilities{}
+	c.convert(capabilities)
+	return capabilities
+}
+
+func (c Capabilities) convert(dst capabilitySet) {
+	for feature, flags := range c {
+		setCapability(dst, feature, "", false)
+		for flag, value := range flags {
+			setCapability(dst, feature, flag, value)
+		}
+	}
+}
+
+// capabilityFlags gives access to the flags of the capability of a feature by name.
+type capabilityFlags interface {
+	flag(name string) *bool
+}
+
+func (c *ToolsCapability) flag(name string) *bool {
+	if name == "listChanged" {
+		return &c.ListChanged
+	}
+	return nil
+}
+
+func (c *ResourcesCapability) flag(name string) *bool {
+	switch name {
+	case "subscribe":
+		return &c.Subscribe
+	case "listChanged":
+		return &c.ListChanged
+	}
+	return nil
+}
+
+func (c *PromptsCapability) flag(name string) *bool {
+	if name == "listChanged" {
+		return &c.ListChanged
+	}
+	return nil
+}
+
+func (c *RootsCapability) flag(name string) *bool {
+	if name == "listChanged" {
+		return &c.ListChanged
+	}
+	return nil
+}
+
+func (*LoggingCapability) flag(string) *bool { return nil }
+
+func (*CompletionsCapability) flag(string) *bool { return nil }
+
+func (*SamplingCapability) flag(string) *bool { return nil }
+
+func (*ElicitationCapability) flag(string) *bool { return nil }
+
+// capabilitySet is implemented by ServerCapabilities and ClientCapabilities,
+// so that their helper methods access the features by name in the same way.
+type capabilitySet interface {
+	// feature returns the capability of the standard feature, creating it if create is true.
+	// ok is false if the feature is not standard.
+	feature(name string, create bool) (flags capabilityFlags, ok bool)
+	experimental() *map[string]json.RawMessage
+}
+
+// ensureFeature returns the capability of a feature, creating it if create is true.
+func ensureFeature[T any, P interface {
+	*T
+	capabilityFlags
+}](p *P, create bool) capabilityFlags {
+	if *p == nil {
+		if !create {
+			return nil
+		}
+		*p = new(T)
+	}
+	return *p
+}
+
+func (c *ServerCapabilities) feature(name string, create bool) (capabilityFlags, bool) {
+	switch name {
+	case "logging":
+		return ensureFeature(&c.Logging, create), true
+	case "completions":
+		return ensureFeature(&c.Completions, create), true
+	case "prompts":
+		return ensureFeature(&c.Prompts, create), true
+	case "resources":
+		return ensureFeature(&c.Resources, create), true
+	case "tools":
+		return ensureFeature(&c.Tools, create), true
+	}
+	return nil, false
+}
+
+func (c *ServerCapabilities) experimental() *map[string]json.RawMessage {
+	return &c.Experimental
+}
+
+func (c *ClientCapabilities) feature(name string, create bool) (capabilityFlags, bool) {
+	switch name {
+	case "roots":
+		return ensureFeature(&c.Roots, create), true
+	case "sampling":
+		return ensureFeature(&c.Sampling, create), true
+	case "elicitation":
+		return ensureFeature(&c.Elicitation, create), true
+	}
+	return nil, false
+}
+
+func (c *ClientCapabilities) experimental() *map[string]json.RawMessage {
+	return &c.Experimental
+}
+
+// EnableCapability enables the flag of the feature, such as "listChanged" of "tools", and adds the feature if needed.
+// Non-standard features are set in Experimental. Unknown flags of the standard features are ignored.
+func (c *ServerCapabilities) EnableCapability(feature string, flag string) *ServerCapabilities {
+	setCapability(c, feature, flag, true)
+	return c
+}
+
+// DisableCapability disables the flag of the feature, and adds the feature if needed.
+func (c *ServerCapabilities) DisableCapability(feature string, flag string) *ServerCapabilities {
+	setCapability(c, feature, flag, false)
+	return c
+}
+
+// HasFeature reports whether the feature is supported, such as "tools".
+func (c *ServerCapabilities) HasFeature(feature string) bool {
+	return c != nil && hasFeature(c, feature)
+}
+
+// HasCapability reports whether the flag of the feature is enabled.
+func (c *ServerCapabilities) HasCapability(feature string, flag string) bool {
+	return c != nil && hasCapability(c, feature, flag)
+}
+
+// Merge adds the features and the flags enabled in other. The experimental capabilities are merged
+// recursively, and the values already set take precedence.
+func (c *ServerCapabilities) Merge(other *ServerCapabilities) *ServerCapabilities {
+	if other == nil {
+		return c
+	}
+
+	c.Experimental = mergeExperimental(c.Experimental, other.Experimental)
+	if other.Logging != nil && c.Logging == nil {
+		c.Logging = &LoggingCapability{}
+	}
+	if other.Completions != nil && c.Completions == nil {
+		c.Completions = &CompletionsCapability{}
+	}
+	if other.Prompts != nil {
+		if c.Prompts == nil {
+			c.Prompts = &PromptsCapability{}
+		}
+		c.Prompts.ListChanged = c.Prompts.ListChanged || other.Prompts.ListChanged
+	}
+	if other.Resources != nil {
+		if c.Resources == nil {
+			c.Resources = &ResourcesCapability{}
+		}
+		c.Resources.Subscribe = c.Resources.Subscribe || other.Resources.Subscribe
+		c.Resources.ListChanged = c.Resources.ListChanged || other.Resources.ListChanged
+	}
+	if other.Tools != nil {
+		if c.Tools == nil {
+			c.Tools = &ToolsCapability{}
+		}
+		c.Tools.ListChanged = c.Tools.ListChanged || other.Tools.ListChanged
+	}
+
+	return c
+}
+
+// Clone returns a deep copy of the capabilities. The copy of nil is empty.
+func (c *ServerCapabilities) Clone() *ServerCapabilities {
+	return (&ServerCapabilities{}).Merge(c)
+}
+
+// EnableCapability enables the flag of the feature, such as "listChanged" of "roots", and adds the feature if needed.
+// Non-standard features are set in Experimental. Unknown flags of the standard features are ignored.
+func (c *ClientCapabilities) EnableCapability(feature string, flag string) *ClientCapabilities {
+	setCapability(c, feature, flag, true)
+	return c
+}
+
+// DisableCapability disables the flag of the feature, and adds the feature if needed.
+func (c *ClientCapabilities) DisableCapability(feature string, flag string) *ClientCapabilities {
+	setCapability(c, feature, flag, false)
+	return c
+}
+
+// HasFeature reports whether the feature is supported, such as "sampling".
+func (c *ClientCapabilities) HasFeature(feature string) bool {
+	return c != nil && hasFeature(c, feature)
+}
+
+// HasCapability reports whether the flag of the feature is enabled.
+func (c *ClientCapabilities) HasCapability(feature string, flag string) bool {
+	return c != nil && hasCapability(c, feature, flag)
+}
+
+// Merge adds the features and the flags enabled in other. The experimental capabilities are merged
+// recursively, and the values already set take precedence.
+func (c *ClientCapabilities) Merge(other *ClientCapabilities) *ClientCapabilities {
+	if other == nil {
+		return c
+	}
+
+	c.Experimental = mergeExperimental(c.Experimental, other.Experimental)
+	if other.Roots != nil {
+		if c.Roots == nil {
+			c.Roots = &RootsCapability{}
+		}
+		c.Roots.ListChanged = c.Roots.ListChanged || other.Roots.ListChanged
+	}
+	if other.Sampling != nil && c.Sampling == nil {
+		c.Sampling = &SamplingCapability{}
+	}
+	if other.Elicitation != nil && c.Elicitation == nil {
+		c.Elicitation = &ElicitationCapability{}
+	}
+
+	return c
+}
+
+// Clone returns a deep copy of the capabilities. The copy of nil is empty.
+func (c *ClientCapabilities) Clone() *ClientCapabilities {
+	return (&ClientCapabilities{}).Merge(c)
+}
+
+// setCapability sets the flag of the feature, and adds the feature if needed. An empty flag only adds the feature.
+func setCapability(c capabilitySet, feature string, flag string, value bool) {
+	if flags, ok := c.feature(feature, true); ok {
+		if p := flags.flag(flag); p != nil {
+			*p = value
+		}
+		return
+	}
+
+	// Non-standard features are objects of flags in Experimental
+	experimental := c.experimental()
+	if *experimental == nil {
+		*experimental = make(map[string]json.RawMessage)
+	}
+
+	var flags map[string]json.RawMessage
+	json.Unmarshal((*experimental)[feature], &flags)
+	if flags == nil {
+		flags = make(map[string]json.RawMessage)
+	}
+	if flag != "" {
+		flags[flag], _ = json.Marshal(value)
+	}
+
+	(*experimental)[feature], _ = json.Marshal(flags)
+}
+
+func hasFeature(c capabilitySet, feature string) bool {
+	if flags, ok := c.feature(feature, false); ok {
+		return flags != nil
+	}
+
+	_, ok := (*c.experimental())[feature]
+	return ok
+}
+
+func hasCapability(c capabilitySet, feature string, flag string) bool {
+	if flags, ok := c.feature(feature, false); ok {
+		if flags == nil {
+			return false
+		}
+		p := flags.flag(flag)
+		return p != nil && *p
+	}
+
+	var flags map[string]json.RawMessage
+	err := json.Unmarshal((*c.experimental())[feature], &flags)
+	if err != nil {
+		return false
+	}
+
+	var enabled bool
+	json.Unmarshal(flags[flag], &enabled)
+	return enabled
+}
+
+// mergeExperimental adds the capabilities of src to dst, merging the JSON objects recursively.
+func mergeExperimental(dst, src map[string]json.RawMessage) map[string]json.RawMessage {
+	if len(src) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[string]json.RawMessage, len(src))
+	}
+
+	for k, v := range src {
+		if existing, ok := dst[k]; ok {
+			dst[k] = mergeJSON(existing, v)
+		} else {
+			dst[k] = v
+		}
+	}
+
+	return dst
+}
+
+// mergeJSON adds the fields of src to dst if both are objects. Otherwise dst is kept.
+func mergeJSON(dst, src json.RawMessage) json.RawMessage {
+	var dstFields, srcFields map[string]json.RawMessage
+	if json.Unmarshal(dst, &dstFields) != nil || json.Unmarshal(src, &srcFields) != nil || dstFields == nil || srcFields == nil {
+		return dst
+	}
+
+	merged, err := json.Marshal(mergeExperimental(dstFields, srcFields))
+	if err != nil {
+		return dst
+	}
+	return merged
+}
+
+// capabilityRequirement is the capability the receiver of a request must advertise to serve it:
+// a feature and, if not empty, a flag of the feature which must be enabled.
+type capabilityRequirement struct {
+	feature string
+	flag    string
+}
+
+func (r capabilityRequirement) String() string {
+	if r.flag == "" {
+		return r.feature
+	}
+	return r.feature + "." + r.flag
+}
+
+var requiredCapabilities = map[Method]capabilityRequirement{
+	// Served by servers
+	MethodListTools:           {feature: "tools"},
+	MethodCallTool:            {feature: "tools"},
+	MethodListResources:       {feature: "resources"},
+	MethodReadResource:        {feature: "resources"},
+	MethodSubscribeResource:   {feature: "resources", flag: "subscribe"},
+	MethodUnsubscribeResource: {feature: "resources", flag: "subscribe"},
+	MethodListPrompts:         {feature: "prompts"},
+	MethodGetPrompt:           {feature: "prompts"},
+	MethodSetLogLevel:         {feature: "logging"},
+
+	// Served by clients
+	MethodListRoots:           {feature: "roots"},
+	MethodCreateSampleMessage: {feature: "sampling"},
+	MethodCreateElicitation:   {feature: "elicitation"},
+}
+
+// checkMethod returns a *CapabilityError if the method requires a capability which is not advertised.
+// Methods which do not require any capability are always allowed.
+func (c *ServerCapabilities) checkMethod(method Method) error {
+	return checkMethod(c.HasFeature, c.HasCapability, method)
+}
+
+// checkMethod returns a *CapabilityError if the method requires a capability which is not advertised.
+// Methods which do not require any capability are always allowed.
+func (c *ClientCapabilities) checkMethod(method Method) error {
+	return checkMethod(c.HasFeature, c.HasCapability, method)
+}
+
+func checkMethod(hasFeature func(string) bool, hasCapability func(string, string) bool, method Method) error {
+	required, ok := requiredCapabilities[method]
+	if !ok {
+		return nil
+	}
+
+	if !hasFeature(required.feature) || (required.flag != "" && !hasCapability(required.feature, required.flag)) {
+		return &CapabilityError{Method: method, Capability: required.String()}
+	}
+
+	return nil
+}
@@ -1,11 +1,396 @@
 package mcp
 
 import (
+	"encoding/json"
+	"reflect"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+func TestServerCapabilities_EnableCapability(t *testing.T) {
+	tests := map[string]struct {
+		initial  *ServerCapabilities
+		feature  string
+		flag     string
+		expected *ServerCapabilities
+	}{
+		"enable capability on empty capabilities": {
+			initial:  &ServerCapabilities{},
+			feature:  "tools",
+			flag:     "listChanged",
+			expected: &ServerCapabilities{Tools: &ToolsCapability{ListChanged: true}},
+		},
+		"enable capability on existing feature": {
+			initial:  &ServerCapabilities{Resources: &ResourcesCapability{Subscribe: true}},
+			feature:  "resources",
+			flag:     "listChanged",
+			expected: &ServerCapabilities{Resources: &ResourcesCapability{Subscribe: true, ListChanged: true}},
+		},
+		"enable feature without flags": {
+			initial:  &ServerCapabilities{},
+			feature:  "logging",
+			expected: &ServerCapabilities{Logging: &LoggingCapability{}},
+		},
+		"enable experimental capability": {
+			initial:  &ServerCapabilities{},
+			feature:  "feature1",
+			flag:     "method1",
+			expected: &ServerCapabilities{Experimental: map[string]json.RawMessage{"feature1": json.RawMessage(`{"method1":true}`)}},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			result := tc.initial.EnableCapability(tc.feature, tc.flag)
+
+			assert.Same(t, tc.initial, result, "EnableCapability should return the receiver")
+			assert.Equal(t, tc.expected, result, "Capabilities after EnableCapability should match expected")
+		})
+	}
+}
+
+func TestServerCapabilities_DisableCapability(t *testing.T) {
+	tests := map[string]struct {
+		initial  *ServerCapabilities
+		feature  string
+		flag     string
+		expected *ServerCapabilities
+	}{
+		"disable capability on empty capabilities": {
+			initial:  &ServerCapabilities{},
+			feature:  "tools",
+			flag:     "listChanged",
+			expected: &ServerCapabilities{Tools: &ToolsCapability{}},
+		},
+		"disable capability on existing feature": {
+			initial:  &ServerCapabilities{Resources: &ResourcesCapability{Subscribe: true, ListChanged: true}},
+			feature:  "resources",
+			flag:     "subscribe",
+			expected: &ServerCapabilities{Resources: &ResourcesCapability{ListChanged: true}},
+		},
+		"disable experimental capability": {
+			initial:  &ServerCapabilities{Experimental: map[string]json.RawMessage{"feature1": json.RawMessage(`{"method1":true,"method2":true}`)}},
+			feature:  "feature1",
+			flag:     "method1",
+			expected: &ServerCapabilities{Experimental: map[string]json.RawMessage{"feature1": json.RawMessage(`{"method1":false,"method2":true}`)}},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			result := tc.initial.DisableCapability(tc.feature, tc.flag)
+
+			assert.Same(t, tc.initial, result, "DisableCapability should return the receiver")
+			assert.Equal(t, tc.expected, result, "Capabilities after DisableCapability should match expected")
+		})
+	}
+}
+
+func TestServerCapabilities_Merge(t *testing.T) {
+	tests := map[string]struct {
+		initial  *ServerCapabilities
+		other    *ServerCapabilities
+		expected *ServerCapabilities
+	}{
+		"merge with nil": {
+			initial:  &ServerCapabilities{Tools: &ToolsCapability{}},
+			other:    nil,
+			expected: &ServerCapabilities{Tools: &ToolsCapability{}},
+		},
+		"merge with different features": {
+			initial:  &ServerCapabilities{Tools: &ToolsCapability{}},
+			other:    &ServerCapabilities{Prompts: &PromptsCapability{ListChanged: true}, Logging: &LoggingCapability{}},
+			expected: &ServerCapabilities{Tools: &ToolsCapability{}, Prompts: &PromptsCapability{ListChanged: true}, Logging: &LoggingCapability{}},
+		},
+		"merge with overlapping features merges the flags": {
+			initial:  &ServerCapabilities{Resources: &ResourcesCapability{Subscribe: true}},
+			other:    &ServerCapabilities{Resources: &ResourcesCapability{ListChanged: true}},
+			expected: &ServerCapabilities{Resources: &ResourcesCapability{Subscribe: true, ListChanged: true}},
+		},
+		"merge experimental capabilities recursively (initial takes precedence)": {
+			initial: &ServerCapabilities{Experimental: map[string]json.RawMessage{
+				"feature1": json.RawMessage(`{"a":1,"nested":{"b":true}}`),
+			}},
+			other: &ServerCapabilities{Experimental: map[string]json.RawMessage{
+				"feature1": json.RawMessage(`{"a":2,"nested":{"c":"x"}}`),
+				"feature2": json.RawMessage(`"value"`),
+			}},
+			expected: &ServerCapabilities{Experimental: map[string]json.RawMessage{
+				"feature1": json.RawMessage(`{"a":1,"nested":{"b":true,"c":"x"}}`),
+				"feature2": json.RawMessage(`"value"`),
+			}},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			result := tc.initial.Merge(tc.other)
+
+			assert.Same(t, tc.initial, result, "Merge should return the receiver")
+			assert.Equal(t, tc.expected, result, "Capabilities after Merge should match expected")
+		})
+	}
+}
+
+func TestServerCapabilities_Clone(t *testing.T) {
+	original := &ServerCapabilities{
+		Tools:        &ToolsCapability{ListChanged: true},
+		Experimental: map[string]json.RawMessage{"feature1": json.RawMessage(`{}`)},
+	}
+
+	clone := original.Clone()
+	require.Equal(t, original, clone)
+
+	clone.Tools.ListChanged = false
+	clone.EnableCapability("feature2", "method1")
+	assert.True(t, original.Tools.ListChanged, "the original should not be modified")
+	assert.NotContains(t, original.Experimental, "feature2", "the original should not be modified")
+
+	assert.Equal(t, &ServerCapabilities{}, (*ServerCapabilities)(nil).Clone())
+}
+
+func TestServerCapabilities_HasFeature(t *testing.T) {
+	tests := map[string]struct {
+		caps     *ServerCapabilities
+		feature  string
+		expected bool
+	}{
+		"nil capabilities": {
+			caps:     nil,
+			feature:  "tools",
+			expected: false,
+		},
+		"feature exists": {
+			caps:     &ServerCapabilities{Tools: &ToolsCapability{}},
+			feature:  "tools",
+			expected: true,
+		},
+		"feature doesn't exist": {
+			caps:     &ServerCapabilities{Tools: &ToolsCapability{}},
+			feature:  "prompts",
+			expected: false,
+		},
+		"experimental feature exists": {
+			caps:     &ServerCapabilities{Experimental: map[string]json.RawMessage{"feature1": json.RawMessage(`{}`)}},
+			feature:  "feature1",
+			expected: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.expected, tc.caps.HasFeature(tc.feature), "HasFeature result should match expected")
+		})
+	}
+}
+
+func TestServerCapabilities_HasCapability(t *testing.T) {
+	tests := map[string]struct {
+		caps     *ServerCapabilities
+		feature  string
+		flag     string
+		expected bool
+	}{
+		"empty capabilities": {
+			caps:     &ServerCapabilities{},
+			feature:  "tools",
+			flag:     "listChanged",
+			expected: false,
+		},
+		"feature exists but flag is disabled": {
+			caps:     &ServerCapabilities{Resources: &ResourcesCapability{ListChanged: true}},
+			feature:  "resources",
+			flag:     "subscribe",
+			expected: false,
+		},
+		"capability is enabled": {
+			caps:     &ServerCapabilities{Resources: &ResourcesCapability{Subscribe: true}},
+			feature:  "resources",
+			flag:     "subscribe",
+			expected: true,
+		},
+		"unknown flag": {
+			caps:     &ServerCapabilities{Tools: &ToolsCapability{ListChanged: true}},
+			feature:  "tools",
+			flag:     "unknown",
+			expected: false,
+		},
+		"experimental capability is enabled": {
+			caps:     &ServerCapabilities{Experimental: map[string]json.RawMessage{"feature1": json.RawMessage(`{"method1":true}`)}},
+			feature:  "feature1",
+			flag:     "method1",
+			expected: true,
+		},
+		"experimental capability is not a boolean": {
+			caps:     &ServerCapabilities{Experimental: map[string]json.RawMessage{"feature1": json.RawMessage(`{"method1":{"x":1}}`)}},
+			feature:  "feature1",
+			flag:     "method1",
+			expected: false,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.expected, tc.caps.HasCapability(tc.feature, tc.flag), "HasCapability result should match expected")
+		})
+	}
+}
+
+func TestClientCapabilities_Merge(t *testing.T) {
+	c := &ClientCapabilities{Roots: &RootsCapability{}}
+	c.Merge(&ClientCapabilities{
+		Roots:        &RootsCapability{ListChanged: true},
+		Sampling:     &SamplingCapability{},
+		Experimental: map[string]json.RawMessage{"feature1": json.RawMessage(`{"method1":true}`)},
+	})
+
+	assert.Equal(t, &ClientCapabilities{
+		Roots:        &RootsCapability{ListChanged: true},
+		Sampling:     &SamplingCapability{},
+		Experimental: map[string]json.RawMessage{"feature1": json.RawMessage(`{"method1":true}`)},
+	}, c)
+	assert.True(t, c.HasCapability("roots", "listChanged"))
+	assert.True(t, c.HasCapability("feature1", "method1"))
+	assert.False(t, c.HasFeature("elicitation"))
+}
+
+func TestCapabilities_JSON(t *testing.T) {
+	tests := map[string]struct {
+		caps any
+		json string
+	}{
+		"absent features are omitted": {
+			caps: &ServerCapabilities{},
+			json: `{}`,
+		},
+		"features without flags are empty objects": {
+			caps: &ClientCapabilities{Sampling: &SamplingCapability{}},
+			json: `{"sampling": {}}`,
+		},
+		"server capabilities": {
+			caps: &ServerCapabilities{
+				Logging:   &LoggingCapability{},
+				Prompts:   &PromptsCapability{ListChanged: true},
+				Resources: &ResourcesCapability{Subscribe: true, ListChanged: true},
+				Tools:     &ToolsCapability{},
+				Experimental: map[string]json.RawMessage{
+					"streaming": json.RawMessage(`{"maxChunkSize": 1024}`),
+				},
+			},
+			json: `{
+				"experimental": {"streaming": {"maxChunkSize": 1024}},
+				"logging": {},
+				"prompts": {"listChanged": true},
+				"resources": {"subscribe": true, "listChanged": true},
+				"tools": {}
+			}`,
+		},
+		"client capabilities": {
+			caps: &ClientCapabilities{
+				Roots:    &RootsCapability{ListChanged: true},
+				Sampling: &SamplingCapability{},
+			},
+			json: `{"roots": {"listChanged": true}, "sampling": {}}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			data, err := json.Marshal(tc.caps)
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.json, string(data), "JSON should match the specification")
+
+			// Decoding gives the same capabilities
+			decoded := reflect.New(reflect.TypeOf(tc.caps).Elem()).Interface()
+			require.NoError(t, json.Unmarshal([]byte(tc.json), decoded))
+			redata, err := json.Marshal(decoded)
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.json, string(redata))
+		})
+	}
+}
+
+func TestCapabilities_checkMethod(t *testing.T) {
+	tests := map[string]struct {
+		caps           *ServerCapabilities
+		method         Method
+		wantCapability string
+	}{
+		"method of an advertised feature": {
+			caps:   &ServerCapabilities{Tools: &ToolsCapability{}},
+			method: MethodCallTool,
+		},
+		"method of a feature which is not advertised": {
+			caps:           &ServerCapabilities{Tools: &ToolsCapability{}},
+			method:         MethodListPrompts,
+			wantCapability: "prompts",
+		},
+		"method of an enabled flag": {
+			caps:   &ServerCapabilities{Resources: &ResourcesCapability{Subscribe: true}},
+			method: MethodSubscribeResource,
+		},
+		"method of a disabled flag": {
+			caps:           &ServerCapabilities{Resources: &ResourcesCapability{}},
+			method:         MethodSubscribeResource,
+			wantCapability: "resources.subscribe",
+		},
+		"method without capability": {
+			caps:   &ServerCapabilities{},
+			method: "ping",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tc.caps.checkMethod(tc.method)
+			if tc.wantCapability == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.ErrorIs(t, err, ErrCapabilityNotSupported)
+			var capErr *CapabilityError
+			if assert.ErrorAs(t, err, &capErr) {
+				assert.Equal(t, tc.method, capErr.Method)
+				assert.Equal(t, tc.wantCapability, capErr.Capability)
+			}
+		})
+	}
+}
+
+func TestCapabilities_Convert(t *testing.T) {
+	c := Capabilities{
+		"tools":     {"listChanged": true},
+		"resources": {"subscribe": false},
+		"roots":     {"listChanged": true},
+		"streaming": {"chunked": true},
+	}
+
+	server := c.ServerCapabilities()
+	assert.Equal(t, &ToolsCapability{ListChanged: true}, server.Tools)
+	assert.Equal(t, &ResourcesCapability{}, server.Resources)
+	assert.True(t, server.HasCapability("streaming", "chunked"))
+
+	client := c.ClientCapabilities()
+	assert.Equal(t, &RootsCapability{ListChanged: true}, client.Roots)
+}
+
 func TestCapabilities_EnableCapability(t *testing.T) {
 	tests := map[string]struct {
 		initial  Capabilities
@@ -108,8 +493,9 @@ func TestCapabilities_DisableCapability(t *testing.T) {
 
 			result := c.DisableCapability(tc.feature, tc.method)
 
-			// Verify the result is the same instance (method returns the receiver)
-			assert.Same(t, c, result, "DisableCapability should return the receiver")
+			// Verify the result is the same instance (method returns the receiver).
+			// Maps are not pointers, so their identity is compared
+			assert.Equal(t, reflect.ValueOf(c).UnsafePointer(), reflect.ValueOf(result).UnsafePointer(), "DisableCapability should return the receiver")
 
 			// Verify all expected features and methods
 			assert.Equal(t, tc.expected, result, "Capabilities after DisableCapability should match expected")
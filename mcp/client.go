@@ -4,9 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"os/exec"
+	"fmt"
+	"net/http"
+	"slices"
 	"sync"
+	"time"
 
+	"github.com/coder/websocket"
 	"golang.org/x/exp/slog"
 )
 
@@ -17,15 +21,23 @@ type Client struct {
 	// Version is the client version of your application
 	Version string
 
-	AdditionalClientInfo   map[string]any
+	AdditionalClientInfo map[string]any
+	// AdditionalClientCapabilities are merged with the capabilities derived from the handler
+	AdditionalClientCapabilities *ClientCapabilities
+	// Deprecated: Use AdditionalClientCapabilities.
 	AdditionalCapabilities Capabilities
 
 	RootsChangedNotification bool
 
+	// RequestTimeout is the default timeout for requests sent to servers.
+	// It applies to requests whose context has no deadline. Zero means no timeout.
+	RequestTimeout time.Duration
+
 	Handler ClientHandler
 
-	sessionIDs map[string]int
-	sessions   []*clientSession
+	// Sessions which are not done, dialed concurrently and by reconnecting sessions in the background
+	sessions     []*clientSession
+	sessionsLock sync.Mutex
 
 	closed bool
 	// closedErr error
@@ -45,7 +57,6 @@ func NewClient(name, version string) *Client {
 
 func (c *Client) init() {
 	c.initOnce.Do(func() {
-		c.sessionIDs = make(map[string]int)
 		c.sessions = make([]*clientSession, 0)
 		c.initialized = true
 	})
@@ -61,48 +72,120 @@ func (c *Client) DialWithContext(ctx context.Context, t Transport) (ClientSessio
 }
 
 func (c *Client) DialStdio(command string, args ...string) (ClientSession, error) {
-	cmd := exec.Command(command, args...)
+	return c.DialStdioCommand(&StdioCommand{Path: command, Args: args})
+}
 
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		return nil, err
+// DialStdioCommand starts the server process and connects to it over its standard input and output.
+// Closing the session terminates the process, and the session ends with the exit status of the process
+// as its error if it exits on its own, unless command.Restart is set.
+func (c *Client) DialStdioCommand(command *StdioCommand) (ClientSession, error) {
+	dial := func(ctx context.Context) (ClientSession, error) {
+		transport, err := startProcess(command)
+		if err != nil {
+			return nil, err
+		}
+
+		sess, err := c.Dial(transport)
+		if err != nil {
+			transport.CloseWithError(err)
+			return nil, err
+		}
+
+		return sess, nil
 	}
 
-	stdout, err := cmd.StdoutPipe()
+	if command.Restart == nil {
+		return dial(context.Background())
+	}
+
+	return NewReconnectingSession(context.Background(), dial, command.Restart)
+}
+
+// DialHTTP connects to a server over the Streamable HTTP transport.
+// If the server answers the initialization with 400 Bad Request, 404 Not Found or 405 Method Not Allowed,
+// it is assumed to support only the HTTP+SSE transport of the protocol version 2024-11-05,
+// and DialSSE is tried on the same URL. Other errors, such as 401 Unauthorized, are returned.
+func (c *Client) DialHTTP(url string, config *HTTPConfig) (ClientSession, error) {
+	transport := newClientHTTPTransport(url, config)
+
+	sess, err := c.Dial(transport)
 	if err != nil {
+		transport.Close()
+
+		var statusErr *httpStatusError
+		if errors.As(err, &statusErr) && isLegacyStatus(statusErr.StatusCode) {
+			slog.Info("falling back to the HTTP+SSE transport", "url", url, "status_code", statusErr.StatusCode)
+			return c.DialSSE(url, config)
+		}
 		return nil, err
 	}
 
-	err = cmd.Start()
+	return sess, nil
+}
+
+// isLegacyStatus reports whether the status code answering the initialization over Streamable HTTP
+// means that the server may only support the HTTP+SSE transport.
+func isLegacyStatus(code int) bool {
+	switch code {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusMethodNotAllowed:
+		return true
+	}
+	return false
+}
+
+// DialSSE connects to a server over the HTTP+SSE transport of the protocol version 2024-11-05.
+// url is the endpoint of the SSE stream.
+func (c *Client) DialSSE(url string, config *HTTPConfig) (ClientSession, error) {
+	transport := newClientSSETransport(url, config)
+
+	sess, err := c.Dial(transport)
 	if err != nil {
-		slog.Error("failed to start command", "error", err)
+		transport.Close()
 		return nil, err
 	}
 
-	go func() {
-		err := cmd.Wait()
-		if err != nil {
-			slog.Error("command exited with error", "error", err)
+	return sess, nil
+}
+
+// DialWebSocket connects to a server over the WebSocket transport.
+// url is the endpoint of the server, with the ws or wss scheme.
+func (c *Client) DialWebSocket(url string, config *WebSocketConfig) (ClientSession, error) {
+	opts := &websocket.DialOptions{
+		Subprotocols: []string{WebSocketSubprotocol},
+	}
+	if config != nil {
+		opts.HTTPHeader = config.Headers
+		if config.Transport != nil {
+			opts.HTTPClient = &http.Client{Transport: config.Transport}
 		}
-	}()
+	}
 
-	return c.Dial(NewStreamTransport(stdin, stdout))
-}
+	conn, _, err := websocket.Dial(context.Background(), url, opts)
+	if err != nil {
+		return nil, err
+	}
 
-func (c *Client) DialHTTP(url string, config *HTTPConfig) (ClientSession, error) {
-	transport := newClientHTTPTransport(url, config)
+	if conn.Subprotocol() != WebSocketSubprotocol {
+		conn.Close(websocket.StatusPolicyViolation, WebSocketSubprotocol+" subprotocol is required")
+		return nil, fmt.Errorf("server did not negotiate the %s subprotocol", WebSocketSubprotocol)
+	}
+
+	transport := newWebSocketTransport(conn, config)
 
-	// Set session ID
-	key := SessionID("sessionID")
-	ctx := context.WithValue(context.Background(), key, config.SessionID)
+	sess, err := c.Dial(transport)
+	if err != nil {
+		transport.Close()
+		return nil, err
+	}
 
-	return c.DialWithContext(ctx, transport)
+	return sess, nil
 }
 
 func (c *Client) dial(ctx context.Context, t Transport) (*clientSession, error) {
+	advertised := c.capabilities()
 	params := map[string]any{
 		"protocolVersion": DefaultVersion,
-		"capabilities":    c.capabilities(),
+		"capabilities":    advertised,
 		"clientInfo":      c.info(),
 	}
 
@@ -115,8 +198,18 @@ func (c *Client) dial(ctx context.Context, t Transport) (*clientSession, error)
 		Params: Params(paramsJSON),
 	}
 
-	r, err := t.RequestSync(ctx, req)
+	initCtx := ctx
+	if _, ok := ctx.Deadline(); !ok && c.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		initCtx, cancel = context.WithTimeout(ctx, c.RequestTimeout)
+		defer cancel()
+	}
+
+	r, err := t.RequestSync(initCtx, req)
 	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, &TimeoutError{Method: MethodInit, After: c.RequestTimeout}
+		}
 		return nil, err
 	}
 
@@ -130,49 +223,81 @@ func (c *Client) dial(ctx context.Context, t Transport) (*clientSession, error)
 		return nil, err
 	}
 
-	if Version(resultMapping["protocolVersion"]) != DefaultVersion {
-		return nil, errors.New("protocol version mismatch")
+	var version Version
+	err = json.Unmarshal(resultMapping["protocolVersion"], &version)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isSupportedVersion(version) {
+		return nil, fmt.Errorf("unsupported protocol version: %s", version)
 	}
 
-	var capabilities Capabilities
+	var capabilities ServerCapabilities
 	err = json.Unmarshal(resultMapping["capabilities"], &capabilities)
 	if err != nil {
 		return nil, err
 	}
 
-	// TODO: Handle server serverInfo
-	var serverInfo map[string]any
+	var serverInfo Implementation
 	err = json.Unmarshal(resultMapping["serverInfo"], &serverInfo)
 	if err != nil {
 		return nil, err
 	}
 
+	// Instructions are optional
+	var instructions string
+	if raw, ok := resultMapping["instructions"]; ok {
+		err = json.Unmarshal(raw, &instructions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Tell the server that the client is ready for normal operations
+	err = t.Notify(&Notification{Method: MethodNotifyInitialized})
+	if err != nil {
+		return nil, err
+	}
+
 	// Listen requests and handle them
 	ctx, cancel := context.WithCancel(ctx)
-	go c.handleRequests(ctx, t)
+	go c.handleRequests(ctx, t, advertised)
 
 	sess := &clientSession{
 		transport:            t,
-		serverCapabilities:   capabilities,
+		protocolVersion:      version,
+		serverCapabilities:   &capabilities,
 		serverInfo:           serverInfo,
+		instructions:         instructions,
 		subscribingResources: make(map[string]chan *Notification),
+		requestTimeout:       c.RequestTimeout,
 		cancelFunc:           cancel,
 	}
 
-	c.sessions = append(c.sessions, sess)
+	go sess.handleNotifications(ctx)
 
-	if v := ctx.Value("sessionID"); v != nil {
-		sessionID, ok := v.(string)
-		if !ok {
-			return nil, errors.New("sessionID is not string")
-		}
-		c.sessionIDs[sessionID] = len(c.sessions) - 1
-	}
+	c.addSession(sess)
 
 	return sess, nil
 }
 
-func (c *Client) handleRequests(ctx context.Context, t Transport) {
+// addSession keeps the session until it is done, so that Close closes it.
+func (c *Client) addSession(sess *clientSession) {
+	c.sessionsLock.Lock()
+	c.sessions = append(c.sessions, sess)
+	c.sessionsLock.Unlock()
+
+	go func() {
+		<-sess.Done()
+
+		c.sessionsLock.Lock()
+		defer c.sessionsLock.Unlock()
+		c.sessions = slices.DeleteFunc(c.sessions, func(s *clientSession) bool { return s == sess })
+	}()
+}
+
+func (c *Client) handleRequests(ctx context.Context, t Transport, capabilities *ClientCapabilities) {
 	// TODO: Implement
 	for {
 		req, w, err := t.AcceptRequest(ctx)
@@ -180,40 +305,95 @@ func (c *Client) handleRequests(ctx context.Context, t Transport) {
 			return
 		}
 
+		// Methods of capabilities which were not advertised are unknown to the server
+		if capabilities.checkMethod(req.Method) != nil {
+			w.CloseWithError(ErrMethodNotFound.Code, ErrMethodNotFound.Message, nil)
+			continue
+		}
+
 		switch req.Method {
 		case MethodCreateSampleMessage:
-			c.Handler.ServeSample(newContentsWriter(w), "", nil)
+			c.handler().ServeSample(newContentsWriter(ctx, w), "", nil)
+		case MethodCreateElicitation:
+			eh, ok := c.handler().(ElicitationHandler)
+			if !ok {
+				w.CloseWithError(ErrMethodNotFound.Code, ErrMethodNotFound.Message, nil)
+				continue
+			}
+
+			var params ElicitationRequest
+			err := json.Unmarshal(req.Params, &params)
+			if err != nil || params.RequestedSchema == nil {
+				w.CloseWithError(ErrInvalidParams.Code, ErrInvalidParams.Message, nil)
+				continue
+			}
+
+			// The user may take a while to answer, so other requests are not held up
+			go func() {
+				ew := newElicitationWriter(ctx, w)
+				defer ew.finish()
+
+				eh.ServeElicitation(ew, &params)
+			}()
+		case MethodListRoots:
+			roots := c.handler().ListRoots()
+			if roots == nil {
+				roots = []*RootDefinition{}
+			}
+
+			result, err := json.Marshal(map[string]any{"roots": roots})
+			if err != nil {
+				w.CloseWithError(ErrInternalError.Code, ErrInternalError.Message, nil)
+				continue
+			}
+			w.WriteResult(result)
 		case MethodNotifyRootChanged:
-			c.Handler.ServeRootsChanged(t)
+			c.handler().ServeRootsChanged(t)
+		default:
+			w.CloseWithError(ErrMethodNotFound.Code, ErrMethodNotFound.Message, nil)
 		}
 	}
 }
 
 func (c *Client) Close() error {
+	c.sessionsLock.Lock()
+	sessions := slices.Clone(c.sessions)
+	c.closed = true
+	c.sessionsLock.Unlock()
+
 	// Close all sessions
-	for _, session := range c.sessions {
+	for _, session := range sessions {
 		session.Close()
 	}
 
-	c.closed = true
-
 	return nil
 }
 
-func (c *Client) capabilities() Capabilities {
-	capabilities := c.AdditionalCapabilities
-	if capabilities == nil {
-		capabilities = make(Capabilities)
+func (c *Client) capabilities() *ClientCapabilities {
+	capabilities := c.AdditionalClientCapabilities.Clone()
+	capabilities.Merge(c.AdditionalCapabilities.ClientCapabilities())
+
+	// Elicitation is advertised when the handler serves it
+	switch h := c.handler().(type) {
+	case interface{ Capabilities() *ClientCapabilities }:
+		capabilities.Merge(h.Capabilities())
+	case ElicitationHandler:
+		capabilities.Merge(&ClientCapabilities{Elicitation: &ElicitationCapability{}})
 	}
 
-	capabilities.Merge(map[string]map[string]bool{
-		"roots": {
-			"listChanged": c.RootsChangedNotification,
+	return capabilities.Merge(&ClientCapabilities{
+		Roots: &RootsCapability{
+			ListChanged: c.RootsChangedNotification,
 		},
-		"sampling": {},
+		Sampling: &SamplingCapability{},
 	})
+}
 
-	return capabilities
+func (c *Client) handler() ClientHandler {
+	if c.Handler == nil {
+		return DefaultClientMux
+	}
+	return c.Handler
 }
 
 func (c *Client) info() map[string]any {
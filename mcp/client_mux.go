@@ -1,5 +1,7 @@
 package mcp
 
+import "sync"
+
 var DefaultClientMux *ClientMux = defaultClientMux
 
 var defaultClientMux = NewClientMux()
@@ -19,6 +21,14 @@ func HandleSampleFunc(sample *SampleDefinition, handler SampleHandlerFunc) {
 	defaultClientMux.HandleSample(sample, handler)
 }
 
+func HandleElicitation(handler ElicitationHandler) {
+	defaultClientMux.HandleElicitation(handler)
+}
+
+func HandleElicitationFunc(handler ElicitationHandlerFunc) {
+	defaultClientMux.HandleElicitation(handler)
+}
+
 func HandleRoot(root *RootDefinition) {
 	defaultClientMux.HandleRoot(root)
 }
@@ -28,12 +38,48 @@ var _ ClientHandler = (*ClientMux)(nil)
 type ClientMux struct {
 	rootMux   *rootMux
 	sampleMux *sampleMux
+
+	elicitationMu      sync.Mutex
+	elicitationHandler ElicitationHandler
 }
 
 func (m *ClientMux) HandleSample(sample *SampleDefinition, handler SampleHandler) {
 	m.sampleMux.registerSampleHandler(sample.Clone(), handler)
 }
 
+// HandleElicitation registers the handler asking the user for the data requested by servers.
+// The client advertises the elicitation capability once a handler is registered.
+func (m *ClientMux) HandleElicitation(handler ElicitationHandler) {
+	m.elicitationMu.Lock()
+	defer m.elicitationMu.Unlock()
+
+	m.elicitationHandler = handler
+}
+
+// Capabilities returns the features for which handlers are registered, such as "elicitation".
+func (m *ClientMux) Capabilities() *ClientCapabilities {
+	m.elicitationMu.Lock()
+	defer m.elicitationMu.Unlock()
+
+	capabilities := &ClientCapabilities{}
+	if m.elicitationHandler != nil {
+		capabilities.Elicitation = &ElicitationCapability{}
+	}
+	return capabilities
+}
+
+// ElicitationHandler implementation
+func (m *ClientMux) ServeElicitation(w ElicitationWriter, req *ElicitationRequest) {
+	m.elicitationMu.Lock()
+	handler := m.elicitationHandler
+	m.elicitationMu.Unlock()
+
+	if handler == nil {
+		handler = ElicitationNotSupportedHandler
+	}
+	handler.ServeElicitation(w, req)
+}
+
 func (m *ClientMux) HandleRoot(root *RootDefinition) {
 	m.rootMux.registerRoot(root.Clone())
 }
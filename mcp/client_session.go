@@ -3,23 +3,49 @@ package mcp
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"sync"
+	"time"
 )
 
 type ClientSession interface {
 	Close() error
 	Shutdown() error
 
+	// Done returns a channel which is closed when the session is terminated.
+	Done() <-chan struct{}
+	// Err returns the cause of the termination after Done is closed, such as io.EOF.
+	Err() error
+
+	// ServerInfo returns the name and the version of the server, as sent in the initialization.
+	ServerInfo() Implementation
+	// ServerCapabilities returns the capabilities advertised by the server.
+	ServerCapabilities() *ServerCapabilities
+	// Instructions returns the instructions of the server on how to use it, or an empty string.
+	Instructions() string
+	// ProtocolVersion returns the version of the protocol negotiated with the server.
+	ProtocolVersion() Version
+
 	///
-	ListTools(ctx context.Context) ([]*ToolDefinition, error)
-	CallTool(ctx context.Context, tool *ToolDefinition, args map[string]any) ([]Content, error)
+	ListTools(ctx context.Context) (*ListToolsResult, error)
+	CallTool(ctx context.Context, tool *ToolDefinition, args map[string]any) (*CallToolResult, error)
 
-	ListResources(ctx context.Context) ([]*ResourceDefinition, error)
-	ReadResource(ctx context.Context, resource *ResourceDefinition) ([]Content, error)
+	ListResources(ctx context.Context) (*ListResourcesResult, error)
+	ReadResource(ctx context.Context, resource *ResourceDefinition) (*ReadResourceResult, error)
 	SubscribeResource(resource *ResourceDefinition) (<-chan *Notification, error)
 
-	ListPrompts(ctx context.Context) ([]*PromptDefinition, error)
-	GetPrompt(ctx context.Context, prompt *PromptDefinition, args map[string]any) ([]Content, error)
+	ListPrompts(ctx context.Context) (*ListPromptsResult, error)
+	GetPrompt(ctx context.Context, prompt *PromptDefinition, args map[string]any) (*GetPromptResult, error)
+
+	// ListChanged returns a channel receiving the method of the list_changed notifications of the server,
+	// such as MethodNotifyToolChanged. Notifications are dropped if the channel is not read in time.
+	// The channel is closed when the session ends.
+	ListChanged() <-chan Method
+
+	// Batch sends the requests to the server in a single JSON-RPC batch and waits for all of their results.
+	// The results are returned in the same order as the requests, each with its own error.
+	// The returned error is only set when the batch itself could not be sent.
+	Batch(ctx context.Context, reqs ...*Request) ([]BatchResult, error)
 }
 
 var _ ClientSession = (*clientSession)(nil)
@@ -27,12 +53,19 @@ var _ ClientSession = (*clientSession)(nil)
 type clientSession struct {
 	transport Transport
 
-	serverCapabilities Capabilities
-	serverInfo         map[string]any
+	protocolVersion    Version
+	serverCapabilities *ServerCapabilities
+	serverInfo         Implementation
+	instructions       string
 
 	subscribingResources     map[string]chan *Notification
 	subscribingResourcesLock sync.Mutex
 
+	listChanged listChangedListeners
+
+	// requestTimeout is applied to requests whose context has no deadline
+	requestTimeout time.Duration
+
 	cancelFunc context.CancelFunc
 }
 
@@ -42,121 +75,169 @@ func (s *clientSession) Close() error {
 	return nil
 }
 
-func (s *clientSession) Shutdown() error {
-	// TODO: Implement
-	return nil
+func (s *clientSession) Done() <-chan struct{} {
+	return s.transport.Done()
 }
 
-func (cs *clientSession) ListTools(ctx context.Context) ([]*ToolDefinition, error) {
-	req := &Request{
-		Method: MethodListTools,
-	}
-	rsp, err := cs.transport.Request(req)
-	if err != nil {
-		return nil, err
-	}
+func (s *clientSession) Err() error {
+	return s.transport.Err()
+}
 
-	result, err := rsp.ReadResult()
-	if err != nil {
-		return nil, err
+// handleNotifications delivers the notifications of the server until the session ends.
+func (cs *clientSession) handleNotifications(ctx context.Context) {
+	defer cs.listChanged.close()
+
+	for {
+		notif, err := cs.transport.AcceptNotification(ctx)
+		if err != nil {
+			return
+		}
+
+		switch {
+		case isListChanged(notif.Method):
+			cs.listChanged.notify(notif.Method)
+		case notif.Method == MethodNotifyResourceUpdated:
+			var params struct {
+				URI string `json:"uri"`
+			}
+			err := json.Unmarshal(notif.Params, &params)
+			if err != nil {
+				continue
+			}
+
+			cs.subscribingResourcesLock.Lock()
+			ch, ok := cs.subscribingResources[params.URI]
+			cs.subscribingResourcesLock.Unlock()
+			if !ok {
+				continue
+			}
+
+			select {
+			case ch <- notif:
+			case <-ctx.Done():
+				return
+			}
+		}
 	}
+}
 
-	var tools []*ToolDefinition
-	err = json.Unmarshal(result, &tools)
-	if err != nil {
-		return nil, err
-	}
+func (cs *clientSession) ListChanged() <-chan Method {
+	return cs.listChanged.add()
+}
 
-	return tools, nil
+func (s *clientSession) ServerInfo() Implementation {
+	return s.serverInfo
 }
 
-func (cs *clientSession) CallTool(ctx context.Context, tool *ToolDefinition, args map[string]any) ([]Content, error) {
-	// Convert args to JSON
-	v := map[string]any{
-		"name":      tool.Name,
-		"arguments": args,
-	}
-	paramsJSON, err := json.Marshal(v)
-	if err != nil {
-		return nil, err
+func (s *clientSession) ServerCapabilities() *ServerCapabilities {
+	return s.serverCapabilities
+}
+
+func (s *clientSession) Instructions() string {
+	return s.instructions
+}
+
+func (s *clientSession) ProtocolVersion() Version {
+	return s.protocolVersion
+}
+
+func (s *clientSession) Shutdown() error {
+	// TODO: Implement
+	return nil
+}
+
+func (cs *clientSession) request(ctx context.Context, req *Request) (Result, error) {
+	return sendRequest(ctx, cs.transport, req, cs.requestTimeout)
+}
+
+func (cs *clientSession) Batch(ctx context.Context, reqs ...*Request) ([]BatchResult, error) {
+	if len(reqs) == 0 {
+		return sendBatch(ctx, cs.transport, reqs, cs.requestTimeout)
 	}
 
-	req := &Request{
-		Method: MethodCallTool,
-		Params: Params(paramsJSON),
+	// Requests the server cannot serve are not sent, and fail as they would alone
+	results := make([]BatchResult, len(reqs))
+	sent := make([]*Request, 0, len(reqs))
+	indexes := make([]int, 0, len(reqs))
+	for i, req := range reqs {
+		err := cs.serverCapabilities.checkMethod(req.Method)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		sent = append(sent, req)
+		indexes = append(indexes, i)
 	}
-	rsp, err := cs.transport.Request(req)
-	if err != nil {
-		return nil, err
+	if len(sent) == 0 {
+		return results, nil
 	}
 
-	result, err := rsp.ReadResult()
+	sentResults, err := sendBatch(ctx, cs.transport, sent, cs.requestTimeout)
 	if err != nil {
 		return nil, err
 	}
+	for j, i := range indexes {
+		results[i] = sentResults[j]
+	}
 
-	var contents []Content
+	return results, nil
+}
 
-	err = unmarshalContents(result, &contents)
+func (cs *clientSession) ListTools(ctx context.Context) (*ListToolsResult, error) {
+	var result ListToolsResult
+	err := cs.call(ctx, MethodListTools, nil, &result)
 	if err != nil {
 		return nil, err
 	}
 
-	return contents, nil
+	return &result, nil
 }
 
-func (cs *clientSession) ListResources(ctx context.Context) ([]*ResourceDefinition, error) {
-	req := &Request{
-		Method: MethodListResources,
-	}
-	rsp, err := cs.transport.Request(req)
-	if err != nil {
-		return nil, err
+func (cs *clientSession) CallTool(ctx context.Context, tool *ToolDefinition, args map[string]any) (*CallToolResult, error) {
+	params := map[string]any{
+		"name":      tool.Name,
+		"arguments": args,
 	}
 
-	result, err := rsp.ReadResult()
+	var result CallToolResult
+	err := cs.call(ctx, MethodCallTool, params, &result)
 	if err != nil {
 		return nil, err
 	}
 
-	var resources []*ResourceDefinition
-	err = json.Unmarshal(result, &resources)
+	return &result, nil
+}
+
+func (cs *clientSession) ListResources(ctx context.Context) (*ListResourcesResult, error) {
+	var result ListResourcesResult
+	err := cs.call(ctx, MethodListResources, nil, &result)
 	if err != nil {
 		return nil, err
 	}
 
-	return resources, nil
+	return &result, nil
 }
 
-func (cs *clientSession) ReadResource(ctx context.Context, resource *ResourceDefinition) ([]Content, error) {
-	req := &Request{
-		Method: MethodReadResource,
-		Params: Params("{\"uri\": " + resource.URI + "}"),
-	}
-	rsp, err := cs.transport.Request(req)
-	if err != nil {
-		return nil, err
+func (cs *clientSession) ReadResource(ctx context.Context, resource *ResourceDefinition) (*ReadResourceResult, error) {
+	params := map[string]any{
+		"uri": resource.URI,
 	}
 
-	result, err := rsp.ReadResult()
-	if err != nil {
-		return nil, err
-	}
-	var contents []Content
-	err = unmarshalContents(result, &contents)
+	var result ReadResourceResult
+	err := cs.call(ctx, MethodReadResource, params, &result)
 	if err != nil {
 		return nil, err
 	}
 
-	return contents, nil
+	return &result, nil
 }
 
 func (cs *clientSession) SubscribeResource(resource *ResourceDefinition) (<-chan *Notification, error) {
-	req := &Request{
-		Method: MethodSubscribeResource,
-		Params: Params("{\"uri\": " + resource.URI + "}"),
+	params := map[string]any{
+		"uri": resource.URI,
 	}
-	_, err := cs.transport.Request(req)
+
+	err := cs.call(context.Background(), MethodSubscribeResource, params, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -171,54 +252,67 @@ func (cs *clientSession) SubscribeResource(resource *ResourceDefinition) (<-chan
 	return ch, nil
 }
 
-func (s *clientSession) ListPrompts(ctx context.Context) ([]*PromptDefinition, error) {
-	req := &Request{
-		Method: MethodListPrompts,
-	}
-	rsp, err := s.transport.Request(req)
+func (s *clientSession) ListPrompts(ctx context.Context) (*ListPromptsResult, error) {
+	var result ListPromptsResult
+	err := s.call(ctx, MethodListPrompts, nil, &result)
 	if err != nil {
 		return nil, err
 	}
-	result, err := rsp.ReadResult()
-	if err != nil {
-		return nil, err
-	}
-	var prompts []*PromptDefinition
-	err = json.Unmarshal(result, &prompts)
-	if err != nil {
-		return nil, err
-	}
-	return prompts, nil
+
+	return &result, nil
 }
 
-func (s *clientSession) GetPrompt(ctx context.Context, prompt *PromptDefinition, args map[string]any) ([]Content, error) {
+func (s *clientSession) GetPrompt(ctx context.Context, prompt *PromptDefinition, args map[string]any) (*GetPromptResult, error) {
 	params := map[string]any{
 		"name":      prompt.Name,
 		"arguments": args,
 	}
-	paramsJSON, err := json.Marshal(params)
+
+	var result GetPromptResult
+	err := s.call(ctx, MethodGetPrompt, params, &result)
 	if err != nil {
 		return nil, err
 	}
+
+	return &result, nil
+}
+
+// call sends a request with the params encoded in JSON, and decodes its result into v unless v is nil.
+func (cs *clientSession) call(ctx context.Context, method Method, params any, v any) error {
+	// Requests the server cannot serve are not sent
+	err := cs.serverCapabilities.checkMethod(method)
+	if err != nil {
+		return err
+	}
+
 	req := &Request{
-		Method: MethodGetPrompt,
-		Params: Params(paramsJSON),
+		Method: method,
 	}
-	rsp, err := s.transport.Request(req)
-	if err != nil {
-		return nil, err
+	if params != nil {
+		paramsJSON, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		req.Params = Params(paramsJSON)
 	}
-	result, err := rsp.ReadResult()
+
+	result, err := cs.request(ctx, req)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	var messages []struct {
-		Role    string  `json:"role"`
-		Content Content `json:"content"`
+
+	if v == nil {
+		return nil
 	}
-	err = json.Unmarshal(result, &messages)
+	if r, ok := v.(*Result); ok {
+		*r = result
+		return nil
+	}
+
+	err = json.Unmarshal(result, v)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("invalid %s result: %w", method, err)
 	}
-	return nil, nil
+
+	return nil
 }
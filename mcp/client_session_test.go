@@ -0,0 +1,346 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dialTestStream connects a client session to the server over in-process pipes.
+func dialTestStream(t *testing.T, server *Server, client *Client) ClientSession {
+	t.Helper()
+
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+
+	go server.AcceptStream(serverW, serverR)
+
+	sess, err := client.Dial(NewStreamTransport(clientW, clientR))
+	require.NoError(t, err)
+	t.Cleanup(func() { sess.Close() })
+
+	return sess
+}
+
+func TestClientSession_Batch(t *testing.T) {
+	tests := map[string]struct {
+		reqs        []*Request
+		wantErrCode map[int]ErrorCode
+		wantErr     map[int]error
+	}{
+		"single request": {
+			reqs: []*Request{{Method: MethodListTools}},
+		},
+		"results are returned per call in request order": {
+			reqs: []*Request{
+				{Method: MethodListTools},
+				{Method: "unknown/method"},
+				{Method: MethodListResources},
+			},
+			wantErrCode: map[int]ErrorCode{1: MethodNotFoundErrorCode},
+		},
+		"requests of capabilities the server lacks are not sent": {
+			reqs: []*Request{
+				{Method: MethodListPrompts},
+				{Method: MethodListTools},
+			},
+			wantErr: map[int]error{0: ErrCapabilityNotSupported},
+		},
+		"no request the server can serve": {
+			reqs:    []*Request{{Method: MethodListPrompts}},
+			wantErr: map[int]error{0: ErrCapabilityNotSupported},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer("test-server", "0.0.1")
+			server.Handler = newTestServerMux()
+
+			sess := dialTestStream(t, server, NewClient("test-client", "0.0.1"))
+
+			results, err := sess.Batch(context.Background(), tc.reqs...)
+			require.NoError(t, err)
+			require.Len(t, results, len(tc.reqs), "there should be a result for each request")
+
+			for i, result := range results {
+				if wantErr, ok := tc.wantErr[i]; ok {
+					assert.ErrorIs(t, result.Err, wantErr, "result %d should be an error", i)
+					continue
+				}
+				if code, ok := tc.wantErrCode[i]; ok {
+					var errObj *Error
+					require.ErrorAs(t, result.Err, &errObj, "result %d should be an error", i)
+					assert.Equal(t, code, errObj.Code, "error code of result %d should match expected", i)
+					continue
+				}
+
+				assert.NoError(t, result.Err, "result %d should not be an error", i)
+				assert.NotEmpty(t, result.Result, "result %d should not be empty", i)
+			}
+		})
+	}
+}
+
+func TestClientSession_TypedResults(t *testing.T) {
+	mux := NewServerMux()
+	mux.HandleTool(&ToolDefinition{
+		Name:        "echo",
+		Description: "Echo the message",
+		InputSchema: InputSchema(`{"type": "object", "properties": {"message": {"type": "string"}}}`),
+		Annotations: map[string]any{"readOnlyHint": true},
+	}, ToolHandlerFunc(func(w ContentsWriter, name string, args map[string]any) {
+		w.WriteContents([]Content{
+			TextContent{Text: args["message"].(string)},
+			ImageContent{Data: []byte{0x89, 'P', 'N', 'G'}, MimeType: "image/png"},
+		})
+	}))
+	mux.HandleResource(&ResourceDefinition{
+		URI:  `file:///notes/a "quoted" name.txt`,
+		Name: "notes",
+	}, ResourceHandlerFunc(func(w ContentsWriter, name string, args map[string]any) {
+		w.WriteContents([]Content{
+			TextContent{Text: "hello"},
+			ImageContent{Data: []byte{0x01, 0x02}, MimeType: "application/octet-stream"},
+		})
+	}))
+	mux.HandlePrompt(&PromptDefinition{
+		Name:        "greet",
+		Description: "Greet someone",
+	}, PromptHandlerFunc(func(w PromptWriter, name string, args map[string]any) {
+		w.Write(User, TextContent{Text: "Hello, " + args["name"].(string)})
+		w.Write(Assistant, TextContent{Text: "Hi!"})
+	}))
+
+	server := NewServer("test-server", "0.0.1")
+	server.Handler = mux
+
+	clientT, serverT := NewInMemoryTransportsWithConfig(&MemoryConfig{RoundTripJSON: true})
+	go server.Accept(serverT)
+
+	sess, err := NewClient("test-client", "0.0.1").Dial(clientT)
+	require.NoError(t, err)
+	t.Cleanup(func() { sess.Close() })
+
+	ctx := context.Background()
+
+	t.Run("list tools", func(t *testing.T) {
+		result, err := sess.ListTools(ctx)
+		require.NoError(t, err)
+		require.Len(t, result.Tools, 1)
+
+		tool := result.Tools[0]
+		assert.Equal(t, "echo", tool.Name)
+		assert.Equal(t, "Echo the message", tool.Description)
+		assert.JSONEq(t, `{"type": "object", "properties": {"message": {"type": "string"}}}`, string(tool.InputSchema))
+		assert.Equal(t, map[string]any{"readOnlyHint": true}, tool.Annotations)
+	})
+
+	t.Run("call tool", func(t *testing.T) {
+		result, err := sess.CallTool(ctx, &ToolDefinition{Name: "echo"}, map[string]any{"message": "hello"})
+		require.NoError(t, err)
+		assert.Equal(t, []Content{
+			&TextContent{Text: "hello"},
+			&ImageContent{Data: []byte{0x89, 'P', 'N', 'G'}, MimeType: "image/png"},
+		}, result.Content)
+	})
+
+	t.Run("read resource", func(t *testing.T) {
+		resource := &ResourceDefinition{URI: `file:///notes/a "quoted" name.txt`}
+		result, err := sess.ReadResource(ctx, resource)
+		require.NoError(t, err)
+		assert.Equal(t, []*Resource{
+			{URI: resource.URI, Text: "hello"},
+			{URI: resource.URI, MimeType: "application/octet-stream", Blob: []byte{0x01, 0x02}},
+		}, result.Contents)
+	})
+
+	t.Run("get prompt", func(t *testing.T) {
+		result, err := sess.GetPrompt(ctx, &PromptDefinition{Name: "greet"}, map[string]any{"name": "Alice"})
+		require.NoError(t, err)
+		assert.Equal(t, "Greet someone", result.Description)
+		assert.Equal(t, []*PromptMessage{
+			{Role: User, Content: &TextContent{Text: "Hello, Alice"}},
+			{Role: Assistant, Content: &TextContent{Text: "Hi!"}},
+		}, result.Messages)
+	})
+
+	t.Run("list prompts", func(t *testing.T) {
+		result, err := sess.ListPrompts(ctx)
+		require.NoError(t, err)
+		require.Len(t, result.Prompts, 1)
+		assert.Equal(t, "greet", result.Prompts[0].Name)
+	})
+}
+
+func TestTypedResults_JSON(t *testing.T) {
+	t.Run("meta is decoded", func(t *testing.T) {
+		var result ListToolsResult
+		err := json.Unmarshal([]byte(`{"tools": [], "nextCursor": "next", "_meta": {"trace": "abc"}}`), &result)
+		require.NoError(t, err)
+		assert.Equal(t, "next", result.NextCursor)
+		assert.Equal(t, map[string]any{"trace": "abc"}, result.Meta)
+	})
+
+	t.Run("contents are encoded with their type", func(t *testing.T) {
+		data, err := json.Marshal([]Content{
+			TextContent{Text: "hello"},
+			&ImageContent{Data: []byte("png"), MimeType: "image/png"},
+			ResourceContent{Resource: Resource{URI: "file:///a.txt", Text: "a"}},
+		})
+		require.NoError(t, err)
+		assert.JSONEq(t, `[
+			{"type": "text", "text": "hello"},
+			{"type": "image", "data": "cG5n", "mimeType": "image/png"},
+			{"type": "resource", "resource": {"uri": "file:///a.txt", "text": "a"}}
+		]`, string(data))
+	})
+
+	t.Run("result of a tool call", func(t *testing.T) {
+		var result CallToolResult
+		err := json.Unmarshal([]byte(`{
+			"content": [
+				{"type": "text", "text": "not found"},
+				{"type": "resource_link", "uri": "file:///a.txt", "name": "a"}
+			],
+			"isError": true,
+			"_meta": {"trace": "abc"}
+		}`), &result)
+		require.NoError(t, err)
+		assert.True(t, result.IsError)
+		assert.Equal(t, map[string]any{"trace": "abc"}, result.Meta)
+		require.Len(t, result.Content, 2)
+		assert.Equal(t, &TextContent{Text: "not found"}, result.Content[0])
+
+		// Contents of an unknown type are kept as they are
+		assert.Equal(t, "resource_link", result.Content[1].Type())
+		data, err := json.Marshal(result.Content[1])
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"type": "resource_link", "uri": "file:///a.txt", "name": "a"}`, string(data))
+	})
+
+	t.Run("deprecated contents", func(t *testing.T) {
+		data, err := json.Marshal([]Content{
+			BinaryContent{MimeType: "image/png", Data: []byte("png")},
+			BinaryContent{MimeType: "audio/wav", Data: []byte("wav")},
+		})
+		require.NoError(t, err)
+		assert.JSONEq(t, `[
+			{"type": "image", "data": "cG5n", "mimeType": "image/png"},
+			{"type": "audio", "data": "d2F2", "mimeType": "audio/wav"}
+		]`, string(data))
+
+		want := []Content{&TextContent{Text: "hello"}}
+		for _, message := range []string{
+			`{"type": "text", "text": "hello"}`,
+			`[{"type": "text", "text": "hello"}]`,
+			`{"content": [{"type": "text", "text": "hello"}]}`,
+			`{"contents": [{"type": "text", "text": "hello"}]}`,
+		} {
+			assert.Equal(t, want, NewContents(json.RawMessage(message)), message)
+		}
+		assert.Panics(t, func() { NewContents(json.RawMessage(`"hello"`)) })
+	})
+
+	t.Run("empty input schema is an object schema", func(t *testing.T) {
+		data, err := json.Marshal(&ToolDefinition{Name: "noop"})
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"name": "noop", "inputSchema": {"type": "object"}}`, string(data))
+	})
+}
+
+func TestClientSession_ServerInfo(t *testing.T) {
+	tests := map[string]struct {
+		server           *Server
+		wantInfo         Implementation
+		wantInstructions string
+	}{
+		"title and instructions": {
+			server: &Server{
+				Name:         "test-server",
+				Version:      "0.0.1",
+				Title:        "Test Server",
+				Instructions: "Call the echo tool to test the connection.",
+			},
+			wantInfo:         Implementation{Name: "test-server", Version: "0.0.1", Title: "Test Server"},
+			wantInstructions: "Call the echo tool to test the connection.",
+		},
+		"no title nor instructions": {
+			server:   NewServer("test-server", "0.0.1"),
+			wantInfo: Implementation{Name: "test-server", Version: "0.0.1"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tc.server.Handler = NewServerMux()
+			tc.server.ToolsChangedNotification = true
+
+			sess := dialTestStream(t, tc.server, NewClient("test-client", "0.0.1"))
+
+			assert.Equal(t, tc.wantInfo, sess.ServerInfo())
+			assert.Equal(t, tc.wantInstructions, sess.Instructions())
+			assert.Equal(t, DefaultVersion, sess.ProtocolVersion())
+			assert.True(t, sess.ServerCapabilities().Tools.ListChanged)
+		})
+	}
+}
+
+func TestClient_Dial_Concurrent(t *testing.T) {
+	server := NewServer("test-server", "0.0.1")
+	server.Handler = newTestServerMux()
+	client := NewClient("test-client", "0.0.1")
+
+	const n = 8
+	sessions := make(chan ClientSession, n)
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			clientT, serverT := NewInMemoryTransports()
+			go server.Accept(serverT)
+			sess, err := client.Dial(clientT)
+			if assert.NoError(t, err) {
+				sessions <- sess
+			}
+		}()
+	}
+	wg.Wait()
+	close(sessions)
+
+	// Sessions which are done are forgotten
+	var open []ClientSession
+	closing := true
+	for sess := range sessions {
+		if closing {
+			require.NoError(t, sess.Close())
+		} else {
+			open = append(open, sess)
+		}
+		closing = !closing
+	}
+	assert.Eventually(t, func() bool {
+		client.sessionsLock.Lock()
+		defer client.sessionsLock.Unlock()
+		return len(client.sessions) == len(open)
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, client.Close())
+	for _, sess := range open {
+		select {
+		case <-sess.Done():
+		case <-time.After(time.Second):
+			t.Fatal("session should be closed with the client")
+		}
+	}
+}
@@ -1,13 +1,31 @@
 package mcp
 
 import (
+	"bytes"
 	"encoding/json"
-	"errors"
+	"fmt"
+	"strings"
 )
 
+// NewContents decodes a content object, a list of content objects,
+// or the result of a tool call holding them. It panics if the message is invalid.
+//
+// Deprecated: Use DecodeContents, which reports invalid messages with an error.
 func NewContents(message json.RawMessage) []Content {
-	var contents []Content
-	err := unmarshalContents(Result(message), &contents)
+	var result struct {
+		Content  json.RawMessage `json:"content"`
+		Contents json.RawMessage `json:"contents"`
+	}
+	if json.Unmarshal(message, &result) == nil {
+		switch {
+		case result.Content != nil:
+			message = result.Content
+		case result.Contents != nil:
+			message = result.Contents
+		}
+	}
+
+	contents, err := DecodeContents(message)
 	if err != nil {
 		panic(err)
 	}
@@ -15,79 +33,249 @@ func NewContents(message json.RawMessage) []Content {
 	return contents
 }
 
+// DecodeContents decodes a content object, or a list of content objects, as specified by the protocol.
+// Contents of an unknown type are decoded as RawContent.
+func DecodeContents(message json.RawMessage) ([]Content, error) {
+	message = bytes.TrimSpace(message)
+	if len(message) > 0 && message[0] == '{' {
+		message = append(append(json.RawMessage("["), message...), ']')
+	}
+
+	return unmarshalContentList(message)
+}
+
+// marshalContents encodes the result of a tool call.
 func marshalContents(c *[]Content) (Result, error) {
+	contents := *c
+	if contents == nil {
+		contents = []Content{}
+	}
+
 	v := map[string]any{
-		"contents": c,
+		"content": contents,
 	}
 	return json.Marshal(v)
 }
 
-func unmarshalContents(result Result, c *[]Content) error {
-	v := map[string]any{
-		"contents": []map[string]json.RawMessage{},
+// marshalResourceContents encodes the result of the read of the resource.
+// Embedded resources are sent as they are, and other contents as the contents of the resource.
+func marshalResourceContents(uri string, contents []Content) (Result, error) {
+	resources := make([]Resource, 0, len(contents))
+	for _, content := range contents {
+		var resource Resource
+		switch c := content.(type) {
+		case ResourceContent:
+			resource = c.Resource
+		case *ResourceContent:
+			resource = c.Resource
+		case TextContent:
+			resource = Resource{Text: c.Text}
+		case *TextContent:
+			resource = Resource{Text: c.Text}
+		case ImageContent:
+			resource = Resource{MimeType: c.MimeType, Blob: c.Data}
+		case *ImageContent:
+			resource = Resource{MimeType: c.MimeType, Blob: c.Data}
+		case AudioContent:
+			resource = Resource{MimeType: c.MimeType, Blob: c.Data}
+		case *AudioContent:
+			resource = Resource{MimeType: c.MimeType, Blob: c.Data}
+		case BinaryContent:
+			resource = Resource{MimeType: c.MimeType, Blob: c.Data}
+		case *BinaryContent:
+			resource = Resource{MimeType: c.MimeType, Blob: c.Data}
+		default:
+			return nil, fmt.Errorf("content of type %q cannot be the contents of a resource", content.Type())
+		}
+
+		if resource.URI == "" {
+			resource.URI = uri
+		}
+		resources = append(resources, resource)
 	}
-	err := json.Unmarshal(result, &v)
+
+	return json.Marshal(map[string]any{
+		"contents": resources,
+	})
+}
+
+func unmarshalContentList(data json.RawMessage) ([]Content, error) {
+	var list []json.RawMessage
+	err := json.Unmarshal(data, &list)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	contents := v["contents"].([]map[string]json.RawMessage)
-
-	var content Content
-	for _, contentJson := range contents {
-		mimeType, ok := contentJson["mimeType"]
-		if !ok {
-			return errors.New("missing mimeType field")
+	contents := make([]Content, 0, len(list))
+	for _, raw := range list {
+		content, err := unmarshalContent(raw)
+		if err != nil {
+			return nil, err
 		}
+		contents = append(contents, content)
+	}
 
-		if contentJson["resource"] != nil {
-			data, ok := contentJson["resource"]
-			if !ok {
-				return errors.New("missing resource field")
-			}
-
-			var resource Resource
-			err := json.Unmarshal(data, &resource)
-			if err != nil {
-				return err
-			}
-
-			content = &ResourceContent{
-				Resource: Resource{},
-			}
-		} else {
-			content = &BinaryContent{
-				MimeType: string(mimeType),
-				Data:     contentJson["data"],
-			}
-		}
+	return contents, nil
+}
+
+// unmarshalContent decodes a single content object according to its type.
+// A content of an unknown type, such as a type added by a later version of the protocol, is kept as RawContent.
+func unmarshalContent(data json.RawMessage) (Content, error) {
+	var v struct {
+		Type string `json:"type"`
+	}
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		return nil, err
+	}
 
-		*c = append(*c, content)
+	var content Content
+	switch v.Type {
+	case "text":
+		content = &TextContent{}
+	case "image":
+		content = &ImageContent{}
+	case "audio":
+		content = &AudioContent{}
+	case "resource":
+		content = &ResourceContent{}
+	default:
+		return &RawContent{ContentType: v.Type, Data: bytes.Clone(data)}, nil
+	}
+
+	err = json.Unmarshal(data, content)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return content, nil
 }
 
+// Content is an item of the result of a tool call or of a prompt message.
 type Content interface {
+	// Type returns the type of the content, such as "text".
 	Type() string
 }
 
-var _ Content = (*BinaryContent)(nil)
+var _ Content = (*TextContent)(nil)
+var _ Content = (*ImageContent)(nil)
+var _ Content = (*AudioContent)(nil)
 var _ Content = (*ResourceContent)(nil)
+var _ Content = (*RawContent)(nil)
+var _ Content = (*BinaryContent)(nil)
 
+type TextContent struct {
+	Text string `json:"text"`
+}
+
+func (TextContent) Type() string {
+	return "text"
+}
+
+func (c TextContent) MarshalJSON() ([]byte, error) {
+	type content TextContent
+	return marshalTyped(c.Type(), content(c))
+}
+
+// ImageContent is an image. The data is encoded in base64 in JSON.
+type ImageContent struct {
+	Data     []byte `json:"data"`
+	MimeType string `json:"mimeType"`
+}
+
+func (ImageContent) Type() string {
+	return "image"
+}
+
+func (c ImageContent) MarshalJSON() ([]byte, error) {
+	type content ImageContent
+	return marshalTyped(c.Type(), content(c))
+}
+
+// AudioContent is an audio clip. The data is encoded in base64 in JSON.
+type AudioContent struct {
+	Data     []byte `json:"data"`
+	MimeType string `json:"mimeType"`
+}
+
+func (AudioContent) Type() string {
+	return "audio"
+}
+
+func (c AudioContent) MarshalJSON() ([]byte, error) {
+	type content AudioContent
+	return marshalTyped(c.Type(), content(c))
+}
+
+// ResourceContent embeds the contents of a resource.
+type ResourceContent struct {
+	Resource Resource `json:"resource"`
+}
+
+func (ResourceContent) Type() string {
+	return "resource"
+}
+
+func (c ResourceContent) MarshalJSON() ([]byte, error) {
+	type content ResourceContent
+	return marshalTyped(c.Type(), content(c))
+}
+
+// RawContent is a content of a type which the package does not know, kept as it was received.
+type RawContent struct {
+	ContentType string
+	// Data is the JSON object of the content, including its type field
+	Data json.RawMessage
+}
+
+func (c RawContent) Type() string {
+	return c.ContentType
+}
+
+func (c RawContent) MarshalJSON() ([]byte, error) {
+	return c.Data.MarshalJSON()
+}
+
+// BinaryContent is binary data of a MIME type.
+// It is sent as an audio content if its MIME type is audio/*, and as an image content otherwise.
+//
+// Deprecated: Use ImageContent or AudioContent.
 type BinaryContent struct {
 	MimeType string
 	Data     []byte
 }
 
+// Type returns the MIME type of the data.
 func (b BinaryContent) Type() string {
 	return b.MimeType
 }
 
-type ResourceContent struct {
-	Resource Resource `json:"resource"`
+func (b BinaryContent) MarshalJSON() ([]byte, error) {
+	if strings.HasPrefix(b.MimeType, "audio/") {
+		return AudioContent{Data: b.Data, MimeType: b.MimeType}.MarshalJSON()
+	}
+	return ImageContent{Data: b.Data, MimeType: b.MimeType}.MarshalJSON()
 }
 
-func (e ResourceContent) Type() string {
-	return "resource"
+// marshalTyped encodes the content with its type field.
+func marshalTyped(typ string, v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	typeField, err := json.Marshal(typ)
+	if err != nil {
+		return nil, err
+	}
+
+	// The type field is prepended to the object
+	buf := bytes.NewBufferString(`{"type":`)
+	buf.Write(typeField)
+	if len(data) > 2 {
+		buf.WriteByte(',')
+	}
+	buf.Write(data[1:])
+
+	return buf.Bytes(), nil
 }
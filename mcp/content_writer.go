@@ -1,29 +1,55 @@
 package mcp
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sync"
 )
 
 type ContentsWriter interface {
+	// Context returns the context of the request being served.
+	// It is canceled when the peer cancels the request or when the request exceeds its deadline.
+	Context() context.Context
 	WriteContents(content []Content) error
 	CloseWithError(code ErrorCode, msg string) error
 }
 
-func newContentsWriter(rw ResponseWriter) ContentsWriter {
-	return &contentsWriter{rw: rw}
+// newContentsWriter returns a writer answering a tool call with the contents.
+func newContentsWriter(ctx context.Context, rw ResponseWriter) ContentsWriter {
+	return &contentsWriter{ctx: ctx, rw: rw, marshal: marshalContents}
+}
+
+// newResourceContentsWriter returns a writer answering the read of the resource with the contents.
+func newResourceContentsWriter(ctx context.Context, rw ResponseWriter, uri string) ContentsWriter {
+	return &contentsWriter{ctx: ctx, rw: rw, marshal: func(contents *[]Content) (Result, error) {
+		return marshalResourceContents(uri, *contents)
+	}}
 }
 
 var _ ContentsWriter = (*contentsWriter)(nil)
 
 type contentsWriter struct {
+	ctx context.Context
+
+	mu        sync.Mutex
 	done      bool
 	closedErr error
 
 	rw ResponseWriter
+
+	// marshal encodes the result written by WriteContents
+	marshal func(contents *[]Content) (Result, error)
+}
+
+func (cw *contentsWriter) Context() context.Context {
+	return cw.ctx
 }
 
 func (cw *contentsWriter) WriteContents(contents []Content) error {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
 	if cw.done {
 		if cw.closedErr != nil {
 			return fmt.Errorf("writer is already closed: %w", cw.closedErr)
@@ -32,7 +58,7 @@ func (cw *contentsWriter) WriteContents(contents []Content) error {
 		return errors.New("session has already done")
 	}
 
-	result, err := marshalContents(&contents)
+	result, err := cw.marshal(&contents)
 	if err != nil {
 		return err
 	}
@@ -48,6 +74,9 @@ func (cw *contentsWriter) WriteContents(contents []Content) error {
 }
 
 func (cw *contentsWriter) CloseWithError(code ErrorCode, msg string) error {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
 	if cw.done {
 		if cw.closedErr != nil {
 			return fmt.Errorf("writer is already closed: %w", cw.closedErr)
@@ -56,5 +85,8 @@ func (cw *contentsWriter) CloseWithError(code ErrorCode, msg string) error {
 		return errors.New("session has already done")
 	}
 
+	cw.done = true
+	cw.closedErr = newError(code, msg, nil)
+
 	return cw.rw.CloseWithError(code, msg, nil)
 }
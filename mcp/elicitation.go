@@ -0,0 +1,247 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// ElicitationAction is the answer of the user to an elicitation.
+type ElicitationAction string
+
+const (
+	// ElicitationAccept means the user submitted the requested data
+	ElicitationAccept ElicitationAction = "accept"
+	// ElicitationDecline means the user explicitly refused to submit the data
+	ElicitationDecline ElicitationAction = "decline"
+	// ElicitationCancel means the user dismissed the request without choosing
+	ElicitationCancel ElicitationAction = "cancel"
+)
+
+// ElicitationSchema describes the data requested from the user.
+// It is a restricted JSON schema: a flat object whose properties have primitive types.
+type ElicitationSchema struct {
+	// Type is always "object". It is set when the schema is sent if it is empty.
+	Type       string                      `json:"type"`
+	Properties map[string]*PrimitiveSchema `json:"properties"`
+	Required   []string                    `json:"required,omitempty"`
+}
+
+// PrimitiveSchema describes a property of an ElicitationSchema.
+type PrimitiveSchema struct {
+	// Type is "string", "number", "integer" or "boolean"
+	Type        string `json:"type"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	// Constraints of strings
+	MinLength *int   `json:"minLength,omitempty"`
+	MaxLength *int   `json:"maxLength,omitempty"`
+	Format    string `json:"format,omitempty"`
+	// Enum lists the allowed values of a string, and EnumNames their display names
+	Enum      []string `json:"enum,omitempty"`
+	EnumNames []string `json:"enumNames,omitempty"`
+
+	// Constraints of numbers and integers
+	Minimum *float64 `json:"minimum,omitempty"`
+	Maximum *float64 `json:"maximum,omitempty"`
+
+	Default any `json:"default,omitempty"`
+}
+
+var elicitationFormats = []string{"email", "uri", "date", "date-time"}
+
+// Validate reports whether the schema follows the restrictions of the elicitation schemas.
+func (s *ElicitationSchema) Validate() error {
+	if s.Type != "" && s.Type != "object" {
+		return fmt.Errorf("schema type must be object, not %q", s.Type)
+	}
+
+	for name, property := range s.Properties {
+		if property == nil {
+			return fmt.Errorf("property %q has no schema", name)
+		}
+
+		switch property.Type {
+		case "string":
+			if property.Format != "" && !slices.Contains(elicitationFormats, property.Format) {
+				return fmt.Errorf("property %q has an unsupported format %q", name, property.Format)
+			}
+			if len(property.EnumNames) > 0 && len(property.EnumNames) != len(property.Enum) {
+				return fmt.Errorf("property %q must have as many enum names as enum values", name)
+			}
+		case "number", "integer", "boolean":
+			if len(property.Enum) > 0 || property.Format != "" || property.MinLength != nil || property.MaxLength != nil {
+				return fmt.Errorf("property %q of type %s has constraints of strings", name, property.Type)
+			}
+		default:
+			return fmt.Errorf("property %q has an unsupported type %q", name, property.Type)
+		}
+	}
+
+	for _, name := range s.Required {
+		if _, ok := s.Properties[name]; !ok {
+			return fmt.Errorf("required property %q is not defined", name)
+		}
+	}
+
+	return nil
+}
+
+// validateContent reports whether the data submitted by the user matches the schema.
+func (s *ElicitationSchema) validateContent(content map[string]any) error {
+	for _, name := range s.Required {
+		if _, ok := content[name]; !ok {
+			return fmt.Errorf("required property %q is missing", name)
+		}
+	}
+
+	for name, value := range content {
+		property, ok := s.Properties[name]
+		if !ok {
+			return fmt.Errorf("property %q is not requested", name)
+		}
+
+		switch property.Type {
+		case "string":
+			str, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("property %q must be a string", name)
+			}
+			if len(property.Enum) > 0 && !slices.Contains(property.Enum, str) {
+				return fmt.Errorf("property %q must be one of %v", name, property.Enum)
+			}
+		case "number", "integer":
+			number, ok := value.(float64)
+			if !ok || (property.Type == "integer" && number != float64(int64(number))) {
+				return fmt.Errorf("property %q must be a %s", name, property.Type)
+			}
+		case "boolean":
+			if _, ok := value.(bool); !ok {
+				return fmt.Errorf("property %q must be a boolean", name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ElicitationRequest is a request of the server to collect data from the user.
+type ElicitationRequest struct {
+	// Message is shown to the user to explain what is requested
+	Message         string             `json:"message"`
+	RequestedSchema *ElicitationSchema `json:"requestedSchema"`
+}
+
+// ElicitResult is the answer of the user to an elicitation.
+type ElicitResult struct {
+	Action ElicitationAction `json:"action"`
+	// Content is the data submitted by the user when the action is accept
+	Content map[string]any `json:"content,omitempty"`
+	Meta    map[string]any `json:"_meta,omitempty"`
+}
+
+type ElicitationWriter interface {
+	// Context returns the context of the request being served.
+	// It is canceled when the server cancels the request.
+	Context() context.Context
+	// Accept answers with the data submitted by the user.
+	Accept(content map[string]any) error
+	// Decline answers that the user refused to submit the data.
+	Decline() error
+	// Cancel answers that the user dismissed the request.
+	Cancel() error
+	CloseWithError(code ErrorCode, msg string) error
+}
+
+// ElicitationHandler asks the user for the data requested by a server.
+// If the handler returns without answering, the elicitation is cancelled.
+type ElicitationHandler interface {
+	ServeElicitation(w ElicitationWriter, req *ElicitationRequest)
+}
+
+type ElicitationHandlerFunc func(w ElicitationWriter, req *ElicitationRequest)
+
+func (f ElicitationHandlerFunc) ServeElicitation(w ElicitationWriter, req *ElicitationRequest) {
+	f(w, req)
+}
+
+// ElicitationNotSupportedHandler declines all elicitations.
+var ElicitationNotSupportedHandler ElicitationHandlerFunc = func(w ElicitationWriter, req *ElicitationRequest) {
+	w.Decline()
+}
+
+var _ ElicitationWriter = (*elicitationWriter)(nil)
+
+type elicitationWriter struct {
+	ctx context.Context
+	rw  ResponseWriter
+
+	mu   sync.Mutex
+	done bool
+}
+
+func newElicitationWriter(ctx context.Context, rw ResponseWriter) *elicitationWriter {
+	return &elicitationWriter{ctx: ctx, rw: rw}
+}
+
+func (ew *elicitationWriter) Context() context.Context {
+	return ew.ctx
+}
+
+func (ew *elicitationWriter) Accept(content map[string]any) error {
+	if content == nil {
+		content = map[string]any{}
+	}
+	return ew.write(&ElicitResult{Action: ElicitationAccept, Content: content})
+}
+
+func (ew *elicitationWriter) Decline() error {
+	return ew.write(&ElicitResult{Action: ElicitationDecline})
+}
+
+func (ew *elicitationWriter) Cancel() error {
+	return ew.write(&ElicitResult{Action: ElicitationCancel})
+}
+
+func (ew *elicitationWriter) write(result *ElicitResult) error {
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+
+	if ew.done {
+		return errors.New("elicitation is already answered")
+	}
+	ew.done = true
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return ew.rw.WriteResult(data)
+}
+
+func (ew *elicitationWriter) CloseWithError(code ErrorCode, msg string) error {
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+
+	if ew.done {
+		return errors.New("elicitation is already answered")
+	}
+	ew.done = true
+
+	return ew.rw.CloseWithError(code, msg, nil)
+}
+
+// finish cancels the elicitation if the handler did not answer it.
+func (ew *elicitationWriter) finish() {
+	ew.mu.Lock()
+	done := ew.done
+	ew.mu.Unlock()
+
+	if !done {
+		ew.Cancel()
+	}
+}
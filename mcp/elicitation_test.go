@@ -0,0 +1,223 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerSession_Elicit(t *testing.T) {
+	schema := &ElicitationSchema{
+		Properties: map[string]*PrimitiveSchema{
+			"target":   {Type: "string", Enum: []string{"staging", "production"}},
+			"replicas": {Type: "integer"},
+		},
+		Required: []string{"target"},
+	}
+
+	// dialHandler connects a client with the handler to a server with a deploy tool,
+	// which asks the user for its target and answers with the result of the elicitation
+	dialHandler := func(t *testing.T, handler ClientHandler) ClientSession {
+		t.Helper()
+
+		mux := NewServerMux()
+		mux.HandleTool(&ToolDefinition{Name: "deploy"}, ToolHandlerFunc(func(w ContentsWriter, name string, args map[string]any) {
+			sess, ok := ServerSessionFromContext(w.Context())
+			if !assert.True(t, ok, "the session should be in the context of the request") {
+				return
+			}
+
+			result, err := sess.Elicit(w.Context(), "Where to deploy?", schema)
+			if err != nil {
+				w.WriteContents([]Content{TextContent{Text: "error: " + err.Error()}})
+				return
+			}
+			w.WriteContents([]Content{TextContent{Text: fmt.Sprintf("%s %v", result.Action, result.Content["target"])}})
+		}))
+		server := NewServer("test-server", "0.0.1")
+		server.Handler = mux
+
+		client := NewClient("test-client", "0.0.1")
+		client.Handler = handler
+
+		return dialTestStream(t, server, client)
+	}
+
+	// dial connects a client with a mux serving the elicitation handler
+	dial := func(t *testing.T, handler ElicitationHandler) ClientSession {
+		t.Helper()
+
+		clientMux := NewClientMux()
+		if handler != nil {
+			clientMux.HandleElicitation(handler)
+		}
+		return dialHandler(t, clientMux)
+	}
+
+	tests := map[string]struct {
+		handler ElicitationHandlerFunc
+		want    string
+	}{
+		"user accepts": {
+			handler: func(w ElicitationWriter, req *ElicitationRequest) {
+				assert.Equal(t, "Where to deploy?", req.Message)
+				assert.Equal(t, "object", req.RequestedSchema.Type)
+				assert.Equal(t, []string{"staging", "production"}, req.RequestedSchema.Properties["target"].Enum)
+				w.Accept(map[string]any{"target": "staging", "replicas": 3})
+			},
+			want: "accept staging",
+		},
+		"user declines": {
+			handler: func(w ElicitationWriter, req *ElicitationRequest) {
+				w.Decline()
+			},
+			want: "decline <nil>",
+		},
+		"handler without answer cancels": {
+			handler: func(w ElicitationWriter, req *ElicitationRequest) {},
+			want:    "cancel <nil>",
+		},
+		"content not matching the schema is refused": {
+			handler: func(w ElicitationWriter, req *ElicitationRequest) {
+				w.Accept(map[string]any{"target": "moon"})
+			},
+			want: `error: invalid elicitation content: property "target" must be one of [staging production]`,
+		},
+		"missing required content is refused": {
+			handler: func(w ElicitationWriter, req *ElicitationRequest) {
+				w.Accept(map[string]any{"replicas": 1.5})
+			},
+			want: `error: invalid elicitation content: required property "target" is missing`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			sess := dial(t, tc.handler)
+
+			result, err := sess.CallTool(context.Background(), &ToolDefinition{Name: "deploy"}, nil)
+			require.NoError(t, err)
+			assert.Equal(t, []Content{&TextContent{Text: tc.want}}, result.Content)
+		})
+	}
+
+	t.Run("client without handler does not support elicitation", func(t *testing.T) {
+		t.Parallel()
+
+		sess := dial(t, nil)
+
+		result, err := sess.CallTool(context.Background(), &ToolDefinition{Name: "deploy"}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []Content{&TextContent{
+			Text: "error: elicitation/create requires the elicitation capability, which the peer did not advertise",
+		}}, result.Content)
+	})
+
+	t.Run("handler without ServeElicitation does not support elicitation", func(t *testing.T) {
+		t.Parallel()
+
+		sess := dialHandler(t, basicClientHandler{})
+
+		result, err := sess.CallTool(context.Background(), &ToolDefinition{Name: "deploy"}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []Content{&TextContent{
+			Text: "error: elicitation/create requires the elicitation capability, which the peer did not advertise",
+		}}, result.Content)
+	})
+
+	t.Run("handler implementing ServeElicitation supports elicitation", func(t *testing.T) {
+		t.Parallel()
+
+		sess := dialHandler(t, elicitingClientHandler{
+			ElicitationHandlerFunc: func(w ElicitationWriter, req *ElicitationRequest) {
+				w.Accept(map[string]any{"target": "production"})
+			},
+		})
+
+		result, err := sess.CallTool(context.Background(), &ToolDefinition{Name: "deploy"}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []Content{&TextContent{Text: "accept production"}}, result.Content)
+	})
+}
+
+var _ ClientHandler = basicClientHandler{}
+
+// basicClientHandler is a client handler written before elicitation, which does not serve it.
+type basicClientHandler struct{}
+
+func (basicClientHandler) ServeSample(w ContentsWriter, name string, args map[string]any) {}
+
+func (basicClientHandler) ListRoots() []*RootDefinition {
+	return nil
+}
+
+func (basicClientHandler) ServeRootsChanged(t Transport) {}
+
+// elicitingClientHandler serves elicitation without declaring its capabilities.
+type elicitingClientHandler struct {
+	basicClientHandler
+	ElicitationHandlerFunc
+}
+
+func TestElicitationSchema_Validate(t *testing.T) {
+	tests := map[string]struct {
+		schema  *ElicitationSchema
+		wantErr string
+	}{
+		"empty schema": {
+			schema: &ElicitationSchema{},
+		},
+		"primitive properties": {
+			schema: &ElicitationSchema{
+				Type: "object",
+				Properties: map[string]*PrimitiveSchema{
+					"email":   {Type: "string", Format: "email"},
+					"count":   {Type: "integer"},
+					"ratio":   {Type: "number"},
+					"confirm": {Type: "boolean"},
+				},
+				Required: []string{"email"},
+			},
+		},
+		"nested object": {
+			schema: &ElicitationSchema{
+				Properties: map[string]*PrimitiveSchema{"address": {Type: "object"}},
+			},
+			wantErr: `property "address" has an unsupported type "object"`,
+		},
+		"unsupported format": {
+			schema: &ElicitationSchema{
+				Properties: map[string]*PrimitiveSchema{"phone": {Type: "string", Format: "phone"}},
+			},
+			wantErr: `property "phone" has an unsupported format "phone"`,
+		},
+		"enum of a number": {
+			schema: &ElicitationSchema{
+				Properties: map[string]*PrimitiveSchema{"count": {Type: "number", Enum: []string{"1"}}},
+			},
+			wantErr: `property "count" of type number has constraints of strings`,
+		},
+		"undefined required property": {
+			schema:  &ElicitationSchema{Required: []string{"name"}},
+			wantErr: `required property "name" is not defined`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tc.schema.Validate()
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tc.wantErr)
+		})
+	}
+}
@@ -1,5 +1,13 @@
 package mcp
 
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
 var _ error = (*Error)(nil)
 
 type Error struct {
@@ -12,11 +20,32 @@ func (e *Error) Error() string {
 	return e.Message
 }
 
+// Is reports whether the target is an *Error with the same code,
+// so that errors received from the peer can be matched against the predefined errors.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	return e.Code == t.Code
+}
+
+func newError(code ErrorCode, msg string, data map[string]json.RawMessage) *Error {
+	err := &Error{
+		Code:    code,
+		Message: msg,
+	}
+	if data != nil {
+		err.Data = data
+	}
+	return err
+}
+
 type ErrorCode int
 
 const (
 	ParseErrorCode           ErrorCode = -32700
-	InvalidRequestErrorCode  ErrorCode = -32602
+	InvalidRequestErrorCode  ErrorCode = -32600
 	MethodNotFoundErrorCode  ErrorCode = -32601
 	InvalidParamsErrorCode   ErrorCode = -32602
 	JSONRPCInternalErrorCode ErrorCode = -32603
@@ -28,6 +57,9 @@ const (
 	ErrPromptNotFoundCode   ErrorCode = MCPInternalErrorCode - 3 // -32003
 	ErrRootNotFoundCode     ErrorCode = MCPInternalErrorCode - 4 // -32004
 	ErrSampleNotFoundCode   ErrorCode = MCPInternalErrorCode - 5 // -32005
+	RequestTimeoutErrorCode ErrorCode = MCPInternalErrorCode - 6 // -32006
+	QueueFullErrorCode      ErrorCode = MCPInternalErrorCode - 7 // -32007
+	RequestCancelledCode    ErrorCode = MCPInternalErrorCode - 8 // -32008
 )
 
 var (
@@ -81,4 +113,69 @@ var (
 		Code:    ErrSampleNotFoundCode,
 		Message: "Sample not found",
 	}
+
+	ErrRequestTimeout = &Error{
+		Code:    RequestTimeoutErrorCode,
+		Message: "Request timed out",
+	}
+
+	ErrQueueFull = &Error{
+		Code:    QueueFullErrorCode,
+		Message: "Too many pending messages",
+	}
+
+	ErrRequestCancelled = &Error{
+		Code:    RequestCancelledCode,
+		Message: "Request cancelled",
+	}
 )
+
+// ErrCapabilityNotSupported is matched by the errors returned when a request is not sent
+// because the peer did not advertise the capability it requires.
+var ErrCapabilityNotSupported = errors.New("capability not supported by the peer")
+
+var _ error = (*CapabilityError)(nil)
+
+// CapabilityError is returned when a request requires a capability the peer did not advertise in the initialization.
+// It matches ErrCapabilityNotSupported with errors.Is.
+type CapabilityError struct {
+	Method Method
+	// Capability is the required capability, such as "resources.subscribe"
+	Capability string
+}
+
+func (e *CapabilityError) Error() string {
+	return fmt.Sprintf("%s requires the %s capability, which the peer did not advertise", e.Method, e.Capability)
+}
+
+func (e *CapabilityError) Is(target error) bool {
+	return target == ErrCapabilityNotSupported
+}
+
+var _ error = (*TimeoutError)(nil)
+
+// TimeoutError is returned when a request sent to the peer is not answered before its deadline.
+// The peer is notified of the cancellation when this error is returned.
+// It matches both context.DeadlineExceeded and ErrRequestTimeout with errors.Is.
+type TimeoutError struct {
+	Method Method
+	ID     ID
+	// After is the timeout applied to the request, if it was set by the session rather than the caller's context
+	After time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	if e.After > 0 {
+		return fmt.Sprintf("request %s (id %s) timed out after %s", e.Method, e.ID, e.After)
+	}
+	return fmt.Sprintf("request %s (id %s) timed out", e.Method, e.ID)
+}
+
+// Timeout reports true, to satisfy the net.Error style of timeout detection.
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+func (e *TimeoutError) Is(target error) bool {
+	return target == context.DeadlineExceeded || target == ErrRequestTimeout
+}
@@ -0,0 +1,107 @@
+package mcp
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+)
+
+// DefaultEventStoreCapacity is the number of events kept by the event store of a session
+// when HTTPServerConfig.NewEventStore is not set.
+const DefaultEventStoreCapacity = 1024
+
+// ErrEventNotFound is returned by an EventStore when the event to resume after is unknown,
+// for example because it has already been evicted.
+var ErrEventNotFound = errors.New("event not found")
+
+// EventStore stores the events sent on the SSE streams of a session,
+// so that a client reconnecting with the Last-Event-ID header receives the events it missed.
+// A store is created for each session and must be safe for concurrent use.
+type EventStore interface {
+	// StoreEvent stores a message sent on the stream and returns the ID of its event.
+	// Event IDs must be unique across all streams of the session.
+	StoreEvent(streamID string, message json.RawMessage) (eventID string, err error)
+
+	// ReplayEventsAfter calls send, in order, for each event stored after the given event on the same stream,
+	// and returns the ID of that stream.
+	// It returns ErrEventNotFound if the event is unknown.
+	ReplayEventsAfter(lastEventID string, send func(eventID string, message json.RawMessage) error) (streamID string, err error)
+}
+
+// NewMemoryEventStore creates an EventStore keeping the latest events in memory.
+// Once capacity events are stored, the oldest ones are evicted.
+func NewMemoryEventStore(capacity int) EventStore {
+	if capacity <= 0 {
+		capacity = DefaultEventStoreCapacity
+	}
+
+	return &memoryEventStore{
+		events: make([]storedEvent, capacity),
+	}
+}
+
+var _ EventStore = (*memoryEventStore)(nil)
+
+// memoryEventStore is a ring buffer of events. Event IDs are sequence numbers starting from 1.
+type memoryEventStore struct {
+	mu     sync.Mutex
+	events []storedEvent
+	// Sequence number of the last stored event
+	last uint64
+}
+
+type storedEvent struct {
+	seq      uint64
+	streamID string
+	message  json.RawMessage
+}
+
+func (s *memoryEventStore) StoreEvent(streamID string, message json.RawMessage) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.last++
+	s.events[s.last%uint64(len(s.events))] = storedEvent{
+		seq:      s.last,
+		streamID: streamID,
+		message:  message,
+	}
+
+	return strconv.FormatUint(s.last, 10), nil
+}
+
+func (s *memoryEventStore) ReplayEventsAfter(lastEventID string, send func(eventID string, message json.RawMessage) error) (string, error) {
+	seq, err := strconv.ParseUint(lastEventID, 10, 64)
+	if err != nil {
+		return "", ErrEventNotFound
+	}
+
+	// Copy the events to be replayed, so that send is called without holding the lock
+	s.mu.Lock()
+	capacity := uint64(len(s.events))
+	event := s.events[seq%capacity]
+	if seq == 0 || event.seq != seq {
+		s.mu.Unlock()
+		return "", ErrEventNotFound
+	}
+
+	streamID := event.streamID
+	var replay []storedEvent
+	for next := seq + 1; next <= s.last; next++ {
+		e := s.events[next%capacity]
+		if e.streamID == streamID {
+			replay = append(replay, e)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, e := range replay {
+		err := send(strconv.FormatUint(e.seq, 10), e.message)
+		if err != nil {
+			return streamID, err
+		}
+	}
+
+	return streamID, nil
+}
@@ -0,0 +1,79 @@
+package mcp
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryEventStore_ReplayEventsAfter(t *testing.T) {
+	type event struct {
+		streamID string
+		message  string
+	}
+
+	tests := map[string]struct {
+		capacity     int
+		events       []event
+		lastEventID  string
+		wantStreamID string
+		wantMessages []string
+		wantErr      error
+	}{
+		"events after the last one on the same stream are replayed": {
+			capacity: 10,
+			events: []event{
+				{"a", `1`}, {"b", `2`}, {"a", `3`}, {"a", `4`},
+			},
+			lastEventID:  "1",
+			wantStreamID: "a",
+			wantMessages: []string{`3`, `4`},
+		},
+		"nothing is replayed after the latest event": {
+			capacity:     10,
+			events:       []event{{"a", `1`}, {"a", `2`}},
+			lastEventID:  "2",
+			wantStreamID: "a",
+		},
+		"evicted event is not found": {
+			capacity:    2,
+			events:      []event{{"a", `1`}, {"a", `2`}, {"a", `3`}},
+			lastEventID: "1",
+			wantErr:     ErrEventNotFound,
+		},
+		"unknown event is not found": {
+			capacity:    2,
+			events:      []event{{"a", `1`}},
+			lastEventID: "unknown",
+			wantErr:     ErrEventNotFound,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			store := NewMemoryEventStore(tc.capacity)
+			for _, e := range tc.events {
+				_, err := store.StoreEvent(e.streamID, json.RawMessage(e.message))
+				require.NoError(t, err)
+			}
+
+			var messages []string
+			streamID, err := store.ReplayEventsAfter(tc.lastEventID, func(eventID string, message json.RawMessage) error {
+				messages = append(messages, string(message))
+				return nil
+			})
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr, "replay should fail with expected error")
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantStreamID, streamID, "stream ID should match expected")
+			assert.Equal(t, tc.wantMessages, messages, "replayed messages should match expected")
+		})
+	}
+}
@@ -17,6 +17,8 @@ type ServerHandler interface {
 	// Log(t Transport, level slog.Level)
 }
 
+// ClientHandler serves the requests of servers to a client.
+// Elicitation is served by handlers which also implement ElicitationHandler.
 type ClientHandler interface {
 	SampleHandler
 
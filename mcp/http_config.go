@@ -5,19 +5,142 @@ import (
 	"time"
 )
 
+// DefaultRetryDelay is the delay before reconnecting a dropped SSE stream
+// when neither HTTPConfig.RetryDelay nor the server sets one.
+const DefaultRetryDelay = time.Second
+
+// DefaultSessionIdleTimeout is the time after which a session without any HTTP request is closed
+// when HTTPServerConfig.SessionIdleTimeout is not set.
+const DefaultSessionIdleTimeout = 30 * time.Minute
+
 type HTTPConfig struct {
-	// HTTP headers
+	// HTTP headers sent with every request
 	Headers http.Header
 	// HTTP Transport
 	Transport http.RoundTripper
-	// Origin
+	// Origin header sent with every request
 	Origin string
 
-	// Session ID
+	// ID of an existing session to continue.
+	// If empty, the session ID assigned by the server at initialization is used.
 	SessionID SessionID
 
-	// Retry delay
+	// Delay before reconnecting a dropped SSE stream.
+	// The server can override it with the retry field of its events.
 	RetryDelay time.Duration
+
+	// Configuration of the queues holding received requests and notifications until they are accepted
+	Queue QueueConfig
+
+	// OAuth enables the OAuth 2.1 authorization of the requests.
+	// If nil, requests are sent without authorization.
+	OAuth *OAuthConfig
+}
+
+func (c *HTTPConfig) retryDelay() time.Duration {
+	if c == nil || c.RetryDelay <= 0 {
+		return DefaultRetryDelay
+	}
+	return c.RetryDelay
 }
 
 type SessionID string
+
+// HTTPServerConfig configures the Streamable HTTP handler of a server.
+type HTTPServerConfig struct {
+	// JSONResponse makes the handler answer POST requests with a single JSON body
+	// instead of an SSE stream, even if the client accepts both.
+	JSONResponse bool
+
+	// Maximum size in bytes of the body of a POST request.
+	// Larger bodies are refused with 413 Request Entity Too Large.
+	MaxMessageSize int
+
+	// Configuration of the queues holding received requests and notifications until they are accepted
+	Queue QueueConfig
+
+	// Time after which a session without any HTTP request in progress is closed,
+	// so that the sessions abandoned by their clients are released.
+	// Zero means DefaultSessionIdleTimeout, and a negative value keeps idle sessions until they are deleted.
+	SessionIdleTimeout time.Duration
+
+	// NewEventStore creates the store of the events sent on the SSE streams of a session,
+	// which are replayed to a client resuming a stream with the Last-Event-ID header.
+	// If nil, each session keeps its latest events in memory with NewMemoryEventStore.
+	NewEventStore func() EventStore
+
+	// Auth enables the OAuth 2.1 authorization of every HTTP request.
+	// If nil, requests are not authorized.
+	Auth *AuthConfig
+
+	// Origins, such as "https://app.example.com", from which browsers may send cross-origin requests.
+	// "*" allows any origin. Requests from other origins are refused with 403 Forbidden,
+	// while requests without the Origin header and same-origin requests are always allowed.
+	AllowedOrigins []string
+	// Host names accepted in the Host header, to protect against DNS rebinding attacks.
+	// "*" allows any host. If empty, requests received on a loopback address must be sent to a loopback host,
+	// such as localhost, and other requests are not checked.
+	AllowedHosts []string
+	// Request headers allowed in cross-origin requests in addition to the headers used by the protocol
+	AllowedHeaders []string
+}
+
+func (c *HTTPServerConfig) auth() *AuthConfig {
+	if c == nil {
+		return nil
+	}
+	return c.Auth
+}
+
+func (c *HTTPServerConfig) allowedOrigins() []string {
+	if c == nil {
+		return nil
+	}
+	return c.AllowedOrigins
+}
+
+func (c *HTTPServerConfig) allowedHosts() []string {
+	if c == nil {
+		return nil
+	}
+	return c.AllowedHosts
+}
+
+func (c *HTTPServerConfig) allowedHeaders() []string {
+	if c == nil {
+		return nil
+	}
+	return c.AllowedHeaders
+}
+
+func (c *HTTPServerConfig) newEventStore() EventStore {
+	if c == nil || c.NewEventStore == nil {
+		return NewMemoryEventStore(DefaultEventStoreCapacity)
+	}
+	return c.NewEventStore()
+}
+
+func (c *HTTPServerConfig) jsonResponse() bool {
+	return c != nil && c.JSONResponse
+}
+
+func (c *HTTPServerConfig) maxMessageSize() int {
+	if c == nil || c.MaxMessageSize <= 0 {
+		return DefaultMaxMessageSize
+	}
+	return c.MaxMessageSize
+}
+
+func (c *HTTPServerConfig) queueConfig() QueueConfig {
+	if c == nil {
+		return QueueConfig{}
+	}
+	return c.Queue
+}
+
+func (c *HTTPServerConfig) sessionIdleTimeout() time.Duration {
+	if c == nil || c.SessionIdleTimeout == 0 {
+		return DefaultSessionIdleTimeout
+	}
+	return c.SessionIdleTimeout
+}
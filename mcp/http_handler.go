@@ -0,0 +1,525 @@
+package mcp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SessionIDHeader is the HTTP header carrying the session ID of the Streamable HTTP transport.
+const SessionIDHeader = "Mcp-Session-Id"
+
+// HTTPHandler returns an http.Handler serving the server over the Streamable HTTP transport.
+// The handler should be mounted on a single endpoint, such as "/mcp".
+//
+// A session is created by a POST request carrying an initialize request,
+// and its ID is returned in the Mcp-Session-Id header of the response.
+// Every subsequent request must carry that header.
+// POST requests send messages to the server and are answered with a JSON body or an SSE stream,
+// GET requests open an SSE stream for messages initiated by the server,
+// and DELETE requests terminate the session.
+//
+// The same handler is returned on every call, so that all of them share the sessions.
+func (s *Server) HTTPHandler() http.Handler {
+	if !s.initialized {
+		s.init()
+	}
+
+	s.httpHandlerOnce.Do(func() {
+		s.httpHandler = &httpHandler{
+			server:     s,
+			config:     s.HTTPConfig,
+			transports: make(map[string]*httpServerTransport),
+		}
+	})
+
+	return s.httpHandler
+}
+
+// SSEHandler returns an http.Handler serving the server over the HTTP+SSE transport
+// of the protocol version 2024-11-05, for clients which do not support the Streamable HTTP transport.
+//
+// A GET request opens an SSE stream, which creates a session lasting as long as the stream.
+// Its first event, named "endpoint", tells the URL to which the client posts its messages,
+// which is the path of the handler with the session ID in the sessionId query parameter.
+// All messages from the server, including responses, are sent on the stream.
+//
+// The same handler is returned on every call, so that all of them share the sessions.
+func (s *Server) SSEHandler() http.Handler {
+	if !s.initialized {
+		s.init()
+	}
+
+	s.sseHandlerOnce.Do(func() {
+		s.sseHandler = &httpHandler{
+			server:     s,
+			config:     s.HTTPConfig,
+			legacy:     true,
+			transports: make(map[string]*httpServerTransport),
+		}
+	})
+
+	return s.sseHandler
+}
+
+// DefaultHTTPPath is the path on which ListenAndServeHTTP serves the Streamable HTTP transport.
+const DefaultHTTPPath = "/mcp"
+
+// ListenAndServeHTTP listens on addr and serves the Streamable HTTP transport on DefaultHTTPPath,
+// and the protected resource metadata if HTTPConfig.Auth is set.
+// If addr has no host, such as ":8080", it listens on the loopback interface only,
+// so that a local server is not exposed to the network. Use "0.0.0.0:8080" to listen on all interfaces.
+// It returns http.ErrServerClosed once the server is closed.
+func (s *Server) ListenAndServeHTTP(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		addr = net.JoinHostPort("127.0.0.1", port)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(DefaultHTTPPath, s.HTTPHandler())
+	if s.HTTPConfig.auth() != nil {
+		mux.Handle(ProtectedResourceMetadataPath+"/", s.ProtectedResourceMetadataHandler())
+	}
+
+	httpServer := &http.Server{Addr: addr, Handler: mux}
+
+	s.cancelFuncsLock.Lock()
+	s.cancelFuncs = append(s.cancelFuncs, func() { httpServer.Close() })
+	s.cancelFuncsLock.Unlock()
+
+	return httpServer.ListenAndServe()
+}
+
+var _ http.Handler = (*httpHandler)(nil)
+
+type httpHandler struct {
+	server *Server
+	config *HTTPServerConfig
+
+	// legacy is true for the HTTP+SSE transport
+	legacy bool
+
+	transports     map[string]*httpServerTransport
+	transportsLock sync.Mutex
+}
+
+func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	methods := "GET, POST, DELETE"
+	if h.legacy {
+		methods = "GET, POST"
+	}
+	if protectHTTP(w, r, h.config, methods) {
+		return
+	}
+
+	if auth := h.config.auth(); auth != nil {
+		var ok bool
+		r, ok = authenticate(w, r, auth)
+		if !ok {
+			return
+		}
+	}
+
+	if h.legacy {
+		h.serveLegacy(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		h.servePost(w, r)
+	case http.MethodGet:
+		h.serveGet(w, r)
+	case http.MethodDelete:
+		h.serveDelete(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *httpHandler) servePost(w http.ResponseWriter, r *http.Request) {
+	messages, batch, ok := h.readBody(w, r)
+	if !ok {
+		return
+	}
+
+	sse := !h.config.jsonResponse() && acceptsEventStream(r)
+
+	if containsInitialize(messages) {
+		// The initialize request must be sent alone
+		if batch || len(messages) > 1 {
+			writeHTTPError(w, http.StatusBadRequest, ErrInvalidRequest)
+			return
+		}
+
+		sessionID, err := newSessionID()
+		if err != nil {
+			h.server.logger().Error("failed to create session", "error", err)
+			writeHTTPError(w, http.StatusInternalServerError, ErrInternalError)
+			return
+		}
+
+		t := newServerHTTPTransport(sessionID, h.config.queueConfig(), h.config.newEventStore())
+		if info, ok := AuthInfoFromContext(r.Context()); ok {
+			t.subject = info.Subject
+		}
+		ready := h.startSession(t)
+
+		w.Header().Set(SessionIDHeader, t.sessionID)
+		t.servePost(w, r, messages, batch, sse)
+
+		// Wait for the session to be registered, so that it is known once the response is complete
+		select {
+		case <-ready:
+		case <-r.Context().Done():
+		}
+		return
+	}
+
+	t, ok := h.lookupSession(w, r)
+	if !ok {
+		return
+	}
+
+	t.servePost(w, r, messages, batch, sse)
+}
+
+func (h *httpHandler) serveGet(w http.ResponseWriter, r *http.Request) {
+	if !acceptsEventStream(r) {
+		http.Error(w, "client must accept text/event-stream", http.StatusNotAcceptable)
+		return
+	}
+
+	t, ok := h.lookupSession(w, r)
+	if !ok {
+		return
+	}
+
+	t.serveStream(w, r)
+}
+
+func (h *httpHandler) serveDelete(w http.ResponseWriter, r *http.Request) {
+	t, ok := h.lookupSession(w, r)
+	if !ok {
+		return
+	}
+
+	t.Close()
+	h.removeSession(t.sessionID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveLegacy serves a request of the HTTP+SSE transport.
+func (h *httpHandler) serveLegacy(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if !acceptsEventStream(r) {
+			http.Error(w, "client must accept text/event-stream", http.StatusNotAcceptable)
+			return
+		}
+
+		sessionID, err := newSessionID()
+		if err != nil {
+			h.server.logger().Error("failed to create session", "error", err)
+			http.Error(w, "failed to create session", http.StatusInternalServerError)
+			return
+		}
+
+		t := newServerHTTPTransport(sessionID, h.config.queueConfig(), nil)
+		if info, ok := AuthInfoFromContext(r.Context()); ok {
+			t.subject = info.Subject
+		}
+
+		end := t.startHTTPRequest()
+		defer end()
+
+		// The session is registered before the client knows its endpoint, so that its first POST finds it
+		h.startSession(t)
+
+		// The endpoint is written before any message of the session
+		writeSSEHeaders(w)
+		endpoint := url.URL{Path: r.URL.Path, RawQuery: url.Values{"sessionId": {sessionID}}.Encode()}
+		detached, _ := t.standaloneStream.resume(w, func() error {
+			fmt.Fprintf(w, "event: endpoint\ndata: %s\n\n", endpoint.String())
+			http.NewResponseController(w).Flush()
+			return nil
+		})
+		defer t.standaloneStream.detach(detached)
+
+		// The session ends with the stream
+		select {
+		case <-r.Context().Done():
+		case <-t.done:
+		case <-detached:
+		}
+		t.Close()
+	case http.MethodPost:
+		sessionID := r.URL.Query().Get("sessionId")
+		if sessionID == "" {
+			http.Error(w, "missing sessionId query parameter", http.StatusBadRequest)
+			return
+		}
+
+		h.transportsLock.Lock()
+		t, ok := h.transports[sessionID]
+		h.transportsLock.Unlock()
+		if !ok {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		if !checkSubject(w, r, t) {
+			return
+		}
+
+		messages, batch, ok := h.readBody(w, r)
+		if !ok {
+			return
+		}
+
+		t.serveLegacyPost(w, r, messages, batch)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// readBody reads the messages in the body of a POST request.
+// If the body is not valid, the request is answered with an error and ok is false.
+func (h *httpHandler) readBody(w http.ResponseWriter, r *http.Request) (messages []json.RawMessage, batch bool, ok bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(h.config.maxMessageSize())))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "message exceeds maximum size", http.StatusRequestEntityTooLarge)
+			return nil, false, false
+		}
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return nil, false, false
+	}
+
+	messages, batch, errObj := parseHTTPBody(body)
+	if errObj != nil {
+		writeHTTPError(w, http.StatusBadRequest, errObj)
+		return nil, false, false
+	}
+
+	return messages, batch, true
+}
+
+// startSession registers the transport of a new session and starts its initialization,
+// which completes when the initialize request is answered.
+// The returned channel is closed once the initialization has finished, successfully or not.
+func (h *httpHandler) startSession(t *httpServerTransport) <-chan struct{} {
+	sessionID := t.sessionID
+
+	h.transportsLock.Lock()
+	h.transports[sessionID] = t
+	h.transportsLock.Unlock()
+
+	ready := make(chan struct{})
+	go func() {
+		sess, err := h.server.accept(t)
+		if err != nil {
+			h.server.logger().Error("failed to initialize session", "session_id", sessionID, "error", err)
+			t.CloseWithError(err)
+			close(ready)
+		} else {
+			// Sessions served by ServeTransport are not served by the server, and are not registered
+			if sess, ok := sess.(*serverSession); ok {
+				sess.sessionID = sessionID
+				h.server.addSession(sess)
+			}
+			close(ready)
+		}
+
+		h.waitSession(t)
+		h.removeSession(sessionID)
+	}()
+
+	return ready
+}
+
+// errSessionIdle is the cause of the closure of a session which had no HTTP request for the idle timeout.
+var errSessionIdle = errors.New("session closed after being idle")
+
+// waitSession waits for the session to end,
+// and closes it once it has had no HTTP request in progress for the idle timeout,
+// so that the sessions abandoned by their clients are not kept forever.
+func (h *httpHandler) waitSession(t *httpServerTransport) {
+	timeout := h.config.sessionIdleTimeout()
+	if timeout < 0 {
+		<-t.Done()
+		return
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-t.Done():
+			return
+		case <-timer.C:
+		}
+
+		since, idle := t.idleSince()
+		if !idle {
+			timer.Reset(timeout)
+			continue
+		}
+		if remaining := timeout - time.Since(since); remaining > 0 {
+			timer.Reset(remaining)
+			continue
+		}
+
+		h.server.logger().Info("closing idle session", "session_id", t.sessionID, "idle_timeout", timeout)
+		t.CloseWithError(errSessionIdle)
+		<-t.Done()
+		return
+	}
+}
+
+// lookupSession returns the transport of the session identified by the request.
+// If it is not found, the request is answered with
+// 400 Bad Request when the session ID is missing and 404 Not Found when it is unknown.
+// A session initialized by another principal is answered with 403 Forbidden.
+func (h *httpHandler) lookupSession(w http.ResponseWriter, r *http.Request) (*httpServerTransport, bool) {
+	sessionID := r.Header.Get(SessionIDHeader)
+	if sessionID == "" {
+		http.Error(w, "missing "+SessionIDHeader+" header", http.StatusBadRequest)
+		return nil, false
+	}
+
+	h.transportsLock.Lock()
+	t, ok := h.transports[sessionID]
+	h.transportsLock.Unlock()
+
+	if !ok {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return nil, false
+	}
+	if !checkSubject(w, r, t) {
+		return nil, false
+	}
+
+	return t, true
+}
+
+// checkSubject verifies that the request is authorized for the same principal as the initialization of the session,
+// so that a session cannot be used with the token of another user.
+// If not, the request is answered with 403 Forbidden.
+func checkSubject(w http.ResponseWriter, r *http.Request, t *httpServerTransport) bool {
+	info, ok := AuthInfoFromContext(r.Context())
+	if !ok || info.Subject == t.subject {
+		return true
+	}
+
+	http.Error(w, "session belongs to another principal", http.StatusForbidden)
+	return false
+}
+
+func (h *httpHandler) removeSession(sessionID string) {
+	h.transportsLock.Lock()
+	delete(h.transports, sessionID)
+	h.transportsLock.Unlock()
+
+	h.server.removeSession(sessionID)
+}
+
+// closeAll terminates all sessions served by the handler.
+func (h *httpHandler) closeAll() {
+	h.transportsLock.Lock()
+	transports := make([]*httpServerTransport, 0, len(h.transports))
+	for _, t := range h.transports {
+		transports = append(transports, t)
+	}
+	h.transportsLock.Unlock()
+
+	for _, t := range transports {
+		t.Close()
+	}
+}
+
+// newSessionID generates a globally unique and cryptographically secure session ID.
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// parseHTTPBody splits the body of a POST request into its messages.
+// batch reports whether the body is a JSON array.
+func parseHTTPBody(body []byte) (messages []json.RawMessage, batch bool, errObj *Error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		err := json.Unmarshal(body, &messages)
+		if err != nil {
+			return nil, true, ErrParseError
+		}
+		if len(messages) == 0 {
+			return nil, true, ErrInvalidRequest
+		}
+		return messages, true, nil
+	}
+
+	if !json.Valid(body) {
+		return nil, false, ErrParseError
+	}
+
+	return []json.RawMessage{body}, false, nil
+}
+
+func containsInitialize(messages []json.RawMessage) bool {
+	for _, raw := range messages {
+		var message struct {
+			Method Method `json:"method"`
+		}
+		if json.Unmarshal(raw, &message) == nil && message.Method == MethodInit {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsEventStream reports whether the Accept header of the request lists text/event-stream.
+func acceptsEventStream(r *http.Request) bool {
+	for _, value := range r.Header.Values("Accept") {
+		for _, mediaType := range strings.Split(value, ",") {
+			mediaType, _, _ = strings.Cut(mediaType, ";")
+			if strings.TrimSpace(mediaType) == "text/event-stream" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeHTTPError answers an HTTP request with a JSON-RPC error response which has a null ID.
+func writeHTTPError(w http.ResponseWriter, status int, errObj *Error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      nil,
+		"error":   errObj,
+	})
+}
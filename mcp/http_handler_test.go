@@ -0,0 +1,447 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// postHTTP sends a POST request with the message as JSON body to the Streamable HTTP endpoint.
+func postHTTP(t *testing.T, url, sessionID, accept string, message any) *http.Response {
+	t.Helper()
+
+	body, err := json.Marshal(message)
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", accept)
+	if sessionID != "" {
+		req.Header.Set(SessionIDHeader, sessionID)
+	}
+
+	rsp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { rsp.Body.Close() })
+
+	return rsp
+}
+
+// initializeHTTP creates a session on the Streamable HTTP endpoint and returns its ID.
+func initializeHTTP(t *testing.T, url string) string {
+	t.Helper()
+
+	rsp := postHTTP(t, url, "", "application/json, text/event-stream", map[string]any{
+		"jsonrpc": "2.0",
+		"id":      0,
+		"method":  MethodInit,
+		"params": map[string]any{
+			"protocolVersion": DefaultVersion,
+			"capabilities":    map[string]any{},
+			"clientInfo":      map[string]any{"name": "test", "version": "0.0.1"},
+		},
+	})
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+	sessionID := rsp.Header.Get(SessionIDHeader)
+	require.NotEmpty(t, sessionID, "initialize response should carry a session ID")
+
+	// Wait for the response, after which the session is ready
+	readSSEMessage(t, rsp)
+
+	return sessionID
+}
+
+// readSSEMessage reads the data of the next message event of an SSE stream.
+func readSSEMessage(t *testing.T, rsp *http.Response) json.RawMessage {
+	t.Helper()
+
+	scanner := bufio.NewScanner(rsp.Body)
+	for scanner.Scan() {
+		if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			return json.RawMessage(data)
+		}
+	}
+	require.NoError(t, scanner.Err())
+	t.Fatal("stream ended without a message")
+	return nil
+}
+
+func TestHTTPHandler_ServeHTTP(t *testing.T) {
+	tests := map[string]struct {
+		method          string
+		sessionID       string
+		accept          string
+		body            string
+		wantStatus      int
+		wantContentType string
+	}{
+		"request is answered with JSON": {
+			method:          http.MethodPost,
+			accept:          "application/json",
+			body:            `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`,
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/json",
+		},
+		"request is answered with SSE stream when accepted": {
+			method:          http.MethodPost,
+			accept:          "application/json, text/event-stream",
+			body:            `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`,
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/event-stream",
+		},
+		"notification is accepted without body": {
+			method:     http.MethodPost,
+			accept:     "application/json, text/event-stream",
+			body:       `{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+			wantStatus: http.StatusAccepted,
+		},
+		"malformed body is a bad request": {
+			method:          http.MethodPost,
+			accept:          "application/json",
+			body:            `{"jsonrpc":"2.0",`,
+			wantStatus:      http.StatusBadRequest,
+			wantContentType: "application/json",
+		},
+		"batch containing initialize is a bad request": {
+			method:     http.MethodPost,
+			accept:     "application/json",
+			body:       `[{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}]`,
+			wantStatus: http.StatusBadRequest,
+		},
+		"missing session ID is a bad request": {
+			method:     http.MethodPost,
+			sessionID:  "-",
+			accept:     "application/json",
+			body:       `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		"unknown session is not found": {
+			method:     http.MethodPost,
+			sessionID:  "unknown",
+			accept:     "application/json",
+			body:       `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`,
+			wantStatus: http.StatusNotFound,
+		},
+		"stream requires event stream to be accepted": {
+			method:     http.MethodGet,
+			accept:     "application/json",
+			wantStatus: http.StatusNotAcceptable,
+		},
+		"unsupported method is not allowed": {
+			method:     http.MethodPut,
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer("test-server", "0.0.1")
+			server.Handler = newTestServerMux()
+			ts := httptest.NewServer(server.HTTPHandler())
+			t.Cleanup(ts.Close)
+
+			sessionID := initializeHTTP(t, ts.URL)
+			switch tc.sessionID {
+			case "":
+			case "-":
+				sessionID = ""
+			default:
+				sessionID = tc.sessionID
+			}
+
+			req, err := http.NewRequest(tc.method, ts.URL, strings.NewReader(tc.body))
+			require.NoError(t, err)
+			req.Header.Set("Accept", tc.accept)
+			if sessionID != "" {
+				req.Header.Set(SessionIDHeader, sessionID)
+			}
+
+			rsp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer rsp.Body.Close()
+
+			assert.Equal(t, tc.wantStatus, rsp.StatusCode, "status code should match expected")
+			if tc.wantContentType != "" {
+				assert.Equal(t, tc.wantContentType, rsp.Header.Get("Content-Type"), "content type should match expected")
+			}
+		})
+	}
+}
+
+func TestHTTPHandler_Session(t *testing.T) {
+	server := NewServer("test-server", "0.0.1")
+	server.Handler = newTestServerMux()
+	ts := httptest.NewServer(server.HTTPHandler())
+	t.Cleanup(ts.Close)
+
+	sessionID := initializeHTTP(t, ts.URL)
+
+	// Requests are answered within the session
+	rsp := postHTTP(t, ts.URL, sessionID, "application/json, text/event-stream", map[string]any{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  MethodListTools,
+	})
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+	var message struct {
+		ID     ID              `json:"id"`
+		Result json.RawMessage `json:"result"`
+	}
+	require.NoError(t, json.Unmarshal(readSSEMessage(t, rsp), &message))
+	assert.Equal(t, ID("1"), message.ID, "response should answer the request")
+	assert.NotEmpty(t, message.Result, "response should have a result")
+
+	// The session is terminated by DELETE
+	req, err := http.NewRequest(http.MethodDelete, ts.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set(SessionIDHeader, sessionID)
+
+	deleteRsp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	deleteRsp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, deleteRsp.StatusCode, "session should be terminated")
+
+	rsp = postHTTP(t, ts.URL, sessionID, "application/json", map[string]any{
+		"jsonrpc": "2.0",
+		"id":      2,
+		"method":  MethodListTools,
+	})
+	assert.Equal(t, http.StatusNotFound, rsp.StatusCode, "terminated session should not be found")
+}
+
+func TestHTTPHandler_ServeTransport(t *testing.T) {
+	server := NewServer("test-server", "0.0.1")
+	server.ServeTransport = func(t Transport) error {
+		_, w, err := t.AcceptRequest(context.Background())
+		if err != nil {
+			return err
+		}
+		return w.WriteResult(Result(`{"protocolVersion": "` + string(DefaultVersion) + `", "capabilities": {}, "serverInfo": {"name": "relayed", "version": "0.0.1"}}`))
+	}
+	ts := httptest.NewServer(server.HTTPHandler())
+	t.Cleanup(ts.Close)
+
+	initializeHTTP(t, ts.URL)
+
+	// The session is served by ServeTransport, and not by the server
+	server.sessionsLock.Lock()
+	defer server.sessionsLock.Unlock()
+	assert.Empty(t, server.sessions, "relayed session should not be registered")
+}
+
+func TestHTTPHandler_SessionIdleTimeout(t *testing.T) {
+	server := NewServer("test-server", "0.0.1")
+	server.Handler = newTestServerMux()
+	server.HTTPConfig = &HTTPServerConfig{SessionIdleTimeout: 100 * time.Millisecond}
+	ts := httptest.NewServer(server.HTTPHandler())
+	t.Cleanup(ts.Close)
+
+	listTools := map[string]any{"jsonrpc": "2.0", "id": 1, "method": MethodListTools}
+
+	sessionID := initializeHTTP(t, ts.URL)
+
+	// An open stream keeps the session alive
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set(SessionIDHeader, sessionID)
+	stream, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, stream.StatusCode)
+
+	time.Sleep(300 * time.Millisecond)
+	rsp := postHTTP(t, ts.URL, sessionID, "application/json", listTools)
+	assert.Equal(t, http.StatusOK, rsp.StatusCode, "session with a stream open should not be idle")
+
+	cancel()
+	stream.Body.Close()
+
+	// Each check is an HTTP request of the session, so they are spaced by more than the idle timeout
+	assert.Eventually(t, func() bool {
+		rsp := postHTTP(t, ts.URL, sessionID, "application/json", map[string]any{"jsonrpc": "2.0", "method": MethodNotifyInitialized})
+		return rsp.StatusCode == http.StatusNotFound
+	}, time.Second, 200*time.Millisecond, "idle session should be closed")
+}
+
+func TestServer_SSEHandler(t *testing.T) {
+	tests := map[string]struct {
+		dial func(c *Client, url string) (ClientSession, error)
+	}{
+		"client dials the HTTP+SSE transport": {
+			dial: func(c *Client, url string) (ClientSession, error) {
+				return c.DialSSE(url, nil)
+			},
+		},
+		"client falls back to the HTTP+SSE transport": {
+			dial: func(c *Client, url string) (ClientSession, error) {
+				return c.DialHTTP(url, nil)
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer("test-server", "0.0.1")
+			server.Handler = newTestServerMux()
+			ts := httptest.NewServer(server.SSEHandler())
+			t.Cleanup(ts.Close)
+			t.Cleanup(func() { server.Close() })
+
+			sess, err := tc.dial(NewClient("test-client", "0.0.1"), ts.URL+"/sse")
+			require.NoError(t, err)
+			t.Cleanup(func() { sess.Close() })
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			results, err := sess.Batch(ctx, &Request{Method: MethodListTools}, &Request{Method: "unknown/method"})
+			require.NoError(t, err)
+			require.Len(t, results, 2)
+			assert.NoError(t, results[0].Err, "tools/list should be answered on the stream")
+			assert.ErrorIs(t, results[1].Err, ErrMethodNotFound, "unknown method should be answered with an error")
+		})
+	}
+}
+
+func TestServer_SSEHandler_Endpoint(t *testing.T) {
+	server := NewServer("test-server", "0.0.1")
+	ts := httptest.NewServer(server.SSEHandler())
+	t.Cleanup(ts.Close)
+	t.Cleanup(func() { server.Close() })
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/sse", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "text/event-stream")
+	stream, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { stream.Body.Close() })
+
+	reader := bufio.NewReader(stream.Body)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "event: endpoint\n", line)
+	line, err = reader.ReadString('\n')
+	require.NoError(t, err)
+	endpoint := strings.TrimSpace(strings.TrimPrefix(line, "data: "))
+
+	// The session is known as soon as its endpoint is
+	rsp := postHTTP(t, ts.URL+endpoint, "", "application/json", map[string]any{
+		"jsonrpc": "2.0",
+		"id":      0,
+		"method":  MethodInit,
+		"params": map[string]any{
+			"protocolVersion": DefaultVersion,
+			"capabilities":    map[string]any{},
+			"clientInfo":      map[string]any{"name": "test", "version": "0.0.1"},
+		},
+	})
+	assert.Equal(t, http.StatusAccepted, rsp.StatusCode)
+}
+
+func TestHTTPHandler_Protection(t *testing.T) {
+	server := NewServer("test-server", "0.0.1")
+	server.Handler = newTestServerMux()
+	server.HTTPConfig = &HTTPServerConfig{
+		AllowedOrigins: []string{"https://app.example.com"},
+		AllowedHeaders: []string{"X-Custom"},
+	}
+	ts := httptest.NewServer(server.HTTPHandler())
+	t.Cleanup(ts.Close)
+	t.Cleanup(func() { server.Close() })
+
+	tests := map[string]struct {
+		method      string
+		host        string
+		origin      string
+		wantStatus  int
+		wantHeaders map[string]string
+	}{
+		"request without origin is allowed": {
+			method:     http.MethodGet,
+			wantStatus: http.StatusBadRequest,
+		},
+		"same-origin request is allowed": {
+			method:     http.MethodGet,
+			origin:     ts.URL,
+			wantStatus: http.StatusBadRequest,
+		},
+		"cross-origin request from an allowed origin is allowed": {
+			method:     http.MethodGet,
+			origin:     "https://app.example.com",
+			wantStatus: http.StatusBadRequest,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":   "https://app.example.com",
+				"Access-Control-Expose-Headers": SessionIDHeader + ", WWW-Authenticate",
+			},
+		},
+		"cross-origin request is forbidden": {
+			method:     http.MethodGet,
+			origin:     "https://evil.example.com",
+			wantStatus: http.StatusForbidden,
+		},
+		"rebound host on loopback is forbidden": {
+			method:     http.MethodGet,
+			host:       "evil.example.com",
+			origin:     "http://evil.example.com",
+			wantStatus: http.StatusForbidden,
+		},
+		"preflight from an allowed origin is answered": {
+			method:     http.MethodOptions,
+			origin:     "https://app.example.com",
+			wantStatus: http.StatusNoContent,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":  "https://app.example.com",
+				"Access-Control-Allow-Methods": "GET, POST, DELETE",
+				"Access-Control-Allow-Headers": "Accept, Authorization, Content-Type, Last-Event-ID, " + SessionIDHeader + ", X-Custom",
+			},
+		},
+		"preflight from another origin is forbidden": {
+			method:     http.MethodOptions,
+			origin:     "https://evil.example.com",
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, ts.URL, nil)
+			require.NoError(t, err)
+			req.Header.Set("Accept", "text/event-stream")
+			if tc.host != "" {
+				req.Host = tc.host
+			}
+			if tc.origin != "" {
+				req.Header.Set("Origin", tc.origin)
+			}
+			if tc.method == http.MethodOptions {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tc.wantStatus, resp.StatusCode)
+			for key, value := range tc.wantHeaders {
+				assert.Equal(t, value, resp.Header.Get(key), key)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package mcp
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// corsHeaders are the request headers used by the protocol, which are always allowed in cross-origin requests.
+var corsHeaders = []string{"Accept", "Authorization", "Content-Type", "Last-Event-ID", SessionIDHeader}
+
+// checkHost reports whether the Host header of the request is allowed, which protects against DNS rebinding:
+// a malicious page whose domain resolves to a loopback address must not reach a local server.
+// Without an allow-list, a request received on a loopback address must be sent to a loopback host.
+func checkHost(r *http.Request, allowedHosts []string) bool {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+
+	if len(allowedHosts) == 0 {
+		localAddr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+		if !ok || !isLoopbackAddr(localAddr) {
+			return true
+		}
+		return isLoopbackHost(host)
+	}
+
+	for _, allowed := range allowedHosts {
+		if allowed == "*" || strings.EqualFold(allowed, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkOrigin reports whether a request with the Origin header is allowed,
+// that is, whether it is same-origin or its origin is in the allow-list.
+// Requests without the header are not sent by browsers on behalf of a web page, and are allowed.
+func checkOrigin(r *http.Request, allowedOrigins []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || isSameOrigin(r, origin) {
+		return true
+	}
+
+	for _, allowed := range allowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// protectHTTP validates the Host and Origin headers of the request and writes the CORS headers.
+// It answers a CORS preflight request itself. handled is true if the request has been answered,
+// with 403 Forbidden when the request is refused.
+func protectHTTP(w http.ResponseWriter, r *http.Request, config *HTTPServerConfig, methods string) (handled bool) {
+	if !checkHost(r, config.allowedHosts()) {
+		http.Error(w, "host not allowed", http.StatusForbidden)
+		return true
+	}
+	if !checkOrigin(r, config.allowedOrigins()) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return true
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+
+	header := w.Header()
+	header.Set("Access-Control-Allow-Origin", origin)
+	header.Add("Vary", "Origin")
+	header.Set("Access-Control-Expose-Headers", SessionIDHeader+", WWW-Authenticate")
+
+	if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+		allowedHeaders := append(append([]string{}, corsHeaders...), config.allowedHeaders()...)
+		header.Set("Access-Control-Allow-Methods", methods)
+		header.Set("Access-Control-Allow-Headers", strings.Join(allowedHeaders, ", "))
+		header.Set("Access-Control-Max-Age", "86400")
+		w.WriteHeader(http.StatusNoContent)
+		return true
+	}
+
+	return false
+}
+
+func isSameOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func isLoopbackAddr(addr net.Addr) bool {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
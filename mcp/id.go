@@ -1,12 +1,28 @@
 package mcp
 
 import (
+	"encoding/json"
 	"strconv"
 	"sync/atomic"
 )
 
+// ID is a JSON-RPC request ID.
+// It holds the raw JSON representation of the ID, so that IDs received from the peer
+// are echoed back exactly as they were sent, whether they are numbers or strings.
 type ID string
 
+func (id ID) MarshalJSON() ([]byte, error) {
+	if id == "" || !json.Valid([]byte(id)) {
+		return json.Marshal(string(id))
+	}
+	return []byte(id), nil
+}
+
+func (id *ID) UnmarshalJSON(data []byte) error {
+	*id = ID(data)
+	return nil
+}
+
 func NewIDGenerator() IDGenerator {
 	return IDGenerator{}
 }
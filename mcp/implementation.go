@@ -0,0 +1,9 @@
+package mcp
+
+// Implementation describes a client or a server, as sent in the initialization.
+type Implementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// Title is a human-readable name for display. It is optional.
+	Title string `json:"title,omitempty"`
+}
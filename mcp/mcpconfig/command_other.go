@@ -0,0 +1,9 @@
+//go:build !unix
+
+package mcpconfig
+
+import "os/exec"
+
+// killProcessGroup does nothing, as process groups are not supported.
+// Only the command is killed when the context of the command is done.
+func killProcessGroup(cmd *exec.Cmd) {}
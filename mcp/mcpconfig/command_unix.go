@@ -0,0 +1,16 @@
+//go:build unix
+
+package mcpconfig
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killProcessGroup starts the command in a new process group, which is killed when the context of the command is done.
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
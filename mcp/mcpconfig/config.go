@@ -0,0 +1,559 @@
+// Package mcpconfig builds servers from declarative configurations written in YAML or JSON,
+// so that simple servers need no Go code.
+//
+// A configuration declares the information and the capabilities of the server,
+// static resources read from files, prompts rendered from text/template templates,
+// and tools running shell commands:
+//
+//	name: files
+//	version: 1.0.0
+//	instructions: Use the tools to inspect the disk.
+//	resources:
+//	  - name: readme
+//	    file: README.md
+//	prompts:
+//	  - name: review
+//	    arguments:
+//	      - name: code
+//	        required: true
+//	    messages:
+//	      - role: user
+//	        text: "Review this code:\n{{.code}}"
+//	tools:
+//	  - name: disk_usage
+//	    inputSchema:
+//	      type: object
+//	      properties:
+//	        path: {type: string}
+//	      required: [path]
+//	    command: du -sh "$MCP_ARG_PATH"
+//	    timeout: 10s
+package mcpconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the format of a configuration.
+type Format string
+
+const (
+	YAML Format = "yaml"
+	JSON Format = "json"
+)
+
+// Config is the configuration of a server.
+type Config struct {
+	Name    string `json:"name" yaml:"name"`
+	Version string `json:"version" yaml:"version"`
+	// Title is a human-readable name of the server, for display. It is optional.
+	Title        string `json:"title,omitempty" yaml:"title,omitempty"`
+	Instructions string `json:"instructions,omitempty" yaml:"instructions,omitempty"`
+
+	Capabilities Capabilities `json:"capabilities,omitempty" yaml:"capabilities,omitempty"`
+
+	Resources []*Resource `json:"resources,omitempty" yaml:"resources,omitempty"`
+	Prompts   []*Prompt   `json:"prompts,omitempty" yaml:"prompts,omitempty"`
+	Tools     []*Tool     `json:"tools,omitempty" yaml:"tools,omitempty"`
+
+	// Dir is the directory against which the relative paths of the configuration are resolved.
+	// ReadFile sets it to the directory of the file. If empty, it is the working directory.
+	Dir string `json:"-" yaml:"-"`
+}
+
+// Capabilities are the optional capabilities of the server.
+// The resources, prompts and tools capabilities are advertised when any of them is declared.
+type Capabilities struct {
+	ResourceSubscription         bool `json:"resourceSubscription,omitempty" yaml:"resourceSubscription,omitempty"`
+	ResourcesChangedNotification bool `json:"resourcesChangedNotification,omitempty" yaml:"resourcesChangedNotification,omitempty"`
+	PromptsChangedNotification   bool `json:"promptsChangedNotification,omitempty" yaml:"promptsChangedNotification,omitempty"`
+	ToolsChangedNotification     bool `json:"toolsChangedNotification,omitempty" yaml:"toolsChangedNotification,omitempty"`
+}
+
+// Resource is a static resource whose contents are read from a file on every read.
+type Resource struct {
+	// URI defaults to the file URI of the absolute path of the file
+	URI string `json:"uri,omitempty" yaml:"uri,omitempty"`
+	// Name defaults to the base name of the file
+	Name        string `json:"name,omitempty" yaml:"name,omitempty"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	// MimeType defaults to the type of the extension of the file.
+	// Files of text types, or valid UTF-8 without a known type, are read as text, and others as binary.
+	MimeType string `json:"mimeType,omitempty" yaml:"mimeType,omitempty"`
+	// File is the path of the file, relative to the directory of the configuration
+	File string `json:"file" yaml:"file"`
+}
+
+// Prompt is a prompt whose messages are rendered from text/template templates with the arguments of the request.
+type Prompt struct {
+	Name        string            `json:"name" yaml:"name"`
+	Description string            `json:"description,omitempty" yaml:"description,omitempty"`
+	Arguments   []*PromptArgument `json:"arguments,omitempty" yaml:"arguments,omitempty"`
+	Messages    []*PromptMessage  `json:"messages" yaml:"messages"`
+}
+
+// PromptArgument is an argument of a prompt.
+// An optional argument missing from a request is rendered as an empty string.
+type PromptArgument struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Required    bool   `json:"required,omitempty" yaml:"required,omitempty"`
+}
+
+// PromptMessage is a message of a prompt.
+type PromptMessage struct {
+	// Role is "user" or "assistant"
+	Role string `json:"role" yaml:"role"`
+	// Text is the template of the text of the message, executed with the arguments, such as {{.code}}
+	Text string `json:"text" yaml:"text"`
+}
+
+// Tool is a tool running a shell command with "sh -c".
+//
+// The arguments of the call are passed in environment variables rather than in the command,
+// so that they are never interpreted by the shell: MCP_ARGUMENTS holds all of them in JSON,
+// and MCP_ARG_<NAME> holds each of them, with the name in upper case, strings as they are and other values in JSON.
+// Only the properties declared in the input schema are accepted as arguments.
+// The command runs in its own process group, which is killed when the call is cancelled or times out.
+// The standard output of the command is the text content of the result.
+// A command exiting with a non-zero status fails the call with its standard error.
+type Tool struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	// InputSchema is the JSON schema of the arguments, which must be of type object.
+	// If empty, the tool takes no arguments.
+	InputSchema map[string]any `json:"inputSchema,omitempty" yaml:"inputSchema,omitempty"`
+	Annotations map[string]any `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+
+	Command string `json:"command" yaml:"command"`
+	// Dir is the working directory of the command, relative to the directory of the configuration.
+	// If empty, it is the directory of the configuration.
+	Dir string `json:"dir,omitempty" yaml:"dir,omitempty"`
+	// Env are environment variables added to the environment of the current process
+	Env map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
+	// Timeout is the maximum execution time of the command, such as "30s". If empty, there is no limit.
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// FieldError is an invalid field of a configuration.
+type FieldError struct {
+	// Field is the path of the field, such as "tools[1].command"
+	Field string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// ReadFile reads and validates the configuration in the file.
+// The format is YAML for the extensions .yaml and .yml, and JSON for .json.
+func ReadFile(path string) (*Config, error) {
+	var format Format
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		format = YAML
+	case ".json":
+		format = JSON
+	default:
+		return nil, fmt.Errorf("%s: unknown configuration format, the extension must be .yaml, .yml or .json", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := decode(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	c.Dir = filepath.Dir(path)
+
+	err = c.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return c, nil
+}
+
+// Parse parses and validates a configuration.
+// Relative paths are resolved against the working directory.
+func Parse(data []byte, format Format) (*Config, error) {
+	c, err := decode(data, format)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// decode decodes a configuration, rejecting the unknown fields.
+func decode(data []byte, format Format) (*Config, error) {
+	var c Config
+
+	switch format {
+	case YAML:
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err := dec.Decode(&c)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("invalid YAML: %w", err)
+		}
+	case JSON:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err := dec.Decode(&c)
+		if err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				line, column := position(data, syntaxErr.Offset)
+				return nil, fmt.Errorf("invalid JSON at line %d, column %d: %w", line, column, err)
+			}
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown configuration format %q", format)
+	}
+
+	return &c, nil
+}
+
+// position returns the line and the column of the byte at which a syntax error was reported,
+// which is the last byte read before the offset.
+func position(data []byte, offset int64) (line, column int) {
+	index := int(min(max(offset-1, 0), int64(len(data))))
+	before := data[:index]
+	line = bytes.Count(before, []byte("\n")) + 1
+	column = index - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
+
+var (
+	// nameRegexp matches the names of tools and prompts
+	nameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,128}$`)
+	// argumentRegexp matches the names of the arguments of tools, which must be valid in environment variables
+	argumentRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// Validate reports all the invalid fields of the configuration, each as a *FieldError.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(field string, format string, args ...any) {
+		errs = append(errs, &FieldError{Field: field, Err: fmt.Errorf(format, args...)})
+	}
+
+	if c.Name == "" {
+		fail("name", "is required")
+	}
+	if c.Version == "" {
+		fail("version", "is required")
+	}
+
+	uris := make(map[string]string)
+	for i, resource := range c.Resources {
+		field := fmt.Sprintf("resources[%d]", i)
+		if resource == nil {
+			fail(field, "is empty")
+			continue
+		}
+
+		if resource.File == "" {
+			fail(field+".file", "is required")
+			continue
+		}
+		info, err := os.Stat(c.path(resource.File))
+		if err != nil {
+			fail(field+".file", "%w", err)
+			continue
+		}
+		if info.IsDir() {
+			fail(field+".file", "%s is a directory", resource.File)
+			continue
+		}
+
+		uri, err := c.resourceURI(resource)
+		if err != nil {
+			fail(field+".uri", "%w", err)
+			continue
+		}
+		if other, ok := uris[uri]; ok {
+			fail(field+".uri", "%s is already the URI of %s", uri, other)
+			continue
+		}
+		uris[uri] = field
+	}
+
+	prompts := make(map[string]string)
+	for i, prompt := range c.Prompts {
+		field := fmt.Sprintf("prompts[%d]", i)
+		if prompt == nil {
+			fail(field, "is empty")
+			continue
+		}
+
+		if !nameRegexp.MatchString(prompt.Name) {
+			fail(field+".name", "%q is not a valid name, which must be 1 to 128 letters, digits, '_', '-' or '.'", prompt.Name)
+		} else if other, ok := prompts[prompt.Name]; ok {
+			fail(field+".name", "%q is already the name of %s", prompt.Name, other)
+		} else {
+			prompts[prompt.Name] = field
+		}
+
+		arguments := make(map[string]bool)
+		for j, argument := range prompt.Arguments {
+			argField := fmt.Sprintf("%s.arguments[%d]", field, j)
+			switch {
+			case argument == nil:
+				fail(argField, "is empty")
+			case argument.Name == "":
+				fail(argField+".name", "is required")
+			case arguments[argument.Name]:
+				fail(argField+".name", "%q is already declared", argument.Name)
+			default:
+				arguments[argument.Name] = true
+			}
+		}
+
+		if len(prompt.Messages) == 0 {
+			fail(field+".messages", "at least one message is required")
+		}
+		for j, message := range prompt.Messages {
+			msgField := fmt.Sprintf("%s.messages[%d]", field, j)
+			if message == nil {
+				fail(msgField, "is empty")
+				continue
+			}
+
+			if message.Role != "user" && message.Role != "assistant" {
+				fail(msgField+".role", "must be user or assistant, not %q", message.Role)
+			}
+
+			tmpl, err := template.New(msgField).Parse(message.Text)
+			if err != nil {
+				fail(msgField+".text", "%w", err)
+				continue
+			}
+			for _, name := range templateFields(tmpl) {
+				if !arguments[name] {
+					fail(msgField+".text", "uses the undeclared argument %q", name)
+				}
+			}
+		}
+	}
+
+	tools := make(map[string]string)
+	for i, tool := range c.Tools {
+		field := fmt.Sprintf("tools[%d]", i)
+		if tool == nil {
+			fail(field, "is empty")
+			continue
+		}
+
+		if !nameRegexp.MatchString(tool.Name) {
+			fail(field+".name", "%q is not a valid name, which must be 1 to 128 letters, digits, '_', '-' or '.'", tool.Name)
+		} else if other, ok := tools[tool.Name]; ok {
+			fail(field+".name", "%q is already the name of %s", tool.Name, other)
+		} else {
+			tools[tool.Name] = field
+		}
+
+		if strings.TrimSpace(tool.Command) == "" {
+			fail(field+".command", "is required")
+		}
+
+		if tool.Timeout != "" {
+			timeout, err := time.ParseDuration(tool.Timeout)
+			if err != nil {
+				fail(field+".timeout", "%w", err)
+			} else if timeout <= 0 {
+				fail(field+".timeout", "must be positive")
+			}
+		}
+
+		if tool.Dir != "" {
+			info, err := os.Stat(c.path(tool.Dir))
+			if err != nil {
+				fail(field+".dir", "%w", err)
+			} else if !info.IsDir() {
+				fail(field+".dir", "%s is not a directory", tool.Dir)
+			}
+		}
+
+		for _, err := range validateInputSchema(tool.InputSchema) {
+			errs = append(errs, &FieldError{Field: field + ".inputSchema" + err.Field, Err: err.Err})
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateInputSchema reports the errors of the schema of the arguments of a tool,
+// with the fields relative to the schema, such as ".properties.path.type".
+func validateInputSchema(schema map[string]any) []*FieldError {
+	if schema == nil {
+		return nil
+	}
+
+	var errs []*FieldError
+	fail := func(field string, format string, args ...any) {
+		errs = append(errs, &FieldError{Field: field, Err: fmt.Errorf(format, args...)})
+	}
+
+	if schema["type"] != "object" {
+		fail(".type", "must be object, not %v", schema["type"])
+	}
+
+	properties := map[string]any{}
+	if raw, ok := schema["properties"]; ok {
+		properties, ok = raw.(map[string]any)
+		if !ok {
+			fail(".properties", "must be an object")
+		}
+	}
+	// The names are visited in order, so that the collisions of their variables are reported consistently
+	variables := make(map[string]string, len(properties))
+	for _, name := range slices.Sorted(maps.Keys(properties)) {
+		raw := properties[name]
+		field := ".properties." + name
+		if !argumentRegexp.MatchString(name) {
+			fail(field, "%q is not a valid argument name, which must be letters, digits or '_' and not start with a digit", name)
+		}
+		if other, ok := variables[strings.ToUpper(name)]; ok {
+			fail(field, "%q and %q are passed in the same environment variable", other, name)
+		}
+		variables[strings.ToUpper(name)] = name
+
+		property, ok := raw.(map[string]any)
+		if !ok {
+			fail(field, "must be an object")
+			continue
+		}
+		if _, ok := property["type"].(string); !ok {
+			fail(field+".type", "is required")
+		}
+	}
+
+	if raw, ok := schema["required"]; ok {
+		required, ok := raw.([]any)
+		if !ok {
+			fail(".required", "must be a list of property names")
+			return errs
+		}
+		for i, name := range required {
+			name, ok := name.(string)
+			if !ok {
+				fail(fmt.Sprintf(".required[%d]", i), "must be a property name")
+				continue
+			}
+			if _, ok := properties[name]; !ok {
+				fail(fmt.Sprintf(".required[%d]", i), "%q is not a declared property", name)
+			}
+		}
+	}
+
+	_, err := json.Marshal(schema)
+	if err != nil {
+		fail("", "%w", err)
+	}
+
+	slices.SortFunc(errs, func(a, b *FieldError) int { return strings.Compare(a.Field, b.Field) })
+
+	return errs
+}
+
+// path resolves the path against the directory of the configuration.
+func (c *Config) path(path string) string {
+	if filepath.IsAbs(path) || c.Dir == "" {
+		return path
+	}
+	return filepath.Join(c.Dir, path)
+}
+
+// resourceURI returns the URI of the resource, which defaults to the file URI of its file.
+func (c *Config) resourceURI(resource *Resource) (string, error) {
+	if resource.URI != "" {
+		return resource.URI, nil
+	}
+
+	path, err := filepath.Abs(c.path(resource.File))
+	if err != nil {
+		return "", err
+	}
+	return "file://" + filepath.ToSlash(path), nil
+}
+
+// templateFields returns the names of the fields of the arguments used by the template, such as "code" for {{.code}}.
+// The fields used where dot is rebound, in the body of range and with, are not arguments.
+func templateFields(tmpl *template.Template) []string {
+	var names []string
+
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				walk(cmd)
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.FieldNode:
+			names = append(names, n.Ident[0])
+		}
+	}
+	walk(tmpl.Tree.Root)
+
+	return names
+}
@@ -0,0 +1,269 @@
+package mcpconfig
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OkutaniDaichi0106/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `
+name: files
+version: 1.0.0
+instructions: Use the tools to inspect the files.
+capabilities:
+  toolsChangedNotification: true
+resources:
+  - name: readme
+    file: README.md
+  - uri: file:///logo.png
+    file: logo.png
+prompts:
+  - name: review
+    description: Review code
+    arguments:
+      - name: code
+        required: true
+      - name: language
+    messages:
+      - role: user
+        text: "Review this {{.language}} code:\n{{.code}}"
+tools:
+  - name: greet
+    inputSchema:
+      type: object
+      properties:
+        name: {type: string}
+        times: {type: integer}
+      required: [name]
+    command: echo "hello $MCP_ARG_NAME x$MCP_ARG_TIMES"
+  - name: fail
+    command: echo oops >&2; exit 3
+`
+
+// writeConfig writes the configuration and the files it refers to in a temporary directory.
+func writeConfig(t *testing.T, name, config string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("# Files"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "logo.png"), []byte{0x89, 'P', 'N', 'G', 0xff}, 0o644))
+
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(config), 0o644))
+
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	path := writeConfig(t, "server.yaml", testConfig)
+
+	server, mux, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, "files", server.Name)
+	assert.True(t, server.ToolsChangedNotification)
+	assert.Len(t, mux.ListResources(), 2)
+
+	clientT, serverT := mcp.NewInMemoryTransports()
+	go server.Accept(serverT)
+	sess, err := mcp.NewClient("test-client", "0.0.1").Dial(clientT)
+	require.NoError(t, err)
+	t.Cleanup(func() { sess.Close() })
+
+	ctx := context.Background()
+	assert.Equal(t, "Use the tools to inspect the files.", sess.Instructions())
+
+	t.Run("text resource", func(t *testing.T) {
+		readme := "file://" + filepath.ToSlash(filepath.Join(filepath.Dir(path), "README.md"))
+		result, err := sess.ReadResource(ctx, &mcp.ResourceDefinition{URI: readme})
+		require.NoError(t, err)
+		assert.Equal(t, []*mcp.Resource{{URI: readme, MimeType: "text/markdown; charset=utf-8", Text: "# Files"}}, result.Contents)
+	})
+
+	t.Run("binary resource", func(t *testing.T) {
+		result, err := sess.ReadResource(ctx, &mcp.ResourceDefinition{URI: "file:///logo.png"})
+		require.NoError(t, err)
+		assert.Equal(t, []*mcp.Resource{{URI: "file:///logo.png", MimeType: "image/png", Blob: []byte{0x89, 'P', 'N', 'G', 0xff}}}, result.Contents)
+	})
+
+	t.Run("prompt", func(t *testing.T) {
+		result, err := sess.GetPrompt(ctx, &mcp.PromptDefinition{Name: "review"}, map[string]any{"code": "x := 1"})
+		require.NoError(t, err)
+		require.Len(t, result.Messages, 1)
+		assert.Equal(t, mcp.User, result.Messages[0].Role)
+		assert.Equal(t, &mcp.TextContent{Text: "Review this  code:\nx := 1"}, result.Messages[0].Content)
+
+		_, err = sess.GetPrompt(ctx, &mcp.PromptDefinition{Name: "review"}, nil)
+		assert.ErrorIs(t, err, mcp.ErrInvalidParams)
+	})
+
+	t.Run("tool", func(t *testing.T) {
+		result, err := sess.CallTool(ctx, &mcp.ToolDefinition{Name: "greet"}, map[string]any{"name": "$(whoami)", "times": 2})
+		require.NoError(t, err)
+		assert.Equal(t, []mcp.Content{&mcp.TextContent{Text: "hello $(whoami) x2\n"}}, result.Content, "arguments should not be interpreted by the shell")
+
+		_, err = sess.CallTool(ctx, &mcp.ToolDefinition{Name: "greet"}, nil)
+		assert.ErrorIs(t, err, mcp.ErrInvalidParams)
+
+		_, err = sess.CallTool(ctx, &mcp.ToolDefinition{Name: "greet"}, map[string]any{"name": "a", "path": "/tmp"})
+		assert.ErrorIs(t, err, mcp.ErrInvalidParams, "undeclared arguments should be rejected")
+
+		_, err = sess.CallTool(ctx, &mcp.ToolDefinition{Name: "fail"}, nil)
+		assert.EqualError(t, err, "command failed: exit status 3: oops")
+	})
+}
+
+func TestRunCommand_Timeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// The processes started by the shell keep the output open until they are killed
+	start := time.Now()
+	_, err := runCommand(ctx, "sleep 10 | cat", t.TempDir(), nil)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), commandWaitDelay, "the processes of the command should be killed with it")
+}
+
+func TestReadFile_JSON(t *testing.T) {
+	path := writeConfig(t, "server.json", `{
+		"name": "files",
+		"version": "1.0.0",
+		"tools": [{"name": "date", "command": "date"}]
+	}`)
+
+	c, err := ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "date", c.Tools[0].Name)
+	assert.Equal(t, filepath.Dir(path), c.Dir)
+}
+
+func TestReadFile_Errors(t *testing.T) {
+	tests := map[string]struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		"unknown extension": {
+			name:    "server.toml",
+			wantErr: "server.toml: unknown configuration format, the extension must be .yaml, .yml or .json",
+		},
+		"unknown YAML field": {
+			name:    "server.yaml",
+			config:  "name: files\nversion: 1.0.0\ntols: []\n",
+			wantErr: "server.yaml: invalid YAML: yaml: unmarshal errors:\n  line 3: field tols not found in type mcpconfig.Config",
+		},
+		"JSON syntax error": {
+			name:    "server.json",
+			config:  "{\n  \"name\": \"files\",\n  \"version\": 1.0.0\n}",
+			wantErr: "server.json: invalid JSON at line 3, column 17: invalid character '.' after object key:value pair",
+		},
+		"missing fields": {
+			name:    "server.yaml",
+			config:  "tools:\n  - name: date\n",
+			wantErr: "server.yaml: name: is required\nversion: is required\ntools[0].command: is required",
+		},
+		"invalid resources": {
+			name: "server.yaml",
+			config: `
+name: files
+version: 1.0.0
+resources:
+  - file: missing.txt
+  - uri: file:///readme
+    file: README.md
+  - uri: file:///readme
+    file: README.md
+`,
+			wantErr: "server.yaml: resources[0].file: stat missing.txt: no such file or directory\n" +
+				"resources[2].uri: file:///readme is already the URI of resources[1]",
+		},
+		"invalid prompts": {
+			name: "server.yaml",
+			config: `
+name: files
+version: 1.0.0
+prompts:
+  - name: review code
+    messages:
+      - role: system
+        text: "{{.code}}"
+  - name: summary
+    messages:
+      - role: user
+        text: "{{.text"
+  - name: summary
+`,
+			wantErr: `server.yaml: prompts[0].name: "review code" is not a valid name, which must be 1 to 128 letters, digits, '_', '-' or '.'` + "\n" +
+				`prompts[0].messages[0].role: must be user or assistant, not "system"` + "\n" +
+				`prompts[0].messages[0].text: uses the undeclared argument "code"` + "\n" +
+				`prompts[1].messages[0].text: template: prompts[1].messages[0]:1: unclosed action` + "\n" +
+				`prompts[2].name: "summary" is already the name of prompts[1]` + "\n" +
+				`prompts[2].messages: at least one message is required`,
+		},
+		"invalid tools": {
+			name: "server.yaml",
+			config: `
+name: files
+version: 1.0.0
+tools:
+  - name: greet
+    command: echo hello
+    timeout: soon
+    inputSchema:
+      type: object
+      properties:
+        first-name: {type: string}
+        age: {}
+        PATH: {type: string}
+        path: {type: string}
+      required: [name]
+`,
+			wantErr: `server.yaml: tools[0].timeout: time: invalid duration "soon"` + "\n" +
+				`tools[0].inputSchema.properties.age.type: is required` + "\n" +
+				`tools[0].inputSchema.properties.first-name: "first-name" is not a valid argument name, which must be letters, digits or '_' and not start with a digit` + "\n" +
+				`tools[0].inputSchema.properties.path: "PATH" and "path" are passed in the same environment variable` + "\n" +
+				`tools[0].inputSchema.required[0]: "name" is not a declared property`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			path := writeConfig(t, tc.name, tc.config)
+			_, err := ReadFile(path)
+			require.Error(t, err)
+			assert.Equal(t, tc.wantErr, trimDir(err.Error(), filepath.Dir(path)))
+		})
+	}
+}
+
+func TestConfig_NewServer_InvalidSchema(t *testing.T) {
+	c := &Config{Name: "files", Version: "1.0.0", Tools: []*Tool{{
+		Name:        "date",
+		Command:     "date",
+		InputSchema: map[string]any{"type": "object", "required": []any{1}},
+	}}}
+
+	_, _, err := c.NewServer()
+	assert.EqualError(t, err, "tools[0]: inputSchema.required[0]: must be a property name")
+}
+
+func TestConfig_Validate_FieldError(t *testing.T) {
+	c := &Config{Name: "files", Version: "1.0.0", Tools: []*Tool{{Name: "date"}}}
+
+	var fieldErr *FieldError
+	require.ErrorAs(t, c.Validate(), &fieldErr)
+	assert.Equal(t, "tools[0].command", fieldErr.Field)
+}
+
+// trimDir removes the temporary directory from the paths in the message.
+func trimDir(msg, dir string) string {
+	return strings.ReplaceAll(msg, dir+string(filepath.Separator), "")
+}
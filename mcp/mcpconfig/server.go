@@ -0,0 +1,338 @@
+package mcpconfig
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/OkutaniDaichi0106/mcp-go/mcp"
+)
+
+// Load reads the configuration in the file and returns the server it configures, with the mux serving it.
+func Load(path string) (*mcp.Server, *mcp.ServerMux, error) {
+	c, err := ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return c.NewServer()
+}
+
+// NewServer returns a server configured by the configuration, with the mux serving it as its handler.
+// The configuration must be valid.
+func (c *Config) NewServer() (*mcp.Server, *mcp.ServerMux, error) {
+	mux := mcp.NewServerMux()
+
+	for i, resource := range c.Resources {
+		definition, handler, err := c.resource(resource)
+		if err != nil {
+			return nil, nil, &FieldError{Field: fmt.Sprintf("resources[%d]", i), Err: err}
+		}
+		mux.HandleResource(definition, handler)
+	}
+
+	for i, prompt := range c.Prompts {
+		definition, handler, err := c.prompt(prompt)
+		if err != nil {
+			return nil, nil, &FieldError{Field: fmt.Sprintf("prompts[%d]", i), Err: err}
+		}
+		mux.HandlePrompt(definition, handler)
+	}
+
+	for i, tool := range c.Tools {
+		definition, handler, err := c.tool(tool)
+		if err != nil {
+			return nil, nil, &FieldError{Field: fmt.Sprintf("tools[%d]", i), Err: err}
+		}
+		mux.HandleTool(definition, handler)
+	}
+
+	server := mcp.NewServer(c.Name, c.Version)
+	server.Title = c.Title
+	server.Instructions = c.Instructions
+	server.ResourceSubscription = c.Capabilities.ResourceSubscription
+	server.ResourcesChangedNotification = c.Capabilities.ResourcesChangedNotification
+	server.PromptsChangedNotification = c.Capabilities.PromptsChangedNotification
+	server.ToolsChangedNotification = c.Capabilities.ToolsChangedNotification
+	server.Handler = mux
+
+	return server, mux, nil
+}
+
+// resource returns the definition of the resource and a handler reading its file.
+func (c *Config) resource(resource *Resource) (*mcp.ResourceDefinition, mcp.ResourceHandler, error) {
+	uri, err := c.resourceURI(resource)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	path := c.path(resource.File)
+
+	name := resource.Name
+	if name == "" {
+		name = filepath.Base(path)
+	}
+
+	mimeType := resource.MimeType
+	if mimeType == "" {
+		mimeType = mime.TypeByExtension(filepath.Ext(path))
+	}
+
+	definition := &mcp.ResourceDefinition{
+		URI:         uri,
+		MimeType:    mimeType,
+		Name:        name,
+		Description: resource.Description,
+	}
+
+	handler := mcp.ResourceHandlerFunc(func(w mcp.ContentsWriter, _ string, _ map[string]any) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			slog.Error("failed to read resource file", "uri", uri, "error", err)
+			w.CloseWithError(mcp.ErrInternalError.Code, mcp.ErrInternalError.Message)
+			return
+		}
+
+		if isText(mimeType, data) {
+			w.WriteContents([]mcp.Content{mcp.ResourceContent{Resource: mcp.Resource{URI: uri, MimeType: mimeType, Text: string(data)}}})
+			return
+		}
+		w.WriteContents([]mcp.Content{mcp.ResourceContent{Resource: mcp.Resource{URI: uri, MimeType: mimeType, Blob: data}}})
+	})
+
+	return definition, handler, nil
+}
+
+// isText reports whether the contents of a file of the MIME type are text.
+func isText(mimeType string, data []byte) bool {
+	mediaType, _, _ := mime.ParseMediaType(mimeType)
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		mediaType == "application/json", mediaType == "application/xml", mediaType == "application/yaml",
+		strings.HasSuffix(mediaType, "+json"), strings.HasSuffix(mediaType, "+xml"):
+		return true
+	case mediaType == "":
+		return utf8.Valid(data)
+	default:
+		return false
+	}
+}
+
+// prompt returns the definition of the prompt and a handler rendering its messages.
+func (c *Config) prompt(prompt *Prompt) (*mcp.PromptDefinition, mcp.PromptHandler, error) {
+	definition := &mcp.PromptDefinition{
+		Name:        prompt.Name,
+		Description: prompt.Description,
+	}
+	for _, argument := range prompt.Arguments {
+		definition.Arguments = append(definition.Arguments, struct {
+			Name        string `json:"name"`
+			Description string `json:"description"`
+			Required    bool   `json:"required"`
+		}{
+			Name:        argument.Name,
+			Description: argument.Description,
+			Required:    argument.Required,
+		})
+	}
+
+	templates := make([]*template.Template, len(prompt.Messages))
+	for i, message := range prompt.Messages {
+		tmpl, err := template.New(prompt.Name).Option("missingkey=error").Parse(message.Text)
+		if err != nil {
+			return nil, nil, &FieldError{Field: fmt.Sprintf("messages[%d].text", i), Err: err}
+		}
+		templates[i] = tmpl
+	}
+
+	handler := mcp.PromptHandlerFunc(func(w mcp.PromptWriter, name string, args map[string]any) {
+		data := make(map[string]any, len(prompt.Arguments))
+		for _, argument := range prompt.Arguments {
+			value, ok := args[argument.Name]
+			if !ok {
+				if argument.Required {
+					w.CloseWithError(mcp.ErrInvalidParams.Code, fmt.Sprintf("missing required argument %q", argument.Name))
+					return
+				}
+				value = ""
+			}
+			data[argument.Name] = value
+		}
+
+		for i, tmpl := range templates {
+			var text bytes.Buffer
+			err := tmpl.Execute(&text, data)
+			if err != nil {
+				slog.Error("failed to render prompt", "prompt", name, "error", err)
+				w.CloseWithError(mcp.ErrInternalError.Code, mcp.ErrInternalError.Message)
+				return
+			}
+
+			err = w.Write(mcp.Role(prompt.Messages[i].Role), mcp.TextContent{Text: text.String()})
+			if err != nil {
+				slog.Error("failed to write prompt message", "prompt", name, "error", err)
+				return
+			}
+		}
+	})
+
+	return definition, handler, nil
+}
+
+// tool returns the definition of the tool and a handler running its command.
+func (c *Config) tool(tool *Tool) (*mcp.ToolDefinition, mcp.ToolHandler, error) {
+	schema := tool.InputSchema
+	if schema == nil {
+		schema = map[string]any{"type": "object"}
+	}
+	rawSchema, err := json.Marshal(schema)
+	if err != nil {
+		return nil, nil, &FieldError{Field: "inputSchema", Err: err}
+	}
+
+	var timeout time.Duration
+	if tool.Timeout != "" {
+		timeout, err = time.ParseDuration(tool.Timeout)
+		if err != nil {
+			return nil, nil, &FieldError{Field: "timeout", Err: err}
+		}
+	}
+
+	definition := &mcp.ToolDefinition{
+		Name:        tool.Name,
+		Description: tool.Description,
+		InputSchema: mcp.InputSchema(rawSchema),
+		Annotations: tool.Annotations,
+		Timeout:     timeout,
+	}
+
+	var required []string
+	if list, ok := schema["required"].([]any); ok {
+		for i, name := range list {
+			name, ok := name.(string)
+			if !ok {
+				return nil, nil, &FieldError{Field: fmt.Sprintf("inputSchema.required[%d]", i), Err: errors.New("must be a property name")}
+			}
+			required = append(required, name)
+		}
+	}
+	properties, _ := schema["properties"].(map[string]any)
+
+	dir := c.Dir
+	if tool.Dir != "" {
+		dir = c.path(tool.Dir)
+	}
+
+	handler := mcp.ToolHandlerFunc(func(w mcp.ContentsWriter, name string, args map[string]any) {
+		for _, argument := range required {
+			if _, ok := args[argument]; !ok {
+				w.CloseWithError(mcp.ErrInvalidParams.Code, fmt.Sprintf("missing required argument %q", argument))
+				return
+			}
+		}
+
+		env, err := commandEnv(tool.Env, properties, args)
+		if err != nil {
+			w.CloseWithError(mcp.ErrInvalidParams.Code, err.Error())
+			return
+		}
+
+		stdout, err := runCommand(w.Context(), tool.Command, dir, env)
+		if err != nil {
+			if w.Context().Err() != nil {
+				// The call was cancelled or timed out, which the server answers
+				return
+			}
+			w.CloseWithError(mcp.ErrInternalError.Code, err.Error())
+			return
+		}
+
+		w.WriteContents([]mcp.Content{mcp.TextContent{Text: stdout}})
+	})
+
+	return definition, handler, nil
+}
+
+// commandEnv returns the environment of a command: the environment of the current process,
+// the variables of the tool, and then the arguments of the call.
+// Arguments which are not declared properties, or whose variables collide, are rejected.
+func commandEnv(vars map[string]string, properties map[string]any, args map[string]any) ([]string, error) {
+	env := os.Environ()
+	for key, value := range vars {
+		env = append(env, key+"="+value)
+	}
+
+	all, err := json.Marshal(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	env = append(env, "MCP_ARGUMENTS="+string(all))
+
+	variables := make(map[string]string, len(args))
+	for name, value := range args {
+		if _, ok := properties[name]; !ok {
+			return nil, fmt.Errorf("undeclared argument %q", name)
+		}
+		if !argumentRegexp.MatchString(name) {
+			return nil, fmt.Errorf("invalid argument name %q", name)
+		}
+		variable := "MCP_ARG_" + strings.ToUpper(name)
+		if other, ok := variables[variable]; ok {
+			return nil, fmt.Errorf("arguments %q and %q are passed in the same environment variable", other, name)
+		}
+		variables[variable] = name
+
+		str, ok := value.(string)
+		if !ok {
+			raw, err := json.Marshal(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid argument %q: %w", name, err)
+			}
+			str = string(raw)
+		}
+		env = append(env, variable+"="+str)
+	}
+
+	return env, nil
+}
+
+// commandWaitDelay is the time given to the output of a killed command to be closed,
+// after which the processes it started and which keep it open are not waited for.
+const commandWaitDelay = time.Second
+
+// runCommand runs the command with "sh -c" and returns its standard output.
+// The command runs in its own process group, which is killed when the context is done,
+// so that the processes started by the shell are killed with it.
+// If the command fails, the error includes its standard error.
+func runCommand(ctx context.Context, command, dir string, env []string) (string, error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.WaitDelay = commandWaitDelay
+	killProcessGroup(cmd)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("command failed: %w: %s", err, msg)
+		}
+		return "", fmt.Errorf("command failed: %w", err)
+	}
+
+	return stdout.String(), nil
+}
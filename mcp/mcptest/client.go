@@ -0,0 +1,89 @@
+package mcptest
+
+import (
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/OkutaniDaichi0106/mcp-go/mcp"
+)
+
+// FakeClient is a scripted client connected to a server under test over in-process pipes,
+// as a client is connected to a stdio server.
+type FakeClient struct {
+	*Conn
+
+	sessions chan mcp.ServerSession
+	session  mcp.ServerSession
+}
+
+// NewFakeClient connects a fake client to the server. The session is not initialized.
+// The connection is closed when the test ends.
+func NewFakeClient(tb testing.TB, server *mcp.Server) *FakeClient {
+	tb.Helper()
+
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+
+	c := &FakeClient{
+		Conn:     newConn(tb, clientW, clientR),
+		sessions: make(chan mcp.ServerSession, 1),
+	}
+
+	go func() {
+		sess, err := server.AcceptStream(serverW, serverR)
+		if err != nil {
+			close(c.sessions)
+			return
+		}
+		c.sessions <- sess
+	}()
+
+	tb.Cleanup(func() {
+		clientW.Close()
+		clientR.Close()
+	})
+
+	return c
+}
+
+// Initialize initializes the session with the default protocol version,
+// and then sends the initialized notification. It returns the result of the initialization.
+func (c *FakeClient) Initialize() json.RawMessage {
+	c.tb.Helper()
+
+	result := c.Call(mcp.MethodInit, map[string]any{
+		"protocolVersion": mcp.DefaultVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo": map[string]any{
+			"name":    "mcptest",
+			"version": "0.0.0",
+		},
+	})
+	c.Notify(mcp.MethodNotifyInitialized, nil)
+
+	return result
+}
+
+// Session returns the session accepted by the server.
+// It fails the test if the session is not initialized in time.
+func (c *FakeClient) Session() mcp.ServerSession {
+	c.tb.Helper()
+
+	if c.session != nil {
+		return c.session
+	}
+
+	select {
+	case sess, ok := <-c.sessions:
+		if !ok {
+			c.tb.Fatal("mcptest: the server failed to accept the session")
+		}
+		c.session = sess
+		return sess
+	case <-time.After(c.timeout()):
+		c.tb.Fatalf("mcptest: the server did not accept the session after %v", c.timeout())
+		return nil
+	}
+}
@@ -0,0 +1,459 @@
+package mcptest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/OkutaniDaichi0106/mcp-go/mcp"
+)
+
+// RunConformance serves the handler with a new server and checks, in subtests,
+// that the initialization, the listings, the tool calls, the resource reads and subscriptions,
+// the prompts, the cancellation and the shutdown follow the specification.
+// The features which the server does not advertise are skipped.
+//
+// Every tool is called with empty arguments, and every prompt with its required arguments set to "test".
+// A tool or a prompt may fail then, as long as the failure is reported as specified.
+// The cancellation is checked with a tool of the suite, "mcptest_block", which blocks until its request is cancelled.
+func RunConformance(t *testing.T, handler mcp.ServerHandler) {
+	t.Helper()
+
+	newServer := func(t *testing.T) *mcp.Server {
+		server := mcp.NewServer("mcptest-conformance", "0.0.0")
+		server.Handler = handler
+		// Subscriptions are served by the server whatever the handler
+		server.ResourceSubscription = true
+		t.Cleanup(func() { server.Close() })
+		return server
+	}
+
+	// newClient returns an initialized client with the capabilities advertised by the server
+	newClient := func(t *testing.T) (*FakeClient, map[string]json.RawMessage) {
+		t.Helper()
+
+		c := NewFakeClient(t, newServer(t))
+
+		var result struct {
+			Capabilities map[string]json.RawMessage `json:"capabilities"`
+		}
+		decode(t, "initialize result", c.Initialize(), &result)
+
+		return c, result.Capabilities
+	}
+
+	requireCapability := func(t *testing.T, capabilities map[string]json.RawMessage, name string) {
+		t.Helper()
+
+		if raw, ok := capabilities[name]; !ok || string(raw) == "null" {
+			t.Skipf("the server does not advertise the %s capability", name)
+		}
+	}
+
+	t.Run("initialize", func(t *testing.T) {
+		c := NewFakeClient(t, newServer(t))
+
+		var result struct {
+			ProtocolVersion *string                    `json:"protocolVersion"`
+			Capabilities    map[string]json.RawMessage `json:"capabilities"`
+			ServerInfo      *struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			} `json:"serverInfo"`
+		}
+		decode(t, "initialize result", c.Initialize(), &result)
+
+		if result.ProtocolVersion == nil || *result.ProtocolVersion != string(mcp.DefaultVersion) {
+			t.Errorf("protocolVersion should be the requested version %q", mcp.DefaultVersion)
+		}
+		if result.Capabilities == nil {
+			t.Error("capabilities should be an object")
+		}
+		if result.ServerInfo == nil || result.ServerInfo.Name == "" || result.ServerInfo.Version == "" {
+			t.Error("serverInfo should have a name and a version")
+		}
+	})
+
+	t.Run("initialize with an unsupported version", func(t *testing.T) {
+		c := NewFakeClient(t, newServer(t))
+
+		var result struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		decode(t, "initialize result", c.Call(mcp.MethodInit, map[string]any{
+			"protocolVersion": "1900-01-01",
+			"capabilities":    map[string]any{},
+			"clientInfo":      map[string]any{"name": "mcptest", "version": "0.0.0"},
+		}), &result)
+
+		if result.ProtocolVersion == "" || result.ProtocolVersion == "1900-01-01" {
+			t.Errorf("protocolVersion should be a version supported by the server, got %q", result.ProtocolVersion)
+		}
+	})
+
+	t.Run("unknown method", func(t *testing.T) {
+		c, _ := newClient(t)
+
+		rsp := c.Request("mcptest/unknown", nil).Wait()
+		expectErrorCode(t, rsp, mcp.ErrMethodNotFound.Code)
+	})
+
+	t.Run("malformed message", func(t *testing.T) {
+		c, _ := newClient(t)
+
+		c.SendRaw([]byte(`{"jsonrpc": "2.0", "id": 1, "method": `))
+		rsp := c.ExpectMessage("parse error", func(m *Message) bool {
+			return m.Error != nil && string(m.ID) == "null"
+		})
+		expectErrorCode(t, rsp, mcp.ErrParseError.Code)
+	})
+
+	t.Run("tools", func(t *testing.T) {
+		c, capabilities := newClient(t)
+		requireCapability(t, capabilities, "tools")
+
+		var list struct {
+			Tools []struct {
+				Name        string          `json:"name"`
+				InputSchema json.RawMessage `json:"inputSchema"`
+			} `json:"tools"`
+		}
+		decode(t, "tools/list result", c.Call(mcp.MethodListTools, nil), &list)
+
+		for _, tool := range list.Tools {
+			if tool.Name == "" {
+				t.Error("tool should have a name")
+				continue
+			}
+
+			var schema struct {
+				Type string `json:"type"`
+			}
+			if json.Unmarshal(tool.InputSchema, &schema) != nil || schema.Type != "object" {
+				t.Errorf("inputSchema of tool %q should be a JSON Schema object of type \"object\", got %s", tool.Name, tool.InputSchema)
+			}
+
+			rsp := c.Request(mcp.MethodCallTool, map[string]any{
+				"name":      tool.Name,
+				"arguments": map[string]any{},
+			}).Wait()
+			if rsp.Error != nil {
+				continue
+			}
+
+			var result struct {
+				Content []json.RawMessage `json:"content"`
+				IsError bool              `json:"isError"`
+			}
+			decode(t, fmt.Sprintf("result of tool %q", tool.Name), rsp.Result, &result)
+			if result.Content == nil {
+				t.Errorf("result of tool %q should have a content list, got %s", tool.Name, rsp.Result)
+			}
+			for _, content := range result.Content {
+				checkContent(t, fmt.Sprintf("content of tool %q", tool.Name), content)
+			}
+		}
+
+		// An unknown tool is reported either as an error or as a tool error
+		rsp := c.Request(mcp.MethodCallTool, map[string]any{
+			"name":      "mcptest_unknown_tool",
+			"arguments": map[string]any{},
+		}).Wait()
+		if rsp.Error == nil {
+			var result struct {
+				IsError bool `json:"isError"`
+			}
+			decode(t, "result of an unknown tool", rsp.Result, &result)
+			if !result.IsError {
+				t.Error("call of an unknown tool should fail")
+			}
+		}
+	})
+
+	t.Run("resources", func(t *testing.T) {
+		c, capabilities := newClient(t)
+		requireCapability(t, capabilities, "resources")
+
+		var list struct {
+			Resources []struct {
+				URI  string `json:"uri"`
+				Name string `json:"name"`
+			} `json:"resources"`
+		}
+		decode(t, "resources/list result", c.Call(mcp.MethodListResources, nil), &list)
+
+		for _, resource := range list.Resources {
+			if resource.URI == "" || resource.Name == "" {
+				t.Errorf("resource should have a uri and a name, got %+v", resource)
+				continue
+			}
+
+			rsp := c.Request(mcp.MethodReadResource, map[string]any{"uri": resource.URI}).Wait()
+			if rsp.Error != nil {
+				t.Errorf("read of resource %q failed: %v", resource.URI, rsp.Error)
+				continue
+			}
+
+			var result struct {
+				Contents []struct {
+					URI  string  `json:"uri"`
+					Text *string `json:"text"`
+					Blob *string `json:"blob"`
+				} `json:"contents"`
+			}
+			decode(t, fmt.Sprintf("contents of resource %q", resource.URI), rsp.Result, &result)
+			if result.Contents == nil {
+				t.Errorf("result of resource %q should have a contents list, got %s", resource.URI, rsp.Result)
+			}
+			for _, content := range result.Contents {
+				if content.URI == "" || (content.Text == nil) == (content.Blob == nil) {
+					t.Errorf("contents of resource %q should have a uri and either text or blob, got %s", resource.URI, rsp.Result)
+				}
+			}
+		}
+
+		rsp := c.Request(mcp.MethodReadResource, map[string]any{"uri": "mcptest:///unknown"}).Wait()
+		if rsp.Error == nil {
+			t.Error("read of an unknown resource should fail")
+		}
+	})
+
+	t.Run("subscribe", func(t *testing.T) {
+		c, capabilities := newClient(t)
+		requireCapability(t, capabilities, "resources")
+
+		var resources struct {
+			Subscribe bool `json:"subscribe"`
+		}
+		decode(t, "resources capability", capabilities["resources"], &resources)
+		if !resources.Subscribe {
+			t.Skip("the server does not advertise resource subscriptions")
+		}
+
+		var list struct {
+			Resources []struct {
+				URI string `json:"uri"`
+			} `json:"resources"`
+		}
+		decode(t, "resources/list result", c.Call(mcp.MethodListResources, nil), &list)
+		if len(list.Resources) == 0 {
+			t.Skip("the server has no resource to subscribe to")
+		}
+
+		c.Call(mcp.MethodSubscribeResource, map[string]any{"uri": list.Resources[0].URI})
+		c.Call(mcp.MethodUnsubscribeResource, map[string]any{"uri": list.Resources[0].URI})
+	})
+
+	t.Run("prompts", func(t *testing.T) {
+		c, capabilities := newClient(t)
+		requireCapability(t, capabilities, "prompts")
+
+		var list struct {
+			Prompts []struct {
+				Name      string `json:"name"`
+				Arguments []struct {
+					Name     string `json:"name"`
+					Required bool   `json:"required"`
+				} `json:"arguments"`
+			} `json:"prompts"`
+		}
+		decode(t, "prompts/list result", c.Call(mcp.MethodListPrompts, nil), &list)
+
+		for _, prompt := range list.Prompts {
+			if prompt.Name == "" {
+				t.Error("prompt should have a name")
+				continue
+			}
+
+			args := make(map[string]string)
+			for _, arg := range prompt.Arguments {
+				if arg.Required {
+					args[arg.Name] = "test"
+				}
+			}
+
+			rsp := c.Request(mcp.MethodGetPrompt, map[string]any{
+				"name":      prompt.Name,
+				"arguments": args,
+			}).Wait()
+			if rsp.Error != nil {
+				continue
+			}
+
+			var result struct {
+				Messages []struct {
+					Role    string          `json:"role"`
+					Content json.RawMessage `json:"content"`
+				} `json:"messages"`
+			}
+			decode(t, fmt.Sprintf("result of prompt %q", prompt.Name), rsp.Result, &result)
+			if result.Messages == nil {
+				t.Errorf("result of prompt %q should have a messages list, got %s", prompt.Name, rsp.Result)
+			}
+			for _, message := range result.Messages {
+				if message.Role != "user" && message.Role != "assistant" {
+					t.Errorf("role of a message of prompt %q should be user or assistant, got %q", prompt.Name, message.Role)
+				}
+				checkContent(t, fmt.Sprintf("message of prompt %q", prompt.Name), message.Content)
+			}
+		}
+
+		rsp := c.Request(mcp.MethodGetPrompt, map[string]any{"name": "mcptest_unknown_prompt"}).Wait()
+		if rsp.Error == nil {
+			t.Error("get of an unknown prompt should fail")
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		// A tool of the suite blocks until its request is cancelled
+		blocking := &blockingHandler{
+			ServerHandler: handler,
+			served:        make(chan context.Context, 1),
+		}
+		server := newServer(t)
+		server.Handler = blocking
+
+		c := NewFakeClient(t, server)
+		c.Initialize()
+
+		call := c.Request(mcp.MethodCallTool, map[string]any{
+			"name":      blockingToolName,
+			"arguments": map[string]any{},
+		})
+		var ctx context.Context
+		select {
+		case ctx = <-blocking.served:
+		case <-time.After(c.timeout()):
+			t.Fatal("the tool call should be served")
+		}
+
+		c.Notify(mcp.MethodNotifyCancelled, map[string]any{
+			"requestId": call.ID,
+			"reason":    "cancelled by mcptest",
+		})
+		select {
+		case <-ctx.Done():
+		case <-time.After(c.timeout()):
+			t.Fatal("the context of the handler should be done when its request is cancelled")
+		}
+
+		c.Notify(mcp.MethodNotifyCancelled, map[string]any{
+			"requestId": "mcptest-unknown-request",
+		})
+
+		// The session keeps working
+		rsp := c.Request("mcptest/unknown", nil).Wait()
+		expectErrorCode(t, rsp, mcp.ErrMethodNotFound.Code)
+
+		// The cancelled request is not answered, or answered with a cancellation error
+		select {
+		case rsp := <-call.Response():
+			expectErrorCode(t, rsp, mcp.ErrRequestCancelled.Code)
+		default:
+		}
+	})
+
+	t.Run("shutdown", func(t *testing.T) {
+		c, _ := newClient(t)
+		sess := c.Session()
+
+		// The end of the input of a stdio server ends the session
+		c.Close()
+
+		select {
+		case <-sess.Done():
+		case <-time.After(c.timeout()):
+			t.Fatal("the session should end when the client closes its output")
+		}
+		select {
+		case <-c.Done():
+		case <-time.After(c.timeout()):
+			t.Fatal("the server should close its output when the session ends")
+		}
+	})
+}
+
+func decode(t *testing.T, desc string, data json.RawMessage, v any) {
+	t.Helper()
+
+	err := json.Unmarshal(data, v)
+	if err != nil {
+		t.Fatalf("%s is invalid: %v: %s", desc, err, data)
+	}
+}
+
+func expectErrorCode(t *testing.T, rsp *Message, code mcp.ErrorCode) {
+	t.Helper()
+
+	if rsp.Error == nil {
+		t.Errorf("expected error %d, got result %s", code, rsp.Result)
+		return
+	}
+	if rsp.Error.Code != code {
+		t.Errorf("expected error %d, got %d %s", code, rsp.Error.Code, rsp.Error.Message)
+	}
+}
+
+// checkContent checks a content item of a tool result or a prompt message.
+func checkContent(t *testing.T, desc string, data json.RawMessage) {
+	t.Helper()
+
+	var content struct {
+		Type     string `json:"type"`
+		Text     string `json:"text"`
+		Data     string `json:"data"`
+		MimeType string `json:"mimeType"`
+		Resource *struct {
+			URI string `json:"uri"`
+		} `json:"resource"`
+	}
+	err := json.Unmarshal(data, &content)
+	if err != nil {
+		t.Errorf("%s is invalid: %v: %s", desc, err, data)
+		return
+	}
+
+	switch content.Type {
+	case "text":
+		// The text may be empty
+	case "image", "audio":
+		if content.Data == "" || content.MimeType == "" {
+			t.Errorf("%s of type %s should have data and a mimeType, got %s", desc, content.Type, data)
+		}
+	case "resource":
+		if content.Resource == nil || content.Resource.URI == "" {
+			t.Errorf("%s of type resource should have a resource with a uri, got %s", desc, data)
+		}
+	default:
+		t.Errorf("%s has an unknown type %q: %s", desc, content.Type, data)
+	}
+}
+
+// blockingToolName is the name of the tool which blockingHandler adds to the handler.
+const blockingToolName = "mcptest_block"
+
+// blockingHandler serves the tools of the handler, and a tool blocking until its request is done.
+// The context of every call of the blocking tool is sent on served.
+type blockingHandler struct {
+	mcp.ServerHandler
+	served chan context.Context
+}
+
+func (h *blockingHandler) ListTools() []*mcp.ToolDefinition {
+	return append(h.ServerHandler.ListTools(), &mcp.ToolDefinition{
+		Name:        blockingToolName,
+		Description: "Blocks until the request is cancelled",
+	})
+}
+
+func (h *blockingHandler) ServeTool(w mcp.ContentsWriter, name string, args map[string]any) {
+	if name != blockingToolName {
+		h.ServerHandler.ServeTool(w, name, args)
+		return
+	}
+
+	h.served <- w.Context()
+	<-w.Context().Done()
+}
@@ -0,0 +1,452 @@
+// Package mcptest provides utilities for testing MCP servers and clients.
+//
+// FakeClient and FakeServer speak raw JSON-RPC with the peer under test, so that
+// tests can script the exchange and check the messages exactly as they are on the wire.
+// RunConformance checks a ServerHandler against the specification.
+package mcptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/OkutaniDaichi0106/mcp-go/mcp"
+)
+
+// DefaultTimeout is how long a Conn waits for an expected message when Conn.Timeout is not set.
+const DefaultTimeout = 5 * time.Second
+
+// Message is a JSON-RPC message exchanged with the peer under test.
+type Message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  mcp.Method      `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *mcp.Error      `json:"error,omitempty"`
+}
+
+// IsRequest reports whether the message is a request.
+func (m *Message) IsRequest() bool {
+	return m.Method != "" && len(m.ID) > 0
+}
+
+// IsNotification reports whether the message is a notification.
+func (m *Message) IsNotification() bool {
+	return m.Method != "" && len(m.ID) == 0
+}
+
+// IsResponse reports whether the message is a response.
+func (m *Message) IsResponse() bool {
+	return m.Method == "" && len(m.ID) > 0
+}
+
+// Err returns the error of a response, or nil if it has a result.
+func (m *Message) Err() error {
+	if m.Error == nil {
+		return nil
+	}
+	return m.Error
+}
+
+// RequestHandler answers a request received from the peer under test.
+// Either the result or the error is sent back.
+type RequestHandler func(params json.RawMessage) (result any, err *mcp.Error)
+
+// Conn is one end of a JSON-RPC connection with the peer under test.
+// It records every message in both directions for Transcript.
+//
+// Requests from the peer are answered by the handlers registered with Handle,
+// and with mcp.ErrMethodNotFound otherwise.
+// Notifications, unexpected requests and responses which answer no pending call
+// are kept until they are consumed by an Expect method.
+type Conn struct {
+	// Timeout is how long the Expect methods and Call.Wait wait. Zero means DefaultTimeout.
+	Timeout time.Duration
+
+	tb testing.TB
+
+	w   io.WriteCloser
+	wmu sync.Mutex
+
+	mu         sync.Mutex
+	nextID     int
+	pending    map[string]chan *Message
+	handlers   map[mcp.Method]RequestHandler
+	received   []*Message
+	arrived    chan struct{}
+	transcript []string
+	readErr    error
+
+	done chan struct{}
+}
+
+func newConn(tb testing.TB, w io.WriteCloser, r io.Reader) *Conn {
+	c := &Conn{
+		tb:       tb,
+		w:        w,
+		pending:  make(map[string]chan *Message),
+		handlers: make(map[mcp.Method]RequestHandler),
+		arrived:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go c.readMessages(r)
+
+	return c
+}
+
+// Handle registers the handler answering the requests for the method.
+func (c *Conn) Handle(method mcp.Method, handler RequestHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.handlers[method] = handler
+}
+
+// Call is a request sent to the peer under test.
+type Call struct {
+	ID     json.RawMessage
+	Method mcp.Method
+
+	conn *Conn
+	ch   chan *Message
+}
+
+// Response returns a channel receiving the response.
+func (call *Call) Response() <-chan *Message {
+	return call.ch
+}
+
+// Wait waits for the response and fails the test if it does not arrive in time.
+func (call *Call) Wait() *Message {
+	call.conn.tb.Helper()
+
+	select {
+	case rsp := <-call.ch:
+		return rsp
+	case <-time.After(call.conn.timeout()):
+		call.conn.tb.Fatalf("mcptest: no response to %s request %s after %v", call.Method, call.ID, call.conn.timeout())
+		return nil
+	}
+}
+
+// Request sends a request without waiting for its response.
+func (c *Conn) Request(method mcp.Method, params any) *Call {
+	c.tb.Helper()
+
+	c.mu.Lock()
+	c.nextID++
+	id := json.RawMessage(strconv.Itoa(c.nextID))
+	ch := make(chan *Message, 1)
+	c.pending[string(id)] = ch
+	c.mu.Unlock()
+
+	c.send(&Message{ID: id, Method: method, Params: c.encode(params)})
+
+	return &Call{ID: id, Method: method, conn: c, ch: ch}
+}
+
+// Call sends a request and waits for its response.
+// It fails the test if the peer answers with an error.
+func (c *Conn) Call(method mcp.Method, params any) json.RawMessage {
+	c.tb.Helper()
+
+	rsp := c.Request(method, params).Wait()
+	if rsp.Error != nil {
+		c.tb.Fatalf("mcptest: %s request failed: %d %s", method, rsp.Error.Code, rsp.Error.Message)
+	}
+
+	return rsp.Result
+}
+
+// Notify sends a notification.
+func (c *Conn) Notify(method mcp.Method, params any) {
+	c.tb.Helper()
+
+	c.send(&Message{Method: method, Params: c.encode(params)})
+}
+
+// SendRaw writes the data as it is, followed by a newline.
+func (c *Conn) SendRaw(data []byte) {
+	c.tb.Helper()
+
+	c.record("->", data)
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	_, err := c.w.Write(append(bytes.TrimSpace(data), '\n'))
+	if err != nil {
+		c.tb.Fatalf("mcptest: failed to send message: %v", err)
+	}
+}
+
+// ExpectMessage waits for a received message for which match returns true, and consumes it.
+// It fails the test if there is none in time.
+func (c *Conn) ExpectMessage(desc string, match func(*Message) bool) *Message {
+	c.tb.Helper()
+
+	timeout := time.After(c.timeout())
+	for {
+		c.mu.Lock()
+		for i, m := range c.received {
+			if match(m) {
+				c.received = append(c.received[:i], c.received[i+1:]...)
+				c.mu.Unlock()
+				return m
+			}
+		}
+		arrived := c.arrived
+		readErr := c.readErr
+		c.mu.Unlock()
+
+		if readErr != nil {
+			c.tb.Fatalf("mcptest: expected %s, but the connection ended: %v", desc, readErr)
+			return nil
+		}
+
+		select {
+		case <-arrived:
+		case <-timeout:
+			c.tb.Fatalf("mcptest: expected %s after %v, but received %s", desc, c.timeout(), c.describeReceived())
+			return nil
+		}
+	}
+}
+
+// ExpectNotification waits for a notification with the method and returns it.
+func (c *Conn) ExpectNotification(method mcp.Method) *Message {
+	c.tb.Helper()
+
+	return c.ExpectMessage(fmt.Sprintf("%s notification", method), func(m *Message) bool {
+		return m.IsNotification() && m.Method == method
+	})
+}
+
+// ExpectRequest waits for a request with the method and returns it.
+// The request is also answered by its handler, if any.
+func (c *Conn) ExpectRequest(method mcp.Method) *Message {
+	c.tb.Helper()
+
+	return c.ExpectMessage(fmt.Sprintf("%s request", method), func(m *Message) bool {
+		return m.IsRequest() && m.Method == method
+	})
+}
+
+// Transcript returns the messages exchanged so far, one per line,
+// prefixed with "->" when sent to the peer under test and "<-" when received from it.
+// The messages are compacted and their object keys are sorted.
+func (c *Conn) Transcript() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]string(nil), c.transcript...)
+}
+
+// Done returns a channel which is closed when the peer under test ends the connection.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close closes the writing side of the connection, as the end of the input of a stdio server.
+func (c *Conn) Close() error {
+	return c.w.Close()
+}
+
+func (c *Conn) timeout() time.Duration {
+	if c.Timeout <= 0 {
+		return DefaultTimeout
+	}
+	return c.Timeout
+}
+
+func (c *Conn) encode(v any) json.RawMessage {
+	c.tb.Helper()
+
+	if v == nil {
+		return nil
+	}
+	if raw, ok := v.(json.RawMessage); ok {
+		return raw
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		c.tb.Fatalf("mcptest: failed to encode params: %v", err)
+	}
+	return data
+}
+
+func (c *Conn) send(m *Message) {
+	c.tb.Helper()
+
+	m.JSONRPC = "2.0"
+	data, err := json.Marshal(m)
+	if err != nil {
+		c.tb.Fatalf("mcptest: failed to encode message: %v", err)
+	}
+
+	c.SendRaw(data)
+}
+
+// readMessages reads messages until the peer ends the connection.
+// It must not fail the test, as it runs outside of the test goroutine.
+func (c *Conn) readMessages(r io.Reader) {
+	defer close(c.done)
+
+	dec := json.NewDecoder(r)
+	for {
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if err != nil {
+			if errors.Is(err, io.ErrClosedPipe) {
+				err = io.EOF
+			}
+			c.mu.Lock()
+			c.readErr = err
+			c.notifyLocked()
+			c.mu.Unlock()
+			return
+		}
+
+		c.record("<-", raw)
+
+		if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+			var batch []json.RawMessage
+			if json.Unmarshal(raw, &batch) == nil {
+				for _, entry := range batch {
+					c.receive(entry)
+				}
+				continue
+			}
+		}
+		c.receive(raw)
+	}
+}
+
+func (c *Conn) receive(raw json.RawMessage) {
+	// A value which is not a message can only be found in the transcript
+	var m Message
+	err := json.Unmarshal(raw, &m)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if m.IsResponse() {
+		ch, ok := c.pending[string(m.ID)]
+		if ok {
+			delete(c.pending, string(m.ID))
+			ch <- &m
+			return
+		}
+	}
+
+	if m.IsRequest() {
+		go c.answer(&m, c.handlers[m.Method])
+	}
+
+	c.received = append(c.received, &m)
+	c.notifyLocked()
+}
+
+// answer answers a request from the peer with the handler, or with mcp.ErrMethodNotFound if it is nil.
+func (c *Conn) answer(req *Message, handler RequestHandler) {
+	rsp := &Message{JSONRPC: "2.0", ID: req.ID}
+	if handler == nil {
+		rsp.Error = mcp.ErrMethodNotFound
+	} else {
+		result, errObj := handler(req.Params)
+		if errObj != nil {
+			rsp.Error = errObj
+		} else {
+			data, err := json.Marshal(result)
+			if err != nil {
+				rsp.Error = &mcp.Error{Code: mcp.ErrInternalError.Code, Message: err.Error()}
+			} else {
+				rsp.Result = data
+			}
+		}
+	}
+
+	data, err := json.Marshal(rsp)
+	if err != nil {
+		return
+	}
+	c.record("->", data)
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.w.Write(append(data, '\n'))
+}
+
+// notifyLocked wakes up the goroutines waiting for a received message.
+func (c *Conn) notifyLocked() {
+	close(c.arrived)
+	c.arrived = make(chan struct{})
+}
+
+func (c *Conn) record(direction string, data []byte) {
+	line := direction + " " + normalize(data)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.transcript = append(c.transcript, line)
+}
+
+func (c *Conn) describeReceived() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.received) == 0 {
+		return "nothing"
+	}
+
+	var buf bytes.Buffer
+	for i, m := range c.received {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		switch {
+		case m.IsRequest():
+			fmt.Fprintf(&buf, "%s request", m.Method)
+		case m.IsNotification():
+			fmt.Fprintf(&buf, "%s notification", m.Method)
+		default:
+			fmt.Fprintf(&buf, "response %s", m.ID)
+		}
+	}
+	return buf.String()
+}
+
+// normalize compacts the JSON and sorts its object keys, so that equal messages are recorded identically.
+// Invalid JSON is returned as it is.
+func normalize(data []byte) string {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v any
+	err := dec.Decode(&v)
+	if err != nil {
+		return string(bytes.TrimSpace(data))
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	err = enc.Encode(v)
+	if err != nil {
+		return string(bytes.TrimSpace(data))
+	}
+	return string(bytes.TrimSpace(buf.Bytes()))
+}
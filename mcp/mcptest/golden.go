@@ -0,0 +1,60 @@
+package mcptest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// UpdateGoldenEnv is the environment variable which makes AssertGolden write the golden files
+// instead of comparing them, when it is set to a non-empty value.
+const UpdateGoldenEnv = "MCPTEST_UPDATE_GOLDEN"
+
+// AssertGolden compares the transcript with the golden file at path, such as "testdata/initialize.golden",
+// and fails the test if they differ.
+// Run the test with MCPTEST_UPDATE_GOLDEN=1 to record the transcript in the file instead.
+//
+// Only scripts whose messages are exchanged in a deterministic order should be recorded.
+func AssertGolden(tb testing.TB, path string, transcript []string) {
+	tb.Helper()
+
+	got := strings.Join(transcript, "\n") + "\n"
+
+	if os.Getenv(UpdateGoldenEnv) != "" {
+		err := os.MkdirAll(filepath.Dir(path), 0o755)
+		if err != nil {
+			tb.Fatalf("mcptest: failed to create the golden file directory: %v", err)
+		}
+		err = os.WriteFile(path, []byte(got), 0o644)
+		if err != nil {
+			tb.Fatalf("mcptest: failed to write the golden file: %v", err)
+		}
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		tb.Fatalf("mcptest: failed to read the golden file (run with %s=1 to create it): %v", UpdateGoldenEnv, err)
+	}
+	want := string(data)
+
+	if got == want {
+		return
+	}
+
+	gotLines := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+	wantLines := strings.Split(strings.TrimSuffix(want, "\n"), "\n")
+	for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			tb.Fatalf("mcptest: transcript differs from %s at line %d:\n got: %s\nwant: %s\n(run with %s=1 to update it)", path, i+1, g, w, UpdateGoldenEnv)
+		}
+	}
+}
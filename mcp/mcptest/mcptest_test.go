@@ -0,0 +1,80 @@
+package mcptest_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/OkutaniDaichi0106/mcp-go/mcp"
+	"github.com/OkutaniDaichi0106/mcp-go/mcp/mcptest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestMux() *mcp.ServerMux {
+	mux := mcp.NewServerMux()
+	mux.HandleTool(&mcp.ToolDefinition{
+		Name:        "echo",
+		Description: "Echo the arguments",
+		InputSchema: mcp.InputSchema(`{"type": "object"}`),
+	}, mcp.ToolHandlerFunc(func(w mcp.ContentsWriter, name string, args map[string]any) {
+		w.WriteContents([]mcp.Content{})
+	}))
+	mux.HandleResource(&mcp.ResourceDefinition{
+		URI:      "file:///readme.txt",
+		Name:     "readme",
+		MimeType: "text/plain",
+	}, mcp.ResourceHandlerFunc(func(w mcp.ContentsWriter, uri string, args map[string]any) {
+		w.WriteContents([]mcp.Content{})
+	}))
+
+	return mux
+}
+
+func TestFakeClient(t *testing.T) {
+	server := mcp.NewServer("test-server", "0.0.1")
+	server.Handler = newTestMux()
+
+	c := mcptest.NewFakeClient(t, server)
+	c.Initialize()
+
+	rsp := c.Request("unknown/method", nil).Wait()
+	assert.ErrorIs(t, rsp.Err(), mcp.ErrMethodNotFound)
+
+	mcptest.AssertGolden(t, "testdata/fake_client.golden", c.Transcript())
+}
+
+func TestFakeServer(t *testing.T) {
+	s := mcptest.NewFakeServer(t)
+	s.HandleTool("echo", map[string]any{
+		"content": []map[string]any{{"type": "text", "text": "hello"}},
+	})
+
+	sess, err := mcp.NewClient("test-client", "0.0.1").Dial(s.Transport())
+	require.NoError(t, err)
+	defer sess.Close()
+
+	s.ExpectNotification(mcp.MethodNotifyInitialized)
+
+	results, err := sess.Batch(context.Background(), &mcp.Request{
+		Method: mcp.MethodCallTool,
+		Params: mcp.Params(`{"name": "echo", "arguments": {"message": "hello"}}`),
+	})
+	require.NoError(t, err)
+	require.NoError(t, results[0].Err)
+	assert.JSONEq(t, `{"content": [{"type": "text", "text": "hello"}]}`, string(results[0].Result))
+
+	args := s.ExpectToolCall("echo")
+	assert.Equal(t, map[string]any{"message": "hello"}, args)
+
+	results, err = sess.Batch(context.Background(), &mcp.Request{
+		Method: mcp.MethodCallTool,
+		Params: mcp.Params(`{"name": "unknown", "arguments": {}}`),
+	})
+	require.NoError(t, err)
+	assert.ErrorIs(t, results[0].Err, mcp.ErrInvalidParams)
+
+}
+
+func TestRunConformance(t *testing.T) {
+	mcptest.RunConformance(t, newTestMux())
+}
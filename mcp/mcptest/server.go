@@ -0,0 +1,152 @@
+package mcptest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/OkutaniDaichi0106/mcp-go/mcp"
+)
+
+// FakeServer is a scripted server which a client under test dials with Transport.
+//
+// It answers the initialization with Capabilities and ServerInfo, and the tool calls
+// with the results registered with HandleTool. Other requests are answered by the handlers
+// registered with Handle, and with mcp.ErrMethodNotFound otherwise.
+type FakeServer struct {
+	*Conn
+
+	// Capabilities advertised at the initialization
+	Capabilities map[string]any
+	// ServerInfo sent at the initialization
+	ServerInfo map[string]any
+
+	transport mcp.Transport
+
+	toolsLock sync.Mutex
+	tools     map[string]RequestHandler
+}
+
+// NewFakeServer creates a fake server advertising the tools, resources and prompts capabilities.
+// The connection is closed when the test ends.
+func NewFakeServer(tb testing.TB) *FakeServer {
+	tb.Helper()
+
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+
+	s := &FakeServer{
+		Conn: newConn(tb, serverW, serverR),
+		Capabilities: map[string]any{
+			"tools":     map[string]any{},
+			"resources": map[string]any{},
+			"prompts":   map[string]any{},
+		},
+		ServerInfo: map[string]any{
+			"name":    "mcptest",
+			"version": "0.0.0",
+		},
+		transport: mcp.NewStreamTransport(clientW, clientR),
+		tools:     make(map[string]RequestHandler),
+	}
+
+	s.Handle(mcp.MethodInit, s.initialize)
+	s.Handle(mcp.MethodCallTool, s.callTool)
+
+	tb.Cleanup(func() {
+		s.transport.Close()
+		serverW.Close()
+		serverR.Close()
+	})
+
+	return s
+}
+
+// Transport returns the transport for the client under test to dial.
+func (s *FakeServer) Transport() mcp.Transport {
+	return s.transport
+}
+
+// HandleTool registers the result of the calls of the tool.
+// result is sent as it is, such as a map with a content list.
+func (s *FakeServer) HandleTool(name string, result any) {
+	s.HandleToolFunc(name, func(json.RawMessage) (any, *mcp.Error) {
+		return result, nil
+	})
+}
+
+// HandleToolFunc registers the handler answering the calls of the tool.
+// The handler receives the arguments of the call.
+func (s *FakeServer) HandleToolFunc(name string, handler RequestHandler) {
+	s.toolsLock.Lock()
+	defer s.toolsLock.Unlock()
+
+	s.tools[name] = handler
+}
+
+// ExpectToolCall waits for a call of the tool and returns its arguments.
+func (s *FakeServer) ExpectToolCall(name string) map[string]any {
+	s.tb.Helper()
+
+	var args map[string]any
+	s.ExpectMessage(fmt.Sprintf("call of tool %q", name), func(m *Message) bool {
+		if !m.IsRequest() || m.Method != mcp.MethodCallTool {
+			return false
+		}
+
+		var params toolCallParams
+		if json.Unmarshal(m.Params, &params) != nil || params.Name != name {
+			return false
+		}
+
+		args = params.Arguments
+		return true
+	})
+
+	return args
+}
+
+type toolCallParams struct {
+	Name      string         `json:"name"`
+	Arguments map[string]any `json:"arguments"`
+}
+
+func (s *FakeServer) initialize(params json.RawMessage) (any, *mcp.Error) {
+	var p struct {
+		ProtocolVersion mcp.Version `json:"protocolVersion"`
+	}
+	err := json.Unmarshal(params, &p)
+	if err != nil || p.ProtocolVersion == "" {
+		return nil, mcp.ErrInvalidParams
+	}
+
+	return map[string]any{
+		"protocolVersion": p.ProtocolVersion,
+		"capabilities":    s.Capabilities,
+		"serverInfo":      s.ServerInfo,
+	}, nil
+}
+
+func (s *FakeServer) callTool(params json.RawMessage) (any, *mcp.Error) {
+	var p toolCallParams
+	err := json.Unmarshal(params, &p)
+	if err != nil {
+		return nil, mcp.ErrInvalidParams
+	}
+
+	s.toolsLock.Lock()
+	handler, ok := s.tools[p.Name]
+	s.toolsLock.Unlock()
+	if !ok {
+		return nil, &mcp.Error{Code: mcp.ErrInvalidParams.Code, Message: fmt.Sprintf("Unknown tool: %s", p.Name)}
+	}
+
+	args, err := json.Marshal(p.Arguments)
+	if err != nil {
+		return nil, mcp.ErrInvalidParams
+	}
+
+	return handler(args)
+}
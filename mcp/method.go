@@ -4,6 +4,11 @@ type Method string
 
 const (
 	MethodInit Method = "initialize"
+	// Notification sent by the client once it has received the result of the initialize request
+	MethodNotifyInitialized Method = "notifications/initialized"
+
+	// Utilities
+	MethodNotifyCancelled Method = "notifications/cancelled"
 
 	// Tools
 	MethodListTools         Method = "tools/list"
@@ -14,6 +19,7 @@ const (
 	MethodListResources         Method = "resources/list"
 	MethodReadResource          Method = "resources/read"
 	MethodSubscribeResource     Method = "resources/subscribe"
+	MethodUnsubscribeResource   Method = "resources/unsubscribe"
 	MethodNotifyResourceChanged Method = "notifications/resources/list_changed"
 	MethodNotifyResourceUpdated Method = "notifications/resources/updated"
 
@@ -28,6 +34,9 @@ const (
 	// Sampling
 	MethodCreateSampleMessage Method = "sampling/createMessage"
 
+	// Elicitation
+	MethodCreateElicitation Method = "elicitation/create"
+
 	// Roots
 	MethodListRoots         Method = "roots/list"
 	MethodNotifyRootChanged Method = "notifications/roots/list_changed"
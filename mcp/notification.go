@@ -1,3 +1,66 @@
 package mcp
 
+import "sync"
+
 type Notification Request
+
+// listChangedBufferSize is the number of list_changed notifications kept for a slow receiver.
+const listChangedBufferSize = 16
+
+// listChangedListeners delivers the methods of list_changed notifications, such as MethodNotifyToolChanged,
+// to the channels returned by ListChanged. As the notifications only tell that a list must be fetched again,
+// they are dropped for a receiver which does not keep up rather than blocking the session.
+type listChangedListeners struct {
+	mu     sync.Mutex
+	chs    []chan Method
+	closed bool
+}
+
+// add returns a new channel receiving the notifications, which is closed by close.
+func (l *listChangedListeners) add() <-chan Method {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ch := make(chan Method, listChangedBufferSize)
+	if l.closed {
+		close(ch)
+		return ch
+	}
+	l.chs = append(l.chs, ch)
+	return ch
+}
+
+func (l *listChangedListeners) notify(method Method) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, ch := range l.chs {
+		select {
+		case ch <- method:
+		default:
+		}
+	}
+}
+
+func (l *listChangedListeners) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return
+	}
+	l.closed = true
+	for _, ch := range l.chs {
+		close(ch)
+	}
+	l.chs = nil
+}
+
+// isListChanged reports whether the method is a list_changed notification.
+func isListChanged(method Method) bool {
+	switch method {
+	case MethodNotifyToolChanged, MethodNotifyResourceChanged, MethodNotifyPromptChanged:
+		return true
+	}
+	return false
+}
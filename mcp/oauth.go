@@ -0,0 +1,511 @@
+package mcp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OAuthConfig configures the OAuth 2.1 authorization of a client over the HTTP transports.
+//
+// When the server answers with 401 Unauthorized, the client discovers the authorization server
+// from the protected resource metadata of the server, and obtains a token with the authorization code flow and PKCE.
+// Tokens are kept in the TokenStore and refreshed when they expire.
+type OAuthConfig struct {
+	// Client credentials registered on the authorization server.
+	// ClientSecret is empty for a public client.
+	ClientID     string
+	ClientSecret string
+
+	// RedirectURL is the URL to which the authorization server redirects the user agent with the authorization code.
+	RedirectURL string
+	// Scopes to request. If empty, the scopes advertised by the server are requested.
+	Scopes []string
+
+	// Authorize sends the user agent to the authorization URL, for example by opening a browser,
+	// and returns the URL to which the authorization server redirected it, with its query parameters.
+	// It is required to run the authorization code flow.
+	Authorize func(ctx context.Context, authorizationURL string) (*url.URL, error)
+
+	// TokenStore keeps the tokens across sessions.
+	// If nil, tokens are kept in memory for the lifetime of the transport.
+	TokenStore TokenStore
+}
+
+// Token is an OAuth 2.0 access token with its refresh token.
+type Token struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	Expiry       time.Time `json:"expiry,omitempty"`
+}
+
+// expiryDelta is how long before its expiry a token is considered expired, to account for clock skew and latency.
+const expiryDelta = 10 * time.Second
+
+// Valid reports whether the token has an access token which has not expired.
+func (t *Token) Valid() bool {
+	if t == nil || t.AccessToken == "" {
+		return false
+	}
+	return t.Expiry.IsZero() || time.Now().Add(expiryDelta).Before(t.Expiry)
+}
+
+// TokenStore keeps the token of a client. It must be safe for concurrent use.
+type TokenStore interface {
+	// Token returns the stored token, or nil if there is none.
+	Token(ctx context.Context) (*Token, error)
+	// SetToken replaces the stored token.
+	SetToken(ctx context.Context, token *Token) error
+}
+
+// NewMemoryTokenStore creates a TokenStore keeping the token in memory.
+func NewMemoryTokenStore() TokenStore {
+	return &memoryTokenStore{}
+}
+
+var _ TokenStore = (*memoryTokenStore)(nil)
+
+type memoryTokenStore struct {
+	mu    sync.Mutex
+	token *Token
+}
+
+func (s *memoryTokenStore) Token(ctx context.Context) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.token, nil
+}
+
+func (s *memoryTokenStore) SetToken(ctx context.Context, token *Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = token
+	return nil
+}
+
+// authorizationServerMetadata is the subset of the OAuth 2.0 authorization server metadata (RFC 8414) used by the client.
+type authorizationServerMetadata struct {
+	Issuer                        string   `json:"issuer"`
+	AuthorizationEndpoint         string   `json:"authorization_endpoint"`
+	TokenEndpoint                 string   `json:"token_endpoint"`
+	CodeChallengeMethodsSupported []string `json:"code_challenge_methods_supported,omitempty"`
+}
+
+var _ http.RoundTripper = (*oauthRoundTripper)(nil)
+
+// oauthRoundTripper authorizes the requests of a client transport with a bearer token.
+// A request answered with 401 Unauthorized is retried once with a new token.
+type oauthRoundTripper struct {
+	base     http.RoundTripper
+	config   *OAuthConfig
+	store    TokenStore
+	resource string
+
+	// mu serializes the acquisition of tokens, so that the user is asked to authorize only once
+	mu sync.Mutex
+	// Endpoints of the authorization server, known after the first 401 response
+	metadata *authorizationServerMetadata
+	// Scopes supported by the server, from its protected resource metadata
+	scopes []string
+}
+
+func newOAuthRoundTripper(base http.RoundTripper, config *OAuthConfig, resource string) *oauthRoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	store := config.TokenStore
+	if store == nil {
+		store = NewMemoryTokenStore()
+	}
+
+	return &oauthRoundTripper{
+		base:     base,
+		config:   config,
+		store:    store,
+		resource: resource,
+	}
+}
+
+func (rt *oauthRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	token, err := rt.validToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := rt.do(req, token)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// The token is missing or was rejected
+	challenge := resp.Header.Get("WWW-Authenticate")
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	token, err = rt.authorize(ctx, token, challenge)
+	if err != nil {
+		return nil, fmt.Errorf("authorization failed: %w", err)
+	}
+
+	retry := req.Clone(ctx)
+	if req.GetBody != nil {
+		retry.Body, err = req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return rt.do(retry, token)
+}
+
+func (rt *oauthRoundTripper) do(req *http.Request, token *Token) (*http.Response, error) {
+	if token != nil {
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	}
+	return rt.base.RoundTrip(req)
+}
+
+// validToken returns the stored token, refreshed if it has expired, or nil if there is no usable token.
+func (rt *oauthRoundTripper) validToken(ctx context.Context) (*Token, error) {
+	token, err := rt.store.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if token.Valid() {
+		return token, nil
+	}
+	if token == nil || token.RefreshToken == "" {
+		return nil, nil
+	}
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if rt.metadata == nil {
+		// The authorization server is not known yet
+		return nil, nil
+	}
+
+	token, err = rt.refresh(ctx, token)
+	if err != nil {
+		// The refresh token may have expired too, so the request is sent without a token
+		return nil, nil
+	}
+	return token, nil
+}
+
+// authorize obtains a new token after the server refused the request sent with rejected, which may be nil.
+// The token is refreshed if possible, and the authorization code flow is run otherwise.
+func (rt *oauthRoundTripper) authorize(ctx context.Context, rejected *Token, challenge string) (*Token, error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	// Another request may have obtained a new token in the meantime
+	token, err := rt.store.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if token.Valid() && (rejected == nil || token.AccessToken != rejected.AccessToken) {
+		return token, nil
+	}
+
+	if rt.metadata == nil {
+		err := rt.discover(ctx, challenge)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if token != nil && token.RefreshToken != "" {
+		token, err := rt.refresh(ctx, token)
+		if err == nil {
+			return token, nil
+		}
+	}
+
+	return rt.authorizeCode(ctx)
+}
+
+// discover finds the authorization server of the server from the protected resource metadata
+// announced in the WWW-Authenticate header, and fetches its metadata.
+// Without protected resource metadata, the authorization server is assumed to be at the origin of the server.
+func (rt *oauthRoundTripper) discover(ctx context.Context, challenge string) error {
+	issuer := ""
+	if metadataURL := authParam(challenge, "resource_metadata"); metadataURL != "" {
+		var prm ProtectedResourceMetadata
+		err := rt.getJSON(ctx, metadataURL, &prm)
+		if err != nil {
+			return fmt.Errorf("failed to fetch protected resource metadata: %w", err)
+		}
+		// The metadata must describe the server, so that a token is never requested for another resource (RFC 9728)
+		if strings.TrimSuffix(prm.Resource, "/") != strings.TrimSuffix(rt.resource, "/") {
+			return fmt.Errorf("protected resource metadata is for %q, not %q", prm.Resource, rt.resource)
+		}
+		if len(prm.AuthorizationServers) > 0 {
+			issuer = prm.AuthorizationServers[0]
+		}
+		rt.scopes = prm.ScopesSupported
+	}
+
+	if issuer == "" {
+		u, err := url.Parse(rt.resource)
+		if err != nil {
+			return err
+		}
+		issuer = u.Scheme + "://" + u.Host
+	}
+
+	issuerURL, err := url.Parse(issuer)
+	if err != nil {
+		return fmt.Errorf("invalid authorization server: %w", err)
+	}
+
+	// The well-known path is inserted between the host and the path of the issuer (RFC 8414)
+	metadataURL := *issuerURL
+	metadataURL.Path = "/.well-known/oauth-authorization-server" + strings.TrimSuffix(issuerURL.Path, "/")
+
+	var metadata authorizationServerMetadata
+	err = rt.getJSON(ctx, metadataURL.String(), &metadata)
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		// Fall back to the default endpoints
+		metadata = authorizationServerMetadata{
+			Issuer:                        issuer,
+			AuthorizationEndpoint:         issuerURL.JoinPath("authorize").String(),
+			TokenEndpoint:                 issuerURL.JoinPath("token").String(),
+			CodeChallengeMethodsSupported: []string{"S256"},
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to fetch authorization server metadata: %w", err)
+	}
+
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" {
+		return errors.New("authorization server metadata lacks endpoints")
+	}
+	// The metadata must be the one of the issuer, so that it cannot be impersonated (RFC 8414)
+	if metadata.Issuer != issuer {
+		return fmt.Errorf("authorization server metadata is for %q, not %q", metadata.Issuer, issuer)
+	}
+	if !slices.Contains(metadata.CodeChallengeMethodsSupported, "S256") {
+		return errors.New("authorization server does not support PKCE with S256")
+	}
+
+	rt.metadata = &metadata
+	return nil
+}
+
+// authorizeCode runs the authorization code flow with PKCE.
+func (rt *oauthRoundTripper) authorizeCode(ctx context.Context) (*Token, error) {
+	if rt.config.Authorize == nil {
+		return nil, errors.New("OAuthConfig.Authorize is not set")
+	}
+
+	verifier, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+	state, err := randomString(16)
+	if err != nil {
+		return nil, err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+
+	scopes := rt.config.Scopes
+	if len(scopes) == 0 {
+		scopes = rt.scopes
+	}
+
+	authURL, err := url.Parse(rt.metadata.AuthorizationEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", rt.config.ClientID)
+	query.Set("redirect_uri", rt.config.RedirectURL)
+	query.Set("state", state)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	query.Set("resource", rt.resource)
+	if len(scopes) > 0 {
+		query.Set("scope", strings.Join(scopes, " "))
+	}
+	authURL.RawQuery = query.Encode()
+
+	redirected, err := rt.config.Authorize(ctx, authURL.String())
+	if err != nil {
+		return nil, err
+	}
+
+	params := redirected.Query()
+	if errCode := params.Get("error"); errCode != "" {
+		return nil, fmt.Errorf("authorization denied: %s %s", errCode, params.Get("error_description"))
+	}
+	if params.Get("state") != state {
+		return nil, errors.New("state of the authorization response does not match")
+	}
+	code := params.Get("code")
+	if code == "" {
+		return nil, errors.New("authorization response lacks the code")
+	}
+
+	return rt.requestToken(ctx, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {rt.config.RedirectURL},
+		"code_verifier": {verifier},
+	}, "")
+}
+
+// refresh exchanges the refresh token of the token for a new one.
+func (rt *oauthRoundTripper) refresh(ctx context.Context, token *Token) (*Token, error) {
+	return rt.requestToken(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {token.RefreshToken},
+	}, token.RefreshToken)
+}
+
+// requestToken requests a token from the token endpoint and stores it.
+// If the response has no refresh token, refreshToken is kept.
+func (rt *oauthRoundTripper) requestToken(ctx context.Context, form url.Values, refreshToken string) (*Token, error) {
+	form.Set("resource", rt.resource)
+	if rt.config.ClientSecret == "" {
+		form.Set("client_id", rt.config.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rt.metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if rt.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(rt.config.ClientID), url.QueryEscape(rt.config.ClientSecret))
+	}
+
+	resp, err := rt.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		AccessToken      string `json:"access_token"`
+		TokenType        string `json:"token_type"`
+		RefreshToken     string `json:"refresh_token"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token response: %w", err)
+	}
+	if body.Error != "" {
+		return nil, fmt.Errorf("token request failed: %s %s", body.Error, body.ErrorDescription)
+	}
+	if resp.StatusCode != http.StatusOK || body.AccessToken == "" {
+		return nil, &httpStatusError{StatusCode: resp.StatusCode}
+	}
+
+	token := &Token{
+		AccessToken:  body.AccessToken,
+		TokenType:    body.TokenType,
+		RefreshToken: body.RefreshToken,
+	}
+	if token.RefreshToken == "" {
+		token.RefreshToken = refreshToken
+	}
+	if body.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	}
+
+	err = rt.store.SetToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (rt *oauthRoundTripper) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := rt.base.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &httpStatusError{StatusCode: resp.StatusCode}
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// authParam returns the value of a parameter of a Bearer challenge of a WWW-Authenticate header.
+func authParam(challenge, name string) string {
+	_, params, ok := strings.Cut(challenge, " ")
+	if !ok {
+		return ""
+	}
+
+	for params != "" {
+		var key, value string
+		key, params, _ = strings.Cut(strings.TrimLeft(params, " ,"), "=")
+		params = strings.TrimLeft(params, " ")
+
+		if strings.HasPrefix(params, `"`) {
+			// Quoted string, which may contain commas and escaped characters
+			var b strings.Builder
+			i := 1
+			for ; i < len(params) && params[i] != '"'; i++ {
+				if params[i] == '\\' && i+1 < len(params) {
+					i++
+				}
+				b.WriteByte(params[i])
+			}
+			value = b.String()
+			params = params[min(i+1, len(params)):]
+		} else {
+			value, params, _ = strings.Cut(params, ",")
+		}
+
+		if strings.EqualFold(strings.TrimSpace(key), name) {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// randomString returns n random bytes encoded in base64url, which is suitable for a PKCE verifier and a state.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -3,3 +3,10 @@ package mcp
 import "encoding/json"
 
 type Params json.RawMessage
+
+func (p Params) MarshalJSON() ([]byte, error) {
+	if len(p) == 0 {
+		return []byte("null"), nil
+	}
+	return json.RawMessage(p).MarshalJSON()
+}
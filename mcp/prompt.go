@@ -2,12 +2,26 @@ package mcp
 
 type PromptDefinition struct {
 	Name        string `json:"name"`
-	Description string `json:"description"`
+	Description string `json:"description,omitempty"`
 	Arguments   []struct {
 		Name        string `json:"name"`
 		Description string `json:"description"`
 		Required    bool   `json:"required"`
-	}
+	} `json:"arguments,omitempty"`
+}
+
+// ListPromptsResult is the result of the listing of the prompts of a server.
+type ListPromptsResult struct {
+	Prompts    []*PromptDefinition `json:"prompts"`
+	NextCursor string              `json:"nextCursor,omitempty"`
+	Meta       map[string]any      `json:"_meta,omitempty"`
+}
+
+// GetPromptResult is a prompt returned by a server.
+type GetPromptResult struct {
+	Description string           `json:"description,omitempty"`
+	Messages    []*PromptMessage `json:"messages"`
+	Meta        map[string]any   `json:"_meta,omitempty"`
 }
 
 func (pd *PromptDefinition) Clone() *PromptDefinition {
@@ -1,5 +1,12 @@
 package mcp
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
 type PromptWriter interface {
 	Write(role Role, content Content) error
 	CloseWithError(code ErrorCode, msg string) error
@@ -11,3 +18,102 @@ const (
 	User      Role = "user"
 	Assistant Role = "assistant"
 )
+
+// PromptMessage is a message of a prompt.
+type PromptMessage struct {
+	Role    Role    `json:"role"`
+	Content Content `json:"content"`
+}
+
+func (m *PromptMessage) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Role    Role            `json:"role"`
+		Content json.RawMessage `json:"content"`
+	}
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		return err
+	}
+
+	content, err := unmarshalContent(v.Content)
+	if err != nil {
+		return err
+	}
+
+	m.Role = v.Role
+	m.Content = content
+
+	return nil
+}
+
+var _ PromptWriter = (*promptWriter)(nil)
+
+// promptWriter collects the messages of a prompt until the handler returns,
+// and then answers the request with them.
+type promptWriter struct {
+	rw ResponseWriter
+
+	mu        sync.Mutex
+	done      bool
+	closedErr error
+	messages  []*PromptMessage
+}
+
+func newPromptWriter(rw ResponseWriter) *promptWriter {
+	return &promptWriter{rw: rw, messages: []*PromptMessage{}}
+}
+
+func (pw *promptWriter) Write(role Role, content Content) error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	if pw.done {
+		if pw.closedErr != nil {
+			return fmt.Errorf("writer is already closed: %w", pw.closedErr)
+		}
+		return errors.New("prompt has already been written")
+	}
+
+	pw.messages = append(pw.messages, &PromptMessage{Role: role, Content: content})
+
+	return nil
+}
+
+func (pw *promptWriter) CloseWithError(code ErrorCode, msg string) error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	if pw.done {
+		if pw.closedErr != nil {
+			return fmt.Errorf("writer is already closed: %w", pw.closedErr)
+		}
+		return errors.New("prompt has already been written")
+	}
+
+	pw.done = true
+	pw.closedErr = newError(code, msg, nil)
+
+	return pw.rw.CloseWithError(code, msg, nil)
+}
+
+// flush answers the request with the messages written so far and the description of the prompt,
+// unless the writer was closed with an error.
+func (pw *promptWriter) flush(description string) error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	if pw.done {
+		return nil
+	}
+	pw.done = true
+
+	result, err := json.Marshal(&GetPromptResult{
+		Description: description,
+		Messages:    pw.messages,
+	})
+	if err != nil {
+		return err
+	}
+
+	return pw.rw.WriteResult(result)
+}
@@ -0,0 +1,406 @@
+// Package proxy relays the sessions of MCP clients to a backend server over another transport,
+// for example to expose a server speaking only over stdio to remote clients over Streamable HTTP.
+//
+// Requests and notifications are relayed in both directions, including the requests initiated by the backend,
+// such as sampling, roots and elicitation, the cancellations and the progress notifications.
+// Each client session is relayed to its own backend connection, so that clients never share a session.
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"sync"
+
+	"github.com/OkutaniDaichi0106/mcp-go/mcp"
+)
+
+// New returns a proxy relaying each client session to a backend connection opened by dial.
+func New(dial func(ctx context.Context) (mcp.Transport, error)) *Proxy {
+	return &Proxy{
+		Dial: dial,
+	}
+}
+
+// Proxy relays client sessions to a backend server.
+//
+// It serves the sessions accepted by an mcp.Server when set as its ServeTransport, on any transport of the server:
+//
+//	p := proxy.New(func(ctx context.Context) (mcp.Transport, error) {
+//		return mcp.NewProcessTransport(&mcp.StdioCommand{Path: "my-server"})
+//	})
+//	server := mcp.NewServer("my-proxy", "1.0.0")
+//	server.ServeTransport = p.ServeTransport
+//	server.ListenAndServeHTTP(":8080")
+type Proxy struct {
+	// Dial opens a new connection to the backend for each client session.
+	// The connection is closed when the client session ends, and the client session is closed when the connection ends.
+	Dial func(ctx context.Context) (mcp.Transport, error)
+
+	// AllowTools, if not empty, limits the tools exposed to the clients to the ones matching any of its patterns.
+	// DenyTools hides the tools matching any of its patterns, even if they are allowed.
+	// Patterns are matched against the names of the tools with path.Match, such as "delete_*".
+	// Hidden tools are removed from the lists and their calls fail with mcp.ErrToolNotFound.
+	AllowTools []string
+	DenyTools  []string
+
+	Logger *slog.Logger
+}
+
+func (p *Proxy) logger() *slog.Logger {
+	if p.Logger == nil {
+		return slog.Default()
+	}
+	return p.Logger
+}
+
+// allowTool reports whether the tool is exposed to the clients.
+func (p *Proxy) allowTool(name string) bool {
+	if len(p.AllowTools) > 0 && !matchAny(p.AllowTools, name) {
+		return false
+	}
+	return !matchAny(p.DenyTools, name)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeTransport relays the session of the client transport to a new backend connection.
+// It returns once the initialize request of the client is answered by the backend,
+// while the session is relayed in the background until either side ends.
+func (p *Proxy) ServeTransport(client mcp.Transport) error {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	req, w, err := client.AcceptRequest(ctx)
+	if err != nil {
+		cancel()
+		return err
+	}
+	if req.Method != mcp.MethodInit {
+		cancel()
+		w.CloseWithError(mcp.ErrInvalidRequest.Code, mcp.ErrInvalidRequest.Message, nil)
+		return errors.New("first request must be init")
+	}
+
+	backend, err := p.Dial(ctx)
+	if err != nil {
+		cancel()
+		w.CloseWithError(mcp.ErrInternalError.Code, mcp.ErrInternalError.Message, nil)
+		return fmt.Errorf("failed to dial the backend: %w", err)
+	}
+
+	s := &session{
+		proxy:   p,
+		client:  newRelay(client),
+		backend: newRelay(backend),
+	}
+
+	// The initialization is relayed before anything else, and fails the session if the backend rejects it
+	err = s.relayRequest(ctx, s.client, s.backend, req, w)
+	if err != nil {
+		cancel()
+		backend.CloseWithError(err)
+		return err
+	}
+
+	go s.serve(ctx, cancel)
+
+	return nil
+}
+
+// session is a client session relayed to its backend connection.
+type session struct {
+	proxy *Proxy
+
+	client  *relay
+	backend *relay
+}
+
+// relay is a side of a session with the requests it sent which are still waiting for their responses.
+type relay struct {
+	t mcp.Transport
+
+	mu sync.Mutex
+	// inflight maps the IDs of the requests relayed from the other side to the IDs they were sent with on this side,
+	// so that the cancellations of the other side refer to the right requests
+	inflight map[mcp.ID]*inflightRequest
+}
+
+// inflightRequest is a request relayed to this side, registered before it is sent.
+type inflightRequest struct {
+	// id is the ID the request was sent with, set once it is sent
+	id     mcp.ID
+	sent   bool
+	cancel context.CancelFunc
+	// cancellation holds the params of a cancellation received before the request was sent
+	cancellation map[string]json.RawMessage
+}
+
+func newRelay(t mcp.Transport) *relay {
+	return &relay{
+		t:        t,
+		inflight: make(map[mcp.ID]*inflightRequest),
+	}
+}
+
+// serve relays the messages of both sides until either side ends, and then closes the other side.
+func (s *session) serve(ctx context.Context, cancel context.CancelFunc) {
+	defer cancel()
+
+	go s.relayRequests(ctx, s.client, s.backend)
+	go s.relayRequests(ctx, s.backend, s.client)
+	go s.relayNotifications(ctx, s.client, s.backend)
+	go s.relayNotifications(ctx, s.backend, s.client)
+
+	select {
+	case <-s.client.t.Done():
+		s.backend.t.CloseWithError(s.client.t.Err())
+	case <-s.backend.t.Done():
+		s.proxy.logger().Info("backend connection ended", "error", s.backend.t.Err())
+		s.client.t.CloseWithError(s.backend.t.Err())
+	}
+}
+
+// relayRequests relays the requests received from one side to the other, each in its own goroutine.
+func (s *session) relayRequests(ctx context.Context, from, to *relay) {
+	for {
+		req, w, err := from.t.AcceptRequest(ctx)
+		if err != nil {
+			return
+		}
+
+		go func() {
+			err := s.relayRequest(ctx, from, to, req, w)
+			if err != nil {
+				s.proxy.logger().Error("failed to relay request", "method", req.Method, "error", err)
+			}
+		}()
+	}
+}
+
+// relayRequest sends the request to the other side and answers it with the response,
+// or with mcp.ErrRequestCancelled if the request is cancelled by its sender in the meantime.
+func (s *session) relayRequest(ctx context.Context, from, to *relay, req *mcp.Request, w mcp.ResponseWriter) error {
+	toBackend := to == s.backend
+
+	if toBackend && req.Method == mcp.MethodCallTool {
+		var params struct {
+			Name string `json:"name"`
+		}
+		err := json.Unmarshal(req.Params, &params)
+		if err != nil {
+			// The tool cannot be checked against the filter, so the call is not relayed
+			return w.CloseWithError(mcp.ErrInvalidParams.Code, mcp.ErrInvalidParams.Message, nil)
+		}
+		if !s.proxy.allowTool(params.Name) {
+			return w.CloseWithError(mcp.ErrToolNotFound.Code, mcp.ErrToolNotFound.Message, nil)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The request is registered before it is sent, so that a cancellation received meanwhile is not lost
+	inflight := &inflightRequest{cancel: cancel}
+	to.mu.Lock()
+	to.inflight[w.ID()] = inflight
+	to.mu.Unlock()
+	defer func() {
+		to.mu.Lock()
+		delete(to.inflight, w.ID())
+		to.mu.Unlock()
+	}()
+
+	rsp, err := to.t.Request(&mcp.Request{Method: req.Method, Params: req.Params})
+	if err != nil {
+		w.CloseWithError(mcp.ErrInternalError.Code, mcp.ErrInternalError.Message, nil)
+		return err
+	}
+
+	to.mu.Lock()
+	inflight.id = rsp.ID()
+	inflight.sent = true
+	cancellation := inflight.cancellation
+	to.mu.Unlock()
+
+	if cancellation != nil {
+		// The request was cancelled before it was sent
+		notif, err := cancellationNotification(cancellation, rsp.ID())
+		if err == nil {
+			err = to.t.Notify(notif)
+		}
+		if err != nil {
+			s.proxy.logger().Error("failed to relay cancellation", "error", err)
+		}
+	}
+
+	result, err := rsp.ReadResultContext(ctx)
+	if ctx.Err() != nil {
+		return w.CloseWithError(mcp.ErrRequestCancelled.Code, mcp.ErrRequestCancelled.Message, nil)
+	}
+	if err != nil {
+		var rpcErr *mcp.Error
+		if errors.As(err, &rpcErr) {
+			return w.CloseWithError(rpcErr.Code, rpcErr.Message, errorData(rpcErr.Data))
+		}
+		w.CloseWithError(mcp.ErrInternalError.Code, mcp.ErrInternalError.Message, nil)
+		return err
+	}
+
+	if toBackend && req.Method == mcp.MethodListTools {
+		result, err = s.filterTools(result)
+		if err != nil {
+			w.CloseWithError(mcp.ErrInternalError.Code, mcp.ErrInternalError.Message, nil)
+			return err
+		}
+	}
+
+	return w.WriteResult(result)
+}
+
+// errorData returns the data of an error received from a side, to be relayed to the other side.
+func errorData(data any) map[string]json.RawMessage {
+	if data == nil {
+		return nil
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(raw, &fields) != nil {
+		return nil
+	}
+	return fields
+}
+
+// filterTools removes the hidden tools from the result of a tools/list request, keeping its other fields.
+func (s *session) filterTools(result mcp.Result) (mcp.Result, error) {
+	if len(s.proxy.AllowTools) == 0 && len(s.proxy.DenyTools) == 0 {
+		return result, nil
+	}
+
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(result, &fields)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s result: %w", mcp.MethodListTools, err)
+	}
+
+	var tools []json.RawMessage
+	err = json.Unmarshal(fields["tools"], &tools)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s result: %w", mcp.MethodListTools, err)
+	}
+
+	allowed := make([]json.RawMessage, 0, len(tools))
+	for _, tool := range tools {
+		var definition struct {
+			Name string `json:"name"`
+		}
+		err := json.Unmarshal(tool, &definition)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s result: %w", mcp.MethodListTools, err)
+		}
+		if s.proxy.allowTool(definition.Name) {
+			allowed = append(allowed, tool)
+		}
+	}
+
+	fields["tools"], err = json.Marshal(allowed)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(fields)
+}
+
+// relayNotifications relays the notifications received from one side to the other.
+// Cancellations are translated to the IDs of the requests on the other side.
+func (s *session) relayNotifications(ctx context.Context, from, to *relay) {
+	for {
+		notif, err := from.t.AcceptNotification(ctx)
+		if err != nil {
+			return
+		}
+
+		if notif.Method == mcp.MethodNotifyCancelled {
+			notif, err = to.cancel(notif)
+			if err != nil {
+				s.proxy.logger().Error("failed to relay cancellation", "error", err)
+				continue
+			}
+			if notif == nil {
+				continue
+			}
+		}
+
+		err = to.t.Notify(&mcp.Notification{Method: notif.Method, Params: notif.Params})
+		if err != nil {
+			s.proxy.logger().Error("failed to relay notification", "method", notif.Method, "error", err)
+		}
+	}
+}
+
+// cancel stops waiting for the response of the request cancelled by the other side,
+// and returns the cancellation to send on this side. It returns nil if the request is not in flight.
+func (r *relay) cancel(notif *mcp.Notification) (*mcp.Notification, error) {
+	var params map[string]json.RawMessage
+	err := json.Unmarshal(notif.Params, &params)
+	if err != nil {
+		return nil, err
+	}
+
+	var id mcp.ID
+	err = json.Unmarshal(params["requestId"], &id)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	req, ok := r.inflight[id]
+	var sent bool
+	var sentID mcp.ID
+	if ok {
+		sent, sentID = req.sent, req.id
+		if !sent {
+			// The cancellation is sent once the ID of the request is known
+			req.cancellation = params
+		}
+	}
+	r.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	req.cancel()
+
+	if !sent {
+		return nil, nil
+	}
+	return cancellationNotification(params, sentID)
+}
+
+// cancellationNotification returns the cancellation with the params of a received one, for the request of the ID.
+func cancellationNotification(params map[string]json.RawMessage, id mcp.ID) (*mcp.Notification, error) {
+	var err error
+	params["requestId"], err = json.Marshal(id)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mcp.Notification{Method: mcp.MethodNotifyCancelled, Params: mcp.Params(raw)}, nil
+}
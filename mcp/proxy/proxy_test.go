@@ -0,0 +1,306 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/OkutaniDaichi0106/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newBackend returns a backend server with an echo tool, a delete_repo tool,
+// a confirm tool asking the user through elicitation, and a wait tool which returns once cancelled.
+func newBackend(t *testing.T, cancelled chan<- struct{}) *mcp.Server {
+	t.Helper()
+
+	mux := mcp.NewServerMux()
+	mux.HandleTool(&mcp.ToolDefinition{Name: "echo"}, mcp.ToolHandlerFunc(func(w mcp.ContentsWriter, name string, args map[string]any) {
+		w.WriteContents([]mcp.Content{mcp.TextContent{Text: args["message"].(string)}})
+	}))
+	mux.HandleTool(&mcp.ToolDefinition{Name: "delete_repo"}, mcp.ToolHandlerFunc(func(w mcp.ContentsWriter, name string, args map[string]any) {
+		w.WriteContents([]mcp.Content{mcp.TextContent{Text: "deleted"}})
+	}))
+	mux.HandleTool(&mcp.ToolDefinition{Name: "confirm"}, mcp.ToolHandlerFunc(func(w mcp.ContentsWriter, name string, args map[string]any) {
+		sess, _ := mcp.ServerSessionFromContext(w.Context())
+		result, err := sess.Elicit(w.Context(), "Continue?", nil)
+		if err != nil {
+			w.CloseWithError(mcp.ErrInternalError.Code, err.Error())
+			return
+		}
+		w.WriteContents([]mcp.Content{mcp.TextContent{Text: string(result.Action)}})
+	}))
+	mux.HandleTool(&mcp.ToolDefinition{Name: "wait"}, mcp.ToolHandlerFunc(func(w mcp.ContentsWriter, name string, args map[string]any) {
+		<-w.Context().Done()
+		cancelled <- struct{}{}
+	}))
+
+	server := mcp.NewServer("backend", "0.0.1")
+	server.Handler = mux
+	t.Cleanup(func() { server.Close() })
+
+	return server
+}
+
+// newProxy returns a proxy to the backend over in-memory transports, which counts the backend connections it opens.
+func newProxy(backend *mcp.Server, dials *atomic.Int32) *Proxy {
+	return New(func(ctx context.Context) (mcp.Transport, error) {
+		dials.Add(1)
+
+		clientT, serverT := mcp.NewInMemoryTransports()
+		go backend.Accept(serverT)
+
+		return clientT, nil
+	})
+}
+
+// dialProxy connects a client to the proxy served over Streamable HTTP.
+func dialProxy(t *testing.T, p *Proxy, client *mcp.Client) mcp.ClientSession {
+	t.Helper()
+
+	server := mcp.NewServer("proxy", "0.0.1")
+	server.ServeTransport = p.ServeTransport
+	ts := httptest.NewServer(server.HTTPHandler())
+	t.Cleanup(ts.Close)
+
+	sess, err := client.DialHTTP(ts.URL, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { sess.Close() })
+
+	return sess
+}
+
+func TestProxy_Relay(t *testing.T) {
+	var dials atomic.Int32
+	p := newProxy(newBackend(t, nil), &dials)
+	sess := dialProxy(t, p, mcp.NewClient("test-client", "0.0.1"))
+
+	assert.Equal(t, "backend", sess.ServerInfo().Name, "the initialization should be answered by the backend")
+
+	result, err := sess.CallTool(context.Background(), &mcp.ToolDefinition{Name: "echo"}, map[string]any{"message": "hello"})
+	require.NoError(t, err)
+	assert.Equal(t, []mcp.Content{&mcp.TextContent{Text: "hello"}}, result.Content)
+
+	_, err = sess.CallTool(context.Background(), &mcp.ToolDefinition{Name: "unknown"}, nil)
+	assert.ErrorIs(t, err, mcp.ErrToolNotFound, "errors of the backend should be relayed")
+}
+
+func TestProxy_FilterTools(t *testing.T) {
+	tests := map[string]struct {
+		allow     []string
+		deny      []string
+		wantTools []string
+	}{
+		"no filter": {
+			wantTools: []string{"echo", "delete_repo", "confirm", "wait"},
+		},
+		"allow list": {
+			allow:     []string{"echo", "confirm"},
+			wantTools: []string{"echo", "confirm"},
+		},
+		"deny pattern": {
+			deny:      []string{"delete_*"},
+			wantTools: []string{"echo", "confirm", "wait"},
+		},
+		"deny overrides allow": {
+			allow:     []string{"*"},
+			deny:      []string{"wait", "delete_repo"},
+			wantTools: []string{"echo", "confirm"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var dials atomic.Int32
+			p := newProxy(newBackend(t, nil), &dials)
+			p.AllowTools = tc.allow
+			p.DenyTools = tc.deny
+			sess := dialProxy(t, p, mcp.NewClient("test-client", "0.0.1"))
+
+			result, err := sess.ListTools(context.Background())
+			require.NoError(t, err)
+			var names []string
+			for _, tool := range result.Tools {
+				names = append(names, tool.Name)
+			}
+			assert.Equal(t, tc.wantTools, names)
+
+			_, err = sess.CallTool(context.Background(), &mcp.ToolDefinition{Name: "delete_repo"}, nil)
+			if slices.Contains(tc.wantTools, "delete_repo") {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, mcp.ErrToolNotFound, "a hidden tool should not be callable")
+			}
+		})
+	}
+}
+
+func TestProxy_Elicitation(t *testing.T) {
+	var dials atomic.Int32
+	p := newProxy(newBackend(t, nil), &dials)
+
+	clientMux := mcp.NewClientMux()
+	clientMux.HandleElicitation(mcp.ElicitationHandlerFunc(func(w mcp.ElicitationWriter, req *mcp.ElicitationRequest) {
+		assert.Equal(t, "Continue?", req.Message)
+		w.Accept(nil)
+	}))
+	client := mcp.NewClient("test-client", "0.0.1")
+	client.Handler = clientMux
+	sess := dialProxy(t, p, client)
+
+	result, err := sess.CallTool(context.Background(), &mcp.ToolDefinition{Name: "confirm"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []mcp.Content{&mcp.TextContent{Text: "accept"}}, result.Content, "the request of the backend should be relayed to the client")
+}
+
+func TestProxy_Cancellation(t *testing.T) {
+	cancelled := make(chan struct{}, 1)
+	var dials atomic.Int32
+	p := newProxy(newBackend(t, cancelled), &dials)
+	sess := dialProxy(t, p, mcp.NewClient("test-client", "0.0.1"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := sess.CallTool(ctx, &mcp.ToolDefinition{Name: "wait"}, nil)
+	require.Error(t, err)
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("the cancellation should be relayed to the backend")
+	}
+}
+
+func TestProxy_SessionIsolation(t *testing.T) {
+	var dials atomic.Int32
+	p := newProxy(newBackend(t, nil), &dials)
+
+	first := dialProxy(t, p, mcp.NewClient("first", "0.0.1"))
+	second := dialProxy(t, p, mcp.NewClient("second", "0.0.1"))
+	assert.EqualValues(t, 2, dials.Load(), "each client session should have its own backend connection")
+
+	require.NoError(t, first.Close())
+
+	result, err := second.CallTool(context.Background(), &mcp.ToolDefinition{Name: "echo"}, map[string]any{"message": "still here"})
+	require.NoError(t, err)
+	assert.Equal(t, []mcp.Content{&mcp.TextContent{Text: "still here"}}, result.Content)
+}
+
+// pendingTransport is a transport whose requests are sent once release is closed, and never answered.
+type pendingTransport struct {
+	mcp.Transport
+
+	release  chan struct{}
+	sending  chan struct{}
+	notified chan *mcp.Notification
+}
+
+func (t *pendingTransport) Request(req *mcp.Request) (mcp.ResponseReader, error) {
+	close(t.sending)
+	<-t.release
+	return pendingResponse{}, nil
+}
+
+func (t *pendingTransport) Notify(notif *mcp.Notification) error {
+	t.notified <- notif
+	return nil
+}
+
+type pendingResponse struct{}
+
+func (pendingResponse) ID() mcp.ID { return `"sent-1"` }
+
+func (pendingResponse) ReadResult() (mcp.Result, error) {
+	return pendingResponse{}.ReadResultContext(context.Background())
+}
+
+func (pendingResponse) ReadResultContext(ctx context.Context) (mcp.Result, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// recordedWriter records the error answering a request.
+type recordedWriter struct {
+	errCode chan mcp.ErrorCode
+}
+
+func (w *recordedWriter) ID() mcp.ID { return `"received-1"` }
+
+func (w *recordedWriter) WriteResult(result mcp.Result) error {
+	return nil
+}
+
+func (w *recordedWriter) CloseWithError(code mcp.ErrorCode, msg string, data map[string]json.RawMessage) error {
+	w.errCode <- code
+	return nil
+}
+
+func TestProxy_CancellationBeforeSending(t *testing.T) {
+	backend := &pendingTransport{
+		release:  make(chan struct{}),
+		sending:  make(chan struct{}),
+		notified: make(chan *mcp.Notification, 1),
+	}
+	s := &session{proxy: New(nil), backend: newRelay(backend)}
+	w := &recordedWriter{errCode: make(chan mcp.ErrorCode, 1)}
+
+	go s.relayRequest(context.Background(), nil, s.backend, &mcp.Request{Method: mcp.MethodListTools}, w)
+
+	// The request is cancelled while it is being sent
+	<-backend.sending
+	notif, err := s.backend.cancel(&mcp.Notification{
+		Method: mcp.MethodNotifyCancelled,
+		Params: mcp.Params(`{"requestId": "received-1", "reason": "user"}`),
+	})
+	require.NoError(t, err)
+	assert.Nil(t, notif, "the cancellation should wait for the ID of the request")
+	close(backend.release)
+
+	select {
+	case notif := <-backend.notified:
+		assert.Equal(t, mcp.MethodNotifyCancelled, notif.Method)
+		assert.JSONEq(t, `{"requestId": "sent-1", "reason": "user"}`, string(notif.Params))
+	case <-time.After(time.Second):
+		t.Fatal("the cancellation should be relayed once the request is sent")
+	}
+
+	select {
+	case code := <-w.errCode:
+		assert.Equal(t, mcp.ErrRequestCancelled.Code, code)
+	case <-time.After(time.Second):
+		t.Fatal("the cancelled request should be answered")
+	}
+}
+
+func TestProxy_InvalidToolCall(t *testing.T) {
+	backend := &pendingTransport{release: make(chan struct{}), sending: make(chan struct{})}
+	close(backend.release)
+	p := New(nil)
+	p.DenyTools = []string{"delete_*"}
+	s := &session{proxy: p, backend: newRelay(backend)}
+	w := &recordedWriter{errCode: make(chan mcp.ErrorCode, 1)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// A call whose tool cannot be checked against the filter is not relayed
+	err := s.relayRequest(ctx, nil, s.backend, &mcp.Request{
+		Method: mcp.MethodCallTool,
+		Params: mcp.Params(`{"name": ["delete_repo"]}`),
+	}, w)
+	require.NoError(t, err)
+	assert.Equal(t, mcp.ErrInvalidParams.Code, <-w.errCode)
+
+	select {
+	case <-backend.sending:
+		t.Fatal("the call should not be relayed")
+	default:
+	}
+}
@@ -0,0 +1,240 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+)
+
+// BackpressurePolicy decides what a bounded queue does when a message arrives while it is full.
+type BackpressurePolicy int
+
+const (
+	// BackpressureBlock makes the reader wait until the queue has room,
+	// which stops reading from the peer in the meantime.
+	//
+	// On stream and WebSocket transports, the responses to the requests sent to the peer are read by the same reader,
+	// so they are not delivered either while it waits. A handler waiting for such a response, for example in Elicit
+	// or ListRoots, deadlocks if the queue stays full because no other request is accepted meanwhile,
+	// as when the concurrency limits of the server are reached. Use another policy in that case,
+	// or a capacity large enough that requests are accepted while handlers wait.
+	BackpressureBlock BackpressurePolicy = iota
+	// BackpressureDropOldest discards the oldest queued message to make room.
+	// A dropped request is answered with ErrQueueFull.
+	BackpressureDropOldest
+	// BackpressureReject discards the incoming message.
+	// A rejected request is answered with ErrQueueFull.
+	BackpressureReject
+)
+
+// QueueConfig configures the queues holding messages received by a transport
+// until they are accepted.
+type QueueConfig struct {
+	// Maximum number of messages waiting to be accepted. Zero means unbounded.
+	Capacity int
+	// Policy applied when the queue is full. It is ignored for unbounded queues.
+	// BackpressureBlock may deadlock handlers waiting for responses of the peer, as it documents.
+	Policy BackpressurePolicy
+}
+
+// QueueStats is a snapshot of the metrics of a receive queue.
+type QueueStats struct {
+	// Number of messages waiting to be accepted
+	Depth int
+	// Highest depth observed
+	MaxDepth int
+
+	Pushed   uint64
+	Dropped  uint64
+	Rejected uint64
+}
+
+// TransportStats holds the metrics of the receive queues of a transport.
+type TransportStats struct {
+	Requests      QueueStats
+	Notifications QueueStats
+}
+
+// StatsReporter is implemented by transports which expose metrics of their receive queues.
+// All transports in this package implement it.
+type StatsReporter interface {
+	Stats() TransportStats
+}
+
+var errQueueClosed = errors.New("queue is closed")
+
+// newQueue creates a queue safe for concurrent use.
+// onDiscard, if not nil, is called for every message dropped or rejected by the backpressure policy.
+func newQueue[T any](config QueueConfig, onDiscard func(T)) *queue[T] {
+	return &queue[T]{
+		config:    config,
+		onDiscard: onDiscard,
+		items:     make([]T, 0),
+		available: make(chan struct{}, 1),
+		space:     make(chan struct{}, 1),
+		closed:    make(chan struct{}),
+	}
+}
+
+type queue[T any] struct {
+	config    QueueConfig
+	onDiscard func(T)
+
+	mu    sync.Mutex
+	items []T
+	stats QueueStats
+
+	// available and space are signaled when an item is pushed and popped respectively
+	available chan struct{}
+	space     chan struct{}
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// Push adds the item to the queue without blocking, unless the queue is full and the policy is BackpressureBlock.
+// It returns ErrQueueFull if the item is rejected.
+func (q *queue[T]) Push(ctx context.Context, item T) error {
+	for {
+		q.mu.Lock()
+
+		select {
+		case <-q.closed:
+			q.mu.Unlock()
+			return errQueueClosed
+		default:
+		}
+
+		if q.config.Capacity <= 0 || len(q.items) < q.config.Capacity {
+			q.pushLocked(item)
+			q.mu.Unlock()
+			return nil
+		}
+
+		switch q.config.Policy {
+		case BackpressureDropOldest:
+			oldest := q.items[0]
+			q.items = q.items[1:]
+			q.stats.Dropped++
+			q.pushLocked(item)
+			q.mu.Unlock()
+
+			if q.onDiscard != nil {
+				q.onDiscard(oldest)
+			}
+			return nil
+		case BackpressureReject:
+			q.stats.Rejected++
+			q.mu.Unlock()
+
+			if q.onDiscard != nil {
+				q.onDiscard(item)
+			}
+			return ErrQueueFull
+		}
+
+		q.mu.Unlock()
+
+		// Wait for room
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-q.closed:
+			return errQueueClosed
+		case <-q.space:
+		}
+	}
+}
+
+func (q *queue[T]) pushLocked(item T) {
+	q.items = append(q.items, item)
+	q.stats.Pushed++
+	if len(q.items) > q.stats.MaxDepth {
+		q.stats.MaxDepth = len(q.items)
+	}
+
+	notifyWaiter(q.available)
+}
+
+// Pop removes the oldest item, waiting until one is available.
+// Items pushed before the queue was closed are still returned,
+// after which it returns errQueueClosed.
+func (q *queue[T]) Pop(ctx context.Context) (T, error) {
+	for {
+		q.mu.Lock()
+		if len(q.items) > 0 {
+			item := q.items[0]
+			var zero T
+			q.items[0] = zero
+			q.items = q.items[1:]
+
+			// Let other consumers and blocked producers proceed
+			if len(q.items) > 0 {
+				notifyWaiter(q.available)
+			}
+			notifyWaiter(q.space)
+
+			q.mu.Unlock()
+			return item, nil
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		case <-q.available:
+		case <-q.closed:
+			// Check the items once more, as they may have been pushed just before closing
+			q.mu.Lock()
+			empty := len(q.items) == 0
+			q.mu.Unlock()
+			if empty {
+				var zero T
+				return zero, errQueueClosed
+			}
+		}
+	}
+}
+
+// Close releases waiting producers and consumers.
+// Items already in the queue can still be popped.
+func (q *queue[T]) Close() {
+	q.closeOnce.Do(func() {
+		close(q.closed)
+	})
+}
+
+func (q *queue[T]) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.items)
+}
+
+func (q *queue[T]) Stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stats := q.stats
+	stats.Depth = len(q.items)
+	return stats
+}
+
+// notifyWaiter notifies a waiter through a channel with a buffer of one, without blocking.
+func notifyWaiter(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// answerDiscardedRequest answers a request discarded by the backpressure policy,
+// so that the peer does not wait for it forever.
+func answerDiscardedRequest(r receivedRequest) {
+	err := r.w.CloseWithError(ErrQueueFull.Code, ErrQueueFull.Message, nil)
+	if err != nil {
+		slog.Error("failed to answer discarded request", "id", r.w.ID(), "error", err)
+	}
+}
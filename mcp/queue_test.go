@@ -0,0 +1,106 @@
+package mcp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueue_Push(t *testing.T) {
+	tests := map[string]struct {
+		config        QueueConfig
+		push          []int
+		wantErrs      []error
+		wantPopped    []int
+		wantDiscarded []int
+		wantStats     QueueStats
+	}{
+		"unbounded queue never blocks": {
+			config:     QueueConfig{},
+			push:       []int{1, 2, 3},
+			wantErrs:   []error{nil, nil, nil},
+			wantPopped: []int{1, 2, 3},
+			wantStats:  QueueStats{MaxDepth: 3, Pushed: 3},
+		},
+		"drop oldest makes room for new items": {
+			config:        QueueConfig{Capacity: 2, Policy: BackpressureDropOldest},
+			push:          []int{1, 2, 3},
+			wantErrs:      []error{nil, nil, nil},
+			wantPopped:    []int{2, 3},
+			wantDiscarded: []int{1},
+			wantStats:     QueueStats{MaxDepth: 2, Pushed: 3, Dropped: 1},
+		},
+		"reject discards new items": {
+			config:        QueueConfig{Capacity: 2, Policy: BackpressureReject},
+			push:          []int{1, 2, 3},
+			wantErrs:      []error{nil, nil, ErrQueueFull},
+			wantPopped:    []int{1, 2},
+			wantDiscarded: []int{3},
+			wantStats:     QueueStats{MaxDepth: 2, Pushed: 2, Rejected: 1},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var discarded []int
+			q := newQueue(tc.config, func(item int) {
+				discarded = append(discarded, item)
+			})
+
+			for i, item := range tc.push {
+				err := q.Push(context.Background(), item)
+				assert.ErrorIs(t, err, tc.wantErrs[i], "Push of %d should return expected error", item)
+			}
+
+			q.Close()
+
+			var popped []int
+			for {
+				item, err := q.Pop(context.Background())
+				if err != nil {
+					assert.ErrorIs(t, err, errQueueClosed, "Pop should end with closed queue")
+					break
+				}
+				popped = append(popped, item)
+			}
+
+			assert.Equal(t, tc.wantPopped, popped, "popped items should match expected")
+			assert.Equal(t, tc.wantDiscarded, discarded, "discarded items should match expected")
+			assert.Equal(t, tc.wantStats, q.Stats(), "stats should match expected")
+		})
+	}
+}
+
+func TestQueue_Push_Block(t *testing.T) {
+	q := newQueue[int](QueueConfig{Capacity: 1, Policy: BackpressureBlock}, nil)
+	require.NoError(t, q.Push(context.Background(), 1))
+
+	pushed := make(chan error, 1)
+	go func() {
+		pushed <- q.Push(context.Background(), 2)
+	}()
+
+	select {
+	case <-pushed:
+		t.Fatal("Push should block while the queue is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	item, err := q.Pop(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, item, "first item should be popped")
+
+	select {
+	case err := <-pushed:
+		assert.NoError(t, err, "blocked Push should succeed once there is room")
+	case <-time.After(time.Second):
+		t.Fatal("Push was not released")
+	}
+
+	assert.Equal(t, 1, q.Len(), "queue should hold the second item")
+}
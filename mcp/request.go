@@ -1,6 +1,124 @@
 package mcp
 
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+)
+
 type Request struct {
 	Method Method
 	Params Params
+
+	// authInfo is the principal authenticated by the HTTP request which carried a received request
+	authInfo *AuthInfo
+
+	// sending, if set, is called with the ID of a sent request right before it is sent
+	sending func(id ID)
+}
+
+// beforeSend is called by transports with the ID of the request right before sending it.
+func (r *Request) beforeSend(id ID) {
+	if r.sending != nil {
+		r.sending(id)
+	}
+}
+
+// receivedRequest is a request waiting in the receive queue of a transport with the writer answering it.
+type receivedRequest struct {
+	req *Request
+	w   ResponseWriter
+}
+
+// sendRequest sends the request on the transport and waits for its result.
+// If ctx has no deadline and timeout is positive, the timeout is applied.
+// When ctx is done before the response arrives, the peer is notified of the cancellation,
+// and a *TimeoutError is returned if the deadline was exceeded.
+func sendRequest(ctx context.Context, t Transport, req *Request, timeout time.Duration) (Result, error) {
+	ctx, after, cancel := withDefaultTimeout(ctx, timeout)
+	defer cancel()
+
+	rsp, err := t.Request(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return readResponse(ctx, t, req, rsp, after)
+}
+
+// sendBatch sends the requests in a single batch and waits for all of their results,
+// with the same timeout and cancellation rules as sendRequest.
+// The results are returned in the same order as the requests.
+func sendBatch(ctx context.Context, t Transport, reqs []*Request, timeout time.Duration) ([]BatchResult, error) {
+	if len(reqs) == 0 {
+		return nil, errors.New("empty batch")
+	}
+
+	ctx, after, cancel := withDefaultTimeout(ctx, timeout)
+	defer cancel()
+
+	rsps, err := t.RequestBatch(reqs)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]BatchResult, len(reqs))
+	for i, rsp := range rsps {
+		results[i].Result, results[i].Err = readResponse(ctx, t, reqs[i], rsp, after)
+	}
+
+	return results, nil
+}
+
+func withDefaultTimeout(ctx context.Context, timeout time.Duration) (context.Context, time.Duration, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || timeout <= 0 {
+		return ctx, 0, func() {}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, timeout, cancel
+}
+
+func readResponse(ctx context.Context, t Transport, req *Request, rsp ResponseReader, after time.Duration) (Result, error) {
+	result, err := rsp.ReadResultContext(ctx)
+	if err == nil {
+		return result, nil
+	}
+
+	ctxErr := ctx.Err()
+	if ctxErr == nil {
+		return nil, err
+	}
+
+	notifyErr := notifyCancelled(t, rsp.ID(), ctxErr.Error())
+	if notifyErr != nil {
+		slog.Error("failed to notify cancellation", "id", rsp.ID(), "error", notifyErr)
+	}
+
+	if errors.Is(ctxErr, context.DeadlineExceeded) {
+		return nil, &TimeoutError{
+			Method: req.Method,
+			ID:     rsp.ID(),
+			After:  after,
+		}
+	}
+
+	return nil, ctxErr
+}
+
+func notifyCancelled(t Transport, id ID, reason string) error {
+	params, err := json.Marshal(map[string]any{
+		"requestId": id,
+		"reason":    reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	return t.Notify(&Notification{
+		Method: MethodNotifyCancelled,
+		Params: Params(params),
+	})
 }
@@ -1,10 +1,12 @@
 package mcp
 
+import "encoding/json"
+
 type ResourceDefinition struct {
 	URI         string `json:"uri"`
-	MimeType    string `json:"mimeType"`
+	MimeType    string `json:"mimeType,omitempty"`
 	Name        string `json:"name"`
-	Description string `json:"description"`
+	Description string `json:"description,omitempty"`
 }
 
 func (rd *ResourceDefinition) Clone() *ResourceDefinition {
@@ -16,10 +18,40 @@ func (rd *ResourceDefinition) Clone() *ResourceDefinition {
 	}
 }
 
+// ListResourcesResult is the result of the listing of the resources of a server.
+type ListResourcesResult struct {
+	Resources  []*ResourceDefinition `json:"resources"`
+	NextCursor string                `json:"nextCursor,omitempty"`
+	Meta       map[string]any        `json:"_meta,omitempty"`
+}
+
+// ReadResourceResult holds the contents of a resource read from a server.
+type ReadResourceResult struct {
+	Contents []*Resource    `json:"contents"`
+	Meta     map[string]any `json:"_meta,omitempty"`
+}
+
+// Resource holds the contents of a resource, either as text or as binary data.
 type Resource struct {
 	URI      string `json:"uri"`
-	MimeType string `json:"mimeType"`
-	Data     []byte `json:"data"`
+	MimeType string `json:"mimeType,omitempty"`
+	// Text of a text resource
+	Text string `json:"text"`
+	// Data of a binary resource, encoded in base64 in JSON. If it is not nil, Text is ignored.
+	Blob []byte `json:"blob,omitempty"`
+}
+
+func (r Resource) MarshalJSON() ([]byte, error) {
+	if r.Blob != nil {
+		return json.Marshal(struct {
+			URI      string `json:"uri"`
+			MimeType string `json:"mimeType,omitempty"`
+			Blob     []byte `json:"blob"`
+		}{r.URI, r.MimeType, r.Blob})
+	}
+
+	type resource Resource
+	return json.Marshal(resource(r))
 }
 
 var ResourceNotFoundHandler ResourceHandlerFunc = func(w ContentsWriter, name string, args map[string]any) {
@@ -32,7 +32,7 @@ func (m *resourceMux) registerResourceHandler(resource *ResourceDefinition, hand
 
 	var index int
 
-	if mapping, ok := m.resources[resource.Name]; ok {
+	if mapping, ok := m.resources[resource.URI]; ok {
 		index = mapping.index
 		m.list[mapping.index] = resource
 	} else {
@@ -40,7 +40,7 @@ func (m *resourceMux) registerResourceHandler(resource *ResourceDefinition, hand
 		m.list = append(m.list, resource)
 	}
 
-	m.resources[resource.Name] = struct {
+	m.resources[resource.URI] = struct {
 		handler ResourceHandler
 		index   int
 	}{
@@ -1,5 +1,7 @@
 package mcp
 
+import "context"
+
 // type Responce interface {
 // 	ID() string
 // 	Result() any
@@ -8,8 +10,13 @@ package mcp
 // }
 
 type response struct {
+	id     ID
 	result Result
-	err    *Error
+	err    error
+}
+
+func (r *response) ID() ID {
+	return r.id
 }
 
 func (r *response) ReadResult() (Result, error) {
@@ -20,17 +27,36 @@ func (r *response) ReadResult() (Result, error) {
 	return r.result, nil
 }
 
+func (r *response) ReadResultContext(ctx context.Context) (Result, error) {
+	return r.ReadResult()
+}
+
 type asyncResponseReader struct {
+	id ID
 	ch chan *response
 }
 
+func (r *asyncResponseReader) ID() ID {
+	return r.id
+}
+
 func (r *asyncResponseReader) ReadResult() (Result, error) {
-	rsp := <-r.ch
-	close(r.ch)
+	return r.ReadResultContext(context.Background())
+}
 
-	if rsp.err != nil {
-		return nil, rsp.err
-	}
+func (r *asyncResponseReader) ReadResultContext(ctx context.Context) (Result, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case rsp, ok := <-r.ch:
+		if !ok {
+			return nil, ErrJSONRPCInternalError
+		}
 
-	return rsp.result, nil
+		if rsp.err != nil {
+			return nil, rsp.err
+		}
+
+		return rsp.result, nil
+	}
 }
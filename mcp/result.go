@@ -3,3 +3,10 @@ package mcp
 import "encoding/json"
 
 type Result json.RawMessage
+
+func (r Result) MarshalJSON() ([]byte, error) {
+	if len(r) == 0 {
+		return []byte("{}"), nil
+	}
+	return json.RawMessage(r).MarshalJSON()
+}
@@ -0,0 +1,90 @@
+package mcp
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// newSemaphore creates a semaphore allowing at most n concurrent holders.
+// Waiters are served in FIFO order. If n is not positive, it returns nil,
+// which is a valid semaphore that never blocks.
+func newSemaphore(n int) *semaphore {
+	if n <= 0 {
+		return nil
+	}
+
+	return &semaphore{
+		size:    n,
+		waiters: list.New(),
+	}
+}
+
+type semaphore struct {
+	mu      sync.Mutex
+	size    int
+	cur     int
+	waiters *list.List // of chan struct{}
+}
+
+func (s *semaphore) Acquire(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	if s.cur < s.size && s.waiters.Len() == 0 {
+		s.cur++
+		s.mu.Unlock()
+		return nil
+	}
+
+	ready := make(chan struct{})
+	elem := s.waiters.PushBack(ready)
+	s.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		select {
+		case <-ready:
+			// Acquired just after the context was canceled, so give it back
+			s.cur--
+			s.notifyWaiters()
+		default:
+			s.waiters.Remove(elem)
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (s *semaphore) Release() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cur--
+	if s.cur < 0 {
+		panic("semaphore released more than acquired")
+	}
+	s.notifyWaiters()
+}
+
+func (s *semaphore) notifyWaiters() {
+	for s.cur < s.size {
+		front := s.waiters.Front()
+		if front == nil {
+			return
+		}
+
+		s.cur++
+		s.waiters.Remove(front)
+		close(front.Value.(chan struct{}))
+	}
+}
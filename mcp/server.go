@@ -6,17 +6,26 @@ import (
 	"errors"
 	"io"
 	"log/slog"
+	"maps"
 	"net/http"
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Server struct {
-	Name                 string
-	Version              string
+	Name    string
+	Version string
+	// Title is a human-readable name of the server, for display. It is optional.
+	Title                string
 	AdditionalServerInfo map[string]any
 
+	// Instructions describe how to use the server and its features.
+	// They are sent to the client in the initialization, which may add them to the system prompt of the model.
+	Instructions string
+
 	// Capabilities related to resources
 	ResourceSubscription         bool
 	ResourcesChangedNotification bool
@@ -26,24 +35,59 @@ type Server struct {
 	ToolsChangedNotification bool
 	// Capabilities related to roots
 	RootsChangedNotification bool
+	// AdditionalServerCapabilities are merged with the capabilities derived from the handler
+	AdditionalServerCapabilities *ServerCapabilities
 	// Additional capabilities
+	//
+	// Deprecated: Use AdditionalServerCapabilities.
 	AdditionalCapabilities Capabilities
 
 	Options map[string]any
 
 	Handler ServerHandler
 
-	// http.Server
+	// MaxConcurrentRequests limits the number of requests handled at the same time
+	// across all sessions of the server. Zero means no limit.
+	MaxConcurrentRequests int
+	// MaxConcurrentSessionRequests limits the number of requests handled at the same time
+	// within a single session. Zero means no limit.
+	MaxConcurrentSessionRequests int
+
+	// Configuration of the handler returned by HTTPHandler
+	HTTPConfig *HTTPServerConfig
+	// Configuration of the handler returned by WebSocketHandler
+	WebSocketConfig *WebSocketConfig
+
+	// WrapTransport, if not nil, wraps the transport of every session before it is initialized,
+	// including the sessions accepted by the HTTP and WebSocket handlers.
+	// For example, NewRecordingTransport records the traffic of the sessions.
+	WrapTransport func(t Transport) Transport
+
+	// ServeTransport, if not nil, serves every session in place of the server, including the sessions
+	// accepted by the HTTP and WebSocket handlers, for example to relay them to another server.
+	// It is called with the transport of a new session and returns once the initialize request is answered,
+	// while the session goes on in the background. The handler and the capabilities of the server are not used then.
+	ServeTransport func(t Transport) error
+
 	Logger *slog.Logger
 
 	initOnce    sync.Once
 	initialized bool
 
+	requestSemOnce sync.Once
+	requestSem     *semaphore
+
 	cancelFuncs     []context.CancelFunc
 	cancelFuncsLock sync.Mutex
 
-	// cancelFunc context.CancelFunc
-	sessions map[string]*serverSession
+	httpHandlerOnce sync.Once
+	httpHandler     *httpHandler
+	sseHandlerOnce  sync.Once
+	sseHandler      *httpHandler
+
+	// Sessions served over HTTP, keyed by session ID
+	sessions     map[string]*serverSession
+	sessionsLock sync.Mutex
 }
 
 func NewServer(name, version string) *Server {
@@ -95,91 +139,58 @@ func (s *Server) AcceptStream(w io.WriteCloser, r io.ReadCloser) (ServerSession,
 	return s.Accept(t)
 }
 
+// AcceptHTTP serves a single HTTP request with the handler returned by HTTPHandler,
+// and returns the session the request belongs to.
+//
+// Deprecated: Use HTTPHandler, which manages the sessions across requests.
 func (s *Server) AcceptHTTP(w http.ResponseWriter, r *http.Request) (ServerSession, error) {
-	if !s.initialized {
-		s.init()
-	}
+	s.HTTPHandler().ServeHTTP(w, r)
 
-	if r.Method == http.MethodPost {
-		body := r.Body
+	// A new session ID is only found in the response
+	sessionID := w.Header().Get(SessionIDHeader)
+	if sessionID == "" {
+		sessionID = r.Header.Get(SessionIDHeader)
+	}
 
-		w.Header().Set("Content-Type", "application/json")
-		sessionID := r.Header.Get("mcp-session-id")
+	s.sessionsLock.Lock()
+	session, ok := s.sessions[sessionID]
+	s.sessionsLock.Unlock()
+	if !ok {
+		return nil, errors.New("session not found")
+	}
 
-		if sessionID == "" {
-			// Handle just requests
-			transport := newServerHTTPTransport()
-			go s.handleRequests(context.Background(), transport)
+	return session, nil
+}
 
-			return nil, errors.New("session not found")
-		}
+func (s *Server) addSession(session *serverSession) {
+	s.sessionsLock.Lock()
+	defer s.sessionsLock.Unlock()
 
-		// Get the existing session
-		session, ok := s.sessions[sessionID]
-		if ok {
-			// Get the existing transport
-			transport, ok := session.transport.(*httpServerTransport)
-			if !ok {
-				return nil, errors.New("session is not HTTP session")
-			}
+	s.sessions[session.sessionID] = session
+}
 
-			// Read the messages
-			go transport.readMessages(w, body)
+func (s *Server) removeSession(sessionID string) {
+	s.sessionsLock.Lock()
+	defer s.sessionsLock.Unlock()
 
-			return session, nil
-		}
+	delete(s.sessions, sessionID)
+}
 
-		// Create a new session
-		transport := newServerHTTPTransport()
-		go transport.readMessages(w, body)
+// accept initializes a session on the transport. The session is a *serverSession,
+// unless it is served by ServeTransport.
+func (s *Server) accept(t Transport) (ServerSession, error) {
+	if s.WrapTransport != nil {
+		t = s.WrapTransport(t)
+	}
 
-		session, err := s.accept(transport)
+	if s.ServeTransport != nil {
+		err := s.ServeTransport(t)
 		if err != nil {
 			return nil, err
 		}
-
-		// Set the session ID
-		session.sessionID = sessionID
-
-		// Store the session
-		s.sessions[sessionID] = session
-
-		return session, nil
-	} else if r.Method == http.MethodGet {
-		sessionID := r.Header.Get("mcp-session-id")
-
-		session, ok := s.sessions[sessionID]
-		if !ok {
-			return nil, errors.New("session not found")
-		}
-
-		httpTransport, ok := session.transport.(*httpServerTransport)
-		if !ok {
-			return nil, errors.New("session is not HTTP session")
-		}
-
-		w.Header().Set("Content-Type", "text/event-stream")
-		w.Header().Set("Cache-Control", "no-cache")
-		w.Header().Set("Connection", "keep-alive")
-
-		flusher, ok := w.(http.Flusher)
-		if !ok {
-			s.Logger.Error("failed to get flusher")
-			return nil, errors.New("failed to get flusher")
-		}
-
-		// Set the SSE writer and flusher
-		httpTransport.sseWriter = w
-		httpTransport.sseFlusher = flusher
-
-		return session, nil
-	} else {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		return nil, errors.New("method not allowed")
+		return &relayedSession{transport: t}, nil
 	}
-}
 
-func (s *Server) accept(t Transport) (*serverSession, error) {
 	ctx := context.Background()
 	ctx, cancelFunc := context.WithCancel(ctx)
 	s.cancelFuncsLock.Lock()
@@ -192,31 +203,52 @@ func (s *Server) accept(t Transport) (*serverSession, error) {
 		return nil, err
 	}
 
+	// The request is answered with an error if the initialization fails,
+	// so that the client does not wait for it
 	if req.Method != MethodInit {
+		w.CloseWithError(ErrInvalidRequest.Code, ErrInvalidRequest.Message, nil)
 		return nil, errors.New("first request must be init")
 	}
 
 	var params map[string]json.RawMessage
 	err = json.Unmarshal(req.Params, &params)
 	if err != nil {
+		w.CloseWithError(ErrInvalidParams.Code, ErrInvalidParams.Message, nil)
+		return nil, err
+	}
+
+	var version Version
+	err = json.Unmarshal(params["protocolVersion"], &version)
+	if err != nil {
+		w.CloseWithError(ErrInvalidParams.Code, ErrInvalidParams.Message, nil)
 		return nil, err
 	}
 
-	if Version(params["protocolVersion"]) != DefaultVersion {
-		return nil, errors.New("protocol version mismatch")
+	// The requested version is used if supported. Otherwise the preferred version is proposed,
+	// and the client decides whether to continue
+	if !isSupportedVersion(version) {
+		version = DefaultVersion
 	}
 
-	var capabilities Capabilities
+	var capabilities ClientCapabilities
 	err = json.Unmarshal(params["capabilities"], &capabilities)
 	if err != nil {
+		w.CloseWithError(ErrInvalidParams.Code, ErrInvalidParams.Message, nil)
 		return nil, err
 	}
 
 	// Write result
-	result := s.Options
-	result["protocolVersion"] = DefaultVersion
-	result["capabilities"] = s.capabilities()
+	result := make(map[string]any, len(s.Options)+4)
+	for k, v := range s.Options {
+		result[k] = v
+	}
+	result["protocolVersion"] = version
+	serverCapabilities := s.capabilities()
+	result["capabilities"] = serverCapabilities
 	result["serverInfo"] = s.info()
+	if s.Instructions != "" {
+		result["instructions"] = s.Instructions
+	}
 
 	resultJson, err := json.Marshal(result)
 	if err != nil {
@@ -230,11 +262,14 @@ func (s *Server) accept(t Transport) (*serverSession, error) {
 
 	session := &serverSession{
 		transport:          t,
-		clientCapabilities: capabilities,
+		clientCapabilities: &capabilities,
+		serverCapabilities: serverCapabilities,
+		requestSem:         newSemaphore(s.MaxConcurrentSessionRequests),
 	}
 
-	// Listen requests and handle them
-	go s.handleRequests(ctx, t)
+	// Listen requests and notifications and handle them
+	go s.handleRequests(ctx, session)
+	go s.handleNotifications(ctx, session)
 
 	return session, nil
 }
@@ -254,128 +289,474 @@ func (s *Server) Close() error {
 	for _, cancel := range s.cancelFuncs {
 		cancel()
 	}
+
+	if s.httpHandler != nil {
+		s.httpHandler.closeAll()
+	}
+	if s.sseHandler != nil {
+		s.sseHandler.closeAll()
+	}
 	return nil
 }
 
-func (s *Server) capabilities() Capabilities {
+func (s *Server) capabilities() *ServerCapabilities {
 	// Capabilities
-	capabilities := s.AdditionalCapabilities
-	if capabilities == nil {
-		capabilities = make(Capabilities)
-	}
-
-	capabilities.Merge(map[string]map[string]bool{
-		"tools": {
-			"listChanged": s.ToolsChangedNotification,
-		},
-		"resources": {
-			"listChanged": s.ResourcesChangedNotification,
-			"subscribe":   s.ResourceSubscription,
-		},
-		"prompts": {
-			"listChanged": s.PromptsChangedNotification,
-		},
-	})
-	return capabilities
+	capabilities := s.AdditionalServerCapabilities.Clone()
+	capabilities.Merge(s.AdditionalCapabilities.ServerCapabilities())
+
+	// The features are advertised when the handler serves them, or when their changes are notified
+	served := &ServerCapabilities{
+		Tools:     &ToolsCapability{},
+		Resources: &ResourcesCapability{},
+		Prompts:   &PromptsCapability{},
+	}
+	switch h := s.handler().(type) {
+	case interface{ Capabilities() *ServerCapabilities }:
+		served = h.Capabilities()
+	case interface{ Capabilities() Capabilities }:
+		// Handlers written for the deprecated map of capabilities
+		served = h.Capabilities().ServerCapabilities()
+	}
+
+	// Logging is not advertised, as log messages are not sent to clients
+	features := &ServerCapabilities{}
+	if served.HasFeature("tools") || s.ToolsChangedNotification {
+		features.Tools = &ToolsCapability{
+			ListChanged: s.ToolsChangedNotification,
+		}
+	}
+	if served.HasFeature("resources") || s.ResourcesChangedNotification || s.ResourceSubscription {
+		features.Resources = &ResourcesCapability{
+			ListChanged: s.ResourcesChangedNotification,
+			Subscribe:   s.ResourceSubscription,
+		}
+	}
+	if served.HasFeature("prompts") || s.PromptsChangedNotification {
+		features.Prompts = &PromptsCapability{
+			ListChanged: s.PromptsChangedNotification,
+		}
+	}
+
+	return capabilities.Merge(features)
 }
 
 func (s *Server) info() map[string]any {
-	info := s.AdditionalServerInfo
+	// The map of the server is copied, as sessions are initialized concurrently
+	info := maps.Clone(s.AdditionalServerInfo)
 	if info == nil {
 		info = make(map[string]any)
 	}
 
 	info["name"] = s.Name
 	info["version"] = s.Version
+	if s.Title != "" {
+		info["title"] = s.Title
+	}
 
 	return info
 }
 
-func (s *Server) handleRequests(ctx context.Context, t Transport) {
+func (s *Server) logger() *slog.Logger {
+	if s.Logger == nil {
+		return slog.Default()
+	}
+	return s.Logger
+}
+
+func (s *Server) handler() ServerHandler {
+	if s.Handler == nil {
+		return DefaultServerMux
+	}
+	return s.Handler
+}
+
+func (s *Server) serverRequestSemaphore() *semaphore {
+	s.requestSemOnce.Do(func() {
+		s.requestSem = newSemaphore(s.MaxConcurrentRequests)
+	})
+	return s.requestSem
+}
+
+// handleRequests accepts requests on the session and dispatches each of them to its own goroutine.
+// Requests acquire a session slot and then a server slot in the order they were received,
+// so a busy session cannot overtake requests which arrived earlier.
+// Responses are written as soon as each handler finishes, and are correlated by the request ID.
+func (s *Server) handleRequests(ctx context.Context, sess *serverSession) {
+	serverSem := s.serverRequestSemaphore()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
 	for {
-		req, w, err := t.AcceptRequest(ctx)
+		req, w, err := sess.transport.AcceptRequest(ctx)
 		if err != nil {
 			return
 		}
 
-		switch req.Method {
-		case MethodListTools:
-			// List tools
-			listsJSON, err := json.Marshal(s.Handler.ListTools())
-			if err != nil {
-				slog.Error("failed to marshal tools", "error", err)
-				continue
-			}
-
-			result := Result(`{"tools": ` + string(listsJSON) + `}`)
+		reqCtx, cancel := context.WithCancelCause(withServerSession(ctx, sess))
+		if req.authInfo != nil {
+			reqCtx = withAuthInfo(reqCtx, req.authInfo)
+		}
+		sess.startRequest(w.ID(), cancel)
 
-			// Write result
-			err = w.WriteResult(result)
-			if err != nil {
-				continue
-			}
-		case MethodCallTool:
-			// Call tool
-			var params map[string]json.RawMessage
-			err := json.Unmarshal(req.Params, &params)
-			if err != nil {
-				s.Logger.Error("failed to unmarshal params", "error", err)
-				continue
+		// The client may cancel the request while it waits for its slots
+		err = sess.requestSem.Acquire(reqCtx)
+		if err != nil {
+			if !s.abandonRequest(ctx, sess, w, cancel) {
+				return
 			}
-			name := string(params["name"])
+			continue
+		}
 
-			var args map[string]any
-			err = json.Unmarshal(params["arguments"], &args)
-			if err != nil {
-				s.Logger.Error("failed to unmarshal params", "error", err)
-				continue
+		err = serverSem.Acquire(reqCtx)
+		if err != nil {
+			sess.requestSem.Release()
+			if !s.abandonRequest(ctx, sess, w, cancel) {
+				return
 			}
+			continue
+		}
 
-			s.Handler.ServeTool(newContentsWriter(w), name, args)
-		case MethodListResources:
-			// List resources
-			result := map[string]any{
-				"resources": s.Handler.ListResources(),
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer sess.requestSem.Release()
+			defer serverSem.Release()
+			defer sess.finishRequest(w.ID())
+			defer cancel(nil)
+
+			// Methods of capabilities which were not advertised are unknown to the client
+			if sess.serverCapabilities.checkMethod(req.Method) != nil {
+				w.CloseWithError(ErrMethodNotFound.Code, ErrMethodNotFound.Message, nil)
+				return
 			}
-			resultJson, err := json.Marshal(result)
-			if err != nil {
-				s.Logger.Error("failed to marshal resources", "error", err)
-				continue
+
+			aw := &answerResponseWriter{ResponseWriter: w}
+			s.serveRequest(reqCtx, sess, req, aw)
+
+			// Every request is answered, so that the batch or the HTTP request carrying it is not left pending
+			if !aw.answered() && errors.Is(context.Cause(reqCtx), errRequestCancelled) {
+				aw.CloseWithError(ErrRequestCancelled.Code, ErrRequestCancelled.Message, nil)
 			}
+		}()
+	}
+}
 
-			// Write result
-			err = w.WriteResult(resultJson)
-			if err != nil {
-				s.Logger.Error("failed to write result", "error", err)
-				continue
+// abandonRequest answers a request cancelled by the client before it could be served.
+// It reports false if the session is ending instead.
+func (s *Server) abandonRequest(ctx context.Context, sess *serverSession, w ResponseWriter, cancel context.CancelCauseFunc) bool {
+	sess.finishRequest(w.ID())
+	cancel(nil)
+
+	if ctx.Err() != nil {
+		return false
+	}
+
+	w.CloseWithError(ErrRequestCancelled.Code, ErrRequestCancelled.Message, nil)
+	return true
+}
+
+var _ ResponseWriter = (*answerResponseWriter)(nil)
+
+// answerResponseWriter records whether the request was answered by its handler.
+type answerResponseWriter struct {
+	ResponseWriter
+	done atomic.Bool
+}
+
+func (w *answerResponseWriter) WriteResult(result Result) error {
+	w.done.Store(true)
+	return w.ResponseWriter.WriteResult(result)
+}
+
+func (w *answerResponseWriter) CloseWithError(code ErrorCode, msg string, data map[string]json.RawMessage) error {
+	w.done.Store(true)
+	return w.ResponseWriter.CloseWithError(code, msg, data)
+}
+
+func (w *answerResponseWriter) answered() bool {
+	return w.done.Load()
+}
+
+func (s *Server) handleNotifications(ctx context.Context, sess *serverSession) {
+	for {
+		notif, err := sess.transport.AcceptNotification(ctx)
+		if err != nil {
+			return
+		}
+
+		switch notif.Method {
+		case MethodNotifyCancelled:
+			var params struct {
+				RequestID ID     `json:"requestId"`
+				Reason    string `json:"reason"`
 			}
-		case MethodReadResource:
-			// Read resource
-			var params map[string]json.RawMessage
-			err := json.Unmarshal(req.Params, &params)
+			err := json.Unmarshal(notif.Params, &params)
 			if err != nil {
-				s.Logger.Error("failed to unmarshal params", "error", err)
+				s.logger().Error("failed to unmarshal params", "error", err)
 				continue
 			}
 
-			if params["uri"] == nil {
-				s.Logger.Error("missing uri field")
-				continue
-			}
+			s.logger().Debug("request cancelled by client", "id", params.RequestID, "reason", params.Reason)
+			sess.cancelRequest(params.RequestID)
+		}
+	}
+}
 
-			s.Handler.ServeResource(newContentsWriter(w), string(params["uri"]))
+// toolTimeout returns the maximum execution time declared on the tool definition.
+func (s *Server) toolTimeout(name string) time.Duration {
+	for _, tool := range s.handler().ListTools() {
+		if tool.Name == name {
+			return tool.Timeout
+		}
+	}
+	return 0
+}
 
-		case MethodSetLogLevel:
-			// Set log level
-			var params map[string]json.RawMessage
-			err := json.Unmarshal(req.Params, &params)
-			if err != nil {
-				s.Logger.Error("failed to unmarshal params", "error", err)
-				continue
-			}
+// servePrompt answers the request with the messages written by the prompt handler once it returns.
+func (s *Server) servePrompt(w ResponseWriter, name string, args map[string]any) {
+	var description string
+	for _, prompt := range s.handler().ListPrompts() {
+		if prompt.Name == name {
+			description = prompt.Description
+			break
+		}
+	}
+
+	pw := newPromptWriter(w)
+	s.handler().ServePrompt(pw, name, args)
+
+	err := pw.flush(description)
+	if err != nil {
+		s.logger().Error("failed to write prompt", "prompt", name, "error", err)
+	}
+}
+
+func (s *Server) serveTool(ctx context.Context, w ResponseWriter, name string, args map[string]any) {
+	timeout := s.toolTimeout(name)
+	if timeout <= 0 {
+		s.handler().ServeTool(newContentsWriter(ctx, w), name, args)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cw := newContentsWriter(ctx, w)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.handler().ServeTool(cw, name, args)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		// A request canceled by the client is answered once the handler returns
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			s.logger().Warn("tool execution timed out", "tool", name, "timeout", timeout)
+			cw.CloseWithError(ErrRequestTimeout.Code, ErrRequestTimeout.Message)
+		}
+
+		// The request keeps its slots until the handler returns,
+		// so that the limits of concurrent requests bound the handlers actually running
+		<-done
+	}
+}
+
+func (s *Server) serveRequest(ctx context.Context, sess *serverSession, req *Request, w ResponseWriter) {
+	switch req.Method {
+	case MethodListTools:
+		// List tools
+		result := &ListToolsResult{
+			Tools: s.handler().ListTools(),
+		}
+		if result.Tools == nil {
+			result.Tools = []*ToolDefinition{}
+		}
+		resultJson, err := json.Marshal(result)
+		if err != nil {
+			s.logger().Error("failed to marshal tools", "error", err)
+			w.CloseWithError(ErrInternalError.Code, ErrInternalError.Message, nil)
+			return
+		}
+
+		// Write result
+		err = w.WriteResult(resultJson)
+		if err != nil {
+			s.logger().Error("failed to write result", "error", err)
+			return
+		}
+	case MethodCallTool:
+		// Call tool
+		var params struct {
+			Name      string         `json:"name"`
+			Arguments map[string]any `json:"arguments"`
+		}
+		err := json.Unmarshal(req.Params, &params)
+		if err != nil {
+			s.logger().Error("failed to unmarshal params", "error", err)
+			w.CloseWithError(ErrInvalidParams.Code, ErrInvalidParams.Message, nil)
+			return
+		}
+
+		s.serveTool(ctx, w, params.Name, params.Arguments)
+	case MethodListResources:
+		// List resources
+		result := &ListResourcesResult{
+			Resources: s.handler().ListResources(),
+		}
+		if result.Resources == nil {
+			result.Resources = []*ResourceDefinition{}
+		}
+		resultJson, err := json.Marshal(result)
+		if err != nil {
+			s.logger().Error("failed to marshal resources", "error", err)
+			w.CloseWithError(ErrInternalError.Code, ErrInternalError.Message, nil)
+			return
+		}
+
+		// Write result
+		err = w.WriteResult(resultJson)
+		if err != nil {
+			s.logger().Error("failed to write result", "error", err)
+			return
+		}
+	case MethodReadResource:
+		// Read resource
+		var params struct {
+			URI string `json:"uri"`
+		}
+		err := json.Unmarshal(req.Params, &params)
+		if err != nil {
+			s.logger().Error("failed to unmarshal params", "error", err)
+			w.CloseWithError(ErrInvalidParams.Code, ErrInvalidParams.Message, nil)
+			return
+		}
+
+		if params.URI == "" {
+			s.logger().Error("missing uri field")
+			w.CloseWithError(ErrInvalidParams.Code, ErrInvalidParams.Message, nil)
+			return
+		}
+
+		s.handler().ServeResource(newResourceContentsWriter(ctx, w, params.URI), params.URI)
+	case MethodSubscribeResource, MethodUnsubscribeResource:
+		// Subscribe or unsubscribe to the updates of a resource
+		var params struct {
+			URI string `json:"uri"`
+		}
+		err := json.Unmarshal(req.Params, &params)
+		if err != nil || params.URI == "" {
+			s.logger().Error("invalid subscription params", "error", err)
+			w.CloseWithError(ErrInvalidParams.Code, ErrInvalidParams.Message, nil)
+			return
+		}
 
-			// level := convertStrToLevel(params["level"].(string))
-			// logger := slog.New(NewLogHandler(t, level))
+		if req.Method == MethodSubscribeResource {
+			sess.subscribe(params.URI)
+		} else {
+			sess.unsubscribe(params.URI)
+		}
+
+		err = w.WriteResult(Result("{}"))
+		if err != nil {
+			s.logger().Error("failed to write result", "error", err)
+			return
+		}
+	case MethodListPrompts:
+		// List prompts
+		result := &ListPromptsResult{
+			Prompts: s.handler().ListPrompts(),
+		}
+		if result.Prompts == nil {
+			result.Prompts = []*PromptDefinition{}
+		}
+		resultJson, err := json.Marshal(result)
+		if err != nil {
+			s.logger().Error("failed to marshal prompts", "error", err)
+			w.CloseWithError(ErrInternalError.Code, ErrInternalError.Message, nil)
+			return
+		}
+
+		// Write result
+		err = w.WriteResult(resultJson)
+		if err != nil {
+			s.logger().Error("failed to write result", "error", err)
+			return
+		}
+	case MethodGetPrompt:
+		// Get prompt
+		var params struct {
+			Name      string         `json:"name"`
+			Arguments map[string]any `json:"arguments"`
+		}
+		err := json.Unmarshal(req.Params, &params)
+		if err != nil {
+			s.logger().Error("failed to unmarshal params", "error", err)
+			w.CloseWithError(ErrInvalidParams.Code, ErrInvalidParams.Message, nil)
+			return
 		}
+
+		s.servePrompt(w, params.Name, params.Arguments)
+	case MethodSetLogLevel:
+		// Set log level
+		var params map[string]json.RawMessage
+		err := json.Unmarshal(req.Params, &params)
+		if err != nil {
+			s.logger().Error("failed to unmarshal params", "error", err)
+			w.CloseWithError(ErrInvalidParams.Code, ErrInvalidParams.Message, nil)
+			return
+		}
+
+		// level := convertStrToLevel(params["level"].(string))
+		// logger := slog.New(NewLogHandler(t, level))
+		w.WriteResult(Result("{}"))
+	default:
+		w.CloseWithError(ErrMethodNotFound.Code, ErrMethodNotFound.Message, nil)
 	}
 }
+
+// errRelayedSession is returned by the requests to the client of a session served by ServeTransport.
+var errRelayedSession = errors.New("session is served by ServeTransport")
+
+var _ ServerSession = (*relayedSession)(nil)
+
+// relayedSession is a session served by ServeTransport, of which the server only knows the transport.
+// Requests to the client are left to ServeTransport.
+type relayedSession struct {
+	transport Transport
+}
+
+func (s *relayedSession) Close() error {
+	return s.transport.Close()
+}
+
+func (s *relayedSession) Shutdown() error {
+	return nil
+}
+
+func (s *relayedSession) Done() <-chan struct{} {
+	return s.transport.Done()
+}
+
+func (s *relayedSession) Err() error {
+	return s.transport.Err()
+}
+
+func (s *relayedSession) NotifyResourceUpdated(uri string) error {
+	return errRelayedSession
+}
+
+func (s *relayedSession) ListRoots(ctx context.Context) ([]*RootDefinition, error) {
+	return nil, errRelayedSession
+}
+
+func (s *relayedSession) Sample(ctx context.Context) error {
+	return errRelayedSession
+}
+
+func (s *relayedSession) Elicit(ctx context.Context, message string, schema *ElicitationSchema) (*ElicitResult, error) {
+	return nil, errRelayedSession
+}
@@ -46,6 +46,22 @@ type ServerMux struct {
 	promptMux *promptMux
 }
 
+// Capabilities returns the features for which handlers are registered, such as "tools".
+// A Server using the mux advertises only these features, and refuses the requests of the others.
+func (m *ServerMux) Capabilities() *ServerCapabilities {
+	capabilities := &ServerCapabilities{}
+	if len(m.ListTools()) > 0 {
+		capabilities.Tools = &ToolsCapability{}
+	}
+	if len(m.ListResources()) > 0 {
+		capabilities.Resources = &ResourcesCapability{}
+	}
+	if len(m.ListPrompts()) > 0 {
+		capabilities.Prompts = &PromptsCapability{}
+	}
+	return capabilities
+}
+
 func (m *ServerMux) HandleTool(tool *ToolDefinition, handler ToolHandler) {
 	m.toolMux.registerToolHandler(tool.Clone(), handler)
 }
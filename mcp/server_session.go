@@ -3,17 +3,34 @@ package mcp
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
 )
 
 type ServerSession interface {
 	Close() error
 	Shutdown() error
+
+	// Done returns a channel which is closed when the session is terminated.
+	Done() <-chan struct{}
+	// Err returns the cause of the termination after Done is closed, such as io.EOF.
+	Err() error
 	// Notify() error
 
+	// NotifyResourceUpdated notifies the client that the resource was updated, if it subscribed to it.
+	NotifyResourceUpdated(uri string) error
+
 	//
 	ListRoots(ctx context.Context) ([]*RootDefinition, error)
 
 	Sample(ctx context.Context) error
+
+	// Elicit asks the user, through the client, for the data described by the schema.
+	// A nil schema asks for a confirmation without data.
+	// The content of an accepted elicitation is checked against the schema.
+	Elicit(ctx context.Context, message string, schema *ElicitationSchema) (*ElicitResult, error)
 }
 
 var _ ServerSession = (*serverSession)(nil)
@@ -23,11 +40,129 @@ type serverSession struct {
 
 	transport Transport
 
-	clientCapabilities Capabilities
+	clientCapabilities *ClientCapabilities
+	// serverCapabilities are the capabilities advertised to the client in the initialization
+	serverCapabilities *ServerCapabilities
+
+	requestSem *semaphore
+
+	// inflight holds the cancel functions of requests accepted and not yet answered, keyed by request ID
+	inflight map[ID]context.CancelCauseFunc
+	// cancelled holds the IDs of the cancellations received before their requests were accepted,
+	// as requests and notifications are accepted independently.
+	// Cancellations of requests which are already answered or unknown are never claimed,
+	// so only the most recent ones are kept
+	cancelled    map[ID]struct{}
+	cancelledIDs []ID
+	inflightLock sync.Mutex
+
+	// subscriptions holds the URIs of the resources the client subscribed to
+	subscriptions     map[string]struct{}
+	subscriptionsLock sync.Mutex
+}
+
+// maxEarlyCancellations is the number of cancellations kept for requests which are not accepted yet.
+const maxEarlyCancellations = 64
+
+// errRequestCancelled is the cause of the context of a request cancelled by the client.
+var errRequestCancelled = errors.New("request cancelled by the client")
+
+func (s *serverSession) startRequest(id ID, cancel context.CancelCauseFunc) {
+	s.inflightLock.Lock()
+	defer s.inflightLock.Unlock()
+
+	if _, ok := s.cancelled[id]; ok {
+		delete(s.cancelled, id)
+		s.cancelledIDs = slices.DeleteFunc(s.cancelledIDs, func(cancelled ID) bool { return cancelled == id })
+		cancel(errRequestCancelled)
+	}
+
+	if s.inflight == nil {
+		s.inflight = make(map[ID]context.CancelCauseFunc)
+	}
+	s.inflight[id] = cancel
+}
+
+func (s *serverSession) finishRequest(id ID) {
+	s.inflightLock.Lock()
+	defer s.inflightLock.Unlock()
+
+	delete(s.inflight, id)
+}
+
+func (s *serverSession) cancelRequest(id ID) {
+	s.inflightLock.Lock()
+	cancel, ok := s.inflight[id]
+	if !ok {
+		s.addEarlyCancellation(id)
+	}
+	s.inflightLock.Unlock()
+
+	if ok {
+		cancel(errRequestCancelled)
+	}
+}
+
+// addEarlyCancellation records the cancellation of a request which is not accepted yet,
+// forgetting the oldest one when too many are recorded.
+func (s *serverSession) addEarlyCancellation(id ID) {
+	if s.cancelled == nil {
+		s.cancelled = make(map[ID]struct{})
+	}
+	if _, ok := s.cancelled[id]; ok {
+		return
+	}
+
+	if len(s.cancelledIDs) >= maxEarlyCancellations {
+		delete(s.cancelled, s.cancelledIDs[0])
+		s.cancelledIDs = s.cancelledIDs[1:]
+	}
+	s.cancelled[id] = struct{}{}
+	s.cancelledIDs = append(s.cancelledIDs, id)
+}
+
+func (s *serverSession) subscribe(uri string) {
+	s.subscriptionsLock.Lock()
+	defer s.subscriptionsLock.Unlock()
+
+	if s.subscriptions == nil {
+		s.subscriptions = make(map[string]struct{})
+	}
+	s.subscriptions[uri] = struct{}{}
+}
+
+func (s *serverSession) unsubscribe(uri string) {
+	s.subscriptionsLock.Lock()
+	defer s.subscriptionsLock.Unlock()
+
+	delete(s.subscriptions, uri)
+}
+
+func (s *serverSession) NotifyResourceUpdated(uri string) error {
+	s.subscriptionsLock.Lock()
+	_, ok := s.subscriptions[uri]
+	s.subscriptionsLock.Unlock()
+	if !ok {
+		return nil
+	}
+
+	params, err := json.Marshal(map[string]any{"uri": uri})
+	if err != nil {
+		return err
+	}
+	return s.transport.Notify(&Notification{Method: MethodNotifyResourceUpdated, Params: Params(params)})
 }
 
 func (s *serverSession) Close() error {
-	return nil
+	return s.transport.Close()
+}
+
+func (s *serverSession) Done() <-chan struct{} {
+	return s.transport.Done()
+}
+
+func (s *serverSession) Err() error {
+	return s.transport.Err()
 }
 
 func (s *serverSession) Shutdown() error {
@@ -35,28 +170,96 @@ func (s *serverSession) Shutdown() error {
 }
 
 func (ss *serverSession) ListRoots(ctx context.Context) ([]*RootDefinition, error) {
+	err := ss.clientCapabilities.checkMethod(MethodListRoots)
+	if err != nil {
+		return nil, err
+	}
+
 	req := &Request{
 		Method: MethodListRoots,
 	}
-	rsp, err := ss.transport.Request(req)
+	result, err := sendRequest(ctx, ss.transport, req, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var rootsResult struct {
+		Roots []*RootDefinition `json:"roots"`
+	}
+	err = json.Unmarshal(result, &rootsResult)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s result: %w", MethodListRoots, err)
+	}
+
+	return rootsResult.Roots, nil
+}
+
+func (s *serverSession) Sample(ctx context.Context) error {
+	return nil
+}
+
+func (ss *serverSession) Elicit(ctx context.Context, message string, schema *ElicitationSchema) (*ElicitResult, error) {
+	err := ss.clientCapabilities.checkMethod(MethodCreateElicitation)
 	if err != nil {
 		return nil, err
 	}
 
-	result, err := rsp.ReadResult()
+	if schema == nil {
+		schema = &ElicitationSchema{}
+	}
+	err = schema.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid elicitation schema: %w", err)
+	}
+
+	// The schema is sent with its type and properties, as required
+	requested := *schema
+	requested.Type = "object"
+	if requested.Properties == nil {
+		requested.Properties = map[string]*PrimitiveSchema{}
+	}
+
+	params, err := json.Marshal(&ElicitationRequest{Message: message, RequestedSchema: &requested})
 	if err != nil {
 		return nil, err
 	}
 
-	var roots []*RootDefinition
-	err = json.Unmarshal(result, &roots)
+	result, err := sendRequest(ctx, ss.transport, &Request{Method: MethodCreateElicitation, Params: Params(params)}, 0)
 	if err != nil {
 		return nil, err
 	}
 
-	return roots, nil
+	var elicitResult ElicitResult
+	err = json.Unmarshal(result, &elicitResult)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s result: %w", MethodCreateElicitation, err)
+	}
+
+	switch elicitResult.Action {
+	case ElicitationAccept:
+		err = schema.validateContent(elicitResult.Content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid elicitation content: %w", err)
+		}
+	case ElicitationDecline, ElicitationCancel:
+	default:
+		return nil, fmt.Errorf("invalid %s result: unknown action %q", MethodCreateElicitation, elicitResult.Action)
+	}
+
+	return &elicitResult, nil
 }
 
-func (s *serverSession) Sample(ctx context.Context) error {
-	return nil
+type serverSessionKey struct{}
+
+// ServerSessionFromContext returns the session of the request being served.
+// Handlers get it from the context of their writer to send requests to the client, for example:
+//
+//	sess, ok := mcp.ServerSessionFromContext(w.Context())
+func ServerSessionFromContext(ctx context.Context) (ServerSession, bool) {
+	sess, ok := ctx.Value(serverSessionKey{}).(ServerSession)
+	return sess, ok
+}
+
+func withServerSession(ctx context.Context, sess ServerSession) context.Context {
+	return context.WithValue(ctx, serverSessionKey{}, sess)
 }
@@ -0,0 +1,662 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServerMux returns a mux serving an echo tool and a text resource,
+// so that the server advertises the tools and resources capabilities.
+func newTestServerMux() *ServerMux {
+	mux := NewServerMux()
+	mux.HandleTool(&ToolDefinition{Name: "echo"}, ToolHandlerFunc(func(w ContentsWriter, name string, args map[string]any) {
+		w.WriteContents([]Content{TextContent{Text: fmt.Sprint(args["message"])}})
+	}))
+	mux.HandleResource(&ResourceDefinition{URI: "file:///readme.txt", Name: "readme"}, ResourceHandlerFunc(func(w ContentsWriter, name string, args map[string]any) {
+		w.WriteContents([]Content{TextContent{Text: "Read me"}})
+	}))
+	return mux
+}
+
+// acceptTestStream accepts a session on the server over in-process pipes and completes the initialization.
+// It returns an encoder and a decoder for exchanging raw JSON-RPC messages with the server.
+func acceptTestStream(t *testing.T, server *Server) (*json.Encoder, *json.Decoder) {
+	t.Helper()
+
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	t.Cleanup(func() {
+		clientW.Close()
+		clientR.Close()
+	})
+
+	enc := json.NewEncoder(clientW)
+	dec := json.NewDecoder(clientR)
+
+	go server.AcceptStream(serverW, serverR)
+
+	err := enc.Encode(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      0,
+		"method":  MethodInit,
+		"params": map[string]any{
+			"protocolVersion": DefaultVersion,
+			"capabilities":    map[string]any{},
+			"clientInfo":      map[string]any{"name": "test", "version": "0.0.1"},
+		},
+	})
+	require.NoError(t, err)
+
+	var rsp map[string]json.RawMessage
+	require.NoError(t, dec.Decode(&rsp))
+	require.Contains(t, rsp, "result", "initialize should succeed")
+
+	return enc, dec
+}
+
+func TestServer_HandleRequests_Concurrency(t *testing.T) {
+	tests := map[string]struct {
+		maxSessionRequests int
+		maxRequests        int
+		wantOrder          []string
+	}{
+		"unlimited requests do not wait for a slow tool": {
+			wantOrder: []string{"2", "1"},
+		},
+		"session limit serializes requests in FIFO order": {
+			maxSessionRequests: 1,
+			wantOrder:          []string{"1", "2"},
+		},
+		"server limit serializes requests in FIFO order": {
+			maxRequests: 1,
+			wantOrder:   []string{"1", "2"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			release := make(chan struct{})
+			mux := NewServerMux()
+			mux.HandleTool(&ToolDefinition{Name: "slow"}, ToolHandlerFunc(func(w ContentsWriter, name string, args map[string]any) {
+				<-release
+				w.WriteContents([]Content{})
+			}))
+
+			server := NewServer("test-server", "0.0.1")
+			server.Handler = mux
+			server.MaxConcurrentSessionRequests = tc.maxSessionRequests
+			server.MaxConcurrentRequests = tc.maxRequests
+
+			enc, dec := acceptTestStream(t, server)
+
+			require.NoError(t, enc.Encode(map[string]any{
+				"jsonrpc": "2.0",
+				"id":      1,
+				"method":  MethodCallTool,
+				"params":  map[string]any{"name": "slow", "arguments": map[string]any{}},
+			}))
+			require.NoError(t, enc.Encode(map[string]any{
+				"jsonrpc": "2.0",
+				"id":      2,
+				"method":  MethodListTools,
+			}))
+
+			time.AfterFunc(100*time.Millisecond, func() { close(release) })
+
+			var order []string
+			for range tc.wantOrder {
+				var rsp map[string]json.RawMessage
+				require.NoError(t, dec.Decode(&rsp))
+				assert.Contains(t, rsp, "result", "response should not be an error")
+				order = append(order, string(rsp["id"]))
+			}
+
+			assert.Equal(t, tc.wantOrder, order, "responses should be written in the expected order")
+		})
+	}
+}
+
+func TestServer_ServeTool_Cancellation(t *testing.T) {
+	tests := map[string]struct {
+		timeout      time.Duration
+		cancel       bool
+		wantErrCode  ErrorCode
+		wantResponse bool
+	}{
+		"tool exceeding its timeout is answered with timeout error": {
+			timeout:      50 * time.Millisecond,
+			wantErrCode:  RequestTimeoutErrorCode,
+			wantResponse: true,
+		},
+		"tool canceled by the client is answered with cancellation error": {
+			cancel:       true,
+			wantErrCode:  RequestCancelledCode,
+			wantResponse: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			canceled := make(chan error, 1)
+			mux := NewServerMux()
+			mux.HandleTool(&ToolDefinition{Name: "wait", Timeout: tc.timeout}, ToolHandlerFunc(func(w ContentsWriter, name string, args map[string]any) {
+				<-w.Context().Done()
+				canceled <- w.Context().Err()
+			}))
+
+			server := NewServer("test-server", "0.0.1")
+			server.Handler = mux
+
+			enc, dec := acceptTestStream(t, server)
+
+			require.NoError(t, enc.Encode(map[string]any{
+				"jsonrpc": "2.0",
+				"id":      1,
+				"method":  MethodCallTool,
+				"params":  map[string]any{"name": "wait", "arguments": map[string]any{}},
+			}))
+
+			if tc.cancel {
+				require.NoError(t, enc.Encode(map[string]any{
+					"jsonrpc": "2.0",
+					"method":  MethodNotifyCancelled,
+					"params":  map[string]any{"requestId": 1, "reason": "test"},
+				}))
+			}
+
+			select {
+			case err := <-canceled:
+				assert.Error(t, err, "tool context should be done")
+			case <-time.After(time.Second):
+				t.Fatal("tool context was not canceled")
+			}
+
+			if !tc.wantResponse {
+				return
+			}
+
+			var rsp struct {
+				ID    ID     `json:"id"`
+				Error *Error `json:"error"`
+			}
+			require.NoError(t, dec.Decode(&rsp))
+			assert.Equal(t, ID("1"), rsp.ID, "response should answer the tool call")
+			require.NotNil(t, rsp.Error, "response should be an error")
+			assert.Equal(t, tc.wantErrCode, rsp.Error.Code, "error code should match expected")
+		})
+	}
+}
+
+func TestServer_ServeTool_TimeoutHoldsSlot(t *testing.T) {
+	release := make(chan struct{})
+	mux := NewServerMux()
+	mux.HandleTool(&ToolDefinition{Name: "stuck", Timeout: 20 * time.Millisecond}, ToolHandlerFunc(func(w ContentsWriter, name string, args map[string]any) {
+		// The handler ignores its context
+		<-release
+	}))
+
+	server := NewServer("test-server", "0.0.1")
+	server.Handler = mux
+	server.MaxConcurrentRequests = 1
+
+	enc, dec := acceptTestStream(t, server)
+
+	require.NoError(t, enc.Encode(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  MethodCallTool,
+		"params":  map[string]any{"name": "stuck", "arguments": map[string]any{}},
+	}))
+
+	var rsp struct {
+		ID    ID     `json:"id"`
+		Error *Error `json:"error"`
+	}
+	require.NoError(t, dec.Decode(&rsp))
+	require.NotNil(t, rsp.Error)
+	assert.Equal(t, RequestTimeoutErrorCode, rsp.Error.Code, "tool should time out")
+
+	require.NoError(t, enc.Encode(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      2,
+		"method":  MethodListTools,
+	}))
+
+	answered := make(chan ID, 1)
+	go func() {
+		var rsp struct {
+			ID ID `json:"id"`
+		}
+		if dec.Decode(&rsp) == nil {
+			answered <- rsp.ID
+		}
+	}()
+
+	select {
+	case <-answered:
+		t.Fatal("request should wait for the handler of the timed out tool to return")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case id := <-answered:
+		assert.Equal(t, ID("2"), id)
+	case <-time.After(time.Second):
+		t.Fatal("request should be served once the handler returns")
+	}
+}
+
+func TestServer_CancelQueuedRequest(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	mux := NewServerMux()
+	mux.HandleTool(&ToolDefinition{Name: "stuck"}, ToolHandlerFunc(func(w ContentsWriter, name string, args map[string]any) {
+		<-release
+	}))
+
+	server := NewServer("test-server", "0.0.1")
+	server.Handler = mux
+	server.MaxConcurrentRequests = 1
+
+	enc, dec := acceptTestStream(t, server)
+
+	require.NoError(t, enc.Encode(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  MethodCallTool,
+		"params":  map[string]any{"name": "stuck", "arguments": map[string]any{}},
+	}))
+	require.NoError(t, enc.Encode(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      2,
+		"method":  MethodListTools,
+	}))
+	require.NoError(t, enc.Encode(map[string]any{
+		"jsonrpc": "2.0",
+		"method":  MethodNotifyCancelled,
+		"params":  map[string]any{"requestId": 2, "reason": "test"},
+	}))
+
+	var rsp struct {
+		ID    ID     `json:"id"`
+		Error *Error `json:"error"`
+	}
+	require.NoError(t, dec.Decode(&rsp))
+	assert.Equal(t, ID("2"), rsp.ID, "the queued request should be answered while the slot is taken")
+	require.NotNil(t, rsp.Error)
+	assert.Equal(t, RequestCancelledCode, rsp.Error.Code)
+}
+
+func TestServerSession_CancelRequest_Bounded(t *testing.T) {
+	sess := &serverSession{}
+	for i := range 2 * maxEarlyCancellations {
+		sess.cancelRequest(ID(strconv.Itoa(i)))
+	}
+
+	assert.Len(t, sess.cancelled, maxEarlyCancellations, "cancellations of unknown requests should not accumulate")
+	assert.Len(t, sess.cancelledIDs, maxEarlyCancellations)
+
+	var cause error
+	last := ID(strconv.Itoa(2*maxEarlyCancellations - 1))
+	sess.startRequest(last, func(err error) { cause = err })
+	assert.ErrorIs(t, cause, errRequestCancelled, "a request cancelled before it is accepted should be cancelled once accepted")
+	assert.NotContains(t, sess.cancelled, last)
+	assert.NotContains(t, sess.cancelledIDs, last)
+}
+
+func TestServer_Batch(t *testing.T) {
+	tests := map[string]struct {
+		batch     []any
+		wantIDs   []string
+		wantCodes map[string]ErrorCode
+	}{
+		"requests are answered in a single array without notifications": {
+			batch: []any{
+				map[string]any{"jsonrpc": "2.0", "id": 1, "method": MethodListTools},
+				map[string]any{"jsonrpc": "2.0", "method": "notifications/initialized"},
+				map[string]any{"jsonrpc": "2.0", "id": 2, "method": "unknown/method"},
+			},
+			wantIDs:   []string{"1", "2"},
+			wantCodes: map[string]ErrorCode{"2": MethodNotFoundErrorCode},
+		},
+		"invalid entries are answered with invalid request": {
+			batch: []any{
+				1,
+				map[string]any{"jsonrpc": "2.0", "id": 3, "method": MethodListTools},
+			},
+			wantIDs:   []string{"null", "3"},
+			wantCodes: map[string]ErrorCode{"null": InvalidRequestErrorCode},
+		},
+		"empty batch is an invalid request": {
+			batch:     []any{},
+			wantIDs:   []string{"null"},
+			wantCodes: map[string]ErrorCode{"null": InvalidRequestErrorCode},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer("test-server", "0.0.1")
+			server.Handler = newTestServerMux()
+
+			enc, dec := acceptTestStream(t, server)
+
+			require.NoError(t, enc.Encode(tc.batch))
+
+			var raw json.RawMessage
+			require.NoError(t, dec.Decode(&raw))
+
+			var responses []struct {
+				ID    json.RawMessage `json:"id"`
+				Error *Error          `json:"error"`
+			}
+			if len(tc.batch) == 0 {
+				// A single error response is returned for an empty batch
+				var single struct {
+					ID    json.RawMessage `json:"id"`
+					Error *Error          `json:"error"`
+				}
+				require.NoError(t, json.Unmarshal(raw, &single))
+				responses = append(responses, single)
+			} else {
+				require.NoError(t, json.Unmarshal(raw, &responses), "batch should be answered with an array")
+			}
+
+			var ids []string
+			for _, rsp := range responses {
+				id := string(rsp.ID)
+				ids = append(ids, id)
+
+				if code, ok := tc.wantCodes[id]; ok {
+					require.NotNil(t, rsp.Error, "response %s should be an error", id)
+					assert.Equal(t, code, rsp.Error.Code, "error code of response %s should match expected", id)
+				} else {
+					assert.Nil(t, rsp.Error, "response %s should not be an error", id)
+				}
+			}
+
+			assert.ElementsMatch(t, tc.wantIDs, ids, "batch response should answer every request")
+		})
+	}
+}
+
+func TestServer_Info(t *testing.T) {
+	server := NewServer("test-server", "0.0.1")
+	server.AdditionalServerInfo = map[string]any{"vendor": "example"}
+
+	// Sessions are initialized concurrently
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Equal(t, map[string]any{"name": "test-server", "version": "0.0.1", "vendor": "example"}, server.info())
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, map[string]any{"vendor": "example"}, server.AdditionalServerInfo, "the map of the server should not be modified")
+}
+
+// deprecatedCapabilitiesHandler reports its capabilities with the deprecated map.
+type deprecatedCapabilitiesHandler struct {
+	*ServerMux
+}
+
+func (h *deprecatedCapabilitiesHandler) Capabilities() Capabilities {
+	return Capabilities{"tools": {}}
+}
+
+func TestServer_Capabilities(t *testing.T) {
+	t.Run("capabilities are derived from the mux", func(t *testing.T) {
+		mux := NewServerMux()
+		mux.HandleTool(&ToolDefinition{Name: "echo"}, ToolHandlerFunc(func(w ContentsWriter, name string, args map[string]any) {
+			w.WriteContents([]Content{})
+		}))
+		server := NewServer("test-server", "0.0.1")
+		server.Handler = mux
+		server.PromptsChangedNotification = true
+
+		sess := dialTestStream(t, server, NewClient("test-client", "0.0.1"))
+
+		assert.Equal(t, &ServerCapabilities{
+			Tools:   &ToolsCapability{},
+			Prompts: &PromptsCapability{ListChanged: true},
+		}, sess.ServerCapabilities())
+	})
+
+	t.Run("deprecated capabilities of the handler are converted", func(t *testing.T) {
+		server := NewServer("test-server", "0.0.1")
+		server.Handler = &deprecatedCapabilitiesHandler{ServerMux: newTestServerMux()}
+
+		sess := dialTestStream(t, server, NewClient("test-client", "0.0.1"))
+
+		assert.Equal(t, &ServerCapabilities{
+			Tools: &ToolsCapability{},
+		}, sess.ServerCapabilities())
+	})
+
+	t.Run("additional capabilities are merged", func(t *testing.T) {
+		server := NewServer("test-server", "0.0.1")
+		server.Handler = &deprecatedCapabilitiesHandler{ServerMux: newTestServerMux()}
+		server.AdditionalServerCapabilities = &ServerCapabilities{Completions: &CompletionsCapability{}}
+		server.AdditionalCapabilities = Capabilities{"logging": {}}
+
+		client := NewClient("test-client", "0.0.1")
+		client.AdditionalClientCapabilities = &ClientCapabilities{
+			Experimental: map[string]json.RawMessage{"streaming": json.RawMessage(`{}`)},
+		}
+		client.AdditionalCapabilities = Capabilities{"tracing": {"enabled": true}}
+		assert.Equal(t, map[string]json.RawMessage{
+			"streaming": json.RawMessage(`{}`),
+			"tracing":   json.RawMessage(`{"enabled":true}`),
+		}, client.capabilities().Experimental)
+
+		sess := dialTestStream(t, server, client)
+
+		assert.Equal(t, &ServerCapabilities{
+			Logging:     &LoggingCapability{},
+			Completions: &CompletionsCapability{},
+			Tools:       &ToolsCapability{},
+		}, sess.ServerCapabilities())
+	})
+
+	t.Run("methods of advertised capabilities are served", func(t *testing.T) {
+		server := NewServer("test-server", "0.0.1")
+		server.Handler = newTestServerMux()
+		server.ResourceSubscription = true
+
+		enc, dec := acceptTestStream(t, server)
+
+		require.NoError(t, enc.Encode([]map[string]any{
+			{"jsonrpc": "2.0", "id": 1, "method": MethodSubscribeResource, "params": map[string]any{"uri": "file:///readme.txt"}},
+			{"jsonrpc": "2.0", "id": 2, "method": MethodUnsubscribeResource, "params": map[string]any{"uri": "file:///readme.txt"}},
+		}))
+
+		var responses []struct {
+			ID     ID              `json:"id"`
+			Result json.RawMessage `json:"result"`
+			Error  *Error          `json:"error"`
+		}
+		require.NoError(t, dec.Decode(&responses))
+		require.Len(t, responses, 2)
+		for _, rsp := range responses {
+			assert.Nil(t, rsp.Error, "request %s should succeed", rsp.ID)
+			assert.JSONEq(t, `{}`, string(rsp.Result))
+		}
+	})
+
+	t.Run("methods of capabilities which are not advertised are not found", func(t *testing.T) {
+		server := NewServer("test-server", "0.0.1")
+		server.Handler = newTestServerMux()
+
+		// The requests are sent raw, as the client does not send them
+		enc, dec := acceptTestStream(t, server)
+
+		require.NoError(t, enc.Encode([]map[string]any{
+			{"jsonrpc": "2.0", "id": 1, "method": MethodListPrompts},
+			{"jsonrpc": "2.0", "id": 2, "method": MethodSubscribeResource, "params": map[string]any{"uri": "file:///readme.txt"}},
+			{"jsonrpc": "2.0", "id": 3, "method": MethodSetLogLevel, "params": map[string]any{"level": "debug"}},
+		}))
+
+		var responses []struct {
+			ID    ID     `json:"id"`
+			Error *Error `json:"error"`
+		}
+		require.NoError(t, dec.Decode(&responses))
+		require.Len(t, responses, 3)
+		for _, rsp := range responses {
+			require.NotNil(t, rsp.Error, "request %s should fail", rsp.ID)
+			assert.Equal(t, MethodNotFoundErrorCode, rsp.Error.Code)
+		}
+	})
+
+	t.Run("client does not send requests the server cannot serve", func(t *testing.T) {
+		server := NewServer("test-server", "0.0.1")
+		server.Handler = newTestServerMux()
+
+		sess := dialTestStream(t, server, NewClient("test-client", "0.0.1"))
+
+		_, err := sess.ListPrompts(context.Background())
+		assert.ErrorIs(t, err, ErrCapabilityNotSupported)
+
+		_, err = sess.SubscribeResource(&ResourceDefinition{URI: "file:///readme.txt"})
+		var capErr *CapabilityError
+		require.ErrorAs(t, err, &capErr)
+		assert.Equal(t, "resources.subscribe", capErr.Capability)
+	})
+
+	t.Run("server does not send requests the client cannot serve", func(t *testing.T) {
+		server := NewServer("test-server", "0.0.1")
+		server.Handler = newTestServerMux()
+
+		clientT, serverT := NewInMemoryTransports()
+		t.Cleanup(func() { clientT.Close() })
+
+		accepted := make(chan ServerSession, 1)
+		go func() {
+			sess, err := server.Accept(serverT)
+			assert.NoError(t, err)
+			accepted <- sess
+		}()
+
+		// The client advertises no capabilities
+		_, err := clientT.RequestSync(context.Background(), &Request{
+			Method: MethodInit,
+			Params: Params(`{"protocolVersion": "` + string(DefaultVersion) + `", "capabilities": {}, "clientInfo": {"name": "test-client", "version": "0.0.1"}}`),
+		})
+		require.NoError(t, err)
+
+		_, err = (<-accepted).ListRoots(context.Background())
+		assert.ErrorIs(t, err, ErrCapabilityNotSupported)
+	})
+}
+
+func TestServerSession_NotifyResourceUpdated(t *testing.T) {
+	server := NewServer("test-server", "0.0.1")
+	server.Handler = newTestServerMux()
+	server.ResourceSubscription = true
+
+	clientT, serverT := NewInMemoryTransports()
+	accepted := make(chan ServerSession, 1)
+	go func() {
+		sess, err := server.Accept(serverT)
+		assert.NoError(t, err)
+		accepted <- sess
+	}()
+
+	sess, err := NewClient("test-client", "0.0.1").Dial(clientT)
+	require.NoError(t, err)
+	t.Cleanup(func() { sess.Close() })
+	serverSess := <-accepted
+
+	updates, err := sess.SubscribeResource(&ResourceDefinition{URI: "file:///readme.txt"})
+	require.NoError(t, err)
+
+	// Resources which are not subscribed to are not notified
+	require.NoError(t, serverSess.NotifyResourceUpdated("file:///other.txt"))
+	require.NoError(t, serverSess.NotifyResourceUpdated("file:///readme.txt"))
+
+	select {
+	case notif := <-updates:
+		assert.JSONEq(t, `{"uri": "file:///readme.txt"}`, string(notif.Params))
+	case <-time.After(time.Second):
+		t.Fatal("update of the subscribed resource should be notified")
+	}
+}
+
+func TestServerSession_ListRoots(t *testing.T) {
+	server := NewServer("test-server", "0.0.1")
+
+	clientT, serverT := NewInMemoryTransports()
+	t.Cleanup(func() { clientT.Close() })
+
+	accepted := make(chan ServerSession, 1)
+	go func() {
+		sess, err := server.Accept(serverT)
+		assert.NoError(t, err)
+		accepted <- sess
+	}()
+
+	_, err := clientT.RequestSync(context.Background(), &Request{
+		Method: MethodInit,
+		Params: Params(`{"protocolVersion": "` + string(DefaultVersion) + `", "capabilities": {"roots": {}}, "clientInfo": {"name": "test-client", "version": "0.0.1"}}`),
+	})
+	require.NoError(t, err)
+
+	go func() {
+		req, w, err := clientT.AcceptRequest(context.Background())
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, MethodListRoots, req.Method)
+		w.WriteResult(Result(`{"roots": [{"uri": "file:///home/user/project", "name": "project"}]}`))
+	}()
+
+	roots, err := (<-accepted).ListRoots(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []*RootDefinition{{URI: "file:///home/user/project", Name: "project"}}, roots)
+}
+
+func TestClient_ListRoots(t *testing.T) {
+	server := NewServer("test-server", "0.0.1")
+
+	clientT, serverT := NewInMemoryTransportsWithConfig(&MemoryConfig{RoundTripJSON: true})
+
+	accepted := make(chan ServerSession, 1)
+	go func() {
+		sess, err := server.Accept(serverT)
+		assert.NoError(t, err)
+		accepted <- sess
+	}()
+
+	mux := NewClientMux()
+	mux.HandleRoot(&RootDefinition{URI: "file:///home/user/project", Name: "project"})
+	client := NewClient("test-client", "0.0.1")
+	client.Handler = mux
+
+	sess, err := client.Dial(clientT)
+	require.NoError(t, err)
+	t.Cleanup(func() { sess.Close() })
+
+	// The roots of the handler are served to the server
+	roots, err := (<-accepted).ListRoots(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []*RootDefinition{{URI: "file:///home/user/project", Name: "project"}}, roots)
+}
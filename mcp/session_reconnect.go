@@ -0,0 +1,509 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// DefaultReconnectBackoff is the delay before the first reconnection
+	// when ReconnectConfig.InitialBackoff is not set.
+	DefaultReconnectBackoff = time.Second
+	// DefaultMaxReconnectBackoff is the maximum delay between reconnections
+	// when ReconnectConfig.MaxBackoff is not set.
+	DefaultMaxReconnectBackoff = 30 * time.Second
+	// DefaultMaxRetries is the number of times an idempotent request is retried
+	// when ReconnectConfig.MaxRetries is not set.
+	DefaultMaxRetries = 3
+)
+
+// ConnectionState is the state of the connection of a reconnecting session.
+type ConnectionState int
+
+const (
+	// StateConnected means that a session is initialized and requests are sent to it.
+	StateConnected ConnectionState = iota
+	// StateReconnecting means that the session ended and a new one is being dialed.
+	StateReconnecting
+	// StateClosed means that the session was closed or could not be reconnected.
+	StateClosed
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateClosed:
+		return "closed"
+	default:
+		return fmt.Sprintf("ConnectionState(%d)", int(s))
+	}
+}
+
+// ReconnectConfig configures a session created by NewReconnectingSession.
+// The delay before a reconnection doubles after each consecutive attempt, from InitialBackoff up to MaxBackoff.
+// Attempts are consecutive until a session stays connected for MaxBackoff.
+type ReconnectConfig struct {
+	// Maximum number of consecutive reconnection attempts. Zero means no limit.
+	MaxAttempts int
+
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// Maximum number of times an idempotent request failing because the session ended is retried
+	// on the reconnected session. Zero means DefaultMaxRetries, and a negative value disables retries.
+	MaxRetries int
+
+	// OnStateChange is called when the state of the connection changes,
+	// with the error which ended the previous session, if any. It must not block.
+	OnStateChange func(state ConnectionState, err error)
+}
+
+func (c *ReconnectConfig) initialBackoff() time.Duration {
+	if c == nil || c.InitialBackoff <= 0 {
+		return DefaultReconnectBackoff
+	}
+	return c.InitialBackoff
+}
+
+func (c *ReconnectConfig) maxBackoff() time.Duration {
+	if c == nil || c.MaxBackoff <= 0 {
+		return DefaultMaxReconnectBackoff
+	}
+	return c.MaxBackoff
+}
+
+func (c *ReconnectConfig) maxAttempts() int {
+	if c == nil {
+		return 0
+	}
+	return c.MaxAttempts
+}
+
+func (c *ReconnectConfig) maxRetries() int {
+	if c == nil || c.MaxRetries == 0 {
+		return DefaultMaxRetries
+	}
+	return max(c.MaxRetries, 0)
+}
+
+// NewReconnectingSession dials a session and returns a ClientSession which dials a new one
+// each time it ends unexpectedly. dial must initialize the session, for example with Client.DialHTTP.
+//
+// Resource subscriptions are restored on the new session.
+// Idempotent requests failing because the session ended, which are the list requests,
+// ReadResource, GetPrompt and CallTool for tools annotated as read-only or idempotent,
+// are retried on the new session. Other requests fail with the error of the ended session.
+func NewReconnectingSession(ctx context.Context, dial func(ctx context.Context) (ClientSession, error), config *ReconnectConfig) (ClientSession, error) {
+	sess, err := dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &reconnectingSession{
+		dial:          dial,
+		config:        config,
+		current:       sess,
+		connected:     true,
+		ready:         make(chan struct{}),
+		subscriptions: make(map[string]chan *Notification),
+		done:          make(chan struct{}),
+	}
+	close(s.ready)
+
+	s.setState(StateConnected, nil)
+	go s.forwardListChanged(sess)
+	go s.supervise()
+
+	return s, nil
+}
+
+var _ ClientSession = (*reconnectingSession)(nil)
+
+type reconnectingSession struct {
+	dial   func(ctx context.Context) (ClientSession, error)
+	config *ReconnectConfig
+
+	mu      sync.Mutex
+	current ClientSession
+	// connected is true until current is found to have ended
+	connected bool
+	// ready is closed while connected, and replaced by an open channel while reconnecting
+	ready  chan struct{}
+	closed bool
+	// finished is true once the session has ended for good
+	finished bool
+
+	// Channels returned by SubscribeResource, keyed by URI, which outlive the sessions
+	subscriptions map[string]chan *Notification
+	// Channels returned by ListChanged, which outlive the sessions
+	listChanged listChangedListeners
+
+	closedErr error
+	done      chan struct{}
+}
+
+// supervise dials a new session each time the current one ends,
+// until the session is closed or the attempts are exhausted.
+func (s *reconnectingSession) supervise() {
+	backoff := s.config.initialBackoff()
+	attempts := 0
+
+	for {
+		s.mu.Lock()
+		sess := s.current
+		s.mu.Unlock()
+
+		connected := time.Now()
+		<-sess.Done()
+		cause := sess.Err()
+
+		// A session which stayed connected long enough is healthy, so the backoff is reset
+		if time.Since(connected) >= s.config.maxBackoff() {
+			backoff = s.config.initialBackoff()
+			attempts = 0
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return
+		}
+		s.disconnectLocked(sess)
+		s.mu.Unlock()
+
+		s.setState(StateReconnecting, cause)
+
+		for {
+			if max := s.config.maxAttempts(); max > 0 && attempts >= max {
+				slog.Error("session is not reconnected anymore", "attempts", attempts, "error", cause)
+				s.finish(cause)
+				return
+			}
+
+			select {
+			case <-time.After(backoff):
+			case <-s.done:
+				return
+			}
+
+			attempts++
+			backoff = min(backoff*2, s.config.maxBackoff())
+
+			next, err := s.dial(context.Background())
+			if err != nil {
+				slog.Warn("failed to reconnect session", "attempts", attempts, "error", err)
+				cause = err
+				continue
+			}
+
+			s.restoreSubscriptions(next)
+
+			s.mu.Lock()
+			if s.closed {
+				s.mu.Unlock()
+				next.Close()
+				return
+			}
+			s.current = next
+			s.connected = true
+			close(s.ready)
+			s.mu.Unlock()
+
+			// The lists of the new session may differ from the lists known by the receivers
+			go s.forwardListChanged(next)
+			for _, method := range []Method{MethodNotifyToolChanged, MethodNotifyResourceChanged, MethodNotifyPromptChanged} {
+				s.listChanged.notify(method)
+			}
+
+			s.setState(StateConnected, nil)
+			break
+		}
+	}
+}
+
+// restoreSubscriptions subscribes the new session to the resources subscribed on the previous ones.
+func (s *reconnectingSession) restoreSubscriptions(sess ClientSession) {
+	s.mu.Lock()
+	uris := make([]string, 0, len(s.subscriptions))
+	for uri := range s.subscriptions {
+		uris = append(uris, uri)
+	}
+	s.mu.Unlock()
+
+	for _, uri := range uris {
+		err := s.subscribe(sess, &ResourceDefinition{URI: uri})
+		if err != nil {
+			slog.Error("failed to restore resource subscription", "uri", uri, "error", err)
+		}
+	}
+}
+
+// subscribe subscribes the session to the resource, and forwards its notifications
+// to the channel of the subscription until the session ends.
+func (s *reconnectingSession) subscribe(sess ClientSession, resource *ResourceDefinition) error {
+	notifications, err := sess.SubscribeResource(resource)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	ch, ok := s.subscriptions[resource.URI]
+	if !ok {
+		ch = make(chan *Notification)
+		s.subscriptions[resource.URI] = ch
+	}
+	s.mu.Unlock()
+
+	go func() {
+		for {
+			select {
+			case notif := <-notifications:
+				select {
+				case ch <- notif:
+				case <-sess.Done():
+					return
+				}
+			case <-sess.Done():
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (s *reconnectingSession) setState(state ConnectionState, err error) {
+	if s.config != nil && s.config.OnStateChange != nil {
+		s.config.OnStateChange(state, err)
+	}
+}
+
+// finish ends the session with the cause, unless it has already ended.
+// The state change is reported before Done is closed.
+func (s *reconnectingSession) finish(cause error) {
+	s.mu.Lock()
+	if s.finished {
+		s.mu.Unlock()
+		return
+	}
+	s.finished = true
+	s.closed = true
+	s.closedErr = cause
+	s.mu.Unlock()
+
+	s.setState(StateClosed, cause)
+	s.listChanged.close()
+	close(s.done)
+}
+
+// disconnectLocked marks the session as ended, so that requests wait for the next one.
+func (s *reconnectingSession) disconnectLocked(sess ClientSession) {
+	if s.current == sess && s.connected {
+		s.connected = false
+		s.ready = make(chan struct{})
+	}
+}
+
+// session waits for a connected session.
+func (s *reconnectingSession) session(ctx context.Context) (ClientSession, error) {
+	for {
+		s.mu.Lock()
+		if s.connected {
+			select {
+			case <-s.current.Done():
+				// The supervisor has not noticed the end of the session yet
+				s.disconnectLocked(s.current)
+			default:
+				sess := s.current
+				s.mu.Unlock()
+				return sess, nil
+			}
+		}
+		ready := s.ready
+		s.mu.Unlock()
+
+		select {
+		case <-ready:
+		case <-s.done:
+			return nil, s.Err()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// retry calls fn with a connected session. If fn fails because the session ended,
+// and idempotent is true, fn is called again once a new session is connected.
+func retry[T any](ctx context.Context, s *reconnectingSession, idempotent bool, fn func(sess ClientSession) (T, error)) (T, error) {
+	var zero T
+
+	retries := 0
+	for {
+		sess, err := s.session(ctx)
+		if err != nil {
+			return zero, err
+		}
+
+		v, err := fn(sess)
+		if err == nil {
+			return v, nil
+		}
+
+		// An error from a session which is still connected is not caused by the connection
+		select {
+		case <-sess.Done():
+		default:
+			return zero, err
+		}
+
+		if !idempotent || retries >= s.config.maxRetries() {
+			return zero, err
+		}
+		retries++
+	}
+}
+
+func (s *reconnectingSession) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	sess := s.current
+	s.mu.Unlock()
+
+	err := sess.Close()
+	s.finish(nil)
+	return err
+}
+
+func (s *reconnectingSession) Shutdown() error {
+	sess, err := s.session(context.Background())
+	if err != nil {
+		return err
+	}
+	return sess.Shutdown()
+}
+
+func (s *reconnectingSession) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *reconnectingSession) Err() error {
+	select {
+	case <-s.done:
+	default:
+		return nil
+	}
+
+	if s.closedErr != nil {
+		return s.closedErr
+	}
+	return ErrTransportClosed
+}
+
+// latest returns the current session, or the last one while reconnecting.
+func (s *reconnectingSession) latest() ClientSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current
+}
+
+// ServerInfo returns the server information of the latest session.
+// It may change after a reconnection, such as when the server is upgraded.
+func (s *reconnectingSession) ServerInfo() Implementation {
+	return s.latest().ServerInfo()
+}
+
+func (s *reconnectingSession) ServerCapabilities() *ServerCapabilities {
+	return s.latest().ServerCapabilities()
+}
+
+func (s *reconnectingSession) Instructions() string {
+	return s.latest().Instructions()
+}
+
+func (s *reconnectingSession) ProtocolVersion() Version {
+	return s.latest().ProtocolVersion()
+}
+
+// forwardListChanged forwards the list_changed notifications of the session until it ends.
+func (s *reconnectingSession) forwardListChanged(sess ClientSession) {
+	for method := range sess.ListChanged() {
+		s.listChanged.notify(method)
+	}
+}
+
+func (s *reconnectingSession) ListChanged() <-chan Method {
+	return s.listChanged.add()
+}
+
+func (s *reconnectingSession) ListTools(ctx context.Context) (*ListToolsResult, error) {
+	return retry(ctx, s, true, func(sess ClientSession) (*ListToolsResult, error) {
+		return sess.ListTools(ctx)
+	})
+}
+
+func (s *reconnectingSession) CallTool(ctx context.Context, tool *ToolDefinition, args map[string]any) (*CallToolResult, error) {
+	return retry(ctx, s, isIdempotentTool(tool), func(sess ClientSession) (*CallToolResult, error) {
+		return sess.CallTool(ctx, tool, args)
+	})
+}
+
+func (s *reconnectingSession) ListResources(ctx context.Context) (*ListResourcesResult, error) {
+	return retry(ctx, s, true, func(sess ClientSession) (*ListResourcesResult, error) {
+		return sess.ListResources(ctx)
+	})
+}
+
+func (s *reconnectingSession) ReadResource(ctx context.Context, resource *ResourceDefinition) (*ReadResourceResult, error) {
+	return retry(ctx, s, true, func(sess ClientSession) (*ReadResourceResult, error) {
+		return sess.ReadResource(ctx, resource)
+	})
+}
+
+func (s *reconnectingSession) SubscribeResource(resource *ResourceDefinition) (<-chan *Notification, error) {
+	sess, err := s.session(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.subscribe(sess, resource)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.subscriptions[resource.URI], nil
+}
+
+func (s *reconnectingSession) ListPrompts(ctx context.Context) (*ListPromptsResult, error) {
+	return retry(ctx, s, true, func(sess ClientSession) (*ListPromptsResult, error) {
+		return sess.ListPrompts(ctx)
+	})
+}
+
+func (s *reconnectingSession) GetPrompt(ctx context.Context, prompt *PromptDefinition, args map[string]any) (*GetPromptResult, error) {
+	return retry(ctx, s, true, func(sess ClientSession) (*GetPromptResult, error) {
+		return sess.GetPrompt(ctx, prompt, args)
+	})
+}
+
+func (s *reconnectingSession) Batch(ctx context.Context, reqs ...*Request) ([]BatchResult, error) {
+	sess, err := s.session(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return sess.Batch(ctx, reqs...)
+}
+
+// isIdempotentTool reports whether calling the tool several times has the same effect as calling it once,
+// according to its readOnlyHint and idempotentHint annotations.
+func isIdempotentTool(tool *ToolDefinition) bool {
+	return tool.Annotations["readOnlyHint"] == true || tool.Annotations["idempotentHint"] == true
+}
@@ -0,0 +1,209 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSession is a ClientSession whose connection is ended by kill.
+type fakeSession struct {
+	ClientSession
+
+	name string
+	// killOnCall makes the connection end during the next request
+	killOnCall bool
+	done       chan struct{}
+	once       sync.Once
+
+	mu            sync.Mutex
+	calls         int
+	subscriptions map[string]chan *Notification
+}
+
+func newFakeSession(name string) *fakeSession {
+	return &fakeSession{
+		name:          name,
+		done:          make(chan struct{}),
+		subscriptions: make(map[string]chan *Notification),
+	}
+}
+
+var errFakeConnectionLost = errors.New("connection lost")
+
+func (s *fakeSession) kill() { s.once.Do(func() { close(s.done) }) }
+
+func (s *fakeSession) Close() error          { s.kill(); return nil }
+func (s *fakeSession) Done() <-chan struct{} { return s.done }
+func (s *fakeSession) Err() error            { return errFakeConnectionLost }
+
+func (s *fakeSession) ListChanged() <-chan Method {
+	ch := make(chan Method)
+	go func() {
+		<-s.done
+		close(ch)
+	}()
+	return ch
+}
+
+// call records a request, which fails if the session is dead.
+func (s *fakeSession) call() error {
+	s.mu.Lock()
+	s.calls++
+	if s.killOnCall {
+		s.kill()
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-s.done:
+		return errFakeConnectionLost
+	default:
+		return nil
+	}
+}
+
+func (s *fakeSession) ListTools(ctx context.Context) (*ListToolsResult, error) {
+	err := s.call()
+	if err != nil {
+		return nil, err
+	}
+	return &ListToolsResult{Tools: []*ToolDefinition{{Name: s.name}}}, nil
+}
+
+func (s *fakeSession) CallTool(ctx context.Context, tool *ToolDefinition, args map[string]any) (*CallToolResult, error) {
+	return nil, s.call()
+}
+
+func (s *fakeSession) SubscribeResource(resource *ResourceDefinition) (<-chan *Notification, error) {
+	err := s.call()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ch := make(chan *Notification, 1)
+	s.subscriptions[resource.URI] = ch
+	return ch, nil
+}
+
+func (s *fakeSession) subscription(uri string) chan *Notification {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.subscriptions[uri]
+}
+
+// fakeDialer dials the sessions in order, and fails once they are exhausted.
+type fakeDialer struct {
+	mu       sync.Mutex
+	sessions []*fakeSession
+	dialed   int
+}
+
+func (d *fakeDialer) dial(ctx context.Context) (ClientSession, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.dialed >= len(d.sessions) {
+		return nil, errors.New("server unavailable")
+	}
+	sess := d.sessions[d.dialed]
+	d.dialed++
+	return sess, nil
+}
+
+func TestReconnectingSession(t *testing.T) {
+	newSession := func(t *testing.T, sessions ...*fakeSession) (ClientSession, func() []ConnectionState) {
+		var mu sync.Mutex
+		var states []ConnectionState
+
+		dialer := &fakeDialer{sessions: sessions}
+		sess, err := NewReconnectingSession(context.Background(), dialer.dial, &ReconnectConfig{
+			MaxAttempts:    2,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     10 * time.Millisecond,
+			OnStateChange: func(state ConnectionState, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				states = append(states, state)
+			},
+		})
+		require.NoError(t, err)
+		t.Cleanup(func() { sess.Close() })
+
+		return sess, func() []ConnectionState {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]ConnectionState(nil), states...)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	t.Run("idempotent request is retried on the reconnected session", func(t *testing.T) {
+		first, second := newFakeSession("first"), newFakeSession("second")
+		first.killOnCall = true
+		sess, states := newSession(t, first, second)
+
+		result, err := sess.ListTools(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "second", result.Tools[0].Name)
+		assert.Eventually(t, func() bool {
+			return assert.ObjectsAreEqual([]ConnectionState{StateConnected, StateReconnecting, StateConnected}, states())
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("non-idempotent tool call is not retried", func(t *testing.T) {
+		first, second, third := newFakeSession("first"), newFakeSession("second"), newFakeSession("third")
+		first.killOnCall = true
+		second.killOnCall = true
+		sess, _ := newSession(t, first, second, third)
+
+		_, err := sess.CallTool(ctx, &ToolDefinition{Name: "write"}, nil)
+		assert.ErrorIs(t, err, errFakeConnectionLost)
+
+		_, err = sess.CallTool(ctx, &ToolDefinition{Name: "read", Annotations: map[string]any{"readOnlyHint": true}}, nil)
+		assert.NoError(t, err, "read-only tool call should be retried")
+	})
+
+	t.Run("resource subscriptions are restored", func(t *testing.T) {
+		first, second := newFakeSession("first"), newFakeSession("second")
+		sess, _ := newSession(t, first, second)
+
+		notifications, err := sess.SubscribeResource(&ResourceDefinition{URI: "file:///a"})
+		require.NoError(t, err)
+
+		first.kill()
+		require.Eventually(t, func() bool { return second.subscription("file:///a") != nil }, time.Second, time.Millisecond)
+
+		second.subscription("file:///a") <- &Notification{Method: MethodNotifyResourceUpdated}
+		select {
+		case notif := <-notifications:
+			assert.Equal(t, MethodNotifyResourceUpdated, notif.Method)
+		case <-ctx.Done():
+			t.Fatal("notification of the restored subscription should be forwarded")
+		}
+	})
+
+	t.Run("session ends when reconnection attempts are exhausted", func(t *testing.T) {
+		first := newFakeSession("first")
+		sess, states := newSession(t, first)
+
+		first.kill()
+		select {
+		case <-sess.Done():
+		case <-ctx.Done():
+			t.Fatal("session should end")
+		}
+
+		assert.EqualError(t, sess.Err(), "server unavailable")
+		assert.Equal(t, []ConnectionState{StateConnected, StateReconnecting, StateClosed}, states())
+	})
+}
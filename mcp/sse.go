@@ -0,0 +1,107 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sseEvent is a single event of a text/event-stream.
+type sseEvent struct {
+	ID    string
+	Event string
+	Data  []byte
+	// Reconnection time requested by the server, zero if not set
+	Retry time.Duration
+}
+
+// writeSSEEvent writes a message event. If id is empty, the event has no ID.
+// The data must not contain newlines, which holds for JSON encoded by encoding/json.
+func writeSSEEvent(w io.Writer, id string, data []byte) error {
+	var err error
+	if id != "" {
+		_, err = fmt.Fprintf(w, "id: %s\nevent: message\ndata: %s\n\n", id, data)
+	} else {
+		_, err = fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+	}
+	return err
+}
+
+// sseReader parses events from a text/event-stream as defined by the HTML Living Standard.
+type sseReader struct {
+	r *bufio.Reader
+}
+
+func newSSEReader(r io.Reader) *sseReader {
+	return &sseReader{r: bufio.NewReader(r)}
+}
+
+// ReadEvent returns the next event with data.
+// Events without data are skipped, except that their ID and retry fields are still reported
+// with the next event. It returns io.EOF when the stream ends.
+func (s *sseReader) ReadEvent() (*sseEvent, error) {
+	event := &sseEvent{}
+	var data bytes.Buffer
+	hasData := false
+
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "" {
+			// Dispatch the event
+			if hasData {
+				event.Data = data.Bytes()
+				if event.Event == "" {
+					event.Event = "message"
+				}
+				return event, nil
+			}
+			event.Event = ""
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			continue
+		}
+
+		if strings.HasPrefix(line, ":") {
+			// Comment
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+
+		switch field {
+		case "event":
+			event.Event = value
+		case "data":
+			if hasData {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+			hasData = true
+		case "id":
+			if !strings.Contains(value, "\x00") {
+				event.ID = value
+			}
+		case "retry":
+			ms, convErr := strconv.Atoi(value)
+			if convErr == nil && ms >= 0 {
+				event.Retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+
+		if err == io.EOF {
+			// The last event is incomplete without a blank line and is discarded
+			return nil, io.EOF
+		}
+	}
+}
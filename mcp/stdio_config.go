@@ -0,0 +1,48 @@
+package mcp
+
+import (
+	"io"
+	"time"
+)
+
+// DefaultTerminationTimeout is the time given to a server process to exit at each step of its termination
+// when StdioCommand.TerminationTimeout is not set.
+const DefaultTerminationTimeout = 5 * time.Second
+
+// StdioCommand describes the server process started by Client.DialStdioCommand.
+type StdioCommand struct {
+	// Path of the command, which is looked up in PATH if it contains no path separator
+	Path string
+	// Arguments of the command, without the command itself
+	Args []string
+
+	// Environment of the process, each entry of the form "key=value".
+	// If nil, the process inherits the environment of the current process.
+	Env []string
+	// Working directory of the process. If empty, it is the working directory of the current process.
+	Dir string
+
+	// Stderr receives what the process writes to its standard error.
+	// If both Stderr and OnStderrLine are nil, it is written to the standard error of the current process.
+	Stderr io.Writer
+	// OnStderrLine is called with each line the process writes to its standard error, without the newline.
+	OnStderrLine func(line string)
+
+	// Time given to the process to exit after its standard input is closed, and then after SIGTERM,
+	// before it is killed when the session is closed.
+	TerminationTimeout time.Duration
+
+	// Restart restarts the process and initializes a new session when it exits unexpectedly,
+	// as a session created by NewReconnectingSession. If nil, the session ends when the process exits.
+	Restart *ReconnectConfig
+
+	// Configuration of the stream transport over the standard input and output of the process
+	Stream *StreamConfig
+}
+
+func (c *StdioCommand) terminationTimeout() time.Duration {
+	if c.TerminationTimeout <= 0 {
+		return DefaultTerminationTimeout
+	}
+	return c.TerminationTimeout
+}
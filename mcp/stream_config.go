@@ -0,0 +1,28 @@
+package mcp
+
+// DefaultMaxMessageSize is the maximum size of a single message read by a stream transport
+// when StreamConfig.MaxMessageSize is not set.
+const DefaultMaxMessageSize = 4 << 20 // 4 MiB
+
+type StreamConfig struct {
+	// Maximum size in bytes of a single newline-delimited message.
+	// Longer messages are discarded and answered with a parse error.
+	MaxMessageSize int
+
+	// Configuration of the queues holding received requests and notifications until they are accepted
+	Queue QueueConfig
+}
+
+func (c *StreamConfig) maxMessageSize() int {
+	if c == nil || c.MaxMessageSize <= 0 {
+		return DefaultMaxMessageSize
+	}
+	return c.MaxMessageSize
+}
+
+func (c *StreamConfig) queueConfig() QueueConfig {
+	if c == nil {
+		return QueueConfig{}
+	}
+	return c.Queue
+}
@@ -1,12 +1,60 @@
 package mcp
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 type ToolDefinition struct {
-	Name        string
-	Description string
-	InputSchema InputSchema
-	Annotations map[string]string
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	InputSchema InputSchema `json:"inputSchema"`
+	// Annotations are hints about the behavior of the tool, such as "readOnlyHint": true.
+	Annotations map[string]any `json:"annotations,omitempty"`
+
+	// Timeout is the maximum execution time of the tool.
+	// When it is exceeded, the call is answered with ErrRequestTimeout and
+	// the context of the ContentsWriter is canceled. Zero means no limit.
+	// It is not sent to clients.
+	Timeout time.Duration `json:"-"`
+}
+
+// ListToolsResult is the result of the listing of the tools of a server.
+type ListToolsResult struct {
+	Tools      []*ToolDefinition `json:"tools"`
+	NextCursor string            `json:"nextCursor,omitempty"`
+	Meta       map[string]any    `json:"_meta,omitempty"`
+}
+
+// CallToolResult is the result of a tool call.
+type CallToolResult struct {
+	Content []Content `json:"content"`
+	// IsError reports that the tool failed, the content describing the failure.
+	IsError bool           `json:"isError,omitempty"`
+	Meta    map[string]any `json:"_meta,omitempty"`
+}
+
+func (r *CallToolResult) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Content json.RawMessage `json:"content"`
+		IsError bool            `json:"isError"`
+		Meta    map[string]any  `json:"_meta"`
+	}
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		return err
+	}
+
+	content, err := unmarshalContentList(v.Content)
+	if err != nil {
+		return err
+	}
+
+	r.Content = content
+	r.IsError = v.IsError
+	r.Meta = v.Meta
+
+	return nil
 }
 
 func (td *ToolDefinition) Clone() *ToolDefinition {
@@ -15,11 +63,26 @@ func (td *ToolDefinition) Clone() *ToolDefinition {
 		Description: td.Description,
 		InputSchema: td.InputSchema,
 		Annotations: td.Annotations,
+		Timeout:     td.Timeout,
 	}
 }
 
+// InputSchema is the JSON Schema of the arguments of a tool.
 type InputSchema json.RawMessage
 
+// MarshalJSON encodes the schema as it is. An empty schema accepts any object.
+func (s InputSchema) MarshalJSON() ([]byte, error) {
+	if len(s) == 0 {
+		return []byte(`{"type":"object"}`), nil
+	}
+	return json.RawMessage(s).MarshalJSON()
+}
+
+func (s *InputSchema) UnmarshalJSON(data []byte) error {
+	*s = append((*s)[:0], data...)
+	return nil
+}
+
 type ToolHandler interface {
 	ServeTool(w ContentsWriter, name string, args map[string]any)
 }
@@ -3,16 +3,34 @@ package mcp
 import (
 	"context"
 	"encoding/json"
+	"errors"
 )
 
+// ErrTransportClosed is reported by Transport.Err when the transport was closed without a specific cause.
+var ErrTransportClosed = errors.New("transport closed")
+
+// ErrSessionNotFound is the cause of the closure of an HTTP client transport
+// whose session was terminated by the server. A new session must be initialized.
+var ErrSessionNotFound = errors.New("session not found")
+
 type Transport interface {
 	// Init(version Version, capabilities Capabilities, info map[string]any, options ...map[string]any) error
 
 	Close() error
 	CloseWithError(err error) error
 
+	// Done returns a channel which is closed when the transport is terminated,
+	// either by Close or because the connection to the peer ended.
+	Done() <-chan struct{}
+	// Err returns nil while the transport is open.
+	// After Done is closed, it returns the cause of the termination, such as io.EOF.
+	Err() error
+
 	Request(req *Request) (ResponseReader, error)
 	RequestSync(ctx context.Context, req *Request) (ResponseReader, error)
+	// RequestBatch sends the requests in a single JSON-RPC batch.
+	// The readers are returned in the same order as the requests.
+	RequestBatch(reqs []*Request) ([]ResponseReader, error)
 
 	Notify(notif *Notification) error
 
@@ -21,10 +39,16 @@ type Transport interface {
 }
 
 type ResponseWriter interface {
+	// ID returns the ID of the request being answered.
+	ID() ID
 	WriteResult(result Result) error
 	CloseWithError(code ErrorCode, msg string, data map[string]json.RawMessage) error
 }
 
 type ResponseReader interface {
+	// ID returns the ID of the request which the response answers.
+	ID() ID
 	ReadResult() (Result, error)
+	// ReadResultContext is like ReadResult but gives up waiting when ctx is done.
+	ReadResultContext(ctx context.Context) (Result, error)
 }
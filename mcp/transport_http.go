@@ -7,42 +7,102 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"net/url"
 	"sync"
+	"time"
 
 	"golang.org/x/exp/slog"
 )
 
+// NewHTTPTransport returns the client side of the Streamable HTTP transport to the endpoint,
+// for connecting to the server without a Client, as a proxy does.
+func NewHTTPTransport(url string, config *HTTPConfig) Transport {
+	return newClientHTTPTransport(url, config)
+}
+
+// newClientHTTPTransport creates the client side of the Streamable HTTP transport.
+// Messages are sent in POST requests to the endpoint, and messages initiated by the server
+// are received from the SSE stream opened by a GET request to the same endpoint
+// once the initialization is complete.
+// The session ID assigned by the server in the response to the initialize request is sent with every request,
+// and the session is terminated with a DELETE request when the transport is closed.
 func newClientHTTPTransport(url string, config *HTTPConfig) *httpClientTransport {
+	t := newHTTPClientTransportBase(url, config)
+	t.messageEndpoint = url
+	close(t.endpointReady)
+
+	return t
+}
+
+// newClientSSETransport creates the client side of the HTTP+SSE transport of the protocol version 2024-11-05.
+// The SSE stream is opened by a GET request to the given URL, and its first event, named "endpoint",
+// tells the URL to which messages are sent in POST requests.
+// All messages from the server, including responses, are received from the SSE stream,
+// and the transport is closed when the stream ends.
+func newClientSSETransport(url string, config *HTTPConfig) *httpClientTransport {
+	t := newHTTPClientTransportBase(url, config)
+	t.legacy = true
+
+	go t.listenLegacyStream()
+
+	return t
+}
+
+func newHTTPClientTransportBase(url string, config *HTTPConfig) *httpClientTransport {
 	if config == nil {
 		config = &HTTPConfig{}
 	}
 	idGen := NewIDGenerator()
-	t := &httpClientTransport{
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var transport http.RoundTripper = config.Transport
+	if config.OAuth != nil {
+		transport = newOAuthRoundTripper(config.Transport, config.OAuth, url)
+	}
+
+	return &httpClientTransport{
+		ctx:                        ctx,
+		cancel:                     cancel,
 		endpoint:                   url,
-		client:                     &http.Client{Transport: config.Transport},
+		endpointReady:              make(chan struct{}),
+		client:                     &http.Client{Transport: transport},
 		generateIDFunc:             idGen.Generate,
 		sentRequestMap:             make(map[ID]chan *response),
 		rceivedRequestIDMap:        make(map[ID]struct{}),
-		receivedRequestQueue:       newRequestsQueue(),
-		receivedNotificationsQueue: newNotificationsQueue(),
+		receivedRequestQueue:       newQueue(config.Queue, answerDiscardedRequest),
+		receivedNotificationsQueue: newQueue[*Notification](config.Queue, nil),
 		config:                     config,
+		sessionID:                  string(config.SessionID),
+		done:                       make(chan struct{}),
 	}
-
-	go t.listenMessages()
-
-	return t
 }
 
 var _ Transport = (*httpClientTransport)(nil)
 
 type httpClientTransport struct {
+	// URL on which the SSE stream is opened
 	endpoint string
 	client   *http.Client
 
+	// legacy is true for the HTTP+SSE transport, where responses are received from the SSE stream
+	legacy bool
+	// URL to which messages are posted, set before endpointReady is closed
+	messageEndpoint string
+	endpointReady   chan struct{}
+
 	config *HTTPConfig
 
-	sseReader io.ReadCloser
+	// sessionID is assigned by the server in the response to the initialize request
+	sessionID     string
+	sessionIDLock sync.Mutex
+	// listenOnce starts the SSE stream for messages initiated by the server
+	listenOnce sync.Once
+
+	// ctx is canceled when the transport is closed, which ends the SSE stream and pending HTTP requests
+	ctx    context.Context
+	cancel context.CancelFunc
 
 	generateIDFunc       func() ID
 	sentRequestMap       map[ID]chan *response
@@ -51,390 +111,609 @@ type httpClientTransport struct {
 	rceivedRequestIDMap    map[ID]struct{}
 	rceivedRequestsMapLock sync.RWMutex
 
-	receivedRequestQueue       *requestsQueue
-	receivedNotificationsQueue *notificationsQueue
+	receivedRequestQueue       *queue[receivedRequest]
+	receivedNotificationsQueue *queue[*Notification]
 
-	closed    bool
+	closeOnce sync.Once
 	closedErr error
+	done      chan struct{}
 }
 
-// func (t *httpClientTransport) Init(params Params) (Result, error) {
-// 	req := &Request{
-// 		Method: MethodInit,
-// 		Params: params,
-// 	}
-// 	res, err := t.RequestSync(context.TODO(), req)
-// 	if err != nil {
-// 		return nil, err
-// 	}
-
-// 	result, err := res.ReadResult()
-// 	if err != nil {
-// 		return nil, err
-// 	}
-
-// 	sseReq, err := http.NewRequest("GET", t.endpoint, nil)
-// 	if err != nil {
-// 		return nil, err
-// 	}
-// 	sseReq.Header.Set("Accept", "text/event-stream")
-// 	if t.config.SessionID != "" {
-// 		sseReq.Header.Set("mcp-session-id", string(t.config.SessionID))
-// 	}
-
-// 	sseResp, err := t.client.Do(sseReq)
-// 	if err != nil {
-// 		return nil, err
-// 	}
-
-// 	t.sseReader = sseResp.Body
+func (t *httpClientTransport) Close() error {
+	return t.close(nil)
+}
 
-// 	go t.listenMessages()
+func (t *httpClientTransport) CloseWithError(err error) error {
+	return t.close(err)
+}
 
-// 	return result, nil
-// }
+func (t *httpClientTransport) Done() <-chan struct{} {
+	return t.done
+}
 
-func (t *httpClientTransport) Close() error {
-	if t.closed {
-		if t.closedErr != nil {
-			return fmt.Errorf("transport is already closed: %w", t.closedErr)
-		}
-		return errors.New("transport is already closed")
+func (t *httpClientTransport) Err() error {
+	select {
+	case <-t.done:
+	default:
+		return nil
 	}
 
-	t.receivedRequestQueue.Clear()
-	t.receivedNotificationsQueue.Clear()
-
-	closeErr := t.sseReader.Close()
-	if closeErr != nil {
-		return closeErr
+	if t.closedErr != nil {
+		return t.closedErr
 	}
-
-	t.closed = true
-
-	return nil
+	return ErrTransportClosed
 }
 
-func (t *httpClientTransport) CloseWithError(err error) error {
-	if t.closed {
+func (t *httpClientTransport) close(cause error) error {
+	closed := false
+	t.closeOnce.Do(func() {
+		closed = true
+		t.closedErr = cause
+		close(t.done)
+	})
+	if !closed {
 		if t.closedErr != nil {
 			return fmt.Errorf("transport is already closed: %w", t.closedErr)
 		}
 		return errors.New("transport is already closed")
 	}
 
-	t.receivedRequestQueue.Clear()
-	t.receivedNotificationsQueue.Clear()
+	t.receivedRequestQueue.Close()
+	t.receivedNotificationsQueue.Close()
+
+	t.cancel()
 
-	closeErr := t.sseReader.Close()
-	if closeErr != nil {
-		return closeErr
+	if !t.legacy && !errors.Is(cause, ErrSessionNotFound) {
+		t.terminateSession()
 	}
 
-	t.closed = true
-	t.closedErr = err
+	// Fail all requests waiting for a response
+	if cause == nil {
+		cause = ErrTransportClosed
+	}
+	t.sentRequestIDMapLock.Lock()
+	for id, rspCh := range t.sentRequestMap {
+		rspCh <- &response{
+			id:  id,
+			err: fmt.Errorf("transport closed before response: %w", cause),
+		}
+		delete(t.sentRequestMap, id)
+	}
+	t.sentRequestIDMapLock.Unlock()
 
 	return nil
 }
 
 func (t *httpClientTransport) Request(req *Request) (ResponseReader, error) {
-	id := t.generateIDFunc()
-	if _, ok := t.sentRequestMap[id]; ok {
-		panic("ID is already used")
+	readers, err := t.sendRequests([]*Request{req}, false)
+	if err != nil {
+		return nil, err
 	}
+	return readers[0], nil
+}
 
-	rspCh := make(chan *response)
-
-	// Record request ID
-	t.sentRequestIDMapLock.Lock()
-	t.sentRequestMap[id] = rspCh
-	t.sentRequestIDMapLock.Unlock()
+func (t *httpClientTransport) RequestBatch(reqs []*Request) ([]ResponseReader, error) {
+	return t.sendRequests(reqs, true)
+}
 
-	jsonrpcReq := map[string]any{
-		"jsonrpc": "2.0",
-		"method":  req.Method,
-		"params":  req.Params,
-		"id":      id,
-	}
-	body, err := json.Marshal(jsonrpcReq)
+func (t *httpClientTransport) RequestSync(ctx context.Context, req *Request) (ResponseReader, error) {
+	rsp, err := t.Request(req)
 	if err != nil {
 		return nil, err
 	}
-	httpReq, err := http.NewRequest("POST", t.endpoint, bytes.NewReader(body))
+
+	result, err := rsp.ReadResultContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Accept", "application/json, text/event-stream")
-	if t.config.SessionID != "" {
-		httpReq.Header.Set("mcp-session-id", string(t.config.SessionID))
-	}
-	// httpReq.Header.Set("Authorization", "Bearer "+req.token)
+	return &response{id: rsp.ID(), result: result}, nil
+}
 
-	go func() {
-		defer close(rspCh)
+// sendRequests posts the requests, as a batch if batch is true, and returns readers of their responses.
+// The responses are routed from the HTTP response, or from the SSE stream for the legacy transport.
+// Requests which cannot be sent, or which are not answered in the HTTP response, fail with an error.
+func (t *httpClientTransport) sendRequests(reqs []*Request, batch bool) ([]ResponseReader, error) {
+	messages := make([]map[string]any, 0, len(reqs))
+	readers := make([]ResponseReader, 0, len(reqs))
+	ids := make([]ID, 0, len(reqs))
 
-		httpResp, err := t.client.Do(httpReq)
-		if err != nil {
-			rspCh <- &response{
-				result: nil,
-				err: &Error{
-					Code:    JSONRPCInternalErrorCode,
-					Message: err.Error(),
-				},
-			}
-			return
+	// Record request IDs
+	t.sentRequestIDMapLock.Lock()
+	for _, req := range reqs {
+		id := t.generateIDFunc()
+		if _, ok := t.sentRequestMap[id]; ok {
+			t.sentRequestIDMapLock.Unlock()
+			panic("ID is already used")
 		}
 
-		if httpResp.StatusCode != http.StatusOK {
-			rspCh <- &response{
-				result: nil,
-				err: &Error{
-					Code:    JSONRPCInternalErrorCode,
-					Message: "HTTP status code is not 200",
-					Data: map[string]any{
-						"status_code": httpResp.StatusCode,
-					},
-				},
-			}
-			return
-		}
+		rspCh := make(chan *response, 1)
+		t.sentRequestMap[id] = rspCh
+		ids = append(ids, id)
 
-		defer httpResp.Body.Close()
+		messages = append(messages, map[string]any{
+			"jsonrpc": "2.0",
+			"method":  req.Method,
+			"params":  req.Params,
+			"id":      id,
+		})
+		readers = append(readers, &asyncResponseReader{id: id, ch: rspCh})
+	}
+	t.sentRequestIDMapLock.Unlock()
 
-		var jsonrpcResp map[string]json.RawMessage
-		err = json.NewDecoder(httpResp.Body).Decode(&jsonrpcResp)
-		if err != nil {
-			rspCh <- &response{
-				result: nil,
-				err: &Error{
-					Code:    JSONRPCInternalErrorCode,
-					Message: err.Error(),
-				},
-			}
-			return
-		}
+	for i, req := range reqs {
+		req.beforeSend(ids[i])
+	}
 
-		if id != ID(jsonrpcResp["id"]) {
-			rspCh <- &response{
-				result: nil,
-				err: &Error{
-					Code:    JSONRPCInternalErrorCode,
-					Message: "unexpected request ID",
-				},
-			}
-			return
-		}
+	var message any = messages[0]
+	if batch {
+		message = messages
+	}
 
-		if jsonrpcResp["error"] != nil {
-			var errObj Error
-			err = json.Unmarshal(jsonrpcResp["error"], &errObj)
-			if err != nil {
-				rspCh <- &response{
-					result: nil,
-					err: &Error{
-						Code:    JSONRPCInternalErrorCode,
-						Message: fmt.Sprintf("failed to unmarshal error: %s", err.Error()),
-						Data: map[string]any{
-							"error": jsonrpcResp["error"],
-						},
-					},
-				}
+	go func() {
+		err := t.send(message, true)
+		if err == nil {
+			if t.legacy {
 				return
 			}
-
-			rspCh <- &response{
-				result: nil,
-				err:    &errObj,
-			}
+			err = errors.New("response is missing in HTTP response")
 		}
 
-		if jsonrpcResp["result"] == nil {
-			rspCh <- &response{
-				result: nil,
-				err: &Error{
-					Code:    JSONRPCInternalErrorCode,
-					Message: "missing result field",
-				},
-			}
-			return
-		}
+		t.failRequests(ids, err)
+	}()
 
-		rspCh <- &response{
-			result: Result(jsonrpcResp["result"]),
-			err:    nil,
+	return readers, nil
+}
+
+// failRequests answers the requests which are still waiting for a response with the error.
+func (t *httpClientTransport) failRequests(ids []ID, err error) {
+	t.sentRequestIDMapLock.Lock()
+	defer t.sentRequestIDMapLock.Unlock()
+
+	for _, id := range ids {
+		rspCh, ok := t.sentRequestMap[id]
+		if !ok {
+			continue
 		}
-	}()
+		delete(t.sentRequestMap, id)
 
-	return &asyncResponseReader{ch: rspCh}, nil
+		rspCh <- &response{id: id, err: err}
+	}
 }
 
-func (t *httpClientTransport) RequestSync(ctx context.Context, req *Request) (ResponseReader, error) {
-	id := t.generateIDFunc()
-	if _, ok := t.sentRequestMap[id]; ok {
-		panic("ID is already used")
+func (t *httpClientTransport) Notify(notif *Notification) error {
+	err := t.send(map[string]any{
+		"jsonrpc": "2.0",
+		"method":  notif.Method,
+		"params":  notif.Params,
+	}, false)
+	if err != nil {
+		return err
 	}
 
-	// Record request ID
-	t.sentRequestIDMapLock.Lock()
-	t.sentRequestMap[id] = nil
-	t.sentRequestIDMapLock.Unlock()
+	// The server accepts the SSE stream once the session is initialized
+	if notif.Method == MethodNotifyInitialized && !t.legacy {
+		t.listenOnce.Do(func() {
+			go t.listenMessages()
+		})
+	}
 
-	jsonrpcReq := map[string]any{
-		"jsonrpc": "2.0",
-		"method":  req.Method,
-		"params":  req.Params,
-		"id":      id,
+	return nil
+}
+
+// send posts a message, or a batch of them.
+// If expectResponse is true, the messages in the HTTP response, a JSON body or an SSE stream,
+// are routed like those of the standalone SSE stream.
+func (t *httpClientTransport) send(message any, expectResponse bool) error {
+	httpResp, err := t.post(message)
+	if err != nil {
+		return err
 	}
-	body, err := json.Marshal(jsonrpcReq)
+	defer httpResp.Body.Close()
+
+	if !expectResponse || httpResp.StatusCode == http.StatusAccepted {
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(httpResp.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		body, err := io.ReadAll(httpResp.Body)
+		if err != nil {
+			return err
+		}
+
+		t.readEventData(body)
+		return nil
+	case "text/event-stream":
+		lastEventID, err := t.readStream(httpResp.Body, nil)
+		if err == nil || lastEventID == "" {
+			return err
+		}
+
+		// The stream dropped before all responses were received, so it is resumed from its last event
+		slog.Warn("SSE stream of POST response disconnected", "error", err)
+		return t.resumeStream(lastEventID)
+	default:
+		return fmt.Errorf("unsupported content type of HTTP response: %q", mediaType)
+	}
+}
+
+// post sends the message in a POST request to the message endpoint.
+// It returns an *httpStatusError if the server does not accept it.
+func (t *httpClientTransport) post(message any) (*http.Response, error) {
+	// Wait for the message endpoint to be known
+	select {
+	case <-t.endpointReady:
+	case <-t.done:
+		return nil, t.Err()
+	}
+
+	body, err := json.Marshal(message)
 	if err != nil {
 		return nil, err
 	}
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", t.endpoint, bytes.NewReader(body))
+	httpReq, err := t.newRequest(t.ctx, http.MethodPost, t.messageEndpoint, bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("Accept", "application/json, text/event-stream")
-	// httpReq.Header.Set("Authorization", "Bearer "+req.token)
 
-	httpResp, err := t.client.Do(httpReq)
+	httpResp, err := t.do(httpReq)
 	if err != nil {
 		return nil, err
 	}
 
-	if httpResp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP status code is not 200: %d", httpResp.StatusCode)
+	// The session ID is assigned in the response to the initialize request
+	if sessionID := httpResp.Header.Get(SessionIDHeader); sessionID != "" && !t.legacy {
+		t.sessionIDLock.Lock()
+		if t.sessionID == "" {
+			t.sessionID = sessionID
+		}
+		t.sessionIDLock.Unlock()
 	}
 
-	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK && httpResp.StatusCode != http.StatusAccepted {
+		httpResp.Body.Close()
+		return nil, &httpStatusError{StatusCode: httpResp.StatusCode}
+	}
 
-	var jsonrpcResp map[string]json.RawMessage
-	err = json.NewDecoder(httpResp.Body).Decode(&jsonrpcResp)
+	return httpResp, nil
+}
+
+// newRequest creates an HTTP request with the configured headers and the session ID.
+func (t *httpClientTransport) newRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		return nil, err
 	}
 
-	if id != ID(jsonrpcResp["id"]) {
-		return nil, errors.New("unexpected request ID")
+	for key, values := range t.config.Headers {
+		for _, value := range values {
+			httpReq.Header.Add(key, value)
+		}
+	}
+	if t.config.Origin != "" {
+		httpReq.Header.Set("Origin", t.config.Origin)
+	}
+	if sessionID := t.getSessionID(); sessionID != "" {
+		httpReq.Header.Set(SessionIDHeader, sessionID)
 	}
 
-	if jsonrpcResp["error"] != nil {
-		var errObj Error
-		err = json.Unmarshal(jsonrpcResp["error"], &errObj)
-		if err != nil {
-			return nil, err
-		}
+	return httpReq, nil
+}
 
-		return &response{
-			result: nil,
-			err:    &errObj,
-		}, nil
+// do sends the HTTP request. If the server answers 404 Not Found to a request carrying a session ID,
+// the session has been terminated, and the transport is closed with ErrSessionNotFound.
+func (t *httpClientTransport) do(httpReq *http.Request) (*http.Response, error) {
+	httpResp, err := t.client.Do(httpReq)
+	if err != nil {
+		return nil, err
 	}
 
-	if jsonrpcResp["result"] == nil {
-		return nil, errors.New("missing result field")
+	if httpResp.StatusCode == http.StatusNotFound && httpReq.Header.Get(SessionIDHeader) != "" {
+		httpResp.Body.Close()
+		go t.CloseWithError(ErrSessionNotFound)
+		return nil, ErrSessionNotFound
 	}
 
-	return &response{
-		result: Result(jsonrpcResp["result"]),
-		err:    nil,
-	}, nil
+	return httpResp, nil
 }
 
-func (t *httpClientTransport) Notify(notif *Notification) error {
-	jsonrpcReq := map[string]any{
-		"jsonrpc": "2.0",
-		"method":  notif.Method,
-		"params":  notif.Params,
+func (t *httpClientTransport) getSessionID() string {
+	t.sessionIDLock.Lock()
+	defer t.sessionIDLock.Unlock()
+	return t.sessionID
+}
+
+// terminateSession asks the server to terminate the session with a DELETE request.
+// The server may refuse it with 405 Method Not Allowed, in which case the session expires on its own.
+func (t *httpClientTransport) terminateSession() {
+	sessionID := t.getSessionID()
+	if sessionID == "" {
+		return
 	}
-	body, err := json.Marshal(jsonrpcReq)
+
+	ctx, cancel := context.WithTimeout(context.Background(), sessionTerminationTimeout)
+	defer cancel()
+
+	httpReq, err := t.newRequest(ctx, http.MethodDelete, t.endpoint, nil)
 	if err != nil {
-		return err
+		return
 	}
-	httpReq, err := http.NewRequest("POST", t.endpoint, bytes.NewReader(body))
+
+	httpResp, err := t.client.Do(httpReq)
 	if err != nil {
-		return err
+		slog.Warn("failed to terminate session", "session_id", sessionID, "error", err)
+		return
 	}
+	httpResp.Body.Close()
+}
 
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Accept", "application/json, text/event-stream")
-	// httpReq.Header.Set("Authorization", "Bearer "+req.token)
+// sessionTerminationTimeout bounds the DELETE request sent when the transport is closed.
+const sessionTerminationTimeout = 5 * time.Second
 
-	httpResp, err := t.client.Do(httpReq)
+func (t *httpClientTransport) AcceptRequest(ctx context.Context) (*Request, ResponseWriter, error) {
+	r, err := t.receivedRequestQueue.Pop(ctx)
 	if err != nil {
-		return err
+		if errors.Is(err, errQueueClosed) {
+			return nil, nil, t.Err()
+		}
+		return nil, nil, err
 	}
 
-	if httpResp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP status code is not 200: %d", httpResp.StatusCode)
-	}
+	return r.req, r.w, nil
+}
 
-	defer httpResp.Body.Close()
+func (t *httpClientTransport) AcceptNotification(ctx context.Context) (*Notification, error) {
+	notif, err := t.receivedNotificationsQueue.Pop(ctx)
+	if err != nil {
+		if errors.Is(err, errQueueClosed) {
+			return nil, t.Err()
+		}
+		return nil, err
+	}
 
-	// Ignore response
+	return notif, nil
+}
 
-	return nil
+func (t *httpClientTransport) Stats() TransportStats {
+	return TransportStats{
+		Requests:      t.receivedRequestQueue.Stats(),
+		Notifications: t.receivedNotificationsQueue.Stats(),
+	}
 }
 
-func (t *httpClientTransport) AcceptRequest(ctx context.Context) (*Request, ResponseWriter, error) {
+// listenMessages listens to the SSE stream opened by a GET request for messages initiated by the server.
+// When the stream drops, it reconnects after the retry delay and sends the ID of the last event received
+// in the Last-Event-ID header, so that the server replays the events missed in the meantime.
+// It stops when the transport is closed or the server refuses the stream.
+func (t *httpClientTransport) listenMessages() {
+	retryDelay := t.config.retryDelay()
+	lastEventID := ""
+
 	for {
-		if t.receivedRequestQueue.Len() > 0 {
-			return t.receivedRequestQueue.Pop(), nil, nil
+		err := t.listenStream(&lastEventID, &retryDelay)
+
+		var statusErr *httpStatusError
+		if errors.As(err, &statusErr) && statusErr.permanent() {
+			slog.Info("SSE stream is not available", "status_code", statusErr.StatusCode)
+			return
+		}
+		if errors.Is(err, ErrSessionNotFound) {
+			return
+		}
+		if err == nil {
+			err = io.EOF
 		}
 
 		select {
-		case <-ctx.Done():
-			return nil, nil, ctx.Err()
-		case <-t.receivedRequestQueue.Chan():
-			continue
+		case <-t.ctx.Done():
+			return
+		default:
+		}
+
+		slog.Warn("SSE stream disconnected", "error", err, "retry_delay", retryDelay)
+
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-time.After(retryDelay):
 		}
 	}
 }
 
-func (t *httpClientTransport) AcceptNotification(ctx context.Context) (*Notification, error) {
+// listenStream opens the SSE stream and reads its events until it ends.
+// The ID of the last event and the retry delay requested by the server are updated as events are read.
+func (t *httpClientTransport) listenStream(lastEventID *string, retryDelay *time.Duration) error {
+	httpReq, err := t.newRequest(t.ctx, http.MethodGet, t.endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	httpReq.Header.Set("Accept", "text/event-stream")
+	if *lastEventID != "" {
+		httpReq.Header.Set("Last-Event-ID", *lastEventID)
+	}
+
+	httpResp, err := t.do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return &httpStatusError{StatusCode: httpResp.StatusCode}
+	}
+
+	id, err := t.readStream(httpResp.Body, retryDelay)
+	if id != "" {
+		*lastEventID = id
+	}
+	return err
+}
+
+// readStream routes the messages of an SSE stream until it ends, and returns the ID of the last event received.
+// The retry delay requested by the server is stored in retryDelay, which may be nil.
+// It returns nil when the server ends the stream.
+func (t *httpClientTransport) readStream(body io.Reader, retryDelay *time.Duration) (lastEventID string, err error) {
+	reader := newSSEReader(body)
 	for {
-		if t.receivedNotificationsQueue.Len() > 0 {
-			return t.receivedNotificationsQueue.Pop(), nil
+		event, err := reader.ReadEvent()
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return lastEventID, err
 		}
 
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		case <-t.receivedNotificationsQueue.Chan():
+		if event.ID != "" {
+			lastEventID = event.ID
+		}
+		if event.Retry > 0 && retryDelay != nil {
+			*retryDelay = event.Retry
+		}
+		if event.Event != "message" {
 			continue
 		}
+
+		t.readEventData(event.Data)
 	}
 }
 
-func (t *httpClientTransport) listenMessages() {
-	decoder := json.NewDecoder(t.sseReader)
+// resumeStream resumes a dropped SSE stream with a GET request carrying the ID of its last event,
+// and reads it until the server ends it. It retries after the retry delay while the stream keeps dropping.
+func (t *httpClientTransport) resumeStream(lastEventID string) error {
+	retryDelay := t.config.retryDelay()
 	for {
+		select {
+		case <-t.ctx.Done():
+			return t.Err()
+		case <-time.After(retryDelay):
+		}
 
-		// Read a message as single JSON object
-		var message map[string]json.RawMessage
-		err := decoder.Decode(&message)
+		err := t.listenStream(&lastEventID, &retryDelay)
 		if err == nil {
-			t.listenSingleMessage(message)
-			continue
+			return nil
+		}
+
+		var statusErr *httpStatusError
+		if errors.As(err, &statusErr) && statusErr.permanent() || errors.Is(err, ErrSessionNotFound) {
+			return err
 		}
 
-		// Read a message as batch JSON object
+		slog.Warn("failed to resume SSE stream", "error", err, "retry_delay", retryDelay)
+	}
+}
+
+// readEventData routes the single or batch message carried by an SSE event.
+func (t *httpClientTransport) readEventData(data []byte) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
 		var batch []map[string]json.RawMessage
-		err = decoder.Decode(&batch)
-		if err == nil {
-			for _, message := range batch {
-				t.listenSingleMessage(message)
-			}
-			continue
+		err := json.Unmarshal(data, &batch)
+		if err != nil {
+			slog.Error("failed to decode batch message", "error", err)
+			return
 		}
 
-		err = errors.New("the message is neither single nor batch")
+		for _, message := range batch {
+			t.listenSingleMessage(message)
+		}
+		return
+	}
+
+	var message map[string]json.RawMessage
+	err := json.Unmarshal(data, &message)
+	if err != nil {
 		slog.Error("failed to decode message", "error", err)
+		return
 	}
 
+	t.listenSingleMessage(message)
+}
+
+// listenLegacyStream reads the SSE stream of the legacy HTTP+SSE transport.
+// The stream cannot be resumed, so the transport is closed when it ends.
+func (t *httpClientTransport) listenLegacyStream() {
+	err := t.readLegacyStream()
+	if err == nil {
+		err = io.EOF
+	}
+
+	select {
+	case <-t.done:
+	default:
+		t.CloseWithError(err)
+	}
+}
+
+func (t *httpClientTransport) readLegacyStream() error {
+	httpReq, err := t.newRequest(t.ctx, http.MethodGet, t.endpoint, nil)
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Accept", "text/event-stream")
+
+	httpResp, err := t.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return &httpStatusError{StatusCode: httpResp.StatusCode}
+	}
+
+	reader := newSSEReader(httpResp.Body)
+	for {
+		event, err := reader.ReadEvent()
+		if err != nil {
+			return err
+		}
+
+		switch event.Event {
+		case "endpoint":
+			select {
+			case <-t.endpointReady:
+				slog.Warn("ignored duplicate endpoint event", "endpoint", string(event.Data))
+				continue
+			default:
+			}
+
+			// The endpoint is relative to the URL of the stream
+			base, err := url.Parse(t.endpoint)
+			if err != nil {
+				return err
+			}
+			endpoint, err := base.Parse(string(event.Data))
+			if err != nil {
+				return fmt.Errorf("invalid endpoint event: %w", err)
+			}
+
+			t.messageEndpoint = endpoint.String()
+			close(t.endpointReady)
+		case "message":
+			t.readEventData(event.Data)
+		}
+	}
+}
+
+// httpStatusError is returned when the server answers an HTTP request with an unexpected status code.
+type httpStatusError struct {
+	StatusCode int
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("unexpected HTTP status code: %d", e.StatusCode)
+}
+
+// permanent reports whether retrying the same HTTP request is pointless.
+func (e *httpStatusError) permanent() bool {
+	return e.StatusCode >= 400 && e.StatusCode < 500 &&
+		e.StatusCode != http.StatusRequestTimeout && e.StatusCode != http.StatusTooManyRequests
 }
 
 func (t *httpClientTransport) listenSingleMessage(message map[string]json.RawMessage) {
@@ -443,67 +722,72 @@ func (t *httpClientTransport) listenSingleMessage(message map[string]json.RawMes
 	if hasID && hasMethod {
 		// It should be a request
 
-		// Check if params field is present
-		rawParams, hasParams := message["params"]
-		if !hasParams {
-			slog.Error("Missing params field for request")
+		var method Method
+		err := json.Unmarshal(rawMethod, &method)
+		if err != nil {
+			slog.Error("Invalid method", "method", string(rawMethod))
 			return
 		}
 
 		// Check if ID is valid
-		if string(id) == "" {
+		if len(id) == 0 || string(id) == "null" {
 			slog.Error("Invalid request ID", "id", id)
 			return
 		}
 
-		// Check if ID is already received
-		t.rceivedRequestsMapLock.RLock()
+		// Check if ID is already received and record it
+		t.rceivedRequestsMapLock.Lock()
 		if _, ok := t.rceivedRequestIDMap[ID(id)]; ok {
+			t.rceivedRequestsMapLock.Unlock()
 			slog.Error("Duplicate request ID", "id", id)
 			return
 		}
-		t.rceivedRequestsMapLock.RUnlock()
-
-		// Record received request ID
-		t.rceivedRequestsMapLock.Lock()
 		t.rceivedRequestIDMap[ID(id)] = struct{}{}
 		t.rceivedRequestsMapLock.Unlock()
 
 		// Push request to queue
-		t.receivedRequestQueue.Push(&Request{
-			Method: Method(rawMethod),
-			Params: Params(rawParams),
+		err = t.receivedRequestQueue.Push(context.Background(), receivedRequest{
+			req: &Request{
+				Method: method,
+				Params: Params(message["params"]),
+			},
+			w: &httpClientResponseWriter{t: t, id: ID(id)},
 		})
+		if err != nil {
+			slog.Error("failed to queue request", "id", id, "error", err)
+			if !errors.Is(err, ErrQueueFull) {
+				t.forgetReceivedRequest(ID(id))
+			}
+		}
 	} else if !hasID && hasMethod {
 		// It should be a notification
-		// Check if params field is present
-		rawParams, hasParams := message["params"]
-		if !hasParams {
-			slog.Error("Missing params field for request")
-			return
-		}
 
-		// Check if ID is valid
-		if string(id) == "" {
-			slog.Error("Invalid request ID", "id", id)
+		var method Method
+		err := json.Unmarshal(rawMethod, &method)
+		if err != nil {
+			slog.Error("Invalid method", "method", string(rawMethod))
 			return
 		}
 
 		// Queue notification
-		t.receivedNotificationsQueue.Push(&Notification{
-			Method: Method(rawMethod),
-			Params: Params(rawParams),
+		err = t.receivedNotificationsQueue.Push(context.Background(), &Notification{
+			Method: method,
+			Params: Params(message["params"]),
 		})
+		if err != nil {
+			slog.Error("failed to queue notification", "method", method, "error", err)
+		}
 	} else if hasID && !hasMethod {
 		// It should be a response
 
-		t.sentRequestIDMapLock.RLock()
+		t.sentRequestIDMapLock.Lock()
 		rspCh, ok := t.sentRequestMap[ID(id)]
+		delete(t.sentRequestMap, ID(id))
+		t.sentRequestIDMapLock.Unlock()
 		if !ok {
 			slog.Error("Unknown request ID", "id", id)
 			return
 		}
-		t.sentRequestIDMapLock.RUnlock()
 
 		rawResult, hasResult := message["result"]
 		rawError, hasError := message["error"]
@@ -512,26 +796,72 @@ func (t *httpClientTransport) listenSingleMessage(message map[string]json.RawMes
 			err := json.Unmarshal(rawError, &errObj)
 			if err != nil {
 				slog.Error("Failed to unmarshal error", "error", err)
-				return
+				errObj = *ErrParseError
 			}
 
 			rspCh <- &response{
+				id:     ID(id),
 				result: nil,
 				err:    &errObj,
 			}
-
-			close(rspCh)
 		} else if hasResult {
 			rspCh <- &response{
+				id:     ID(id),
 				result: Result(rawResult),
 				err:    nil,
 			}
-
-			close(rspCh)
+		} else {
+			slog.Error("Missing result and error fields for response", "id", id)
+			rspCh <- &response{
+				id:  ID(id),
+				err: errInvalidResponse,
+			}
 		}
-
 	} else {
 		slog.Error("Unknown message type")
 		return
 	}
 }
+
+// errInvalidResponse is returned for a response with neither a result nor an error.
+var errInvalidResponse = errors.New("invalid response without result or error")
+
+// forgetReceivedRequest removes the ID of a request once it is answered,
+// so that the IDs do not accumulate for the lifetime of the session.
+func (t *httpClientTransport) forgetReceivedRequest(id ID) {
+	t.rceivedRequestsMapLock.Lock()
+	defer t.rceivedRequestsMapLock.Unlock()
+
+	delete(t.rceivedRequestIDMap, id)
+}
+
+var _ ResponseWriter = (*httpClientResponseWriter)(nil)
+
+type httpClientResponseWriter struct {
+	t  *httpClientTransport
+	id ID
+}
+
+func (w *httpClientResponseWriter) ID() ID {
+	return w.id
+}
+
+func (w *httpClientResponseWriter) WriteResult(result Result) error {
+	defer w.t.forgetReceivedRequest(w.id)
+
+	return w.t.send(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      w.id,
+		"result":  result,
+	}, false)
+}
+
+func (w *httpClientResponseWriter) CloseWithError(code ErrorCode, msg string, data map[string]json.RawMessage) error {
+	defer w.t.forgetReceivedRequest(w.id)
+
+	return w.t.send(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      w.id,
+		"error":   newError(code, msg, data),
+	}, false)
+}
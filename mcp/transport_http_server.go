@@ -4,288 +4,906 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"io"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"sync"
-
-	"golang.org/x/exp/slog"
+	"sync/atomic"
+	"time"
 )
 
 var _ Transport = (*httpServerTransport)(nil)
 
-func newServerHTTPTransport() *httpServerTransport {
+// errNoStream is returned when the server sends a message while the client has no stream open to receive it.
+var errNoStream = errors.New("no stream is open to send messages to the client")
+
+// standaloneStreamID is the ID of the stream opened by GET requests, used to resume it.
+const standaloneStreamID = "standalone"
+
+// newServerHTTPTransport creates the server side of a session.
+// store may be nil, in which case SSE streams cannot be resumed.
+func newServerHTTPTransport(sessionID string, queueConfig QueueConfig, store EventStore) *httpServerTransport {
 	idGen := NewIDGenerator()
 	t := &httpServerTransport{
+		sessionID:                  sessionID,
 		generateIDFunc:             idGen.Generate,
 		sentRequestMap:             make(map[ID]chan *response),
-		rceivedRequestIDMap:        make(map[ID]http.ResponseWriter),
-		receivedRequestQueue:       newRequestsQueue(),
-		receivedNotificationsQueue: newNotificationsQueue(),
+		rceivedRequestIDMap:        make(map[ID]struct{}),
+		receivedRequestQueue:       newQueue(queueConfig, answerDiscardedRequest),
+		receivedNotificationsQueue: newQueue[*Notification](queueConfig, nil),
+		store:                      store,
+		standaloneStream:           newHTTPStream(standaloneStreamID, true, store),
+		postStreams:                make(map[string]*httpStream),
+		lastActive:                 time.Now(),
+		done:                       make(chan struct{}),
 	}
 
 	return t
 }
 
+// httpServerTransport is the server side of a session over the Streamable HTTP transport.
+// Messages from the client arrive in POST requests, and their responses are written to the same HTTP response.
+// Messages initiated by the server are written to the SSE stream opened by a GET request,
+// or to an SSE stream of a POST request in progress when the client has not opened one.
 type httpServerTransport struct {
+	sessionID string
+	// subject is the principal which initialized the session, empty without authorization
+	subject string
+
 	generateIDFunc func() ID
 
 	sentRequestMap       map[ID]chan *response
 	sentRequestIDMapLock sync.RWMutex
 
-	sseWriter  http.ResponseWriter
-	sseFlusher http.Flusher
-	wmu        sync.Mutex
+	// Events sent on SSE streams, kept for resumption
+	store EventStore
+
+	// Streams on which messages initiated by the server can be sent.
+	// SSE streams of POST requests are kept until all their requests are answered,
+	// so that a client can resume them after a disconnection.
+	standaloneStream *httpStream
+	postStreams      map[string]*httpStream
+	streamsLock      sync.Mutex
+	lastStreamID     atomic.Uint64
 
-	rceivedRequestIDMap    map[ID]http.ResponseWriter
+	rceivedRequestIDMap    map[ID]struct{}
 	rceivedRequestsMapLock sync.RWMutex
 
-	receivedRequestQueue       *requestsQueue
-	receivedNotificationsQueue *notificationsQueue
+	receivedRequestQueue       *queue[receivedRequest]
+	receivedNotificationsQueue *queue[*Notification]
 
+	// Number of HTTP requests of the session in progress, and the time the latest one ended,
+	// from which the session is idle
+	activeRequests int
+	lastActive     time.Time
+	activityMu     sync.Mutex
+
+	closeMu   sync.Mutex
 	closed    bool
 	closedErr error
+	done      chan struct{}
+}
+
+// startHTTPRequest records an HTTP request of the session in progress, until end is called.
+func (t *httpServerTransport) startHTTPRequest() (end func()) {
+	t.activityMu.Lock()
+	t.activeRequests++
+	t.activityMu.Unlock()
+
+	return func() {
+		t.activityMu.Lock()
+		t.activeRequests--
+		t.lastActive = time.Now()
+		t.activityMu.Unlock()
+	}
+}
+
+// idleSince returns the time since which the session has no HTTP request in progress.
+// ok is false if a request is in progress.
+func (t *httpServerTransport) idleSince() (since time.Time, ok bool) {
+	t.activityMu.Lock()
+	defer t.activityMu.Unlock()
+
+	return t.lastActive, t.activeRequests == 0
 }
 
 func (t *httpServerTransport) Close() error {
-	t.closed = true
-	return nil
+	return t.close(nil)
 }
 
 func (t *httpServerTransport) CloseWithError(err error) error {
-	t.closed = true
+	return t.close(err)
+}
 
-	t.wmu.Lock()
-	defer t.wmu.Unlock()
+func (t *httpServerTransport) Done() <-chan struct{} {
+	return t.done
+}
 
-	t.sseWriter.WriteHeader(http.StatusInternalServerError)
-	t.sseWriter.Write([]byte("event: error\ndata: " + err.Error() + "\n\n"))
-	t.sseFlusher.Flush()
+func (t *httpServerTransport) Err() error {
+	t.closeMu.Lock()
+	defer t.closeMu.Unlock()
 
-	t.closedErr = err
+	if !t.closed {
+		return nil
+	}
+	if t.closedErr != nil {
+		return t.closedErr
+	}
+	return ErrTransportClosed
+}
+
+// close terminates the session with the given cause.
+// Pending requests are answered with an error wrapping the cause,
+// and HTTP requests waiting on the session are released.
+func (t *httpServerTransport) close(cause error) error {
+	t.closeMu.Lock()
+	defer t.closeMu.Unlock()
+
+	if t.closed {
+		if t.closedErr != nil {
+			return fmt.Errorf("transport is already closed: %w", t.closedErr)
+		}
+		return errors.New("transport is already closed")
+	}
+
+	t.closed = true
+	t.closedErr = cause
+	close(t.done)
+
+	// Messages already received are kept, so that they can still be accepted
+	t.receivedRequestQueue.Close()
+	t.receivedNotificationsQueue.Close()
+
+	// Fail all requests waiting for a response
+	if cause == nil {
+		cause = ErrTransportClosed
+	}
+	t.sentRequestIDMapLock.Lock()
+	for id, rspCh := range t.sentRequestMap {
+		rspCh <- &response{
+			id:  id,
+			err: fmt.Errorf("transport closed before response: %w", cause),
+		}
+		delete(t.sentRequestMap, id)
+	}
+	t.sentRequestIDMapLock.Unlock()
 
 	return nil
 }
 
 func (t *httpServerTransport) Request(req *Request) (ResponseReader, error) {
 	id := t.generateIDFunc()
+	rspCh := make(chan *response, 1)
+
+	t.sentRequestIDMapLock.Lock()
 	if _, ok := t.sentRequestMap[id]; ok {
+		t.sentRequestIDMapLock.Unlock()
 		panic("ID is already used")
 	}
-
-	rspCh := make(chan *response)
-
-	t.sentRequestIDMapLock.Lock()
 	t.sentRequestMap[id] = rspCh
 	t.sentRequestIDMapLock.Unlock()
 
-	jsonrpcReq := map[string]any{
+	req.beforeSend(id)
+	err := t.send(map[string]any{
 		"jsonrpc": "2.0",
 		"method":  req.Method,
 		"params":  req.Params,
 		"id":      id,
-	}
-
-	t.wmu.Lock()
-
-	err := json.NewEncoder(t.sseWriter).Encode(jsonrpcReq)
-	t.sseFlusher.Flush()
-	t.wmu.Unlock()
+	})
 	if err != nil {
+		t.sentRequestIDMapLock.Lock()
+		delete(t.sentRequestMap, id)
+		t.sentRequestIDMapLock.Unlock()
 		return nil, err
 	}
 
-	return &asyncResponseReader{ch: rspCh}, nil
+	return &asyncResponseReader{id: id, ch: rspCh}, nil
 }
 
 func (t *httpServerTransport) RequestSync(ctx context.Context, req *Request) (ResponseReader, error) {
-	id := t.generateIDFunc()
-	if _, ok := t.sentRequestMap[id]; ok {
-		panic("ID is already used")
+	rsp, err := t.Request(req)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := rsp.ReadResultContext(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	rspCh := make(chan *response)
+	return &response{id: rsp.ID(), result: result}, nil
+}
+
+func (t *httpServerTransport) RequestBatch(reqs []*Request) ([]ResponseReader, error) {
+	messages := make([]map[string]any, 0, len(reqs))
+	readers := make([]ResponseReader, 0, len(reqs))
+	ids := make([]ID, 0, len(reqs))
 
 	t.sentRequestIDMapLock.Lock()
-	t.sentRequestMap[id] = rspCh
+	for _, req := range reqs {
+		id := t.generateIDFunc()
+		rspCh := make(chan *response, 1)
+		t.sentRequestMap[id] = rspCh
+		ids = append(ids, id)
+
+		messages = append(messages, map[string]any{
+			"jsonrpc": "2.0",
+			"method":  req.Method,
+			"params":  req.Params,
+			"id":      id,
+		})
+		readers = append(readers, &asyncResponseReader{id: id, ch: rspCh})
+	}
 	t.sentRequestIDMapLock.Unlock()
 
-	jsonrpcReq := map[string]any{
+	for i, req := range reqs {
+		req.beforeSend(ids[i])
+	}
+	err := t.send(messages)
+	if err != nil {
+		t.sentRequestIDMapLock.Lock()
+		for _, id := range ids {
+			delete(t.sentRequestMap, id)
+		}
+		t.sentRequestIDMapLock.Unlock()
+		return nil, err
+	}
+
+	return readers, nil
+}
+
+func (t *httpServerTransport) Notify(notif *Notification) error {
+	return t.send(map[string]any{
 		"jsonrpc": "2.0",
-		"method":  req.Method,
-		"params":  req.Params,
-		"id":      id,
+		"method":  notif.Method,
+		"params":  notif.Params,
+	})
+}
+
+func (t *httpServerTransport) AcceptRequest(ctx context.Context) (*Request, ResponseWriter, error) {
+	r, err := t.receivedRequestQueue.Pop(ctx)
+	if err != nil {
+		if errors.Is(err, errQueueClosed) {
+			return nil, nil, t.Err()
+		}
+		return nil, nil, err
 	}
 
-	t.wmu.Lock()
-	err := json.NewEncoder(t.sseWriter).Encode(jsonrpcReq)
-	t.sseFlusher.Flush()
-	t.wmu.Unlock()
+	return r.req, r.w, nil
+}
 
+func (t *httpServerTransport) AcceptNotification(ctx context.Context) (*Notification, error) {
+	notif, err := t.receivedNotificationsQueue.Pop(ctx)
 	if err != nil {
+		if errors.Is(err, errQueueClosed) {
+			return nil, t.Err()
+		}
 		return nil, err
 	}
 
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	case rsp := <-rspCh:
-		return rsp, nil
+	return notif, nil
+}
+
+func (t *httpServerTransport) Stats() TransportStats {
+	return TransportStats{
+		Requests:      t.receivedRequestQueue.Stats(),
+		Notifications: t.receivedNotificationsQueue.Stats(),
 	}
 }
 
-func (t *httpServerTransport) Notify(notif *Notification) error {
-	return nil
+// send writes a message initiated by the server.
+// The standalone stream is preferred, as streams of POST requests end once their requests are answered.
+func (t *httpServerTransport) send(message any) error {
+	select {
+	case <-t.done:
+		return t.Err()
+	default:
+	}
+
+	stream := t.standaloneStream
+	if !stream.connected() {
+		stream = nil
+
+		t.streamsLock.Lock()
+		for _, s := range t.postStreams {
+			if s.connected() {
+				stream = s
+				break
+			}
+		}
+		t.streamsLock.Unlock()
+	}
+
+	if stream == nil {
+		return errNoStream
+	}
+
+	return stream.writeMessage(message)
 }
 
-func (t *httpServerTransport) AcceptRequest(ctx context.Context) (*Request, ResponseWriter, error) {
-	for {
-		if t.receivedRequestQueue.Len() > 0 {
-			return t.receivedRequestQueue.Pop(), nil, nil
+// servePost routes the messages received in a POST request and answers the requests among them.
+// If sse is true, responses are written as SSE events as soon as each of them is ready,
+// and the stream can also carry messages initiated by the server in the meantime.
+// Otherwise all responses are written at once as a JSON body.
+// It returns when all requests are answered, the HTTP request is canceled, or the session is closed.
+func (t *httpServerTransport) servePost(w http.ResponseWriter, r *http.Request, messages []json.RawMessage, batch bool, sse bool) {
+	end := t.startHTTPRequest()
+	defer end()
+
+	auth, _ := AuthInfoFromContext(r.Context())
+
+	n := 0
+	for _, raw := range messages {
+		if isRequestMessage(raw) {
+			n++
 		}
+	}
+
+	if n == 0 {
+		// Only notifications and responses, which are not answered
+		for _, raw := range messages {
+			var message map[string]json.RawMessage
+			err := json.Unmarshal(raw, &message)
+			if err != nil {
+				continue
+			}
+
+			t.readSingleMessage(message, nil, nil)
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	done := make(chan struct{})
+
+	var collector interface {
+		Writer(id ID) ResponseWriter
+		WriteError(id ID, err *Error) error
+	}
+	var stream *httpStream
+	if sse {
+		streamID := "post-" + strconv.FormatUint(t.lastStreamID.Add(1), 10)
+		stream = newHTTPStream(streamID, true, t.store)
+
+		t.streamsLock.Lock()
+		t.postStreams[streamID] = stream
+		t.streamsLock.Unlock()
+
+		// The stream is kept until all requests are answered, even if the client disconnects
+		go func() {
+			select {
+			case <-done:
+			case <-t.done:
+			}
 
-		select {
-		case <-ctx.Done():
-			return nil, nil, ctx.Err()
-		case <-t.receivedRequestQueue.Chan():
+			t.streamsLock.Lock()
+			delete(t.postStreams, streamID)
+			t.streamsLock.Unlock()
+		}()
+
+		writeSSEHeaders(w)
+		collector = &sseExchange{stream: stream, pending: n, done: done}
+	} else {
+		stream = newHTTPStream("", false, nil)
+
+		collector = newBatchWriter(n, func(responses []map[string]any) error {
+			defer close(done)
+
+			if batch {
+				return stream.writeMessage(responses)
+			}
+			return stream.writeMessage(responses[0])
+		})
+	}
+
+	detached := stream.attach(w)
+	defer stream.detach(detached)
+
+	for _, raw := range messages {
+		var message map[string]json.RawMessage
+		err := json.Unmarshal(raw, &message)
+		if err != nil {
+			collector.WriteError("", ErrInvalidRequest)
 			continue
 		}
+
+		id, errObj := t.readSingleMessage(message, collector.Writer, auth)
+		if errObj != nil {
+			collector.WriteError(id, errObj)
+		}
+	}
+
+	select {
+	case <-done:
+	case <-r.Context().Done():
+	case <-t.done:
+	case <-detached:
 	}
 }
 
-func (t *httpServerTransport) AcceptNotification(ctx context.Context) (*Notification, error) {
-	for {
-		if t.receivedNotificationsQueue.Len() > 0 {
-			return t.receivedNotificationsQueue.Pop(), nil
+// serveLegacyPost routes the messages received in a POST request of the legacy HTTP+SSE transport.
+// Responses are written to the standalone stream rather than to the HTTP response,
+// which is answered with 202 Accepted.
+func (t *httpServerTransport) serveLegacyPost(w http.ResponseWriter, r *http.Request, messages []json.RawMessage, batch bool) {
+	end := t.startHTTPRequest()
+	defer end()
+
+	auth, _ := AuthInfoFromContext(r.Context())
+
+	n := 0
+	for _, raw := range messages {
+		if isRequestMessage(raw) {
+			n++
 		}
+	}
 
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		case <-t.receivedNotificationsQueue.Chan():
+	var collector interface {
+		Writer(id ID) ResponseWriter
+		WriteError(id ID, err *Error) error
+	}
+	if batch {
+		collector = newBatchWriter(n, func(responses []map[string]any) error {
+			return t.standaloneStream.writeMessage(responses)
+		})
+	} else {
+		collector = &streamCollector{stream: t.standaloneStream}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+
+	for _, raw := range messages {
+		var message map[string]json.RawMessage
+		err := json.Unmarshal(raw, &message)
+		if err != nil {
+			collector.WriteError("", ErrInvalidRequest)
 			continue
 		}
+
+		id, errObj := t.readSingleMessage(message, collector.Writer, auth)
+		if errObj != nil {
+			collector.WriteError(id, errObj)
+		}
 	}
 }
 
-func (t *httpServerTransport) readMessages(w http.ResponseWriter, r io.ReadCloser) {
-	decoder := json.NewDecoder(r)
-	for {
-		// Read a message as single JSON object
-		var message map[string]json.RawMessage
-		err := decoder.Decode(&message)
-		if err == nil {
-			t.readSingleMessage(w, message)
-			continue
+// serveStream serves an SSE stream opened by a GET request
+// until the client disconnects or the session is closed.
+// Without the Last-Event-ID header, it is the standalone stream carrying messages initiated by the server,
+// and a new one replaces the previous one.
+// With the header, the events sent after that event on its stream are replayed first,
+// and the stream is then resumed on this request if it is still in progress.
+func (t *httpServerTransport) serveStream(w http.ResponseWriter, r *http.Request) {
+	end := t.startHTTPRequest()
+	defer end()
+
+	stream := t.standaloneStream
+
+	writeSSEHeaders(w)
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID != "" && t.store != nil {
+		rc := http.NewResponseController(w)
+		send := func(eventID string, message json.RawMessage) error {
+			lastEventID = eventID
+			err := writeSSEEvent(w, eventID, message)
+			if err != nil {
+				return err
+			}
+			return rc.Flush()
 		}
 
-		// Read a message as batch JSON object
-		var batch []map[string]json.RawMessage
-		err = decoder.Decode(&batch)
-		if err == nil {
-			for _, message := range batch {
-				t.readSingleMessage(w, message)
+		streamID, err := t.store.ReplayEventsAfter(lastEventID, send)
+		switch {
+		case errors.Is(err, ErrEventNotFound):
+			slog.Warn("cannot resume stream from unknown event", "session_id", t.sessionID, "last_event_id", lastEventID)
+		case err != nil:
+			slog.Error("failed to replay events", "session_id", t.sessionID, "error", err)
+			return
+		default:
+			stream = t.lookupStream(streamID)
+			if stream == nil {
+				// The stream has already ended, so nothing follows the replayed events
+				return
+			}
+
+			// Replay the events stored in the meantime and resume the stream atomically
+			detached, err := stream.resume(w, func() error {
+				_, err := t.store.ReplayEventsAfter(lastEventID, send)
+				return err
+			})
+			if err != nil {
+				slog.Error("failed to replay events", "session_id", t.sessionID, "error", err)
+				return
 			}
-			continue
+			defer stream.detach(detached)
+
+			select {
+			case <-r.Context().Done():
+			case <-t.done:
+			case <-detached:
+			}
+			return
 		}
+	}
 
-		err = errors.New("the message is neither single nor batch")
-		slog.Error("failed to decode message", "error", err)
+	detached := stream.attach(w)
+	defer stream.detach(detached)
+
+	select {
+	case <-r.Context().Done():
+	case <-t.done:
+	case <-detached:
 	}
 }
 
-func (t *httpServerTransport) readSingleMessage(w http.ResponseWriter, message map[string]json.RawMessage) {
+func (t *httpServerTransport) lookupStream(streamID string) *httpStream {
+	if streamID == standaloneStreamID {
+		return t.standaloneStream
+	}
+
+	t.streamsLock.Lock()
+	defer t.streamsLock.Unlock()
+
+	return t.postStreams[streamID]
+}
+
+// readSingleMessage routes a single message to the request queue, the notification queue,
+// or the request waiting for the response.
+// If the message is an invalid request, it returns the error to be answered with the request ID, if any.
+// newWriter may be nil if the message is known not to be a request.
+// auth is the principal authenticated by the HTTP request carrying the message, if any.
+func (t *httpServerTransport) readSingleMessage(message map[string]json.RawMessage, newWriter func(id ID) ResponseWriter, auth *AuthInfo) (ID, *Error) {
 	id, hasID := message["id"]
 	rawMethod, hasMethod := message["method"]
 	if hasID && hasMethod {
 		// It should be a request
 
-		// Check if params field is present
-		rawParams, hasParams := message["params"]
-		if !hasParams {
-			slog.Error("Missing params field for request")
-			return
-		}
-
 		// Check if ID is valid
-		if string(id) == "" {
+		if len(id) == 0 || string(id) == "null" {
 			slog.Error("Invalid request ID", "id", id)
-			return
+			return "", ErrInvalidRequest
 		}
 
-		// Check if ID is already received
-		t.rceivedRequestsMapLock.RLock()
-		if _, ok := t.rceivedRequestIDMap[ID(id)]; ok {
-			slog.Error("Duplicate request ID", "id", id)
-			return
+		var method Method
+		err := json.Unmarshal(rawMethod, &method)
+		if err != nil {
+			slog.Error("Invalid method", "method", string(rawMethod))
+			return ID(id), ErrInvalidRequest
 		}
-		t.rceivedRequestsMapLock.RUnlock()
 
-		// Record received request ID
+		// Check if ID is already received and record it
 		t.rceivedRequestsMapLock.Lock()
-		t.rceivedRequestIDMap[ID(id)] = w
+		if _, ok := t.rceivedRequestIDMap[ID(id)]; ok {
+			t.rceivedRequestsMapLock.Unlock()
+			slog.Error("Duplicate request ID", "id", id)
+			return ID(id), ErrInvalidRequest
+		}
+		t.rceivedRequestIDMap[ID(id)] = struct{}{}
 		t.rceivedRequestsMapLock.Unlock()
 
 		// Push request to queue
-		t.receivedRequestQueue.Push(&Request{
-			Method: Method(rawMethod),
-			Params: Params(rawParams),
+		err = t.receivedRequestQueue.Push(context.Background(), receivedRequest{
+			req: &Request{
+				Method:   method,
+				Params:   Params(message["params"]),
+				authInfo: auth,
+			},
+			w: newWriter(ID(id)),
 		})
+		if err != nil {
+			slog.Error("failed to queue request", "id", id, "error", err)
+			// A request rejected by the backpressure policy is already answered
+			if !errors.Is(err, ErrQueueFull) {
+				return ID(id), ErrInternalError
+			}
+		}
 	} else if !hasID && hasMethod {
 		// It should be a notification
-		// Check if params field is present
-		rawParams, hasParams := message["params"]
-		if !hasParams {
-			slog.Error("Missing params field for request")
-			return
-		}
 
-		// Check if ID is valid
-		if string(id) == "" {
-			slog.Error("Invalid request ID", "id", id)
-			return
+		var method Method
+		err := json.Unmarshal(rawMethod, &method)
+		if err != nil {
+			slog.Error("Invalid method", "method", string(rawMethod))
+			return "", nil
 		}
 
 		// Queue notification
-		t.receivedNotificationsQueue.Push(&Notification{
-			Method: Method(rawMethod),
-			Params: Params(rawParams),
+		err = t.receivedNotificationsQueue.Push(context.Background(), &Notification{
+			Method: method,
+			Params: Params(message["params"]),
 		})
+		if err != nil {
+			slog.Error("failed to queue notification", "method", method, "error", err)
+		}
 	} else if hasID && !hasMethod {
 		// It should be a response
-		t.sentRequestIDMapLock.RLock()
+
+		rawResult, hasResult := message["result"]
+		rawError, hasError := message["error"]
+		if !hasResult && !hasError {
+			slog.Error("Missing result and error fields for response", "id", id)
+			return ID(id), ErrInvalidRequest
+		}
+
+		t.sentRequestIDMapLock.Lock()
 		rspCh, ok := t.sentRequestMap[ID(id)]
+		delete(t.sentRequestMap, ID(id))
+		t.sentRequestIDMapLock.Unlock()
 		if !ok {
 			slog.Error("Unknown request ID", "id", id)
-			return
+			return "", nil
 		}
-		t.sentRequestIDMapLock.RUnlock()
 
-		rawResult, hasResult := message["result"]
-		rawError, hasError := message["error"]
 		if hasError {
 			errObj := Error{}
 			err := json.Unmarshal(rawError, &errObj)
 			if err != nil {
 				slog.Error("Failed to unmarshal error", "error", err)
-				return
+				errObj = *ErrParseError
 			}
 
 			rspCh <- &response{
+				id:     ID(id),
 				result: nil,
 				err:    &errObj,
 			}
-
-			close(rspCh)
-		} else if hasResult {
+		} else {
 			rspCh <- &response{
+				id:     ID(id),
 				result: Result(rawResult),
 				err:    nil,
 			}
-
-			close(rspCh)
 		}
 	} else {
 		slog.Error("Unknown message type")
+		return "", ErrInvalidRequest
+	}
+
+	return "", nil
+}
+
+// httpStream is a logical stream of messages written to the body of HTTP responses,
+// either as SSE events or as a single JSON body.
+// An SSE stream outlives the HTTP response it is attached to:
+// while it is detached, messages are only stored in the event store, if any,
+// and they are replayed when the client resumes the stream on a new response.
+type httpStream struct {
+	id    string
+	sse   bool
+	store EventStore
+
+	mu sync.Mutex
+	w  http.ResponseWriter
+	rc *http.ResponseController
+	// detached is closed when the current response is detached from the stream
+	detached chan struct{}
+}
+
+func newHTTPStream(id string, sse bool, store EventStore) *httpStream {
+	return &httpStream{
+		id:    id,
+		sse:   sse,
+		store: store,
+	}
+}
+
+// attach makes the stream write to the response, detaching the previous one if any.
+// It returns a channel which is closed when the response is detached.
+// The response must be detached before the HTTP handler returns.
+func (s *httpStream) attach(w http.ResponseWriter) <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.attachLocked(w)
+}
+
+// resume calls replay and then attaches the response, without any message being written in between.
+func (s *httpStream) resume(w http.ResponseWriter, replay func() error) (<-chan struct{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := replay()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.attachLocked(w), nil
+}
+
+func (s *httpStream) attachLocked(w http.ResponseWriter) <-chan struct{} {
+	if s.detached != nil {
+		close(s.detached)
+	}
+
+	if !s.sse {
+		w.Header().Set("Content-Type", "application/json")
+	}
+
+	s.w = w
+	s.rc = http.NewResponseController(w)
+	s.detached = make(chan struct{})
+
+	return s.detached
+}
+
+// detach detaches the response attached when detached was returned, if it is still attached.
+func (s *httpStream) detach(detached <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.detached == nil || (<-chan struct{})(s.detached) != detached {
 		return
 	}
+
+	s.detachLocked()
+}
+
+func (s *httpStream) detachLocked() {
+	close(s.detached)
+	s.w = nil
+	s.rc = nil
+	s.detached = nil
+}
+
+func (s *httpStream) connected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.w != nil
+}
+
+// writeMessage writes a message to the attached response.
+// If the stream is detached, the message is only stored for resumption,
+// and an error is returned if there is no event store.
+func (s *httpStream) writeMessage(message any) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var eventID string
+	stored := false
+	if s.sse && s.store != nil {
+		eventID, err = s.store.StoreEvent(s.id, data)
+		if err != nil {
+			slog.Error("failed to store event", "stream_id", s.id, "error", err)
+		} else {
+			stored = true
+		}
+	}
+
+	if s.w == nil {
+		if stored {
+			return nil
+		}
+		return errors.New("HTTP stream is closed")
+	}
+
+	if s.sse {
+		err = writeSSEEvent(s.w, eventID, data)
+	} else {
+		_, err = s.w.Write(data)
+	}
+	if err == nil {
+		err = s.rc.Flush()
+	}
+	if err != nil {
+		// The client will resume the stream if the message is stored
+		s.detachLocked()
+		if stored {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+// writeSSEHeaders starts an SSE response.
+func writeSSEHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	http.NewResponseController(w).Flush()
+}
+
+// sseExchange writes the responses to the requests of a POST request to its SSE stream
+// as soon as each of them is ready. done is closed once all of them are written.
+type sseExchange struct {
+	stream *httpStream
+
+	mu      sync.Mutex
+	pending int
+	done    chan struct{}
+}
+
+func (e *sseExchange) Writer(id ID) ResponseWriter {
+	return &sseResponseWriter{write: e.add, id: id}
+}
+
+// WriteError writes an error response for a message which is not a valid request.
+func (e *sseExchange) WriteError(id ID, err *Error) error {
+	message := map[string]any{
+		"jsonrpc": "2.0",
+		"id":      nil,
+		"error":   err,
+	}
+	if id != "" {
+		message["id"] = id
+	}
+	return e.add(message)
+}
+
+func (e *sseExchange) add(message map[string]any) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.pending <= 0 {
+		return errors.New("all responses in the exchange are already written")
+	}
+
+	err := e.stream.writeMessage(message)
+
+	e.pending--
+	if e.pending == 0 {
+		close(e.done)
+	}
+
+	return err
+}
+
+// streamCollector writes each response to the stream independently.
+type streamCollector struct {
+	stream *httpStream
+}
+
+func (c *streamCollector) Writer(id ID) ResponseWriter {
+	write := func(message map[string]any) error {
+		return c.stream.writeMessage(message)
+	}
+	return &sseResponseWriter{write: write, id: id}
+}
+
+func (c *streamCollector) WriteError(id ID, err *Error) error {
+	message := map[string]any{
+		"jsonrpc": "2.0",
+		"id":      nil,
+		"error":   err,
+	}
+	if id != "" {
+		message["id"] = id
+	}
+	return c.stream.writeMessage(message)
+}
+
+var _ ResponseWriter = (*sseResponseWriter)(nil)
+
+type sseResponseWriter struct {
+	write func(message map[string]any) error
+	id    ID
+}
+
+func (w *sseResponseWriter) ID() ID {
+	return w.id
+}
+
+func (w *sseResponseWriter) WriteResult(result Result) error {
+	return w.write(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      w.id,
+		"result":  result,
+	})
+}
+
+func (w *sseResponseWriter) CloseWithError(code ErrorCode, msg string, data map[string]json.RawMessage) error {
+	return w.write(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      w.id,
+		"error":   newError(code, msg, data),
+	})
 }
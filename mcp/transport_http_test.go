@@ -0,0 +1,190 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPClientTransport_ListenMessages_Reconnect(t *testing.T) {
+	var mu sync.Mutex
+	var lastEventIDs []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		mu.Lock()
+		lastEventIDs = append(lastEventIDs, r.Header.Get("Last-Event-ID"))
+		n := len(lastEventIDs)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "id: %d\nevent: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/%d\"}\n\n", n, n)
+		w.(http.Flusher).Flush()
+
+		if n > 1 {
+			// Keep the second stream open
+			<-r.Context().Done()
+		}
+		// The first stream drops after a single event
+	}))
+	t.Cleanup(ts.Close)
+
+	transport := newClientHTTPTransport(ts.URL, &HTTPConfig{RetryDelay: 10 * time.Millisecond})
+	t.Cleanup(func() { transport.Close() })
+
+	// The stream is opened once the initialization is complete
+	require.NoError(t, transport.Notify(&Notification{Method: MethodNotifyInitialized}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var methods []Method
+	for range 2 {
+		notif, err := transport.AcceptNotification(ctx)
+		require.NoError(t, err)
+		methods = append(methods, notif.Method)
+	}
+
+	assert.Equal(t, []Method{"notifications/1", "notifications/2"}, methods, "events from both streams should be received")
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"", "1"}, lastEventIDs, "reconnection should resume after the last event")
+}
+
+func TestHTTPClientTransport_InvalidResponse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			ID ID `json:"id"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		// The response has neither a result nor an error
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": req.ID})
+	}))
+	t.Cleanup(ts.Close)
+
+	transport := newClientHTTPTransport(ts.URL, nil)
+	t.Cleanup(func() { transport.Close() })
+
+	rsp, err := transport.Request(&Request{Method: MethodListTools})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = rsp.ReadResultContext(ctx)
+	assert.ErrorIs(t, err, errInvalidResponse, "the reader should not wait forever")
+}
+
+func TestClient_DialHTTP_Unauthorized(t *testing.T) {
+	var mu sync.Mutex
+	methods := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		methods[r.Method]++
+		mu.Unlock()
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	t.Cleanup(ts.Close)
+
+	_, err := NewClient("test-client", "0.0.1").DialHTTP(ts.URL, nil)
+	var statusErr *httpStatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusUnauthorized, statusErr.StatusCode)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Zero(t, methods[http.MethodGet], "client should not fall back to the HTTP+SSE transport")
+}
+
+func TestClient_DialHTTP(t *testing.T) {
+	tests := map[string]struct {
+		jsonResponse bool
+	}{
+		"server answers with SSE streams": {jsonResponse: false},
+		"server answers with JSON bodies": {jsonResponse: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := NewServer("test-server", "0.0.1")
+			server.Handler = newTestServerMux()
+			server.HTTPConfig = &HTTPServerConfig{JSONResponse: tc.jsonResponse}
+			t.Cleanup(func() { server.Close() })
+
+			type record struct {
+				method    string
+				sessionID string
+				custom    string
+			}
+			var mu sync.Mutex
+			var records []record
+
+			handler := server.HTTPHandler()
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				records = append(records, record{
+					method:    r.Method,
+					sessionID: r.Header.Get(SessionIDHeader),
+					custom:    r.Header.Get("X-Custom"),
+				})
+				mu.Unlock()
+
+				handler.ServeHTTP(w, r)
+			}))
+			t.Cleanup(ts.Close)
+
+			sess, err := NewClient("test-client", "0.0.1").DialHTTP(ts.URL, &HTTPConfig{
+				Headers: http.Header{"X-Custom": {"value"}},
+			})
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			results, err := sess.Batch(ctx, &Request{Method: MethodListTools}, &Request{Method: "unknown/method"})
+			require.NoError(t, err)
+			require.Len(t, results, 2)
+			assert.NoError(t, results[0].Err)
+			assert.ErrorIs(t, results[1].Err, ErrMethodNotFound)
+
+			require.NoError(t, sess.Close())
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			require.NotEmpty(t, records)
+			assert.Empty(t, records[0].sessionID, "initialize request should not carry a session ID")
+			sessionID := records[1].sessionID
+			assert.NotEmpty(t, sessionID, "session ID should be captured from the initialize response")
+			for _, r := range records {
+				assert.Equal(t, "value", r.custom, "configured headers should be sent with every request")
+			}
+			// The SSE stream may be opened concurrently with the other requests, so only the set of requests is checked
+			methods := make(map[string]int)
+			for _, r := range records[1:] {
+				assert.Equal(t, sessionID, r.sessionID, "session ID should be sent with every request")
+				methods[r.method]++
+			}
+			assert.Equal(t, 1, methods[http.MethodDelete], "session should be terminated on close")
+		})
+	}
+}
@@ -0,0 +1,374 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+)
+
+// MemoryConfig configures a pair of in-memory transports.
+type MemoryConfig struct {
+	// If true, the parameters and results of every message are encoded to JSON and decoded again
+	// when they are passed to the peer, as they would be by a transport over a connection,
+	// so that invalid JSON is reported as it would be on the wire.
+	// Otherwise they are passed to the peer as they are.
+	RoundTripJSON bool
+
+	// Configuration of the queues holding received requests and notifications until they are accepted
+	Queue QueueConfig
+}
+
+func (c *MemoryConfig) roundTripJSON() bool {
+	return c != nil && c.RoundTripJSON
+}
+
+func (c *MemoryConfig) queueConfig() QueueConfig {
+	if c == nil {
+		return QueueConfig{}
+	}
+	return c.Queue
+}
+
+// NewInMemoryTransports returns a pair of connected transports passing messages to each other in memory,
+// for a client and a server running in the same process.
+// Closing either transport closes its peer with io.EOF.
+func NewInMemoryTransports() (client, server Transport) {
+	return NewInMemoryTransportsWithConfig(nil)
+}
+
+func NewInMemoryTransportsWithConfig(config *MemoryConfig) (client, server Transport) {
+	c := newMemoryTransport(config)
+	s := newMemoryTransport(config)
+	c.peer = s
+	s.peer = c
+
+	return c, s
+}
+
+func newMemoryTransport(config *MemoryConfig) *memoryTransport {
+	queueConfig := config.queueConfig()
+
+	return &memoryTransport{
+		roundTripJSON:              config.roundTripJSON(),
+		idGenerator:                NewIDGenerator(),
+		sentRequestMap:             make(map[ID]chan *response),
+		receivedRequestQueue:       newQueue(queueConfig, answerDiscardedRequest),
+		receivedNotificationsQueue: newQueue[*Notification](queueConfig, nil),
+		done:                       make(chan struct{}),
+	}
+}
+
+var _ Transport = (*memoryTransport)(nil)
+var _ StatsReporter = (*memoryTransport)(nil)
+
+type memoryTransport struct {
+	peer          *memoryTransport
+	roundTripJSON bool
+
+	idGenerator          IDGenerator
+	sentRequestMap       map[ID]chan *response
+	sentRequestIDMapLock sync.Mutex
+
+	receivedRequestQueue       *queue[receivedRequest]
+	receivedNotificationsQueue *queue[*Notification]
+
+	closeMu   sync.Mutex
+	closed    bool
+	closedErr error
+	done      chan struct{}
+}
+
+func (t *memoryTransport) Request(req *Request) (ResponseReader, error) {
+	params, err := t.transfer(json.RawMessage(req.Params))
+	if err != nil {
+		return nil, err
+	}
+
+	id := t.idGenerator.Generate()
+	rspCh := make(chan *response, 1)
+
+	// The transport is checked under the lock, so that a request is either failed by close or refused here
+	t.sentRequestIDMapLock.Lock()
+	err = t.checkOpen()
+	if err != nil {
+		t.sentRequestIDMapLock.Unlock()
+		return nil, err
+	}
+	t.sentRequestMap[id] = rspCh
+	t.sentRequestIDMapLock.Unlock()
+
+	req.beforeSend(id)
+	err = t.peer.receivedRequestQueue.Push(context.Background(), receivedRequest{
+		req: &Request{
+			Method: req.Method,
+			Params: Params(params),
+		},
+		w: &memoryResponseWriter{t: t.peer, id: id},
+	})
+	if err != nil {
+		t.sentRequestIDMapLock.Lock()
+		delete(t.sentRequestMap, id)
+		t.sentRequestIDMapLock.Unlock()
+		return nil, fmt.Errorf("failed to deliver request: %w", t.peerErr(err))
+	}
+
+	return &asyncResponseReader{id: id, ch: rspCh}, nil
+}
+
+func (t *memoryTransport) RequestSync(ctx context.Context, req *Request) (ResponseReader, error) {
+	rsp, err := t.Request(req)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := rsp.ReadResultContext(ctx)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+
+	return &response{id: rsp.ID(), result: result, err: err}, nil
+}
+
+// RequestBatch sends the requests one by one, as there is no batch to frame in memory.
+func (t *memoryTransport) RequestBatch(reqs []*Request) ([]ResponseReader, error) {
+	readers := make([]ResponseReader, 0, len(reqs))
+	for _, req := range reqs {
+		rsp, err := t.Request(req)
+		if err != nil {
+			return nil, err
+		}
+		readers = append(readers, rsp)
+	}
+
+	return readers, nil
+}
+
+func (t *memoryTransport) Notify(notif *Notification) error {
+	err := t.checkOpen()
+	if err != nil {
+		return err
+	}
+
+	params, err := t.transfer(json.RawMessage(notif.Params))
+	if err != nil {
+		return err
+	}
+
+	err = t.peer.receivedNotificationsQueue.Push(context.Background(), &Notification{
+		Method: notif.Method,
+		Params: Params(params),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to deliver notification: %w", t.peerErr(err))
+	}
+
+	return nil
+}
+
+func (t *memoryTransport) AcceptRequest(ctx context.Context) (*Request, ResponseWriter, error) {
+	r, err := t.receivedRequestQueue.Pop(ctx)
+	if err != nil {
+		if errors.Is(err, errQueueClosed) {
+			return nil, nil, t.Err()
+		}
+		return nil, nil, err
+	}
+
+	return r.req, r.w, nil
+}
+
+func (t *memoryTransport) AcceptNotification(ctx context.Context) (*Notification, error) {
+	notif, err := t.receivedNotificationsQueue.Pop(ctx)
+	if err != nil {
+		if errors.Is(err, errQueueClosed) {
+			return nil, t.Err()
+		}
+		return nil, err
+	}
+
+	return notif, nil
+}
+
+func (t *memoryTransport) Stats() TransportStats {
+	return TransportStats{
+		Requests:      t.receivedRequestQueue.Stats(),
+		Notifications: t.receivedNotificationsQueue.Stats(),
+	}
+}
+
+func (t *memoryTransport) Close() error {
+	return t.close(nil)
+}
+
+func (t *memoryTransport) CloseWithError(err error) error {
+	return t.close(err)
+}
+
+func (t *memoryTransport) Done() <-chan struct{} {
+	return t.done
+}
+
+func (t *memoryTransport) Err() error {
+	t.closeMu.Lock()
+	defer t.closeMu.Unlock()
+
+	if !t.closed {
+		return nil
+	}
+	if t.closedErr != nil {
+		return t.closedErr
+	}
+	return ErrTransportClosed
+}
+
+// close terminates the transport with the given cause, and then its peer with io.EOF,
+// as the end of a connection is seen by the other side.
+func (t *memoryTransport) close(cause error) error {
+	t.closeMu.Lock()
+	if t.closed {
+		closedErr := t.closedErr
+		t.closeMu.Unlock()
+		if closedErr != nil {
+			return fmt.Errorf("transport is already closed: %w", closedErr)
+		}
+		return errors.New("transport is already closed")
+	}
+
+	t.closed = true
+	t.closedErr = cause
+	close(t.done)
+	t.closeMu.Unlock()
+
+	// Messages already received are kept, so that they can still be accepted
+	t.receivedRequestQueue.Close()
+	t.receivedNotificationsQueue.Close()
+
+	// Fail all requests waiting for a response
+	if cause == nil {
+		cause = ErrTransportClosed
+	}
+	t.sentRequestIDMapLock.Lock()
+	for id, rspCh := range t.sentRequestMap {
+		rspCh <- &response{
+			id:  id,
+			err: fmt.Errorf("transport closed before response: %w", cause),
+		}
+		delete(t.sentRequestMap, id)
+	}
+	t.sentRequestIDMapLock.Unlock()
+
+	t.peer.close(io.EOF)
+
+	return nil
+}
+
+func (t *memoryTransport) checkOpen() error {
+	err := t.Err()
+	if err != nil {
+		return fmt.Errorf("transport is closed: %w", err)
+	}
+	return nil
+}
+
+// peerErr reports a message which could not be queued by the peer because it is closed with its cause.
+func (t *memoryTransport) peerErr(err error) error {
+	if errors.Is(err, errQueueClosed) {
+		if cause := t.peer.Err(); cause != nil {
+			return cause
+		}
+	}
+	return err
+}
+
+// transfer returns the raw JSON of a message as it is received by the peer.
+func (t *memoryTransport) transfer(raw json.RawMessage) (json.RawMessage, error) {
+	if !t.roundTripJSON || len(raw) == 0 {
+		return raw, nil
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var received json.RawMessage
+	err = json.Unmarshal(data, &received)
+	if err != nil {
+		return nil, err
+	}
+
+	return received, nil
+}
+
+// respond passes a response to the request sent by this transport with the ID.
+func (t *memoryTransport) respond(rsp *response) {
+	t.sentRequestIDMapLock.Lock()
+	rspCh, ok := t.sentRequestMap[rsp.id]
+	delete(t.sentRequestMap, rsp.id)
+	t.sentRequestIDMapLock.Unlock()
+	if !ok {
+		slog.Error("Unknown request ID", "id", rsp.id)
+		return
+	}
+
+	rspCh <- rsp
+}
+
+var _ ResponseWriter = (*memoryResponseWriter)(nil)
+
+// memoryResponseWriter answers a request received by t from its peer.
+type memoryResponseWriter struct {
+	t  *memoryTransport
+	id ID
+}
+
+func (w *memoryResponseWriter) ID() ID {
+	return w.id
+}
+
+func (w *memoryResponseWriter) WriteResult(result Result) error {
+	err := w.t.checkOpen()
+	if err != nil {
+		return err
+	}
+
+	if len(result) == 0 {
+		result = Result("{}")
+	}
+	raw, err := w.t.transfer(json.RawMessage(result))
+	if err != nil {
+		return err
+	}
+
+	w.t.peer.respond(&response{id: w.id, result: Result(raw)})
+
+	return nil
+}
+
+func (w *memoryResponseWriter) CloseWithError(code ErrorCode, msg string, data map[string]json.RawMessage) error {
+	err := w.t.checkOpen()
+	if err != nil {
+		return err
+	}
+
+	errObj := newError(code, msg, data)
+	if w.t.roundTripJSON {
+		raw, err := json.Marshal(errObj)
+		if err != nil {
+			return err
+		}
+		errObj = &Error{}
+		err = json.Unmarshal(raw, errObj)
+		if err != nil {
+			return err
+		}
+	}
+
+	w.t.peer.respond(&response{id: w.id, err: errObj})
+
+	return nil
+}
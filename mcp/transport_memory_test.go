@@ -0,0 +1,94 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewInMemoryTransports(t *testing.T) {
+	// dial connects a client to a server with a single tool over in-memory transports
+	dial := func(t *testing.T, config *MemoryConfig) (ClientSession, Transport) {
+		t.Helper()
+
+		mux := NewServerMux()
+		mux.HandleTool(&ToolDefinition{Name: "echo"}, ToolHandlerFunc(func(w ContentsWriter, name string, args map[string]any) {
+			w.WriteContents([]Content{})
+		}))
+		server := NewServer("test-server", "0.0.1")
+		server.Handler = mux
+
+		clientT, serverT := NewInMemoryTransportsWithConfig(config)
+		go server.Accept(serverT)
+
+		sess, err := NewClient("test-client", "0.0.1").Dial(clientT)
+		require.NoError(t, err)
+		t.Cleanup(func() { sess.Close() })
+
+		return sess, serverT
+	}
+
+	t.Run("client and server exchange messages", func(t *testing.T) {
+		sess, _ := dial(t, nil)
+
+		results, err := sess.Batch(context.Background(), &Request{Method: MethodListTools})
+		require.NoError(t, err)
+		require.NoError(t, results[0].Err)
+
+		var result struct {
+			Tools []struct {
+				Name string `json:"name"`
+			} `json:"tools"`
+		}
+		require.NoError(t, json.Unmarshal(results[0].Result, &result))
+		require.Len(t, result.Tools, 1)
+		assert.Equal(t, "echo", result.Tools[0].Name)
+
+		results, err = sess.Batch(context.Background(), &Request{Method: "unknown/method"})
+		require.NoError(t, err)
+		assert.ErrorIs(t, results[0].Err, ErrMethodNotFound)
+	})
+
+	t.Run("invalid JSON is passed as is without round trip", func(t *testing.T) {
+		sess, _ := dial(t, nil)
+
+		results, err := sess.Batch(context.Background(), &Request{
+			Method: MethodCallTool,
+			Params: Params(`{"name": unquoted}`),
+		})
+		require.NoError(t, err)
+		assert.ErrorIs(t, results[0].Err, ErrInvalidParams, "the server should fail to decode the params")
+	})
+
+	t.Run("invalid JSON is refused with round trip", func(t *testing.T) {
+		sess, _ := dial(t, &MemoryConfig{RoundTripJSON: true})
+
+		_, err := sess.Batch(context.Background(), &Request{
+			Method: MethodCallTool,
+			Params: Params(`{"name": unquoted}`),
+		})
+		var syntaxErr *json.SyntaxError
+		assert.ErrorAs(t, err, &syntaxErr)
+	})
+
+	t.Run("closing a transport closes its peer", func(t *testing.T) {
+		sess, serverT := dial(t, nil)
+
+		require.NoError(t, sess.Close())
+
+		select {
+		case <-serverT.Done():
+		case <-time.After(time.Second):
+			t.Fatal("server transport should be closed")
+		}
+		assert.ErrorIs(t, serverT.Err(), io.EOF)
+
+		_, err := serverT.Request(&Request{Method: MethodListRoots})
+		assert.ErrorIs(t, err, io.EOF)
+	})
+}
@@ -0,0 +1,188 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// NewProcessTransport starts the server process and returns a transport over its standard input and output,
+// for connecting to the server without a Client, as a proxy does. command.Restart is ignored.
+// Closing the transport terminates the process.
+func NewProcessTransport(command *StdioCommand) (Transport, error) {
+	return startProcess(command)
+}
+
+// startProcess starts the command and returns a transport over its standard input and output.
+// The transport is closed with the exit status of the process when it exits,
+// and closing the transport terminates the process.
+func startProcess(command *StdioCommand) (*streamTransport, error) {
+	cmd := exec.Command(command.Path, command.Args...)
+	cmd.Env = command.Env
+	cmd.Dir = command.Dir
+	setProcessGroup(cmd)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	// The read end of stdout is owned by the transport, so that Wait does not close it before all messages are read
+	stdout, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdout = stdoutWriter
+
+	var lines *lineWriter
+	switch {
+	case command.OnStderrLine != nil:
+		lines = &lineWriter{fn: command.OnStderrLine}
+		if command.Stderr != nil {
+			cmd.Stderr = io.MultiWriter(command.Stderr, lines)
+		} else {
+			cmd.Stderr = lines
+		}
+	case command.Stderr != nil:
+		cmd.Stderr = command.Stderr
+	default:
+		cmd.Stderr = os.Stderr
+	}
+
+	err = cmd.Start()
+	stdoutWriter.Close()
+	if err != nil {
+		stdin.Close()
+		stdout.Close()
+		return nil, err
+	}
+
+	conn := &processConn{
+		lineConn: lineConn{
+			w:       stdin,
+			r:       stdout,
+			reader:  bufio.NewReader(stdout),
+			maxSize: command.Stream.maxMessageSize(),
+		},
+		process:            cmd.Process,
+		terminationTimeout: command.terminationTimeout(),
+		exited:             make(chan struct{}),
+	}
+
+	go func() {
+		conn.exitErr = cmd.Wait()
+		if lines != nil {
+			lines.flush()
+		}
+		close(conn.exited)
+	}()
+
+	return newMessageTransport(conn, command.Stream.queueConfig()), nil
+}
+
+var _ messageConn = (*processConn)(nil)
+
+// processConn frames messages as newline-delimited JSON over the standard input and output of a process.
+type processConn struct {
+	lineConn
+
+	process            *os.Process
+	terminationTimeout time.Duration
+
+	closeOnce sync.Once
+
+	// exitErr is the result of waiting for the process, set before exited is closed
+	exitErr error
+	exited  chan struct{}
+}
+
+// ReadMessage reads the next message from the standard output.
+// When the output ends, it waits for the process to exit and reports its exit status.
+func (c *processConn) ReadMessage() ([]byte, error) {
+	data, err := c.lineConn.ReadMessage()
+	if err == nil || !isClosedStreamError(err) {
+		return data, err
+	}
+
+	<-c.exited
+	if c.exitErr != nil {
+		return data, fmt.Errorf("server process exited: %w", c.exitErr)
+	}
+	return data, io.EOF
+}
+
+// Close terminates the process gracefully:
+// its standard input is closed, then its process group is sent SIGTERM and finally killed if it does not exit in time.
+// The processes left in the group, such as those started by a shell, are killed once it exits.
+// It is called by the transport without holding its locks, as it may wait for the termination timeout twice.
+func (c *processConn) Close(cause error) error {
+	c.closeOnce.Do(func() {
+		c.w.Close()
+
+		if !c.waitExit() {
+			err := signalProcessGroup(c.process, syscall.SIGTERM)
+			if err != nil || !c.waitExit() {
+				// SIGTERM is not supported on Windows
+				signalProcessGroup(c.process, syscall.SIGKILL)
+				<-c.exited
+			}
+		}
+		signalProcessGroup(c.process, syscall.SIGKILL)
+
+		c.r.Close()
+	})
+	return nil
+}
+
+// waitExit waits for the process to exit within the termination timeout.
+func (c *processConn) waitExit() bool {
+	timer := time.NewTimer(c.terminationTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-c.exited:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// lineWriter calls fn with each line written to it.
+type lineWriter struct {
+	mu  sync.Mutex
+	buf []byte
+	fn  func(line string)
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.fn(string(bytes.TrimSuffix(w.buf[:i], []byte("\r"))))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush calls fn with the last line if it does not end with a newline.
+func (w *lineWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) > 0 {
+		w.fn(string(w.buf))
+		w.buf = nil
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !unix
+
+package mcp
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup does nothing, as process groups are not supported.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// signalProcessGroup sends the signal to the process only, as process groups are not supported.
+// Only SIGKILL is supported on Windows.
+func signalProcessGroup(process *os.Process, sig syscall.Signal) error {
+	if sig == syscall.SIGKILL {
+		return process.Kill()
+	}
+	return process.Signal(sig)
+}
@@ -0,0 +1,182 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHelperStdioServer is not a test, but the server process started by the tests of DialStdioCommand.
+func TestHelperStdioServer(t *testing.T) {
+	mode := os.Getenv("MCP_HELPER_MODE")
+	if mode == "" {
+		t.Skip("helper process")
+	}
+
+	fmt.Fprintln(os.Stderr, "started", os.Getenv("MCP_HELPER_VALUE"))
+	if mode == "ignore-sigterm" {
+		signal.Ignore(syscall.SIGTERM)
+	}
+	if mode == "grandchild" {
+		// The grandchild keeps the standard error open after the server exits
+		grandchild := exec.Command("sleep", "60")
+		grandchild.Stderr = os.Stderr
+		if err := grandchild.Start(); err != nil {
+			os.Exit(1)
+		}
+	}
+
+	mux := NewServerMux()
+	mux.HandleTool(&ToolDefinition{Name: "crash"}, ToolHandlerFunc(func(w ContentsWriter, name string, args map[string]any) {
+		os.Exit(3)
+	}))
+
+	server := NewServer("helper-server", "0.0.1")
+	server.Handler = mux
+	sess, err := server.AcceptStream(os.Stdout, os.Stdin)
+	if err != nil {
+		os.Exit(1)
+	}
+
+	<-sess.Done()
+	if mode == "ignore-sigterm" {
+		select {}
+	}
+	os.Exit(0)
+}
+
+func helperCommand(mode string) *StdioCommand {
+	return &StdioCommand{
+		Path: os.Args[0],
+		Args: []string{"-test.run=^TestHelperStdioServer$"},
+		// The race detector otherwise delays the exit of the process by a second
+		Env: append(os.Environ(), "MCP_HELPER_MODE="+mode, "MCP_HELPER_VALUE=from-env", "GORACE=atexit_sleep_ms=0"),
+	}
+}
+
+func callCrash(t *testing.T, sess ClientSession) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	sess.Batch(ctx, &Request{Method: MethodCallTool, Params: Params(`{"name":"crash"}`)})
+}
+
+func TestClient_DialStdioCommand(t *testing.T) {
+	t.Run("stderr lines are reported with the configured environment", func(t *testing.T) {
+		lines := make(chan string, 10)
+		command := helperCommand("serve")
+		command.OnStderrLine = func(line string) { lines <- line }
+
+		sess, err := NewClient("test-client", "0.0.1").DialStdioCommand(command)
+		require.NoError(t, err)
+		defer sess.Close()
+
+		select {
+		case line := <-lines:
+			assert.Equal(t, "started from-env", line)
+		case <-time.After(time.Second):
+			t.Fatal("stderr line should be reported")
+		}
+	})
+
+	t.Run("exit status of the process ends the session", func(t *testing.T) {
+		sess, err := NewClient("test-client", "0.0.1").DialStdioCommand(helperCommand("serve"))
+		require.NoError(t, err)
+		defer sess.Close()
+
+		callCrash(t, sess)
+
+		select {
+		case <-sess.Done():
+		case <-time.After(time.Second):
+			t.Fatal("session should end when the process exits")
+		}
+
+		var exitErr *exec.ExitError
+		require.ErrorAs(t, sess.Err(), &exitErr)
+		assert.Equal(t, 3, exitErr.ExitCode())
+	})
+
+	t.Run("process ignoring SIGTERM is killed on close", func(t *testing.T) {
+		command := helperCommand("ignore-sigterm")
+		command.TerminationTimeout = 50 * time.Millisecond
+
+		sess, err := NewClient("test-client", "0.0.1").DialStdioCommand(command)
+		require.NoError(t, err)
+
+		start := time.Now()
+		require.NoError(t, sess.Close())
+		assert.Less(t, time.Since(start), time.Second, "process should be killed after the termination timeout")
+	})
+
+	t.Run("children of the process are killed on close", func(t *testing.T) {
+		command := helperCommand("grandchild")
+		command.TerminationTimeout = 50 * time.Millisecond
+		command.OnStderrLine = func(line string) {}
+
+		sess, err := NewClient("test-client", "0.0.1").DialStdioCommand(command)
+		require.NoError(t, err)
+
+		closed := make(chan struct{})
+		go func() {
+			sess.Close()
+			close(closed)
+		}()
+
+		select {
+		case <-closed:
+		case <-time.After(2 * time.Second):
+			t.Fatal("close should kill the grandchild holding the standard error")
+		}
+	})
+
+	t.Run("process is restarted after it exits", func(t *testing.T) {
+		var mu sync.Mutex
+		starts := 0
+		restarted := make(chan struct{}, 1)
+
+		command := helperCommand("serve")
+		command.Restart = &ReconnectConfig{InitialBackoff: 10 * time.Millisecond}
+		command.OnStderrLine = func(line string) {
+			mu.Lock()
+			defer mu.Unlock()
+			starts++
+			if starts == 2 {
+				restarted <- struct{}{}
+			}
+		}
+
+		sess, err := NewClient("test-client", "0.0.1").DialStdioCommand(command)
+		require.NoError(t, err)
+		defer sess.Close()
+
+		callCrash(t, sess)
+
+		select {
+		case <-restarted:
+		case <-time.After(2 * time.Second):
+			t.Fatal("process should be restarted")
+		}
+
+		// The restarted session serves requests
+		require.Eventually(t, func() bool {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			results, err := sess.Batch(ctx, &Request{Method: MethodListTools})
+			return err == nil && results[0].Err == nil
+		}, 2*time.Second, 10*time.Millisecond)
+
+		require.NoError(t, sess.Close())
+		<-sess.Done()
+		assert.True(t, errors.Is(sess.Err(), ErrTransportClosed))
+	})
+}
@@ -0,0 +1,294 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Direction tells whether a recorded message was received or sent by the recording transport.
+type Direction string
+
+const (
+	// Inbound messages were received from the peer.
+	Inbound Direction = "in"
+	// Outbound messages were sent to the peer.
+	Outbound Direction = "out"
+)
+
+// RecordedMessage is a JSON-RPC message recorded by a transport returned by NewRecordingTransport.
+// A recording is written as JSON lines, one RecordedMessage per line.
+type RecordedMessage struct {
+	Time      time.Time       `json:"time"`
+	Direction Direction       `json:"direction"`
+	Message   json.RawMessage `json:"message"`
+}
+
+// ReadRecording reads a recording written by a recording transport.
+func ReadRecording(r io.Reader) ([]RecordedMessage, error) {
+	var records []RecordedMessage
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, DefaultMaxMessageSize)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record RecordedMessage
+		err := json.Unmarshal(scanner.Bytes(), &record)
+		if err != nil {
+			return nil, fmt.Errorf("invalid record at line %d: %w", line, err)
+		}
+		if record.Direction != Inbound && record.Direction != Outbound {
+			return nil, fmt.Errorf("invalid record at line %d: unknown direction %q", line, record.Direction)
+		}
+
+		records = append(records, record)
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// jsonrpcMessage is the JSON-RPC representation of a request, a notification or a response.
+type jsonrpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *ID             `json:"id,omitempty"`
+	Method  Method          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+func (m *jsonrpcMessage) isRequest() bool {
+	return m.Method != "" && m.ID != nil
+}
+
+func (m *jsonrpcMessage) isNotification() bool {
+	return m.Method != "" && m.ID == nil
+}
+
+func newRequestMessage(id ID, req *Request) *jsonrpcMessage {
+	return &jsonrpcMessage{JSONRPC: "2.0", ID: &id, Method: req.Method, Params: json.RawMessage(req.Params)}
+}
+
+func newNotificationMessage(notif *Notification) *jsonrpcMessage {
+	return &jsonrpcMessage{JSONRPC: "2.0", Method: notif.Method, Params: json.RawMessage(notif.Params)}
+}
+
+func newResponseMessage(id ID, result Result, errObj *Error) *jsonrpcMessage {
+	m := &jsonrpcMessage{JSONRPC: "2.0", ID: &id}
+	if errObj != nil {
+		m.Error = errObj
+		return m
+	}
+
+	if len(result) == 0 {
+		result = Result("{}")
+	}
+	m.Result = json.RawMessage(result)
+	return m
+}
+
+// NewRecordingTransport returns a transport which records every message exchanged through t
+// to w as JSON lines, with the time and the direction of the message.
+// Outbound messages are recorded right before they are sent, even if sending them fails,
+// and responses are recorded as soon as they arrive, whether they are read or not.
+// The messages exchanged by the transport itself, such as the answers to malformed messages, are not seen.
+func NewRecordingTransport(t Transport, w io.Writer) Transport {
+	return &recordingTransport{
+		Transport: t,
+		w:         w,
+		now:       time.Now,
+	}
+}
+
+var _ Transport = (*recordingTransport)(nil)
+
+type recordingTransport struct {
+	Transport
+
+	mu  sync.Mutex
+	w   io.Writer
+	now func() time.Time
+}
+
+func (t *recordingTransport) record(direction Direction, message *jsonrpcMessage) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		slog.Error("failed to encode recorded message", "error", err)
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	line, err := json.Marshal(RecordedMessage{
+		Time:      t.now(),
+		Direction: direction,
+		Message:   data,
+	})
+	if err != nil {
+		slog.Error("failed to encode record", "error", err)
+		return
+	}
+
+	_, err = t.w.Write(append(line, '\n'))
+	if err != nil {
+		slog.Error("failed to write record", "error", err)
+	}
+}
+
+func (t *recordingTransport) Request(req *Request) (ResponseReader, error) {
+	rsp, err := t.Transport.Request(t.recordSending(req))
+	if err != nil {
+		return nil, err
+	}
+
+	return t.recordArrival(rsp), nil
+}
+
+func (t *recordingTransport) RequestSync(ctx context.Context, req *Request) (ResponseReader, error) {
+	var id ID
+	rsp, err := t.Transport.RequestSync(ctx, t.recordSending(req, func(sent ID) { id = sent }))
+	if err != nil {
+		// Transports which read the response themselves return the error it carries
+		var errObj *Error
+		if errors.As(err, &errObj) {
+			t.record(Inbound, newResponseMessage(id, nil, errObj))
+		}
+		return nil, err
+	}
+
+	// The response has arrived when RequestSync returns
+	result, err := rsp.ReadResult()
+	t.recordResponse(rsp.ID(), result, err)
+
+	return &response{id: rsp.ID(), result: result, err: err}, nil
+}
+
+func (t *recordingTransport) RequestBatch(reqs []*Request) ([]ResponseReader, error) {
+	sent := make([]*Request, len(reqs))
+	for i, req := range reqs {
+		sent[i] = t.recordSending(req)
+	}
+
+	rsps, err := t.Transport.RequestBatch(sent)
+	if err != nil {
+		return nil, err
+	}
+
+	readers := make([]ResponseReader, len(rsps))
+	for i, rsp := range rsps {
+		readers[i] = t.recordArrival(rsp)
+	}
+
+	return readers, nil
+}
+
+// recordSending returns a copy of the request which is recorded right before it is sent,
+// once the wrapped transport has given it an ID. The ID is also passed to the given functions.
+func (t *recordingTransport) recordSending(req *Request, funcs ...func(id ID)) *Request {
+	sent := *req
+	sent.sending = func(id ID) {
+		// The request may be recorded by several transports
+		req.beforeSend(id)
+
+		for _, f := range funcs {
+			f(id)
+		}
+		t.record(Outbound, newRequestMessage(id, req))
+	}
+	return &sent
+}
+
+// recordArrival returns a reader of the response, which is recorded as soon as it arrives,
+// whether it is read or not.
+func (t *recordingTransport) recordArrival(rsp ResponseReader) ResponseReader {
+	ch := make(chan *response, 1)
+	go func() {
+		// Transports fail the requests waiting for a response when they are closed
+		result, err := rsp.ReadResult()
+		t.recordResponse(rsp.ID(), result, err)
+		ch <- &response{id: rsp.ID(), result: result, err: err}
+	}()
+
+	return &asyncResponseReader{id: rsp.ID(), ch: ch}
+}
+
+// recordResponse records a received response, unless no response was received,
+// such as when the transport was closed before.
+func (t *recordingTransport) recordResponse(id ID, result Result, err error) {
+	var errObj *Error
+	if err != nil && !errors.As(err, &errObj) {
+		return
+	}
+
+	t.record(Inbound, newResponseMessage(id, result, errObj))
+}
+
+func (t *recordingTransport) Notify(notif *Notification) error {
+	t.record(Outbound, newNotificationMessage(notif))
+
+	return t.Transport.Notify(notif)
+}
+
+func (t *recordingTransport) AcceptRequest(ctx context.Context) (*Request, ResponseWriter, error) {
+	req, w, err := t.Transport.AcceptRequest(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	t.record(Inbound, newRequestMessage(w.ID(), req))
+
+	return req, &recordingResponseWriter{ResponseWriter: w, t: t}, nil
+}
+
+func (t *recordingTransport) AcceptNotification(ctx context.Context) (*Notification, error) {
+	notif, err := t.Transport.AcceptNotification(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	t.record(Inbound, newNotificationMessage(notif))
+
+	return notif, nil
+}
+
+// Stats reports the metrics of the wrapped transport, if it has any.
+func (t *recordingTransport) Stats() TransportStats {
+	if reporter, ok := t.Transport.(StatsReporter); ok {
+		return reporter.Stats()
+	}
+	return TransportStats{}
+}
+
+var _ ResponseWriter = (*recordingResponseWriter)(nil)
+
+type recordingResponseWriter struct {
+	ResponseWriter
+	t *recordingTransport
+}
+
+func (w *recordingResponseWriter) WriteResult(result Result) error {
+	w.t.record(Outbound, newResponseMessage(w.ID(), result, nil))
+
+	return w.ResponseWriter.WriteResult(result)
+}
+
+func (w *recordingResponseWriter) CloseWithError(code ErrorCode, msg string, data map[string]json.RawMessage) error {
+	w.t.record(Outbound, newResponseMessage(w.ID(), nil, newError(code, msg, data)))
+
+	return w.ResponseWriter.CloseWithError(code, msg, data)
+}
@@ -0,0 +1,239 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syncBuffer is a buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) records(t *testing.T) []RecordedMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	records, err := ReadRecording(bytes.NewReader(b.buf.Bytes()))
+	require.NoError(t, err)
+	return records
+}
+
+// summarize returns the direction and the message of the records in a sorted order,
+// as requests and notifications are accepted concurrently.
+func summarize(records []RecordedMessage) []string {
+	lines := make([]string, len(records))
+	for i, record := range records {
+		lines[i] = string(record.Direction) + " " + string(record.Message)
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func newRecordingTestServer() *Server {
+	mux := NewServerMux()
+	mux.HandleTool(&ToolDefinition{Name: "echo"}, ToolHandlerFunc(func(w ContentsWriter, name string, args map[string]any) {
+		w.WriteContents([]Content{})
+	}))
+	server := NewServer("test-server", "0.0.1")
+	server.Handler = mux
+	return server
+}
+
+func TestRecordingTransport(t *testing.T) {
+	var serverRecording, clientRecording syncBuffer
+
+	server := newRecordingTestServer()
+	server.WrapTransport = func(t Transport) Transport {
+		return NewRecordingTransport(t, &serverRecording)
+	}
+
+	clientT, serverT := NewInMemoryTransports()
+	go server.Accept(serverT)
+
+	sess, err := NewClient("test-client", "0.0.1").Dial(NewRecordingTransport(clientT, &clientRecording))
+	require.NoError(t, err)
+
+	results, err := sess.Batch(context.Background(), &Request{Method: MethodListTools})
+	require.NoError(t, err)
+	require.NoError(t, results[0].Err)
+
+	// The initialized notification is recorded once the server accepts it, which may happen after the response
+	require.Eventually(t, func() bool {
+		return len(serverRecording.records(t)) == 5
+	}, time.Second, time.Millisecond)
+	sess.Close()
+
+	records := serverRecording.records(t)
+	for _, record := range records {
+		assert.WithinDuration(t, time.Now(), record.Time, time.Minute)
+	}
+
+	var messages []jsonrpcMessage
+	for _, record := range records {
+		var m jsonrpcMessage
+		require.NoError(t, json.Unmarshal(record.Message, &m))
+		messages = append(messages, m)
+	}
+	assert.Equal(t, Inbound, records[0].Direction)
+	assert.Equal(t, MethodInit, messages[0].Method)
+	assert.Equal(t, Outbound, records[1].Direction)
+	assert.Equal(t, *messages[0].ID, *messages[1].ID, "the response should answer the initialize request")
+
+	// The client sees the same messages in the other direction
+	clientRecords := clientRecording.records(t)
+	require.Len(t, clientRecords, len(records))
+	for i := range clientRecords {
+		if clientRecords[i].Direction == Inbound {
+			clientRecords[i].Direction = Outbound
+		} else {
+			clientRecords[i].Direction = Inbound
+		}
+	}
+	assert.Equal(t, summarize(records), summarize(clientRecords))
+}
+
+func TestRecordingTransport_Order(t *testing.T) {
+	var recording syncBuffer
+
+	clientT, serverT := NewInMemoryTransports()
+	client := NewRecordingTransport(clientT, &recording)
+	defer client.Close()
+
+	rsp, err := client.Request(&Request{Method: MethodListTools})
+	require.NoError(t, err)
+
+	_, w, err := serverT.AcceptRequest(context.Background())
+	require.NoError(t, err)
+
+	// The request is recorded before it is sent
+	records := recording.records(t)
+	require.Len(t, records, 1)
+	assert.Equal(t, Outbound, records[0].Direction)
+
+	require.NoError(t, w.WriteResult(Result(`{"tools":[]}`)))
+
+	// The response is recorded when it arrives, although it is not read
+	require.Eventually(t, func() bool {
+		return len(recording.records(t)) == 2
+	}, time.Second, time.Millisecond)
+	records = recording.records(t)
+	assert.Equal(t, Inbound, records[1].Direction)
+	id, err := json.Marshal(rsp.ID())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":`+string(id)+`,"result":{"tools":[]}}`, string(records[1].Message))
+
+	result, err := rsp.ReadResult()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"tools":[]}`, string(result))
+	assert.Len(t, recording.records(t), 2, "the response should be recorded once")
+}
+
+func TestReplayTransport(t *testing.T) {
+	// record makes a recording of a session listing the tools on both sides
+	record := func(t *testing.T) (serverRecords, clientRecords []RecordedMessage, result Result) {
+		var serverRecording, clientRecording syncBuffer
+
+		server := newRecordingTestServer()
+		server.WrapTransport = func(t Transport) Transport {
+			return NewRecordingTransport(t, &serverRecording)
+		}
+
+		clientT, serverT := NewInMemoryTransports()
+		go server.Accept(serverT)
+
+		sess, err := NewClient("test-client", "0.0.1").Dial(NewRecordingTransport(clientT, &clientRecording))
+		require.NoError(t, err)
+
+		results, err := sess.Batch(context.Background(), &Request{Method: MethodListTools})
+		require.NoError(t, err)
+		sess.Close()
+
+		return serverRecording.records(t), clientRecording.records(t), results[0].Result
+	}
+
+	t.Run("server reproduces the recorded session", func(t *testing.T) {
+		records, _, _ := record(t)
+
+		replay, err := NewReplayTransport(records, nil)
+		require.NoError(t, err)
+
+		var recording syncBuffer
+		_, err = newRecordingTestServer().Accept(NewRecordingTransport(replay, &recording))
+		require.NoError(t, err)
+
+		select {
+		case <-replay.Done():
+		case <-time.After(time.Second):
+			t.Fatal("replay should end")
+		}
+		assert.ErrorIs(t, replay.Err(), io.EOF)
+
+		assert.Equal(t, summarize(records), summarize(recording.records(t)))
+	})
+
+	t.Run("client reproduces the recorded session", func(t *testing.T) {
+		_, records, want := record(t)
+
+		replay, err := NewReplayTransport(records, nil)
+		require.NoError(t, err)
+
+		sess, err := NewClient("test-client", "0.0.1").Dial(replay)
+		require.NoError(t, err)
+
+		results, err := sess.Batch(context.Background(), &Request{Method: MethodListTools})
+		require.NoError(t, err)
+		require.NoError(t, results[0].Err)
+		assert.JSONEq(t, string(want), string(results[0].Result))
+
+		<-replay.Done()
+		assert.ErrorIs(t, replay.Err(), io.EOF)
+	})
+
+	t.Run("replay diverges when a recorded message is not sent", func(t *testing.T) {
+		records, _, _ := record(t)
+
+		// The session is expected to send a notification it never sends
+		records = append(records[:2:2], RecordedMessage{
+			Direction: Outbound,
+			Message:   json.RawMessage(`{"jsonrpc": "2.0", "method": "notifications/message"}`),
+		})
+
+		replay, err := NewReplayTransport(records, &ReplayConfig{Timeout: 50 * time.Millisecond})
+		require.NoError(t, err)
+
+		_, err = newRecordingTestServer().Accept(replay)
+		require.NoError(t, err)
+
+		select {
+		case <-replay.Done():
+		case <-time.After(time.Second):
+			t.Fatal("replay should end")
+		}
+		assert.ErrorIs(t, replay.Err(), ErrReplayDiverged)
+	})
+
+	t.Run("invalid recording is refused", func(t *testing.T) {
+		_, err := NewReplayTransport([]RecordedMessage{{Direction: Inbound, Message: json.RawMessage(`{}`)}}, nil)
+		assert.Error(t, err)
+
+		_, err = ReadRecording(bytes.NewReader([]byte(`{"direction": "sideways", "message": {}}`)))
+		assert.ErrorContains(t, err, "unknown direction")
+	})
+}
@@ -0,0 +1,399 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// DefaultReplayTimeout is how long a replay transport waits for a recorded outbound message
+// when ReplayConfig.Timeout is not set.
+const DefaultReplayTimeout = 5 * time.Second
+
+// ErrReplayDiverged is the cause of the closure of a replay transport
+// when the session does not send the messages of the recording.
+var ErrReplayDiverged = errors.New("replay diverged from the recording")
+
+type ReplayConfig struct {
+	// Timeout is how long to wait for the session to send a recorded outbound message.
+	// Zero means DefaultReplayTimeout.
+	Timeout time.Duration
+}
+
+func (c *ReplayConfig) timeout() time.Duration {
+	if c == nil || c.Timeout <= 0 {
+		return DefaultReplayTimeout
+	}
+	return c.Timeout
+}
+
+// NewReplayTransport returns a transport which plays the peer of a recording made by a recording transport,
+// so that a Server or a Client reproduces the recorded session.
+//
+// The inbound messages are delivered in the recorded order, as fast as possible.
+// Before going past a recorded outbound message, the transport waits until the session sends
+// the same kind of message: a request or a notification with the same method, or the response
+// to the same request. Its content may differ, and additional messages are ignored.
+// If the message is not sent in time, the transport is closed with ErrReplayDiverged.
+// Once the last message is replayed and the delivered messages are accepted,
+// the transport is closed with io.EOF, as when the peer ends the connection.
+func NewReplayTransport(records []RecordedMessage, config *ReplayConfig) (Transport, error) {
+	messages := make([]*jsonrpcMessage, len(records))
+	for i, record := range records {
+		var m jsonrpcMessage
+		err := json.Unmarshal(record.Message, &m)
+		if err != nil {
+			return nil, fmt.Errorf("invalid message in record %d: %w", i+1, err)
+		}
+		if m.Method == "" && m.ID == nil {
+			return nil, fmt.Errorf("invalid message in record %d: neither a request, a notification nor a response", i+1)
+		}
+		messages[i] = &m
+	}
+
+	t := &replayTransport{
+		records:                    records,
+		messages:                   messages,
+		timeout:                    config.timeout(),
+		idGenerator:                NewIDGenerator(),
+		replayedRequests:           make(map[ID]*sentMessage),
+		receivedRequestQueue:       newQueue(QueueConfig{}, answerDiscardedRequest),
+		receivedNotificationsQueue: newQueue[*Notification](QueueConfig{}, nil),
+		sentSignal:                 make(chan struct{}),
+		done:                       make(chan struct{}),
+	}
+
+	go t.replay()
+
+	return t, nil
+}
+
+var _ Transport = (*replayTransport)(nil)
+
+type replayTransport struct {
+	records  []RecordedMessage
+	messages []*jsonrpcMessage
+	timeout  time.Duration
+
+	idGenerator IDGenerator
+
+	receivedRequestQueue       *queue[receivedRequest]
+	receivedNotificationsQueue *queue[*Notification]
+
+	mu sync.Mutex
+	// sent holds the messages sent by the session which have not matched a recorded message yet
+	sent       []*sentMessage
+	sentSignal chan struct{}
+	// replayedRequests holds the requests sent by the session which matched a recorded request, keyed by the recorded ID
+	replayedRequests map[ID]*sentMessage
+	closed           bool
+	closedErr        error
+	done             chan struct{}
+}
+
+// sentMessage is a message sent by the session, with the channel of its response if it is a request.
+type sentMessage struct {
+	message *jsonrpcMessage
+	rspCh   chan *response
+}
+
+// replay delivers the recorded inbound messages and waits for the recorded outbound messages in order.
+func (t *replayTransport) replay() {
+	for i, m := range t.messages {
+		var err error
+		if t.records[i].Direction == Inbound {
+			err = t.deliver(m)
+		} else {
+			err = t.expect(m)
+		}
+		if err != nil {
+			t.close(fmt.Errorf("record %d: %w", i+1, err))
+			return
+		}
+	}
+
+	t.waitAccepted()
+	t.close(io.EOF)
+}
+
+// waitAccepted waits until the session has accepted the delivered requests and notifications,
+// so that none of them is lost when the transport is closed.
+func (t *replayTransport) waitAccepted() {
+	ticker := time.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+
+	timeout := time.After(t.timeout)
+	for t.receivedRequestQueue.Stats().Depth > 0 || t.receivedNotificationsQueue.Stats().Depth > 0 {
+		select {
+		case <-ticker.C:
+		case <-t.done:
+			return
+		case <-timeout:
+			return
+		}
+	}
+}
+
+func (t *replayTransport) deliver(m *jsonrpcMessage) error {
+	switch {
+	case m.isRequest():
+		return t.receivedRequestQueue.Push(context.Background(), receivedRequest{
+			req: &Request{Method: m.Method, Params: Params(m.Params)},
+			w:   &replayResponseWriter{t: t, id: *m.ID},
+		})
+	case m.isNotification():
+		return t.receivedNotificationsQueue.Push(context.Background(), &Notification{
+			Method: m.Method,
+			Params: Params(m.Params),
+		})
+	default:
+		t.mu.Lock()
+		sent, ok := t.replayedRequests[*m.ID]
+		delete(t.replayedRequests, *m.ID)
+		t.mu.Unlock()
+		if !ok {
+			return fmt.Errorf("%w: response to request %s which was not sent", ErrReplayDiverged, *m.ID)
+		}
+
+		// The response is delivered with the ID of the request sent by the session
+		rsp := &response{id: *sent.message.ID, result: Result(m.Result)}
+		if m.Error != nil {
+			rsp.err = m.Error
+		}
+		sent.rspCh <- rsp
+		return nil
+	}
+}
+
+// expect waits until the session sends a message matching the recorded outbound message.
+func (t *replayTransport) expect(recorded *jsonrpcMessage) error {
+	timeout := time.After(t.timeout)
+	for {
+		t.mu.Lock()
+		if t.closed {
+			t.mu.Unlock()
+			return t.Err()
+		}
+		for i, sent := range t.sent {
+			if !matchesRecorded(sent.message, recorded) {
+				continue
+			}
+
+			t.sent = append(t.sent[:i], t.sent[i+1:]...)
+			if sent.rspCh != nil {
+				t.replayedRequests[*recorded.ID] = sent
+			}
+			t.mu.Unlock()
+			return nil
+		}
+		signal := t.sentSignal
+		t.mu.Unlock()
+
+		select {
+		case <-signal:
+		case <-t.done:
+			return t.Err()
+		case <-timeout:
+			return fmt.Errorf("%w: %s was not sent after %v", ErrReplayDiverged, describeMessage(recorded), t.timeout)
+		}
+	}
+}
+
+func matchesRecorded(sent, recorded *jsonrpcMessage) bool {
+	switch {
+	case recorded.isRequest():
+		return sent.isRequest() && sent.Method == recorded.Method
+	case recorded.isNotification():
+		return sent.isNotification() && sent.Method == recorded.Method
+	default:
+		return sent.Method == "" && sent.ID != nil && *sent.ID == *recorded.ID
+	}
+}
+
+func describeMessage(m *jsonrpcMessage) string {
+	switch {
+	case m.isRequest():
+		return fmt.Sprintf("%s request", m.Method)
+	case m.isNotification():
+		return fmt.Sprintf("%s notification", m.Method)
+	default:
+		return fmt.Sprintf("response to request %s", *m.ID)
+	}
+}
+
+// send records a message sent by the session, to be matched by the replay.
+func (t *replayTransport) send(m *jsonrpcMessage, rspCh chan *response) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return fmt.Errorf("transport is closed: %w", t.errLocked())
+	}
+
+	t.sent = append(t.sent, &sentMessage{message: m, rspCh: rspCh})
+	close(t.sentSignal)
+	t.sentSignal = make(chan struct{})
+
+	return nil
+}
+
+func (t *replayTransport) Request(req *Request) (ResponseReader, error) {
+	id := t.idGenerator.Generate()
+	rspCh := make(chan *response, 1)
+
+	req.beforeSend(id)
+	err := t.send(newRequestMessage(id, req), rspCh)
+	if err != nil {
+		return nil, err
+	}
+
+	return &asyncResponseReader{id: id, ch: rspCh}, nil
+}
+
+func (t *replayTransport) RequestSync(ctx context.Context, req *Request) (ResponseReader, error) {
+	rsp, err := t.Request(req)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := rsp.ReadResultContext(ctx)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+
+	return &response{id: rsp.ID(), result: result, err: err}, nil
+}
+
+func (t *replayTransport) RequestBatch(reqs []*Request) ([]ResponseReader, error) {
+	readers := make([]ResponseReader, 0, len(reqs))
+	for _, req := range reqs {
+		rsp, err := t.Request(req)
+		if err != nil {
+			return nil, err
+		}
+		readers = append(readers, rsp)
+	}
+
+	return readers, nil
+}
+
+func (t *replayTransport) Notify(notif *Notification) error {
+	return t.send(newNotificationMessage(notif), nil)
+}
+
+func (t *replayTransport) AcceptRequest(ctx context.Context) (*Request, ResponseWriter, error) {
+	r, err := t.receivedRequestQueue.Pop(ctx)
+	if err != nil {
+		if errors.Is(err, errQueueClosed) {
+			return nil, nil, t.Err()
+		}
+		return nil, nil, err
+	}
+
+	return r.req, r.w, nil
+}
+
+func (t *replayTransport) AcceptNotification(ctx context.Context) (*Notification, error) {
+	notif, err := t.receivedNotificationsQueue.Pop(ctx)
+	if err != nil {
+		if errors.Is(err, errQueueClosed) {
+			return nil, t.Err()
+		}
+		return nil, err
+	}
+
+	return notif, nil
+}
+
+func (t *replayTransport) Close() error {
+	return t.close(nil)
+}
+
+func (t *replayTransport) CloseWithError(err error) error {
+	return t.close(err)
+}
+
+func (t *replayTransport) Done() <-chan struct{} {
+	return t.done
+}
+
+func (t *replayTransport) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.errLocked()
+}
+
+func (t *replayTransport) errLocked() error {
+	if !t.closed {
+		return nil
+	}
+	if t.closedErr != nil {
+		return t.closedErr
+	}
+	return ErrTransportClosed
+}
+
+func (t *replayTransport) close(cause error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return errors.New("transport is already closed")
+	}
+
+	t.closed = true
+	t.closedErr = cause
+	close(t.done)
+
+	// Messages already delivered are kept, so that they can still be accepted
+	t.receivedRequestQueue.Close()
+	t.receivedNotificationsQueue.Close()
+
+	// Fail all requests waiting for a response
+	if cause == nil {
+		cause = ErrTransportClosed
+	}
+	for _, sent := range t.sent {
+		if sent.rspCh != nil {
+			sent.rspCh <- &response{
+				id:  *sent.message.ID,
+				err: fmt.Errorf("transport closed before response: %w", cause),
+			}
+		}
+	}
+	t.sent = nil
+	for id, sent := range t.replayedRequests {
+		sent.rspCh <- &response{
+			id:  *sent.message.ID,
+			err: fmt.Errorf("transport closed before response: %w", cause),
+		}
+		delete(t.replayedRequests, id)
+	}
+
+	return nil
+}
+
+var _ ResponseWriter = (*replayResponseWriter)(nil)
+
+// replayResponseWriter answers a replayed request with its recorded ID.
+type replayResponseWriter struct {
+	t  *replayTransport
+	id ID
+}
+
+func (w *replayResponseWriter) ID() ID {
+	return w.id
+}
+
+func (w *replayResponseWriter) WriteResult(result Result) error {
+	return w.t.send(newResponseMessage(w.id, result, nil), nil)
+}
+
+func (w *replayResponseWriter) CloseWithError(code ErrorCode, msg string, data map[string]json.RawMessage) error {
+	return w.t.send(newResponseMessage(w.id, nil, newError(code, msg, data)), nil)
+}
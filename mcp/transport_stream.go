@@ -1,25 +1,44 @@
 package mcp
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"sync"
 
 	"golang.org/x/exp/slog"
 )
 
 func NewStreamTransport(w io.WriteCloser, r io.ReadCloser) Transport {
+	return NewStreamTransportWithConfig(w, r, nil)
+}
+
+func NewStreamTransportWithConfig(w io.WriteCloser, r io.ReadCloser, config *StreamConfig) Transport {
+	conn := &lineConn{
+		w:       w,
+		r:       r,
+		reader:  bufio.NewReader(r),
+		maxSize: config.maxMessageSize(),
+	}
+
+	return newMessageTransport(conn, config.queueConfig())
+}
+
+// newMessageTransport creates a transport exchanging messages over a connection which frames them.
+func newMessageTransport(conn messageConn, queueConfig QueueConfig) *streamTransport {
 	t := &streamTransport{
-		w:                          w,
-		r:                          r,
+		conn:                       conn,
 		idGenerator:                NewIDGenerator(),
 		sentRequestMap:             make(map[ID]chan *response),
 		rceivedRequestIDMap:        make(map[ID]struct{}),
-		receivedRequestQueue:       newRequestsQueue(),
-		receivedNotificationsQueue: newNotificationsQueue(),
+		receivedRequestQueue:       newQueue(queueConfig, answerDiscardedRequest),
+		receivedNotificationsQueue: newQueue[*Notification](queueConfig, nil),
+		done:                       make(chan struct{}),
 	}
 
 	go t.listenMessages()
@@ -27,13 +46,47 @@ func NewStreamTransport(w io.WriteCloser, r io.ReadCloser) Transport {
 	return t
 }
 
+// messageConn frames JSON-RPC messages over an underlying connection.
+type messageConn interface {
+	// ReadMessage returns the next message.
+	// It returns errMessageTooLarge for a message exceeding the maximum size, after which reading can continue.
+	// A message may be returned together with an error if it is the last one.
+	ReadMessage() ([]byte, error)
+	// WriteMessage writes a single message. It is not called concurrently.
+	WriteMessage(data []byte) error
+	// Close closes the connection. cause is the reason of the termination, or nil for a normal closure.
+	Close(cause error) error
+}
+
+var _ messageConn = (*lineConn)(nil)
+
+// lineConn frames messages as newline-delimited JSON.
+type lineConn struct {
+	w       io.WriteCloser
+	r       io.ReadCloser
+	reader  *bufio.Reader
+	maxSize int
+}
+
+func (c *lineConn) ReadMessage() ([]byte, error) {
+	return readLine(c.reader, c.maxSize)
+}
+
+func (c *lineConn) WriteMessage(data []byte) error {
+	_, err := c.w.Write(append(data, '\n'))
+	return err
+}
+
+func (c *lineConn) Close(cause error) error {
+	c.r.Close()
+	return c.w.Close()
+}
+
 var _ Transport = (*streamTransport)(nil)
 
 type streamTransport struct {
-	w   io.WriteCloser
-	wmu sync.Mutex
-
-	r io.ReadCloser
+	conn messageConn
+	wmu  sync.Mutex
 
 	idGenerator          IDGenerator
 	sentRequestMap       map[ID]chan *response
@@ -42,22 +95,24 @@ type streamTransport struct {
 	rceivedRequestIDMap    map[ID]struct{}
 	rceivedRequestsMapLock sync.RWMutex
 
-	receivedRequestQueue       *requestsQueue
-	receivedNotificationsQueue *notificationsQueue
+	receivedRequestQueue       *queue[receivedRequest]
+	receivedNotificationsQueue *queue[*Notification]
 
+	closeMu   sync.Mutex
 	closed    bool
 	closedErr error
+	done      chan struct{}
 }
 
 func (t *streamTransport) RequestSync(ctx context.Context, req *Request) (ResponseReader, error) {
 	id := t.idGenerator.Generate()
+	rspCh := make(chan *response, 1)
+
+	t.sentRequestIDMapLock.Lock()
 	if _, ok := t.sentRequestMap[id]; ok {
+		t.sentRequestIDMapLock.Unlock()
 		panic("ID is already used")
 	}
-
-	rspCh := make(chan *response)
-
-	t.sentRequestIDMapLock.Lock()
 	t.sentRequestMap[id] = rspCh
 	t.sentRequestIDMapLock.Unlock()
 
@@ -68,16 +123,17 @@ func (t *streamTransport) RequestSync(ctx context.Context, req *Request) (Respon
 		"id":      id,
 	}
 
-	t.wmu.Lock()
-	err := json.NewEncoder(t.w).Encode(jsonrpcReq)
-	t.wmu.Unlock()
-
+	req.beforeSend(id)
+	err := t.writeMessage(jsonrpcReq)
 	if err != nil {
+		t.forgetRequest(id)
 		return nil, err
 	}
 
 	select {
 	case <-ctx.Done():
+		// A response received later is discarded as unknown
+		t.forgetRequest(id)
 		return nil, ctx.Err()
 	case rsp := <-rspCh:
 		return rsp, nil
@@ -86,13 +142,13 @@ func (t *streamTransport) RequestSync(ctx context.Context, req *Request) (Respon
 
 func (t *streamTransport) Request(req *Request) (ResponseReader, error) {
 	id := t.idGenerator.Generate()
+	rspCh := make(chan *response, 1)
+
+	t.sentRequestIDMapLock.Lock()
 	if _, ok := t.sentRequestMap[id]; ok {
+		t.sentRequestIDMapLock.Unlock()
 		panic("ID is already used")
 	}
-
-	rspCh := make(chan *response)
-
-	t.sentRequestIDMapLock.Lock()
 	t.sentRequestMap[id] = rspCh
 	t.sentRequestIDMapLock.Unlock()
 
@@ -104,20 +160,61 @@ func (t *streamTransport) Request(req *Request) (ResponseReader, error) {
 		"id":      id,
 	}
 
-	t.wmu.Lock()
-	err := json.NewEncoder(t.w).Encode(jsonrpcReq)
-	t.wmu.Unlock()
+	req.beforeSend(id)
+	err := t.writeMessage(jsonrpcReq)
 	if err != nil {
+		t.forgetRequest(id)
 		return nil, err
 	}
 
-	return &asyncResponseReader{ch: rspCh}, nil
+	return &asyncResponseReader{id: id, ch: rspCh}, nil
 }
 
-func (t *streamTransport) Notify(notif *Notification) error {
-	t.wmu.Lock()
-	defer t.wmu.Unlock()
+func (t *streamTransport) RequestBatch(reqs []*Request) ([]ResponseReader, error) {
+	messages := make([]map[string]any, 0, len(reqs))
+	readers := make([]ResponseReader, 0, len(reqs))
+	ids := make([]ID, 0, len(reqs))
+
+	t.sentRequestIDMapLock.Lock()
+	for _, req := range reqs {
+		id := t.idGenerator.Generate()
+		rspCh := make(chan *response, 1)
+		t.sentRequestMap[id] = rspCh
+
+		messages = append(messages, map[string]any{
+			"jsonrpc": "2.0",
+			"method":  req.Method,
+			"params":  req.Params,
+			"id":      id,
+		})
+		readers = append(readers, &asyncResponseReader{id: id, ch: rspCh})
+		ids = append(ids, id)
+	}
+	t.sentRequestIDMapLock.Unlock()
 
+	for i, req := range reqs {
+		req.beforeSend(ids[i])
+	}
+	err := t.writeMessage(messages)
+	if err != nil {
+		t.forgetRequest(ids...)
+		return nil, err
+	}
+
+	return readers, nil
+}
+
+// forgetRequest stops waiting for the responses of requests which could not be sent.
+func (t *streamTransport) forgetRequest(ids ...ID) {
+	t.sentRequestIDMapLock.Lock()
+	defer t.sentRequestIDMapLock.Unlock()
+
+	for _, id := range ids {
+		delete(t.sentRequestMap, id)
+	}
+}
+
+func (t *streamTransport) Notify(notif *Notification) error {
 	jsonNotif := map[string]interface {
 	}{
 		"jsonrpc": "2.0",
@@ -125,213 +222,420 @@ func (t *streamTransport) Notify(notif *Notification) error {
 		"params":  notif.Params,
 	}
 
-	err := json.NewEncoder(t.w).Encode(jsonNotif)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return t.writeMessage(jsonNotif)
 }
 
 func (t *streamTransport) AcceptRequest(ctx context.Context) (*Request, ResponseWriter, error) {
-	for {
-		if t.receivedRequestQueue.Len() > 0 {
-			return t.receivedRequestQueue.Pop(), nil, nil
-		}
-
-		select {
-		case <-ctx.Done():
-			return nil, nil, ctx.Err()
-		case <-t.receivedRequestQueue.Chan():
-			continue
+	r, err := t.receivedRequestQueue.Pop(ctx)
+	if err != nil {
+		if errors.Is(err, errQueueClosed) {
+			return nil, nil, t.Err()
 		}
+		return nil, nil, err
 	}
+
+	return r.req, r.w, nil
 }
 
 func (t *streamTransport) AcceptNotification(ctx context.Context) (*Notification, error) {
-	for {
-		if t.receivedNotificationsQueue.Len() > 0 {
-			return t.receivedNotificationsQueue.Pop(), nil
+	notif, err := t.receivedNotificationsQueue.Pop(ctx)
+	if err != nil {
+		if errors.Is(err, errQueueClosed) {
+			return nil, t.Err()
 		}
+		return nil, err
+	}
 
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		case <-t.receivedNotificationsQueue.Chan():
-			continue
-		}
+	return notif, nil
+}
+
+func (t *streamTransport) Stats() TransportStats {
+	return TransportStats{
+		Requests:      t.receivedRequestQueue.Stats(),
+		Notifications: t.receivedNotificationsQueue.Stats(),
 	}
 }
 
 func (t *streamTransport) Close() error {
-	t.wmu.Lock()
-	defer t.wmu.Unlock()
+	return t.close(nil)
+}
+
+func (t *streamTransport) CloseWithError(err error) error {
+	return t.close(err)
+}
+
+func (t *streamTransport) Done() <-chan struct{} {
+	return t.done
+}
+
+func (t *streamTransport) Err() error {
+	t.closeMu.Lock()
+	defer t.closeMu.Unlock()
 
+	if !t.closed {
+		return nil
+	}
+	if t.closedErr != nil {
+		return t.closedErr
+	}
+	return ErrTransportClosed
+}
+
+// close terminates the transport with the given cause.
+// Pending requests are answered with an error wrapping the cause,
+// and goroutines waiting for incoming messages are released.
+func (t *streamTransport) close(cause error) error {
+	t.closeMu.Lock()
 	if t.closed {
-		if t.closedErr != nil {
-			return fmt.Errorf("transport is already closed: %w", t.closedErr)
+		closedErr := t.closedErr
+		t.closeMu.Unlock()
+
+		if closedErr != nil {
+			return fmt.Errorf("transport is already closed: %w", closedErr)
 		}
 		return errors.New("transport is already closed")
 	}
 
-	t.receivedRequestQueue.Clear()
-	t.receivedNotificationsQueue.Clear()
-
-	t.r.Close()
-	t.w.Close()
-
 	t.closed = true
+	t.closedErr = cause
+	close(t.done)
+
+	// Messages already received are kept, so that they can still be accepted
+	t.receivedRequestQueue.Close()
+	t.receivedNotificationsQueue.Close()
+	t.closeMu.Unlock()
+
+	// The connection is closed without waiting for a pending write,
+	// which may be blocked by a peer not reading, and which the closure unblocks
+	t.conn.Close(cause)
+
+	// Fail all requests waiting for a response.
+	// Requests sent from now on fail to be written, and are not waiting
+	if cause == nil {
+		cause = ErrTransportClosed
+	}
+	t.sentRequestIDMapLock.Lock()
+	for id, rspCh := range t.sentRequestMap {
+		rspCh <- &response{
+			id:  id,
+			err: fmt.Errorf("transport closed before response: %w", cause),
+		}
+		delete(t.sentRequestMap, id)
+	}
+	t.sentRequestIDMapLock.Unlock()
+
 	return nil
 }
 
-func (t *streamTransport) CloseWithError(err error) error {
-	t.wmu.Lock()
-	defer t.wmu.Unlock()
+// listenMessages reads messages until the connection ends.
+// Malformed and oversized messages are answered with a parse error and skipped,
+// so that a broken message never desynchronizes the following ones.
+// When the connection reaches EOF or is closed, the transport is closed with that cause.
+func (t *streamTransport) listenMessages() {
+	for {
+		line, err := t.conn.ReadMessage()
+		if errors.Is(err, errMessageTooLarge) {
+			slog.Error("discarded message exceeding maximum size")
+			t.writeParseError("message exceeds maximum size")
+			continue
+		}
 
-	if t.closed {
-		if t.closedErr != nil {
-			return fmt.Errorf("transport is already closed: %w", t.closedErr)
+		if len(line) > 0 {
+			t.listenLine(line)
+		}
+
+		if err != nil {
+			if isClosedStreamError(err) {
+				err = io.EOF
+			}
+			t.close(err)
+			return
 		}
-		return errors.New("transport is already closed")
 	}
+}
 
-	t.receivedRequestQueue.Clear()
-	t.receivedNotificationsQueue.Clear()
+func (t *streamTransport) listenLine(line []byte) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return
+	}
 
-	t.r.Close()
-	t.w.Close()
+	if line[0] == '[' {
+		// Read a message as batch JSON object
+		var batch []json.RawMessage
+		err := json.Unmarshal(line, &batch)
+		if err != nil {
+			slog.Error("failed to decode batch message", "error", err)
+			t.writeParseError(err.Error())
+			return
+		}
 
-	t.closed = true
-	t.closedErr = err
+		if len(batch) == 0 {
+			t.writeError("", ErrInvalidRequest)
+			return
+		}
 
-	return nil
+		// Count the entries to be answered, so that the batch response is written once all of them are
+		n := 0
+		for _, raw := range batch {
+			if isRequestMessage(raw) {
+				n++
+			}
+		}
+
+		bw := newBatchWriter(n, func(responses []map[string]any) error {
+			return t.writeMessage(responses)
+		})
+
+		for _, raw := range batch {
+			var message map[string]json.RawMessage
+			err := json.Unmarshal(raw, &message)
+			if err != nil {
+				bw.WriteError("", ErrInvalidRequest)
+				continue
+			}
+
+			id, errObj := t.listenSingleMessage(message, bw.Writer)
+			if errObj != nil {
+				bw.WriteError(id, errObj)
+			}
+		}
+		return
+	}
+
+	// Read a message as single JSON object
+	var message map[string]json.RawMessage
+	err := json.Unmarshal(line, &message)
+	if err != nil {
+		slog.Error("failed to decode message", "error", err)
+		t.writeParseError(err.Error())
+		return
+	}
+
+	id, errObj := t.listenSingleMessage(message, t.newResponseWriter)
+	if errObj != nil {
+		t.writeError(id, errObj)
+	}
 }
 
-func (t *streamTransport) listenMessages() {
-	decoder := json.NewDecoder(t.r)
-	defer t.r.Close()
+func (t *streamTransport) newResponseWriter(id ID) ResponseWriter {
+	return &streamResponseWriter{t: t, id: id}
+}
+
+func (t *streamTransport) writeParseError(reason string) {
+	data, _ := json.Marshal(reason)
+	t.writeError("", newError(ErrParseError.Code, ErrParseError.Message, map[string]json.RawMessage{"reason": data}))
+}
+
+// writeError writes an error response which is not related to any accepted request.
+// If the ID is empty, the response has a null ID.
+func (t *streamTransport) writeError(id ID, errObj *Error) {
+	message := map[string]any{
+		"jsonrpc": "2.0",
+		"id":      nil,
+		"error":   errObj,
+	}
+	if id != "" {
+		message["id"] = id
+	}
+
+	err := t.writeMessage(message)
+	if err != nil {
+		slog.Error("failed to write error response", "error", err)
+	}
+}
+
+var errMessageTooLarge = errors.New("message too large")
+
+// readLine reads a single line without the trailing newline.
+// If the line is longer than maxSize, the rest of the line is discarded and errMessageTooLarge is returned.
+// The last line of the stream may not end with a newline; it is returned together with the read error.
+func readLine(r *bufio.Reader, maxSize int) ([]byte, error) {
+	var line []byte
+	tooLarge := false
 
 	for {
+		chunk, err := r.ReadSlice('\n')
+		if !tooLarge {
+			if len(line)+len(chunk) > maxSize+1 {
+				tooLarge = true
+				line = nil
+			} else {
+				line = append(line, chunk...)
+			}
+		}
 
-		// Read a message as single JSON object
-		var message map[string]json.RawMessage
-		err := decoder.Decode(&message)
-		if err == nil {
-			t.listenSingleMessage(message)
+		if errors.Is(err, bufio.ErrBufferFull) {
 			continue
 		}
 
-		// Read a message as batch JSON object
-		var batch []map[string]json.RawMessage
-		err = decoder.Decode(&batch)
-		if err == nil {
-			for _, message := range batch {
-				t.listenSingleMessage(message)
+		if tooLarge {
+			if err != nil {
+				return nil, err
 			}
-			continue
+			return nil, errMessageTooLarge
 		}
 
-		err = errors.New("the message is neither single nor batch")
-		slog.Error("failed to decode message", "error", err)
+		return bytes.TrimSuffix(line, []byte("\n")), err
 	}
+}
 
+func isClosedStreamError(err error) bool {
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrClosedPipe) ||
+		errors.Is(err, os.ErrClosed)
 }
 
-func (t *streamTransport) listenSingleMessage(message map[string]json.RawMessage) {
+// listenSingleMessage routes a single message to the request queue, the notification queue,
+// or the request waiting for the response.
+// If the message is an invalid request, it returns the error to be answered with the request ID, if any.
+func (t *streamTransport) listenSingleMessage(message map[string]json.RawMessage, newWriter func(id ID) ResponseWriter) (ID, *Error) {
 	id, hasID := message["id"]
 	rawMethod, hasMethod := message["method"]
 	if hasID && hasMethod {
 		// It should be a request
 
-		// Check if params field is present
-		rawParams, hasParams := message["params"]
-		if !hasParams {
-			slog.Error("Missing params field for request")
-			return
-		}
-
 		// Check if ID is valid
-		if string(id) == "" {
+		if len(id) == 0 || string(id) == "null" {
 			slog.Error("Invalid request ID", "id", id)
-			return
+			return "", ErrInvalidRequest
 		}
 
-		// Check if ID is already received
-		t.rceivedRequestsMapLock.RLock()
-		if _, ok := t.rceivedRequestIDMap[ID(id)]; ok {
-			slog.Error("Duplicate request ID", "id", id)
-			return
+		var method Method
+		err := json.Unmarshal(rawMethod, &method)
+		if err != nil {
+			slog.Error("Invalid method", "method", string(rawMethod))
+			return ID(id), ErrInvalidRequest
 		}
-		t.rceivedRequestsMapLock.RUnlock()
 
-		// Record received request ID
+		// Check if ID is already received and record it
 		t.rceivedRequestsMapLock.Lock()
+		if _, ok := t.rceivedRequestIDMap[ID(id)]; ok {
+			t.rceivedRequestsMapLock.Unlock()
+			slog.Error("Duplicate request ID", "id", id)
+			return ID(id), ErrInvalidRequest
+		}
 		t.rceivedRequestIDMap[ID(id)] = struct{}{}
 		t.rceivedRequestsMapLock.Unlock()
 
 		// Push request to queue
-		t.receivedRequestQueue.Push(&Request{
-			Method: Method(rawMethod),
-			Params: Params(rawParams),
+		err = t.receivedRequestQueue.Push(context.Background(), receivedRequest{
+			req: &Request{
+				Method: method,
+				Params: Params(message["params"]),
+			},
+			w: newWriter(ID(id)),
 		})
+		if err != nil {
+			slog.Error("failed to queue request", "id", id, "error", err)
+			// A request rejected by the backpressure policy is already answered
+			if !errors.Is(err, ErrQueueFull) {
+				return ID(id), ErrInternalError
+			}
+		}
 	} else if !hasID && hasMethod {
 		// It should be a notification
-		// Check if params field is present
-		rawParams, hasParams := message["params"]
-		if !hasParams {
-			slog.Error("Missing params field for request")
-			return
-		}
 
-		// Check if ID is valid
-		if string(id) == "" {
-			slog.Error("Invalid request ID", "id", id)
-			return
+		var method Method
+		err := json.Unmarshal(rawMethod, &method)
+		if err != nil {
+			slog.Error("Invalid method", "method", string(rawMethod))
+			return "", nil
 		}
 
 		// Queue notification
-		t.receivedNotificationsQueue.Push(&Notification{
-			Method: Method(rawMethod),
-			Params: Params(rawParams),
+		err = t.receivedNotificationsQueue.Push(context.Background(), &Notification{
+			Method: method,
+			Params: Params(message["params"]),
 		})
+		if err != nil {
+			slog.Error("failed to queue notification", "method", method, "error", err)
+		}
 	} else if hasID && !hasMethod {
 		// It should be a response
 
-		t.sentRequestIDMapLock.RLock()
+		rawResult, hasResult := message["result"]
+		rawError, hasError := message["error"]
+
+		t.sentRequestIDMapLock.Lock()
 		rspCh, ok := t.sentRequestMap[ID(id)]
+		delete(t.sentRequestMap, ID(id))
+		t.sentRequestIDMapLock.Unlock()
 		if !ok {
 			slog.Error("Unknown request ID", "id", id)
-			return
+			return "", nil
 		}
-		t.sentRequestIDMapLock.RUnlock()
 
-		rawResult, hasResult := message["result"]
-		rawError, hasError := message["error"]
+		// A response is never answered, so an invalid one fails the request waiting for it
 		if hasError {
 			errObj := Error{}
 			err := json.Unmarshal(rawError, &errObj)
 			if err != nil {
 				slog.Error("Failed to unmarshal error", "error", err)
-				return
+				errObj = *ErrParseError
 			}
 
 			rspCh <- &response{
+				id:     ID(id),
 				result: nil,
 				err:    &errObj,
 			}
-
-			close(rspCh)
 		} else if hasResult {
 			rspCh <- &response{
+				id:     ID(id),
 				result: Result(rawResult),
 				err:    nil,
 			}
-
-			close(rspCh)
+		} else {
+			slog.Error("Missing result and error fields for response", "id", id)
+			rspCh <- &response{
+				id:  ID(id),
+				err: errInvalidResponse,
+			}
 		}
-
 	} else {
 		slog.Error("Unknown message type")
-		return
+		return "", ErrInvalidRequest
 	}
+
+	return "", nil
+}
+
+func (t *streamTransport) writeMessage(message any) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	t.wmu.Lock()
+	defer t.wmu.Unlock()
+
+	return t.conn.WriteMessage(data)
+}
+
+var _ ResponseWriter = (*streamResponseWriter)(nil)
+
+type streamResponseWriter struct {
+	t  *streamTransport
+	id ID
+}
+
+func (w *streamResponseWriter) ID() ID {
+	return w.id
+}
+
+func (w *streamResponseWriter) WriteResult(result Result) error {
+	return w.t.writeMessage(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      w.id,
+		"result":  result,
+	})
+}
+
+func (w *streamResponseWriter) CloseWithError(code ErrorCode, msg string, data map[string]json.RawMessage) error {
+	return w.t.writeMessage(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      w.id,
+		"error":   newError(code, msg, data),
+	})
 }
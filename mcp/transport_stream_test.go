@@ -0,0 +1,291 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamTransport_ListenMessages(t *testing.T) {
+	tests := map[string]struct {
+		input           string
+		wantParseErrors int
+		wantMethods     []Method
+	}{
+		"valid notifications": {
+			input: `{"jsonrpc":"2.0","method":"notifications/a"}` + "\n" +
+				`{"jsonrpc":"2.0","method":"notifications/b","params":{}}` + "\n",
+			wantMethods: []Method{"notifications/a", "notifications/b"},
+		},
+		"malformed line does not desync the stream": {
+			input: `{"jsonrpc":"2.0",` + "\n" +
+				`{"jsonrpc":"2.0","method":"notifications/a"}` + "\n",
+			wantParseErrors: 1,
+			wantMethods:     []Method{"notifications/a"},
+		},
+		"oversized line is discarded": {
+			input: `{"jsonrpc":"2.0","method":"notifications/` + strings.Repeat("x", 100) + `"}` + "\n" +
+				`{"jsonrpc":"2.0","method":"notifications/a"}` + "\n",
+			wantParseErrors: 1,
+			wantMethods:     []Method{"notifications/a"},
+		},
+		"last line without newline": {
+			input:       `{"jsonrpc":"2.0","method":"notifications/a"}`,
+			wantMethods: []Method{"notifications/a"},
+		},
+		"blank lines are ignored": {
+			input:       "\n\n" + `{"jsonrpc":"2.0","method":"notifications/a"}` + "\n\n",
+			wantMethods: []Method{"notifications/a"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			peerR, transportW := io.Pipe()
+			transport := NewStreamTransportWithConfig(transportW, io.NopCloser(strings.NewReader(tc.input)), &StreamConfig{MaxMessageSize: 64})
+
+			// Collect the messages written by the transport
+			parseErrors := make(chan *Error, 10)
+			go func() {
+				dec := json.NewDecoder(peerR)
+				for {
+					var message struct {
+						Error *Error `json:"error"`
+					}
+					if dec.Decode(&message) != nil {
+						return
+					}
+					parseErrors <- message.Error
+				}
+			}()
+
+			for range tc.wantParseErrors {
+				select {
+				case err := <-parseErrors:
+					require.NotNil(t, err, "transport should answer with an error")
+					assert.Equal(t, ParseErrorCode, err.Code, "error code should be a parse error")
+				case <-time.After(time.Second):
+					t.Fatal("parse error was not reported")
+				}
+			}
+
+			var methods []Method
+			for {
+				notif, err := transport.AcceptNotification(context.Background())
+				if err != nil {
+					break
+				}
+				methods = append(methods, notif.Method)
+			}
+
+			assert.Equal(t, tc.wantMethods, methods, "accepted notifications should match expected")
+			assert.ErrorIs(t, transport.Err(), io.EOF, "transport should be terminated by EOF")
+		})
+	}
+}
+
+func TestStreamTransport_Close_FailsPendingRequests(t *testing.T) {
+	peerR, transportW := io.Pipe()
+	transportR, peerW := io.Pipe()
+	transport := NewStreamTransport(transportW, transportR)
+
+	go func() {
+		// Consume the request, then end the stream without answering
+		bufio.NewReader(peerR).ReadBytes('\n')
+		peerW.Close()
+	}()
+
+	rsp, err := transport.Request(&Request{Method: MethodListTools})
+	require.NoError(t, err)
+
+	_, err = rsp.ReadResultContext(context.Background())
+	assert.ErrorIs(t, err, io.EOF, "pending request should fail with the terminal error")
+
+	select {
+	case <-transport.Done():
+	case <-time.After(time.Second):
+		t.Fatal("transport was not terminated")
+	}
+}
+
+func TestStreamTransport_Close_BlockedWrite(t *testing.T) {
+	// The peer never reads, so the write of the request blocks
+	_, transportW := io.Pipe()
+	transportR, _ := io.Pipe()
+	transport := NewStreamTransport(transportW, transportR)
+
+	requested := make(chan error, 1)
+	go func() {
+		_, err := transport.Request(&Request{Method: MethodListTools})
+		requested <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	closed := make(chan error, 1)
+	go func() { closed <- transport.Close() }()
+
+	select {
+	case err := <-closed:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("close should not wait for the blocked write")
+	}
+
+	select {
+	case err := <-requested:
+		assert.Error(t, err, "the blocked write should fail")
+	case <-time.After(time.Second):
+		t.Fatal("the blocked write was not released")
+	}
+}
+
+func TestStreamTransport_Request_WriteError(t *testing.T) {
+	_, transportW := io.Pipe()
+	transportR, _ := io.Pipe()
+	transport := NewStreamTransport(transportW, transportR).(*streamTransport)
+	require.NoError(t, transport.Close())
+
+	_, err := transport.Request(&Request{Method: MethodListTools})
+	assert.Error(t, err)
+	_, err = transport.RequestBatch([]*Request{{Method: MethodListTools}})
+	assert.Error(t, err)
+
+	assert.Empty(t, transport.sentRequestMap, "requests which could not be sent should not wait for a response")
+}
+
+func TestStreamTransport_InvalidResponse(t *testing.T) {
+	peerR, transportW := io.Pipe()
+	transportR, peerW := io.Pipe()
+	transport := NewStreamTransport(transportW, transportR)
+	t.Cleanup(func() { transport.Close() })
+
+	lines := make(chan []byte, 10)
+	go func() {
+		peer := bufio.NewReader(peerR)
+		for {
+			line, err := peer.ReadBytes('\n')
+			if err != nil {
+				return
+			}
+			lines <- line
+		}
+	}()
+
+	rsp, err := transport.Request(&Request{Method: MethodListTools})
+	require.NoError(t, err)
+
+	var req struct {
+		ID ID `json:"id"`
+	}
+	require.NoError(t, json.Unmarshal(<-lines, &req))
+
+	// The response has neither a result nor an error
+	go peerW.Write([]byte(`{"jsonrpc":"2.0","id":` + string(req.ID) + `}` + "\n"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = rsp.ReadResultContext(ctx)
+	assert.ErrorIs(t, err, errInvalidResponse, "the reader should not wait forever")
+
+	// The invalid response is not answered, so the next message of the transport is the notification
+	require.NoError(t, transport.Notify(&Notification{Method: "notifications/a"}))
+	assert.Contains(t, string(<-lines), "notifications/a")
+}
+
+func TestStreamTransport_RequestSync_Cancel(t *testing.T) {
+	peerR, transportW := io.Pipe()
+	transportR, _ := io.Pipe()
+	transport := NewStreamTransport(transportW, transportR).(*streamTransport)
+	t.Cleanup(func() { transport.Close() })
+	go io.Copy(io.Discard, peerR)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := transport.RequestSync(ctx, &Request{Method: MethodListTools})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	transport.sentRequestIDMapLock.Lock()
+	defer transport.sentRequestIDMapLock.Unlock()
+	assert.Empty(t, transport.sentRequestMap, "cancelled requests should not wait for a response")
+}
+
+func TestStreamTransport_BlockedQueue_DelaysResponses(t *testing.T) {
+	peerR, transportW := io.Pipe()
+	transportR, peerW := io.Pipe()
+	transport := NewStreamTransportWithConfig(transportW, transportR, &StreamConfig{
+		Queue: QueueConfig{Capacity: 1, Policy: BackpressureBlock},
+	})
+	t.Cleanup(func() { transport.Close() })
+
+	ids := make(chan ID, 1)
+	go func() {
+		var req struct {
+			ID ID `json:"id"`
+		}
+		json.NewDecoder(peerR).Decode(&req)
+		ids <- req.ID
+	}()
+
+	rsp, err := transport.Request(&Request{Method: MethodListRoots})
+	require.NoError(t, err)
+
+	// The second request blocks the reader, as the queue is full, and then the response is not read
+	go peerW.Write([]byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}` + "\n" +
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}` + "\n" +
+		`{"jsonrpc":"2.0","id":` + string(<-ids) + `,"result":{"roots":[]}}` + "\n"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = rsp.ReadResultContext(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded, "the response should wait for the queue to have room")
+
+	// Accepting a request makes room, after which the response is delivered
+	_, _, err = transport.AcceptRequest(context.Background())
+	require.NoError(t, err)
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	result, err := rsp.ReadResultContext(ctx)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"roots":[]}`, string(result))
+}
+
+func TestStreamTransport_Batch_QueueFull(t *testing.T) {
+	peerR, transportW := io.Pipe()
+	transportR, peerW := io.Pipe()
+	transport := NewStreamTransportWithConfig(transportW, transportR, &StreamConfig{
+		Queue: QueueConfig{Capacity: 1, Policy: BackpressureReject},
+	})
+	t.Cleanup(func() { transport.Close() })
+
+	go peerW.Write([]byte(`[{"jsonrpc":"2.0","id":1,"method":"tools/list"},{"jsonrpc":"2.0","id":2,"method":"tools/list"}]` + "\n"))
+
+	_, w, err := transport.AcceptRequest(context.Background())
+	require.NoError(t, err)
+	go w.WriteResult(Result(`{}`))
+
+	line, err := bufio.NewReader(peerR).ReadBytes('\n')
+	require.NoError(t, err)
+
+	var responses []struct {
+		ID    ID     `json:"id"`
+		Error *Error `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(line, &responses))
+	require.Len(t, responses, 2, "every entry of the batch should be answered")
+	for _, rsp := range responses {
+		if rsp.ID == "2" {
+			require.NotNil(t, rsp.Error)
+			assert.Equal(t, QueueFullErrorCode, rsp.Error.Code, "the rejected request should be answered")
+		}
+	}
+}
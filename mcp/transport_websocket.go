@@ -0,0 +1,217 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// WebSocketSubprotocol is the WebSocket subprotocol negotiated by the WebSocket transport.
+const WebSocketSubprotocol = "mcp"
+
+// ErrPingTimeout is the cause of the termination of a WebSocket connection whose peer did not answer a ping in time.
+var ErrPingTimeout = errors.New("websocket ping timeout")
+
+// maxCloseReason is the maximum length in bytes of the reason of a close frame.
+const maxCloseReason = 123
+
+// newWebSocketTransport creates a transport exchanging one JSON-RPC message per text frame of the connection.
+func newWebSocketTransport(conn *websocket.Conn, config *WebSocketConfig) *streamTransport {
+	conn.SetReadLimit(int64(config.maxMessageSize()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &webSocketConn{
+		conn:   conn,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	if interval := config.pingInterval(); interval > 0 {
+		go c.keepAlive(interval, config.pingTimeout())
+	}
+
+	return newMessageTransport(c, config.queueConfig())
+}
+
+var _ messageConn = (*webSocketConn)(nil)
+
+// webSocketConn frames messages as WebSocket text messages.
+type webSocketConn struct {
+	conn *websocket.Conn
+
+	// pingErr is the error which made the keep-alive close the connection
+	pingErr   error
+	pingErrMu sync.Mutex
+
+	// ctx is canceled when the connection is closed, which releases a write blocked by a peer not reading
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func (c *webSocketConn) ReadMessage() ([]byte, error) {
+	typ, data, err := c.conn.Read(context.Background())
+	if err != nil {
+		c.pingErrMu.Lock()
+		pingErr := c.pingErr
+		c.pingErrMu.Unlock()
+		if pingErr != nil {
+			return nil, pingErr
+		}
+
+		switch websocket.CloseStatus(err) {
+		case websocket.StatusNormalClosure, websocket.StatusGoingAway:
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+
+	if typ != websocket.MessageText {
+		err := errors.New("binary messages are not supported")
+		c.conn.Close(websocket.StatusUnsupportedData, err.Error())
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (c *webSocketConn) WriteMessage(data []byte) error {
+	return c.conn.Write(c.ctx, websocket.MessageText, data)
+}
+
+// Close closes the connection with the normal closure status if cause is nil,
+// and with the internal error status and cause as the reason otherwise.
+// If the connection has already been closed by the peer, it is only released.
+func (c *webSocketConn) Close(cause error) error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.cancel()
+
+		var closeErr websocket.CloseError
+		switch {
+		case cause == nil:
+			err = c.conn.Close(websocket.StatusNormalClosure, "")
+		case errors.As(cause, &closeErr), errors.Is(cause, io.EOF), errors.Is(cause, ErrPingTimeout):
+			err = c.conn.CloseNow()
+		default:
+			err = c.conn.Close(websocket.StatusInternalError, closeReason(cause))
+		}
+	})
+	return err
+}
+
+// keepAlive pings the peer at every interval, and closes the connection if a pong is not received within timeout.
+func (c *webSocketConn) keepAlive(interval, timeout time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := c.conn.Ping(ctx)
+		cancel()
+		if err == nil {
+			continue
+		}
+
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+
+		c.pingErrMu.Lock()
+		c.pingErr = fmt.Errorf("%w: %v", ErrPingTimeout, err)
+		c.pingErrMu.Unlock()
+
+		// Unblock the pending read, which then reports the ping error
+		c.conn.CloseNow()
+		return
+	}
+}
+
+// closeReason truncates the message of err to fit in a close frame.
+func closeReason(err error) string {
+	reason := err.Error()
+	if len(reason) <= maxCloseReason {
+		return reason
+	}
+
+	// Avoid cutting a multi-byte character
+	i := maxCloseReason
+	for i > 0 && reason[i]&0xC0 == 0x80 {
+		i--
+	}
+	return reason[:i]
+}
+
+// WebSocketHandler returns an http.Handler serving the server over the WebSocket transport.
+// Each connection is a session, which ends when the connection is closed.
+// Clients must negotiate the "mcp" subprotocol, and every JSON-RPC message is sent in a text message.
+func (s *Server) WebSocketHandler() http.Handler {
+	if !s.initialized {
+		s.init()
+	}
+
+	return http.HandlerFunc(s.serveWebSocket)
+}
+
+func (s *Server) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	config := s.WebSocketConfig
+
+	var originPatterns []string
+	if config != nil {
+		originPatterns = config.OriginPatterns
+	}
+
+	if !checkHost(r, config.allowedHosts()) {
+		http.Error(w, "host not allowed", http.StatusForbidden)
+		return
+	}
+
+	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+		Subprotocols:   []string{WebSocketSubprotocol},
+		OriginPatterns: originPatterns,
+	})
+	if err != nil {
+		// Accept has already answered the request
+		s.logger().Error("failed to accept websocket connection", "error", err)
+		return
+	}
+
+	if conn.Subprotocol() != WebSocketSubprotocol {
+		conn.Close(websocket.StatusPolicyViolation, WebSocketSubprotocol+" subprotocol is required")
+		return
+	}
+
+	t := newWebSocketTransport(conn, config)
+
+	_, err = s.accept(t)
+	if err != nil {
+		s.logger().Error("failed to initialize session", "error", err)
+		t.CloseWithError(err)
+		return
+	}
+
+	// The connection is hijacked, but the handler must not return while it is in use
+	select {
+	case <-t.Done():
+	case <-r.Context().Done():
+		t.Close()
+	}
+}
@@ -0,0 +1,151 @@
+package mcp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_WebSocketHandler(t *testing.T) {
+	server := NewServer("test-server", "0.0.1")
+	server.Handler = newTestServerMux()
+	ts := httptest.NewServer(server.WebSocketHandler())
+	t.Cleanup(ts.Close)
+	t.Cleanup(func() { server.Close() })
+
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http")
+
+	t.Run("client dials with the mcp subprotocol", func(t *testing.T) {
+		sess, err := NewClient("test-client", "0.0.1").DialWebSocket(wsURL, nil)
+		require.NoError(t, err)
+		t.Cleanup(func() { sess.Close() })
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		results, err := sess.Batch(ctx, &Request{Method: MethodListTools}, &Request{Method: "unknown/method"})
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		assert.NoError(t, results[0].Err)
+		assert.ErrorIs(t, results[1].Err, ErrMethodNotFound)
+	})
+
+	t.Run("connection without the mcp subprotocol is closed", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		conn, _, err := websocket.Dial(ctx, wsURL, nil)
+		require.NoError(t, err)
+		defer conn.CloseNow()
+
+		_, _, err = conn.Read(ctx)
+		assert.Equal(t, websocket.StatusPolicyViolation, websocket.CloseStatus(err))
+	})
+}
+
+func TestWebSocketTransport_PingTimeout(t *testing.T) {
+	// The peer never reads, so that pings are never answered
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{Subprotocols: []string{WebSocketSubprotocol}})
+		if err != nil {
+			return
+		}
+		defer conn.CloseNow()
+		<-release
+	}))
+	t.Cleanup(ts.Close)
+	t.Cleanup(func() { close(release) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(ts.URL, "http"), &websocket.DialOptions{
+		Subprotocols: []string{WebSocketSubprotocol},
+	})
+	require.NoError(t, err)
+
+	transport := newWebSocketTransport(conn, &WebSocketConfig{
+		PingInterval: 10 * time.Millisecond,
+		PingTimeout:  10 * time.Millisecond,
+	})
+
+	select {
+	case <-transport.Done():
+	case <-ctx.Done():
+		t.Fatal("transport should be closed when pings are not answered")
+	}
+
+	transport.closeMu.Lock()
+	defer transport.closeMu.Unlock()
+	assert.ErrorIs(t, transport.closedErr, ErrPingTimeout)
+}
+
+func TestWebSocketTransport_Close_BlockedWrite(t *testing.T) {
+	// The peer never reads, so that writes block once the buffers are full
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{Subprotocols: []string{WebSocketSubprotocol}})
+		if err != nil {
+			return
+		}
+		defer conn.CloseNow()
+		<-release
+	}))
+	t.Cleanup(ts.Close)
+	t.Cleanup(func() { close(release) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(ts.URL, "http"), &websocket.DialOptions{
+		Subprotocols: []string{WebSocketSubprotocol},
+	})
+	require.NoError(t, err)
+
+	transport := newWebSocketTransport(conn, nil)
+
+	var sent atomic.Int64
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		params := Params(`"` + strings.Repeat("x", 1<<20) + `"`)
+		for transport.Notify(&Notification{Method: "notifications/large", Params: params}) == nil {
+			sent.Add(1)
+		}
+	}()
+
+	// Wait for a write to block, once the buffers are full
+	last := int64(-1)
+	require.Eventually(t, func() bool {
+		n := sent.Load()
+		blocked := n == last
+		last = n
+		return blocked
+	}, 5*time.Second, 200*time.Millisecond, "writes should block while the peer does not read")
+
+	closed := make(chan struct{})
+	go func() {
+		transport.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("close should not wait for the blocked write")
+	}
+	select {
+	case <-written:
+	case <-time.After(time.Second):
+		t.Fatal("the blocked write should be released")
+	}
+}
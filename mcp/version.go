@@ -9,3 +9,15 @@ const (
 	Version20250326 Version = "2025-03-26"
 	Version20241105 Version = "2024-11-05"
 )
+
+// supportedVersions lists the protocol versions which can be negotiated, the preferred one first.
+var supportedVersions = []Version{DefaultVersion, Version20250326, Version20241105}
+
+func isSupportedVersion(v Version) bool {
+	for _, supported := range supportedVersions {
+		if v == supported {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package mcp
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	// DefaultPingInterval is the interval between pings when WebSocketConfig.PingInterval is not set.
+	DefaultPingInterval = 30 * time.Second
+	// DefaultPingTimeout is the time to wait for a pong when WebSocketConfig.PingTimeout is not set.
+	DefaultPingTimeout = 10 * time.Second
+)
+
+type WebSocketConfig struct {
+	// Interval between pings checking that the peer is alive.
+	// Zero means DefaultPingInterval, and a negative value disables pings.
+	PingInterval time.Duration
+	// Time to wait for the pong answering a ping before the connection is considered dead.
+	PingTimeout time.Duration
+
+	// Maximum size in bytes of a single message.
+	// A larger message closes the connection with the status 1009 (message too big).
+	MaxMessageSize int
+
+	// Configuration of the queues holding received requests and notifications until they are accepted
+	Queue QueueConfig
+
+	// HTTP headers sent by the client with the opening handshake
+	Headers http.Header
+	// HTTP transport used by the client for the opening handshake
+	Transport http.RoundTripper
+
+	// Host patterns of the origins accepted by the server in addition to the host of the request,
+	// with the syntax of path.Match.
+	OriginPatterns []string
+	// Host names accepted by the server in the Host header, to protect against DNS rebinding attacks,
+	// with the same rules as HTTPServerConfig.AllowedHosts.
+	AllowedHosts []string
+}
+
+func (c *WebSocketConfig) pingInterval() time.Duration {
+	if c == nil || c.PingInterval == 0 {
+		return DefaultPingInterval
+	}
+	return c.PingInterval
+}
+
+func (c *WebSocketConfig) pingTimeout() time.Duration {
+	if c == nil || c.PingTimeout <= 0 {
+		return DefaultPingTimeout
+	}
+	return c.PingTimeout
+}
+
+func (c *WebSocketConfig) maxMessageSize() int {
+	if c == nil || c.MaxMessageSize <= 0 {
+		return DefaultMaxMessageSize
+	}
+	return c.MaxMessageSize
+}
+
+func (c *WebSocketConfig) allowedHosts() []string {
+	if c == nil {
+		return nil
+	}
+	return c.AllowedHosts
+}
+
+func (c *WebSocketConfig) queueConfig() QueueConfig {
+	if c == nil {
+		return QueueConfig{}
+	}
+	return c.Queue
+}